@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Recommendations made by advise.
+const (
+	AdviceConvert      = "convert"
+	AdviceNotNeeded    = "not needed"
+	AdviceDoNotConvert = "do not convert"
+)
+
+// dolbyVisionInBandCodecs maps the Dolby Vision codecs allowing in-band
+// parameter sets to their configuration box and out-of-band counterpart.
+var dolbyVisionInBandCodecs = map[string]struct{ config, to string }{
+	CodecDVHE: {config: "hvcC", to: CodecDVH1},
+	CodecDVAV: {config: "avcC", to: CodecDVA1},
+}
+
+type Advice struct {
+	File           string   `json:"file"`
+	Recommendation string   `json:"recommendation"`
+	Reasons        []string `json:"reasons"`
+}
+
+// advise decides whether converting the Dolby Vision sample entries of info is
+// likely to help playback. dvhe and dvav allow parameter sets to be carried
+// in-band only, which many players, Apple's in particular, reject; dvh1 and
+// dva1 promise them out-of-band in hvcC or avcC. Renaming is only safe when
+// that configuration box, and the dvcC describing the Dolby Vision stream, are
+// already there.
+func advise(info *FileInfo) *Advice {
+	advice := &Advice{File: info.File, Recommendation: AdviceNotNeeded, Reasons: []string{}}
+	dolbyVision := false
+	for i, track := range info.Tracks {
+		for j, entry := range track.SampleEntries {
+			reason := func(format string, args ...any) {
+				advice.Reasons = append(advice.Reasons, fmt.Sprintf("track %d entry %d (%s): ", i+1, j+1, entry.Codec)+fmt.Sprintf(format, args...))
+			}
+			switch entry.Codec {
+			case CodecDVH1, CodecDVA1:
+				dolbyVision = true
+				reason("already signals out-of-band parameter sets")
+				continue
+			case EncvBoxType.String():
+				reason("encrypted, see -patch-frma")
+				continue
+			}
+			target, ok := dolbyVisionInBandCodecs[entry.Codec]
+			if !ok {
+				continue
+			}
+			dolbyVision = true
+			switch {
+			case !entry.hasBox("dvcC", "dvvC", "dvwC"):
+				reason("no dvcC or dvvC configuration, the Dolby Vision stream is undescribed and renaming will not help")
+				advice.Recommendation = AdviceDoNotConvert
+			case !entry.hasBox(target.config):
+				reason("no out-of-band %s, parameter sets are likely in-band only and %s would be invalid", target.config, target.to)
+				advice.Recommendation = AdviceDoNotConvert
+			default:
+				reason("%s and Dolby Vision configuration present out-of-band, %s is what most players expect", target.config, target.to)
+				if advice.Recommendation != AdviceDoNotConvert {
+					advice.Recommendation = AdviceConvert
+				}
+			}
+		}
+	}
+	if info.Protected {
+		advice.Reasons = append(advice.Reasons, "CENC-protected, renaming sample entries does not help players unable to decrypt it")
+	}
+	if !dolbyVision {
+		advice.Reasons = append(advice.Reasons, "no Dolby Vision sample entries")
+	} else if !info.hasBrand(BrandDBY1) {
+		advice.Reasons = append(advice.Reasons, fmt.Sprintf("ftyp lacks the %s compatible brand many Dolby Vision players require, which converting does not add", BrandDBY1))
+	}
+	return advice
+}
+
+func runAdvise(ctx context.Context, mp4files []string) (err error) {
+	rep := newReporter(os.Stdout, outputFormat)
+	for i, mp4file := range mp4files {
+		var info *FileInfo
+		if err = ctx.Err(); err != nil {
+			return fmt.Errorf(`[runAdvise] interrupted after %d of %d files: %w`, i, len(mp4files), err)
+		}
+		if info, err = inspectFile(mp4file); err != nil {
+			return fmt.Errorf(`[runAdvise] failed inspecting file %s: %w`, mp4file, err)
+		}
+		if err = rep.report(advise(info)); err != nil {
+			return fmt.Errorf(`[runAdvise] %w`, err)
+		}
+	}
+	if err = rep.finish(); err != nil {
+		return fmt.Errorf(`[runAdvise] %w`, err)
+	}
+	return
+}
+
+func (advice *Advice) printText() {
+	fmt.Printf("%s: %s\n", advice.File, advice.Recommendation)
+	for _, reason := range advice.Reasons {
+		fmt.Printf("  %s\n", reason)
+	}
+}
+
+func (advice *Advice) columns() []string {
+	return []string{"file", "recommendation", "reasons"}
+}
+
+func (advice *Advice) row() []string {
+	return []string{advice.File, advice.Recommendation, strings.Join(advice.Reasons, "; ")}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAdvise(t *testing.T) {
+	for name, test := range map[string]struct {
+		data []byte
+		want string
+
+		// reasons the advice gives, in order
+		reasons []string
+	}{
+		"convert":       {movie(trak(visualSampleEntry("dvhe", 1920, 1080, hvcC(), dvcC(8, 6)))), AdviceConvert, []string{"hvcC and Dolby Vision configuration present out-of-band, dvh1"}},
+		"dvav":          {movie(trak(visualSampleEntry("dvav", 1920, 1080, box("avcC", make([]byte, 8)), dvcC(9, 6)))), AdviceConvert, []string{"avcC and Dolby Vision configuration present out-of-band, dva1"}},
+		"converted":     {movie(trak(visualSampleEntry("dvh1", 1920, 1080, hvcC(), dvcC(8, 6)))), AdviceNotNeeded, []string{"already signals out-of-band"}},
+		"no dvcC":       {movie(trak(visualSampleEntry("dvhe", 1920, 1080, hvcC()))), AdviceDoNotConvert, []string{"no dvcC or dvvC configuration"}},
+		"in-band only":  {movie(trak(visualSampleEntry("dvhe", 1920, 1080, dvcC(8, 6)))), AdviceDoNotConvert, []string{"no out-of-band hvcC"}},
+		"one bad track": {movie(trak(visualSampleEntry("dvhe", 1920, 1080, hvcC(), dvcC(8, 6))), trak(visualSampleEntry("dvhe", 1920, 1080, dvcC(8, 6)))), AdviceDoNotConvert, []string{"track 1 entry 1", "track 2 entry 1 (dvhe): no out-of-band hvcC"}},
+		"encrypted":     {protectedMovie("edef8ba979d64acea3c827dcd51d21ed"), AdviceNotNeeded, []string{"encrypted, see -patch-frma", "CENC-protected", "no Dolby Vision sample entries"}},
+		"not DV":        {movie(trak(visualSampleEntry("hvc1", 1920, 1080, hvcC()))), AdviceNotNeeded, []string{"no Dolby Vision sample entries"}},
+		"no dby1 brand": {append(box("ftyp", []byte("isom"), u32(0), []byte("isom")), movie(trak(visualSampleEntry("dvhe", 1920, 1080, hvcC(), dvcC(8, 6))))[24:]...), AdviceConvert, []string{"out-of-band", "ftyp lacks the dby1 compatible brand"}},
+	} {
+		info, err := inspect(bytes.NewReader(test.data))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		advice := advise(info)
+		if advice.Recommendation != test.want || len(advice.Reasons) != len(test.reasons) {
+			t.Errorf("%s: got %s for %q, want %s for %q", name, advice.Recommendation, advice.Reasons, test.want, test.reasons)
+			continue
+		}
+		for i, reason := range test.reasons {
+			if !strings.Contains(advice.Reasons[i], reason) {
+				t.Errorf("%s: got reason %q, want it to mention %q", name, advice.Reasons[i], reason)
+			}
+		}
+	}
+}
+
+func TestRunAdvise(t *testing.T) {
+	mp4file := filepath.Join(t.TempDir(), "movie.mp4")
+	if err := os.WriteFile(mp4file, movie(trak(visualSampleEntry("dvhe", 1920, 1080, dvcC(8, 6)))), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	printed := captureStdout(t, func() {
+		if err := runAdvise(context.Background(), []string{mp4file}); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if want := mp4file + ": do not convert\n  track 1 entry 1 (dvhe): no out-of-band hvcC"; !strings.HasPrefix(printed, want) {
+		t.Errorf("printed %q, want it to start with %q", printed, want)
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// anywhereVisitor renames every box of type from to type to, wherever it
+// appears in the parts of the file whose layout is known (see childOffset),
+// up to maxDepth levels deep. Only the 4 byte type is ever written, so no box
+// size changes.
+type anywhereVisitor struct {
+	rw       io.ReadWriteSeeker
+	from, to BoxType
+	maxDepth int
+	changed  int
+}
+
+func (v *anywhereVisitor) EnterBox(path []BoxType, h Header) (descend bool, err error) {
+	if matchesFrom(h.Type.String()) {
+		typeOffset := h.Offset + int64(getHeaderSize(&h)) + getHeaderTypeOffset(&h)
+		if hexPreview {
+			if err = printHexPreview(v.rw, "before", typeOffset); err != nil {
+				return false, fmt.Errorf(`[anywhereVisitor] %w`, err)
+			}
+		}
+		if _, err = v.rw.Seek(typeOffset, io.SeekStart); err != nil {
+			return false, fmt.Errorf(`[anywhereVisitor] failed to seek: %w`, err)
+		}
+		if _, err = v.rw.Write(v.to[:]); err != nil {
+			return false, fmt.Errorf(`[anywhereVisitor] failed to write box header type "%s": %w`, v.to, err)
+		}
+		if err = readBackFourCC(v.rw, typeOffset, v.to.String()); err != nil {
+			return false, fmt.Errorf(`[anywhereVisitor] %w`, err)
+		}
+		v.changed++
+
+		types := make([]string, len(path))
+		for i, t := range path {
+			types[i] = t.String()
+		}
+		fmt.Printf("Changed box type from %v to %v at %d(%#x) (%s)%s\n", h.Type, v.to, typeOffset, typeOffset, strings.Join(types, "/"), lenientNote(h.Type.String()))
+		recordChange("box type", typeOffset, h.Type.String(), v.to.String())
+		if hexPreview {
+			if err = printHexPreview(v.rw, "after", typeOffset); err != nil {
+				return false, fmt.Errorf(`[anywhereVisitor] %w`, err)
+			}
+		}
+	}
+	return v.maxDepth <= 0 || len(path) < v.maxDepth, nil
+}
+
+func (v *anywhereVisitor) LeaveBox(path []BoxType, h Header) error {
+	return nil
+}
+
+// patchAnywhere renames every box of type -from to -to found by a walk of the
+// whole file rather than only the sample entries under moov, for -anywhere.
+func patchAnywhere(rw io.ReadWriteSeeker) (err error) {
+	v := &anywhereVisitor{rw: rw, maxDepth: anywhereDepth}
+	copy(v.from[:], codecFrom)
+	copy(v.to[:], codecTo)
+
+	if _, err = rw.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf(`[patchAnywhere] failed to seek: %w`, err)
+	}
+	if err = Walk(rw, v); err != nil {
+		return fmt.Errorf(`[patchAnywhere] %w`, err)
+	}
+	if v.changed == 0 {
+		fmt.Printf("No %s box found\n", v.from)
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// copyFile copies the contents of src into dst, creating or truncating dst.
+func copyFile(dst, src string, perm os.FileMode) (err error) {
+	var in, out *os.File
+
+	if in, err = os.Open(src); err != nil {
+		return fmt.Errorf(`[copyFile] cannot open file "%s": %w`, src, err)
+	}
+	defer in.Close()
+
+	if out, err = os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm); err != nil {
+		return fmt.Errorf(`[copyFile] cannot open file "%s": %w`, dst, err)
+	}
+	if _, err = io.Copy(out, in); err != nil {
+		out.Close()
+		return fmt.Errorf(`[copyFile] failed copying "%s" to "%s": %w`, src, dst, err)
+	}
+	if err = out.Close(); err != nil {
+		return fmt.Errorf(`[copyFile] cannot close file "%s": %w`, dst, err)
+	}
+	return
+}
+
+// processFileAtomic converts a temporary copy of mp4file and renames it over
+// the original, or to its output path with -out-dir, so readers never observe
+// a partially patched file. With -strip-free, -remux, -add-entry or -canonical
+// the copy is rewritten rather than copied verbatim, and with -strip-prefix it
+// starts after the bytes stripped. When the temporary directory is on another
+// device the rename is impossible and the patched copy is copied back over the
+// original instead.
+func processFileAtomic(mp4file string) (err error) {
+	var (
+		src  *os.File
+		tmp  *os.File
+		info os.FileInfo
+	)
+
+	dst := mp4file
+	if outDir != "" {
+		dst = outputPaths[mp4file]
+	}
+	dir := tempDir
+	if dir == "" {
+		dir = filepath.Dir(dst)
+	}
+
+	if src, err = os.Open(mp4file); err != nil {
+		return fmt.Errorf(`[processFileAtomic] cannot open file "%s": %w`, mp4file, err)
+	}
+	defer src.Close()
+
+	if info, err = src.Stat(); err != nil {
+		return fmt.Errorf(`[processFileAtomic] cannot stat file "%s": %w`, mp4file, err)
+	}
+
+	// With -strip-prefix the copy starts at the first box.
+	var in io.ReadSeeker = src
+	if stripPrefix > 0 {
+		if in, err = stripPrefixReader(src, info.Size()); err != nil {
+			return fmt.Errorf(`[processFileAtomic] %w`, err)
+		}
+	}
+
+	if tmp, err = os.CreateTemp(dir, "."+filepath.Base(mp4file)+".*.tmp"); err != nil {
+		return fmt.Errorf(`[processFileAtomic] cannot create temporary file in "%s": %w`, dir, err)
+	}
+	tmpName := tmp.Name()
+	defer func() {
+		tmp.Close()
+		if err != nil {
+			os.Remove(tmpName)
+		}
+	}()
+
+	fmt.Printf("Processing %s ...\n", mp4file)
+
+	if stripFree || remux || addEntry != "" || canonical {
+		var written int64
+		opts := rewriteOptions{StripFree: stripFree, MoovFirst: remux, Canonical: canonical, BufferSize: rewriteBufferSize, LenientMatch: lenientMatch}
+		if addEntry != "" {
+			copy(opts.AddEntryFrom[:], codecFrom)
+			copy(opts.AddEntryAs[:], addEntry)
+		}
+		since := changeCount()
+		if written, err = rewriteFile(tmp, in, opts); err != nil {
+			return fmt.Errorf(`[processFileAtomic] %w`, err)
+		}
+		if addEntry != "" && limitChanges > 0 {
+			if err = enforceAddedEntryLimit(since); err != nil {
+				return fmt.Errorf(`[processFileAtomic] %w`, err)
+			}
+		}
+		if stripFree {
+			fmt.Printf("Removed %d bytes of free space\n", info.Size()-stripPrefix-written)
+		}
+		if remux {
+			fmt.Printf("Remuxed %s with moov ahead of the media data\n", mp4file)
+		}
+		if canonical {
+			fmt.Printf("Rewrote %s with canonical box sizes (%+d bytes)\n", mp4file, written-info.Size()+stripPrefix)
+		}
+	} else if _, err = io.Copy(tmp, in); err != nil {
+		return fmt.Errorf(`[processFileAtomic] failed copying "%s" to "%s": %w`, mp4file, tmpName, err)
+	}
+
+	if stripPrefix > 0 {
+		fmt.Printf("Stripped the first %d bytes of %s\n", stripPrefix, mp4file)
+	}
+
+	// With -add-entry the original entries are kept rather than renamed.
+	if addEntry == "" {
+		if err = convert(tmp); err != nil {
+			return fmt.Errorf(`[processFileAtomic] %w`, err)
+		}
+	}
+
+	if err = tmp.Sync(); err != nil {
+		return fmt.Errorf(`[processFileAtomic] failed to sync "%s": %w`, tmpName, err)
+	}
+	if err = tmp.Close(); err != nil {
+		return fmt.Errorf(`[processFileAtomic] cannot close file "%s": %w`, tmpName, err)
+	}
+	if err = os.Chmod(tmpName, info.Mode().Perm()); err != nil {
+		return fmt.Errorf(`[processFileAtomic] cannot set permissions of "%s": %w`, tmpName, err)
+	}
+	src.Close()
+
+	if err = os.Rename(tmpName, dst); err == nil {
+		if dst != mp4file {
+			fmt.Printf("Wrote %s\n", dst)
+		}
+		return
+	}
+	if !errors.Is(err, syscall.EXDEV) {
+		return fmt.Errorf(`[processFileAtomic] cannot rename "%s" to "%s": %w`, tmpName, dst, err)
+	}
+
+	fmt.Printf("Warning: %s is on a different device from %s, copying instead of renaming\n", dir, dst)
+	if err = copyFile(dst, tmpName, info.Mode().Perm()); err != nil {
+		return fmt.Errorf(`[processFileAtomic] %w`, err)
+	}
+	return os.Remove(tmpName)
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// writeMovie writes data to movie.mp4 in a new temporary directory with the
+// permissions perm.
+func writeMovie(t *testing.T, data []byte, perm os.FileMode) string {
+	t.Helper()
+	mp4file := filepath.Join(t.TempDir(), "movie.mp4")
+	if err := os.WriteFile(mp4file, data, perm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(mp4file, perm); err != nil {
+		t.Fatal(err)
+	}
+	return mp4file
+}
+
+// tempFiles returns the temporary copies left in dir.
+func tempFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	names, err := filepath.Glob(filepath.Join(dir, ".*.tmp"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return names
+}
+
+func TestProcessFileAtomic(t *testing.T) {
+	withCodecs(t, "dvhe", "dvh1")
+	t.Cleanup(func() { atomicWrite, tempDir = false, "" })
+	data := movie(trak(visualSampleEntry("dvhe", 1920, 1080, hvcC(), box("dvcC", make([]byte, 24)))))
+	want := &memFile{data: append([]byte{}, data...)}
+	if err := convert(want); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, temp := range map[string]bool{"-atomic": false, "-temp-dir": true} {
+		t.Run(name, func(t *testing.T) {
+			atomicWrite, tempDir = !temp, ""
+			if temp {
+				tempDir = t.TempDir()
+			}
+			mp4file := writeMovie(t, data, 0o640)
+			if err := processFile(mp4file); err != nil {
+				t.Fatal(err)
+			}
+			takeChanges()
+			if got, _ := os.ReadFile(mp4file); !bytes.Equal(got, want.data) {
+				t.Error("file differs from the file converted in place")
+			}
+			if stat, err := os.Stat(mp4file); err != nil || stat.Mode().Perm() != 0o640 {
+				t.Errorf("got mode %v and error %v, want the original -rw-r-----", stat.Mode(), err)
+			}
+			for _, dir := range []string{filepath.Dir(mp4file), tempDir} {
+				if left := tempFiles(t, dir); dir != "" && len(left) != 0 {
+					t.Errorf("temporary files left: %v", left)
+				}
+			}
+		})
+	}
+}
+
+func TestProcessFileAtomicError(t *testing.T) {
+	withCodecs(t, "dvhe", "dvh1")
+	t.Cleanup(func() { atomicWrite, tempDir = false, "" })
+	atomicWrite, tempDir = true, t.TempDir()
+
+	data := corruptSize(t, movie(trak(visualSampleEntry("dvhe", 1920, 1080, hvcC(), box("dvcC", make([]byte, 24))))), "stsd", 1000)
+	mp4file := writeMovie(t, data, 0o644)
+	if err := processFile(mp4file); err == nil {
+		t.Fatal("got no error converting a corrupt file")
+	}
+	takeChanges()
+	if got, _ := os.ReadFile(mp4file); !bytes.Equal(got, data) {
+		t.Error("original changed by a failed conversion")
+	}
+	for _, dir := range []string{filepath.Dir(mp4file), tempDir} {
+		if left := tempFiles(t, dir); len(left) != 0 {
+			t.Errorf("temporary files left: %v", left)
+		}
+	}
+}
+
+func TestProcessFileAtomicCrossDevice(t *testing.T) {
+	withCodecs(t, "dvhe", "dvh1")
+	t.Cleanup(func() { tempDir = "" })
+
+	mp4file := writeMovie(t, movie(trak(visualSampleEntry("dvhe", 1920, 1080, hvcC(), box("dvcC", make([]byte, 24))))), 0o600)
+	dir, err := os.MkdirTemp("/dev/shm", "mp4dovi")
+	if err != nil {
+		t.Skip(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	probe := filepath.Join(dir, "probe")
+	if err := os.WriteFile(probe, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(probe, mp4file+".probe"); !errors.Is(err, syscall.EXDEV) {
+		t.Skip("no temporary directory on another device")
+	}
+	tempDir = dir
+
+	if err := processFile(mp4file); err != nil {
+		t.Fatal(err)
+	}
+	takeChanges()
+	if got, _ := os.ReadFile(mp4file); !bytes.Contains(got, []byte("dvh1")) || bytes.Contains(got, []byte("dvhe")) {
+		t.Error("file not converted")
+	}
+	if stat, err := os.Stat(mp4file); err != nil || stat.Mode().Perm() != 0o600 {
+		t.Errorf("got mode %v and error %v, want the original -rw-------", stat.Mode(), err)
+	}
+	if left := tempFiles(t, dir); len(left) != 0 {
+		t.Errorf("temporary files left: %v", left)
+	}
+}
+
+func TestCopyFile(t *testing.T) {
+	dir := t.TempDir()
+	src, dst := filepath.Join(dir, "src"), filepath.Join(dir, "dst")
+	if err := os.WriteFile(src, []byte("patched"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(dst, []byte("original and longer"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := copyFile(dst, src, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(dst); string(got) != "patched" {
+		t.Errorf("got %q, want the copy truncated to the source", got)
+	}
+	if err := copyFile(dst, filepath.Join(dir, "missing"), 0o644); err == nil || !strings.Contains(err.Error(), "cannot open") {
+		t.Errorf("got %v, want an error opening the source", err)
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// Change is a modification made to a file.
+type Change struct {
+	// Kind is "sample entry", "original format", "added sample entry" or
+	// "box type" with -anywhere
+	Kind   string `json:"kind"`
+	Offset int64  `json:"offset"`
+	From   string `json:"from"`
+	To     string `json:"to"`
+}
+
+// fileChanges collects the changes made to the file being processed. It is
+// reset by run before every file.
+var fileChanges struct {
+	sync.Mutex
+	changes []Change
+}
+
+// recordChange adds a change to the file being processed. It is safe for
+// concurrent use, as needed with -parallel-boxes.
+func recordChange(kind string, offset int64, from, to string) {
+	fileChanges.Lock()
+	defer fileChanges.Unlock()
+	fileChanges.changes = append(fileChanges.changes, Change{Kind: kind, Offset: offset, From: from, To: to})
+}
+
+// takeChanges returns the changes recorded since the last call.
+func takeChanges() []Change {
+	fileChanges.Lock()
+	defer fileChanges.Unlock()
+	changes := fileChanges.changes
+	fileChanges.changes = nil
+	return changes
+}
+
+// changeCount returns the number of changes recorded since the last call to
+// takeChanges.
+func changeCount() int {
+	fileChanges.Lock()
+	defer fileChanges.Unlock()
+	return len(fileChanges.changes)
+}
+
+// dropChangesSince removes and returns the changes recorded after the first n,
+// as when they were undone.
+func dropChangesSince(n int) []Change {
+	fileChanges.Lock()
+	defer fileChanges.Unlock()
+	dropped := append([]Change{}, fileChanges.changes[n:]...)
+	fileChanges.changes = fileChanges.changes[:n]
+	return dropped
+}
+
+// toolVersion returns the module version mp4dovi was built from.
+func toolVersion() string {
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" {
+		return info.Main.Version
+	}
+	return "(devel)"
+}
+
+// auditRecord is a line of the -log-file audit log.
+type auditRecord struct {
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+	File     string    `json:"file"`
+	Status   string    `json:"status"`
+	Error    string    `json:"error,omitempty"`
+	Reason   string    `json:"reason,omitempty"`
+	From     string    `json:"from"`
+	To       string    `json:"to"`
+	Changes  []Change  `json:"changes"`
+	Renamed  string    `json:"renamedTo,omitempty"`
+	Original string    `json:"original,omitempty"`
+	Version  string    `json:"version"`
+}
+
+// auditLog appends a JSON line per processed file to the -log-file.
+type auditLog struct {
+	f   *os.File
+	enc *json.Encoder
+}
+
+func openAuditLog(path string) (*auditLog, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf(`[openAuditLog] cannot open log file "%s": %w`, path, err)
+	}
+	return &auditLog{f: f, enc: json.NewEncoder(f)}, nil
+}
+
+func (l *auditLog) write(result FileResult, started, finished time.Time) error {
+	record := auditRecord{
+		Started:  started,
+		Finished: finished,
+		File:     result.File,
+		Status:   string(result.Status),
+		From:     codecFrom,
+		To:       codecTo,
+		Changes:  result.Changes,
+		Renamed:  result.RenamedTo,
+		Original: result.Original,
+		Reason:   result.Reason,
+		Version:  toolVersion(),
+	}
+	if record.Changes == nil {
+		record.Changes = []Change{}
+	}
+	if result.Err != nil {
+		record.Error = result.Err.Error()
+	}
+	if err := l.enc.Encode(record); err != nil {
+		return fmt.Errorf(`[auditLog] failed writing record for "%s": %w`, result.File, err)
+	}
+	return nil
+}
+
+func (l *auditLog) Close() error {
+	return l.f.Close()
+}
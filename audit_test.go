@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRunLogFile(t *testing.T) {
+	withCodecs(t, "dvhe", "dvh1")
+	dir := t.TempDir()
+	t.Cleanup(func() { logFile, nullSafe = "", false })
+	logFile, nullSafe = filepath.Join(dir, "audit.jsonl"), true
+
+	converted := filepath.Join(dir, "converted.mp4")
+	empty := filepath.Join(dir, "empty.mp4")
+	data := movie(trak(visualSampleEntry("dvhe", 1920, 1080, hvcC(), box("dvcC", make([]byte, 24)))))
+	if err := os.WriteFile(converted, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(empty, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Records are appended to the log of earlier runs.
+	captureStdout(t, func() {
+		for _, files := range [][]string{{converted, empty}, {converted}} {
+			if err := run(context.Background(), files); err != nil {
+				t.Fatal(err)
+			}
+		}
+	})
+
+	f, err := os.Open(logFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var got []string
+	for scanner := bufio.NewScanner(f); scanner.Scan(); {
+		var record auditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("line %q: %v", scanner.Text(), err)
+		}
+		if record.Version == "" || record.Started.IsZero() || record.Finished.Before(record.Started) {
+			t.Errorf("got version %q started %v finished %v", record.Version, record.Started, record.Finished)
+		}
+		got = append(got, fmt.Sprintf("%s %s %s->%s %v", filepath.Base(record.File), record.Status, record.From, record.To, record.Changes))
+	}
+	offset := bytes.Index(data, []byte("dvhe"))
+	want := []string{
+		fmt.Sprintf("converted.mp4 %s dvhe->dvh1 [{sample entry %d dvhe dvh1}]", statusDone, offset),
+		fmt.Sprintf("empty.mp4 %s dvhe->dvh1 []", statusIncomplete),
+		fmt.Sprintf("converted.mp4 %s dvhe->dvh1 []", statusDone),
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got records %q, want %q", got, want)
+	}
+}
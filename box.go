@@ -0,0 +1,791 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// readFullBoxHeader reads the version and flags that prefix every FullBox payload.
+func readFullBoxHeader(r io.Reader) (version uint8, flags uint32, err error) {
+	var vf uint32
+	if err = binary.Read(r, binary.BigEndian, &vf); err != nil {
+		return 0, 0, err
+	}
+	return uint8(vf >> 24), vf & 0x00ffffff, nil
+}
+
+// errUnsupportedStsdVersion is returned for stsd boxes of a version whose
+// layout is unknown.
+var errUnsupportedStsdVersion = errors.New("unsupported stsd version")
+
+// readStsdHeader reads the version and entry count of a stsd payload, after
+// which the sample entries follow. Version 1, used with the version 1 audio
+// sample entries of QuickTime, has the same layout as version 0. The reader
+// must be positioned right after the box header.
+func readStsdHeader(r io.Reader) (version uint8, entryCount uint32, err error) {
+	if version, _, err = readFullBoxHeader(r); err != nil {
+		return 0, 0, fmt.Errorf(`[readStsdHeader] failed reading version: %w`, err)
+	}
+	if version > 1 {
+		return version, 0, fmt.Errorf(`[readStsdHeader] version %d: %w`, version, errUnsupportedStsdVersion)
+	}
+	if err = binary.Read(r, binary.BigEndian, &entryCount); err != nil {
+		return version, 0, fmt.Errorf(`[readStsdHeader] failed reading entry count: %w`, err)
+	}
+	return
+}
+
+// MvhdBox holds the fields of the movie header box we report on.
+type MvhdBox struct {
+	Version   uint8
+	Timescale uint32
+	Duration  uint64
+}
+
+// readMvhdBox parses an mvhd payload. The reader must be positioned right after the box header.
+func readMvhdBox(r io.Reader) (*MvhdBox, error) {
+	var (
+		box MvhdBox
+		err error
+	)
+	if box.Version, _, err = readFullBoxHeader(r); err != nil {
+		return nil, fmt.Errorf(`[readMvhdBox] failed reading version: %w`, err)
+	}
+
+	switch box.Version {
+	case 0:
+		var fields struct {
+			CreationTime     uint32
+			ModificationTime uint32
+			Timescale        uint32
+			Duration         uint32
+		}
+		if err = binary.Read(r, binary.BigEndian, &fields); err != nil {
+			return nil, fmt.Errorf(`[readMvhdBox] failed reading fields: %w`, err)
+		}
+		box.Timescale = fields.Timescale
+		box.Duration = uint64(fields.Duration)
+	case 1:
+		var fields struct {
+			CreationTime     uint64
+			ModificationTime uint64
+			Timescale        uint32
+			Duration         uint64
+		}
+		if err = binary.Read(r, binary.BigEndian, &fields); err != nil {
+			return nil, fmt.Errorf(`[readMvhdBox] failed reading fields: %w`, err)
+		}
+		box.Timescale = fields.Timescale
+		box.Duration = fields.Duration
+	default:
+		return nil, fmt.Errorf(`[readMvhdBox] unsupported version %d`, box.Version)
+	}
+	return &box, nil
+}
+
+// Track header flags
+const (
+	tkhdTrackEnabled   = 0x1
+	tkhdTrackInMovie   = 0x2
+	tkhdTrackInPreview = 0x4
+)
+
+// TkhdBox holds the fields of the track header box we report on.
+type TkhdBox struct {
+	Version uint8
+	Flags   uint32
+	TrackID uint32
+
+	// Presentation size, 16.16 fixed point in the file
+	Width  float64
+	Height float64
+}
+
+func (box *TkhdBox) Enabled() bool {
+	return box.Flags&tkhdTrackEnabled != 0
+}
+
+// readTkhdBox parses a tkhd payload. The reader must be positioned right after the box header.
+func readTkhdBox(r io.Reader) (*TkhdBox, error) {
+	var (
+		box TkhdBox
+		err error
+	)
+	if box.Version, box.Flags, err = readFullBoxHeader(r); err != nil {
+		return nil, fmt.Errorf(`[readTkhdBox] failed reading version: %w`, err)
+	}
+
+	switch box.Version {
+	case 0:
+		var fields struct {
+			CreationTime     uint32
+			ModificationTime uint32
+			TrackID          uint32
+			Reserved         uint32
+			Duration         uint32
+		}
+		if err = binary.Read(r, binary.BigEndian, &fields); err != nil {
+			return nil, fmt.Errorf(`[readTkhdBox] failed reading fields: %w`, err)
+		}
+		box.TrackID = fields.TrackID
+	case 1:
+		var fields struct {
+			CreationTime     uint64
+			ModificationTime uint64
+			TrackID          uint32
+			Reserved         uint32
+			Duration         uint64
+		}
+		if err = binary.Read(r, binary.BigEndian, &fields); err != nil {
+			return nil, fmt.Errorf(`[readTkhdBox] failed reading fields: %w`, err)
+		}
+		box.TrackID = fields.TrackID
+	default:
+		return nil, fmt.Errorf(`[readTkhdBox] unsupported version %d`, box.Version)
+	}
+
+	var fields struct {
+		Reserved       [2]uint32
+		Layer          int16
+		AlternateGroup int16
+		Volume         int16
+		Reserved2      uint16
+		Matrix         [9]int32
+		Width          uint32
+		Height         uint32
+	}
+	if err = binary.Read(r, binary.BigEndian, &fields); err != nil {
+		return nil, fmt.Errorf(`[readTkhdBox] failed reading presentation fields: %w`, err)
+	}
+	box.Width = float64(fields.Width) / (1 << 16)
+	box.Height = float64(fields.Height) / (1 << 16)
+	return &box, nil
+}
+
+// MdhdBox holds the fields of the media header box we report on.
+type MdhdBox struct {
+	Version   uint8
+	Timescale uint32
+	Duration  uint64
+
+	// Language is the ISO-639-2/T code of the media, empty if the file uses a
+	// QuickTime Macintosh language code instead
+	Language string
+}
+
+// decodeLanguage unpacks an ISO-639-2/T code stored as three 5-bit letters
+// offset by 0x60, after a padding bit. Values below 0x400 are Macintosh
+// language codes, which QuickTime files may use.
+func decodeLanguage(packed uint16) string {
+	if packed < 0x400 {
+		return ""
+	}
+	return string([]byte{
+		byte(packed>>10&0x1f) + 0x60,
+		byte(packed>>5&0x1f) + 0x60,
+		byte(packed&0x1f) + 0x60,
+	})
+}
+
+// readMdhdBox parses an mdhd payload. The reader must be positioned right after the box header.
+func readMdhdBox(r io.Reader) (*MdhdBox, error) {
+	var (
+		box      MdhdBox
+		language uint16
+		err      error
+	)
+	if box.Version, _, err = readFullBoxHeader(r); err != nil {
+		return nil, fmt.Errorf(`[readMdhdBox] failed reading version: %w`, err)
+	}
+
+	switch box.Version {
+	case 0:
+		var fields struct {
+			CreationTime     uint32
+			ModificationTime uint32
+			Timescale        uint32
+			Duration         uint32
+		}
+		if err = binary.Read(r, binary.BigEndian, &fields); err != nil {
+			return nil, fmt.Errorf(`[readMdhdBox] failed reading fields: %w`, err)
+		}
+		box.Timescale = fields.Timescale
+		box.Duration = uint64(fields.Duration)
+	case 1:
+		var fields struct {
+			CreationTime     uint64
+			ModificationTime uint64
+			Timescale        uint32
+			Duration         uint64
+		}
+		if err = binary.Read(r, binary.BigEndian, &fields); err != nil {
+			return nil, fmt.Errorf(`[readMdhdBox] failed reading fields: %w`, err)
+		}
+		box.Timescale = fields.Timescale
+		box.Duration = fields.Duration
+	default:
+		return nil, fmt.Errorf(`[readMdhdBox] unsupported version %d`, box.Version)
+	}
+
+	if err = binary.Read(r, binary.BigEndian, &language); err != nil {
+		return nil, fmt.Errorf(`[readMdhdBox] failed reading language: %w`, err)
+	}
+	box.Language = decodeLanguage(language)
+	return &box, nil
+}
+
+// HdlrBox holds the handler type and human-readable name of a handler reference box.
+type HdlrBox struct {
+	HandlerType FourCC
+	Name        string
+}
+
+// readHdlrBox parses an hdlr payload of payloadSize bytes. ISO files store the
+// name as a null-terminated string while QuickTime files use a counted
+// (Pascal) string; both are accepted.
+func readHdlrBox(r io.Reader, payloadSize int64) (*HdlrBox, error) {
+	var (
+		box    HdlrBox
+		fields struct {
+			PreDefined  uint32
+			HandlerType FourCC
+			Reserved    [3]uint32
+		}
+		err error
+	)
+	if _, _, err = readFullBoxHeader(r); err != nil {
+		return nil, fmt.Errorf(`[readHdlrBox] failed reading version: %w`, err)
+	}
+	if err = binary.Read(r, binary.BigEndian, &fields); err != nil {
+		return nil, fmt.Errorf(`[readHdlrBox] failed reading fields: %w`, err)
+	}
+	box.HandlerType = fields.HandlerType
+
+	nameSize := payloadSize - 4 - int64(binary.Size(fields))
+	if nameSize <= 0 {
+		return &box, nil
+	}
+	// Read incrementally, the size of a damaged box may be far larger than the file.
+	name, err := io.ReadAll(io.LimitReader(r, nameSize))
+	if err == nil && int64(len(name)) < nameSize {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return nil, fmt.Errorf(`[readHdlrBox] failed reading name: %w`, err)
+	}
+	box.Name = parseHandlerName(name)
+	return &box, nil
+}
+
+func parseHandlerName(name []byte) string {
+	// A counted string starts with its length, which is never a printable character
+	if n := int(name[0]); n < 0x20 && n < len(name) {
+		name = name[1 : 1+n]
+	}
+	if i := bytes.IndexByte(name, 0); i >= 0 {
+		name = name[:i]
+	}
+	return string(name)
+}
+
+// TrexBox holds the per-track defaults used by movie fragments.
+type TrexBox struct {
+	TrackID                       uint32
+	DefaultSampleDescriptionIndex uint32
+	DefaultSampleDuration         uint32
+	DefaultSampleSize             uint32
+	DefaultSampleFlags            uint32
+}
+
+func readTrexBox(r io.Reader) (*TrexBox, error) {
+	var box TrexBox
+	if _, _, err := readFullBoxHeader(r); err != nil {
+		return nil, fmt.Errorf(`[readTrexBox] failed reading version: %w`, err)
+	}
+	if err := binary.Read(r, binary.BigEndian, &box); err != nil {
+		return nil, fmt.Errorf(`[readTrexBox] failed reading fields: %w`, err)
+	}
+	return &box, nil
+}
+
+const (
+	tfhdBaseDataOffsetPresent         = 0x000001
+	tfhdSampleDescriptionIndexPresent = 0x000002
+)
+
+// TfhdBox holds the track fragment header fields we report on.
+// SampleDescriptionIndex is 0 when the fragment uses the trex default.
+type TfhdBox struct {
+	TrackID                uint32
+	SampleDescriptionIndex uint32
+}
+
+func readTfhdBox(r io.Reader) (*TfhdBox, error) {
+	var (
+		box   TfhdBox
+		flags uint32
+		err   error
+	)
+	if _, flags, err = readFullBoxHeader(r); err != nil {
+		return nil, fmt.Errorf(`[readTfhdBox] failed reading version: %w`, err)
+	}
+	if err = binary.Read(r, binary.BigEndian, &box.TrackID); err != nil {
+		return nil, fmt.Errorf(`[readTfhdBox] failed reading track ID: %w`, err)
+	}
+	if flags&tfhdBaseDataOffsetPresent != 0 {
+		var baseDataOffset uint64
+		if err = binary.Read(r, binary.BigEndian, &baseDataOffset); err != nil {
+			return nil, fmt.Errorf(`[readTfhdBox] failed reading base data offset: %w`, err)
+		}
+	}
+	if flags&tfhdSampleDescriptionIndexPresent != 0 {
+		if err = binary.Read(r, binary.BigEndian, &box.SampleDescriptionIndex); err != nil {
+			return nil, fmt.Errorf(`[readTfhdBox] failed reading sample description index: %w`, err)
+		}
+	}
+	return &box, nil
+}
+
+// EditListEntry is one edit of an elst box. MediaTime is -1 for an empty edit.
+type EditListEntry struct {
+	SegmentDuration uint64  `json:"segmentDuration"`
+	MediaTime       int64   `json:"mediaTime"`
+	MediaRate       float64 `json:"mediaRate"`
+}
+
+type ElstBox struct {
+	Version uint8
+	Entries []EditListEntry
+}
+
+func readElstBox(r io.Reader) (*ElstBox, error) {
+	var (
+		box   ElstBox
+		count uint32
+		err   error
+	)
+	if box.Version, _, err = readFullBoxHeader(r); err != nil {
+		return nil, fmt.Errorf(`[readElstBox] failed reading version: %w`, err)
+	}
+	if box.Version > 1 {
+		return nil, fmt.Errorf(`[readElstBox] unsupported version %d`, box.Version)
+	}
+	if err = binary.Read(r, binary.BigEndian, &count); err != nil {
+		return nil, fmt.Errorf(`[readElstBox] failed reading entry count: %w`, err)
+	}
+	for i := uint32(0); i < count; i++ {
+		var (
+			entry EditListEntry
+			rate  struct {
+				Integer  int16
+				Fraction uint16
+			}
+		)
+		if box.Version == 1 {
+			var fields struct {
+				SegmentDuration uint64
+				MediaTime       int64
+			}
+			err = binary.Read(r, binary.BigEndian, &fields)
+			entry.SegmentDuration, entry.MediaTime = fields.SegmentDuration, fields.MediaTime
+		} else {
+			var fields struct {
+				SegmentDuration uint32
+				MediaTime       int32
+			}
+			err = binary.Read(r, binary.BigEndian, &fields)
+			entry.SegmentDuration, entry.MediaTime = uint64(fields.SegmentDuration), int64(fields.MediaTime)
+		}
+		if err != nil {
+			return nil, fmt.Errorf(`[readElstBox] failed reading entry %d: %w`, i, err)
+		}
+		if err = binary.Read(r, binary.BigEndian, &rate); err != nil {
+			return nil, fmt.Errorf(`[readElstBox] failed reading rate of entry %d: %w`, i, err)
+		}
+		entry.MediaRate = float64(rate.Integer) + float64(rate.Fraction)/(1<<16)
+		box.Entries = append(box.Entries, entry)
+	}
+	return &box, nil
+}
+
+// DolbyVisionConfig is the DOVIDecoderConfigurationRecord of a dvcC, dvvC or
+// dvwC box.
+type DolbyVisionConfig struct {
+	VersionMajor            uint8 `json:"versionMajor"`
+	VersionMinor            uint8 `json:"versionMinor"`
+	Profile                 uint8 `json:"profile"`
+	Level                   uint8 `json:"level"`
+	RPUPresent              bool  `json:"rpuPresent"`
+	ELPresent               bool  `json:"elPresent"`
+	BLPresent               bool  `json:"blPresent"`
+	BLSignalCompatibilityID uint8 `json:"blSignalCompatibilityId"`
+}
+
+func readDolbyVisionConfig(r io.Reader) (*DolbyVisionConfig, error) {
+	var (
+		fields struct {
+			VersionMajor uint8
+			VersionMinor uint8
+			Flags        uint16
+			Compat       uint8
+		}
+		config DolbyVisionConfig
+	)
+	if err := binary.Read(r, binary.BigEndian, &fields); err != nil {
+		return nil, fmt.Errorf(`[readDolbyVisionConfig] failed reading configuration record: %w`, err)
+	}
+	// dv_profile(7) dv_level(6) rpu_present_flag(1) el_present_flag(1) bl_present_flag(1)
+	config.VersionMajor = fields.VersionMajor
+	config.VersionMinor = fields.VersionMinor
+	config.Profile = uint8(fields.Flags >> 9)
+	config.Level = uint8(fields.Flags>>3) & 0x3f
+	config.RPUPresent = fields.Flags&4 != 0
+	config.ELPresent = fields.Flags&2 != 0
+	config.BLPresent = fields.Flags&1 != 0
+	config.BLSignalCompatibilityID = fields.Compat >> 4
+	return &config, nil
+}
+
+// VisualSampleEntry holds the fixed fields of a visual sample entry, which
+// precede its child boxes.
+type VisualSampleEntry struct {
+	DataReferenceIndex uint16
+	Width              uint16
+	Height             uint16
+	FrameCount         uint16
+	CompressorName     string
+	Depth              uint16
+}
+
+// readVisualSampleEntry parses the fixed fields of a visual sample entry. The
+// reader must be positioned right after the box header. Some muxers write
+// slightly off reserved and pre-defined fields, which are not needed to use
+// the entry: they are returned as deviations instead of failing.
+func readVisualSampleEntry(r io.Reader) (entry *VisualSampleEntry, deviations []string, err error) {
+	var fields struct {
+		Reserved           [6]byte
+		DataReferenceIndex uint16
+		PreDefined1        uint16
+		Reserved2          uint16
+		PreDefined2        [3]uint32
+		Width              uint16
+		Height             uint16
+		HorizResolution    uint32
+		VertResolution     uint32
+		Reserved3          uint32
+		FrameCount         uint16
+		CompressorName     [32]byte
+		Depth              uint16
+		PreDefined3        int16
+	}
+	if err = binary.Read(r, binary.BigEndian, &fields); err != nil {
+		return nil, nil, fmt.Errorf(`[readVisualSampleEntry] failed reading fixed fields: %w`, err)
+	}
+	entry = &VisualSampleEntry{
+		DataReferenceIndex: fields.DataReferenceIndex,
+		Width:              fields.Width,
+		Height:             fields.Height,
+		FrameCount:         fields.FrameCount,
+		Depth:              fields.Depth,
+	}
+
+	if fields.Reserved != [6]byte{} || fields.Reserved2 != 0 || fields.Reserved3 != 0 {
+		deviations = append(deviations, "reserved fields are not zero")
+	}
+	if fields.PreDefined1 != 0 || fields.PreDefined2 != [3]uint32{} || fields.PreDefined3 != -1 {
+		deviations = append(deviations, fmt.Sprintf("pre-defined fields are %d, %v and %d instead of 0, [0 0 0] and -1", fields.PreDefined1, fields.PreDefined2, fields.PreDefined3))
+	}
+	if fields.FrameCount != 1 {
+		deviations = append(deviations, fmt.Sprintf("frame count is %d instead of 1", fields.FrameCount))
+	}
+
+	// compressorname is a Pascal string, padded with zeros to 32 bytes
+	name := fields.CompressorName[1:]
+	if n := int(fields.CompressorName[0]); n <= len(name) {
+		name = name[:n]
+	} else {
+		deviations = append(deviations, fmt.Sprintf("compressor name length %d exceeds 31 bytes", n))
+	}
+	entry.CompressorName = strings.TrimRight(string(name), "\x00")
+	return
+}
+
+// HevcConfig holds the fields of the HEVCDecoderConfigurationRecord of a
+// hvcC box describing the stream, without its parameter sets.
+type HevcConfig struct {
+	ConfigurationVersion uint8  `json:"configurationVersion"`
+	ProfileSpace         uint8  `json:"profileSpace"`
+	HighTier             bool   `json:"highTier"`
+	ProfileIDC           uint8  `json:"profileIdc"`
+	ProfileCompatibility uint32 `json:"profileCompatibility"`
+	LevelIDC             uint8  `json:"levelIdc"`
+	ChromaFormat         uint8  `json:"chromaFormat"`
+	BitDepthLuma         uint8  `json:"bitDepthLuma"`
+	BitDepthChroma       uint8  `json:"bitDepthChroma"`
+	LengthSize           uint8  `json:"lengthSize"`
+}
+
+var hevcProfileNames = map[uint8]string{
+	1: "Main", 2: "Main 10", 3: "Main Still Picture", 4: "Range Extensions",
+	5: "High Throughput", 9: "Screen Content Coding",
+}
+
+// ProfileName returns the name of the general profile, such as "Main 10".
+func (c *HevcConfig) ProfileName() string {
+	if name, ok := hevcProfileNames[c.ProfileIDC]; ok {
+		return name
+	}
+	return fmt.Sprintf("profile %d", c.ProfileIDC)
+}
+
+// Level returns the general level, e.g. 5.1 for general_level_idc 153.
+func (c *HevcConfig) Level() float64 {
+	return float64(c.LevelIDC) / 30
+}
+
+// ChromaFormatName returns the chroma subsampling, such as "4:2:0".
+func (c *HevcConfig) ChromaFormatName() string {
+	return [...]string{"monochrome", "4:2:0", "4:2:2", "4:4:4"}[c.ChromaFormat]
+}
+
+func readHevcConfig(r io.Reader) (*HevcConfig, error) {
+	var (
+		fields struct {
+			ConfigurationVersion uint8
+			Profile              uint8
+			ProfileCompatibility uint32
+			ConstraintIndicator  [6]byte
+			LevelIDC             uint8
+			MinSpatialSegment    uint16
+			ParallelismType      uint8
+			ChromaFormat         uint8
+			BitDepthLuma         uint8
+			BitDepthChroma       uint8
+			AvgFrameRate         uint16
+			Flags                uint8
+		}
+		config HevcConfig
+	)
+	if err := binary.Read(r, binary.BigEndian, &fields); err != nil {
+		return nil, fmt.Errorf(`[readHevcConfig] failed reading configuration record: %w`, err)
+	}
+	// general_profile_space(2) general_tier_flag(1) general_profile_idc(5)
+	config.ConfigurationVersion = fields.ConfigurationVersion
+	config.ProfileSpace = fields.Profile >> 6
+	config.HighTier = fields.Profile&0x20 != 0
+	config.ProfileIDC = fields.Profile & 0x1f
+	config.ProfileCompatibility = fields.ProfileCompatibility
+	config.LevelIDC = fields.LevelIDC
+	config.ChromaFormat = fields.ChromaFormat & 3
+	config.BitDepthLuma = fields.BitDepthLuma&7 + 8
+	config.BitDepthChroma = fields.BitDepthChroma&7 + 8
+	// constantFrameRate(2) numTemporalLayers(3) temporalIdNested(1) lengthSizeMinusOne(2)
+	config.LengthSize = fields.Flags&3 + 1
+	return &config, nil
+}
+
+// Av1Config holds the fields of the AV1CodecConfigurationRecord of an av1C box
+// describing the stream, without its configuration OBUs.
+type Av1Config struct {
+	Version              uint8 `json:"version"`
+	SeqProfile           uint8 `json:"seqProfile"`
+	SeqLevelIdx          uint8 `json:"seqLevelIdx"`
+	HighTier             bool  `json:"highTier"`
+	BitDepth             uint8 `json:"bitDepth"`
+	Monochrome           bool  `json:"monochrome"`
+	ChromaSubsamplingX   bool  `json:"chromaSubsamplingX"`
+	ChromaSubsamplingY   bool  `json:"chromaSubsamplingY"`
+	ChromaSamplePosition uint8 `json:"chromaSamplePosition"`
+}
+
+// ProfileName returns the name of the sequence profile, such as "Main".
+func (c *Av1Config) ProfileName() string {
+	if c.SeqProfile < 3 {
+		return [...]string{"Main", "High", "Professional"}[c.SeqProfile]
+	}
+	return fmt.Sprintf("profile %d", c.SeqProfile)
+}
+
+// LevelName returns the level of the first operating point, e.g. "5.1" for
+// seq_level_idx 13.
+func (c *Av1Config) LevelName() string {
+	if c.SeqLevelIdx == 31 {
+		return "max"
+	}
+	return fmt.Sprintf("%d.%d", 2+c.SeqLevelIdx>>2, c.SeqLevelIdx&3)
+}
+
+// ChromaFormatName returns the chroma subsampling, such as "4:2:0".
+func (c *Av1Config) ChromaFormatName() string {
+	switch {
+	case c.Monochrome:
+		return "monochrome"
+	case c.ChromaSubsamplingX && c.ChromaSubsamplingY:
+		return "4:2:0"
+	case c.ChromaSubsamplingX:
+		return "4:2:2"
+	}
+	return "4:4:4"
+}
+
+func readAv1Config(r io.Reader) (*Av1Config, error) {
+	var (
+		fields [4]byte
+		config Av1Config
+	)
+	if _, err := io.ReadFull(r, fields[:]); err != nil {
+		return nil, fmt.Errorf(`[readAv1Config] failed reading configuration record: %w`, err)
+	}
+	// marker(1) version(7)
+	if fields[0]&0x80 == 0 {
+		return nil, fmt.Errorf(`[readAv1Config] marker bit not set in %#x`, fields[0])
+	}
+	config.Version = fields[0] & 0x7f
+	// seq_profile(3) seq_level_idx_0(5)
+	config.SeqProfile = fields[1] >> 5
+	config.SeqLevelIdx = fields[1] & 0x1f
+	// seq_tier_0(1) high_bitdepth(1) twelve_bit(1) monochrome(1)
+	// chroma_subsampling_x(1) chroma_subsampling_y(1) chroma_sample_position(2)
+	config.HighTier = fields[2]&0x80 != 0
+	config.BitDepth = 8
+	if fields[2]&0x40 != 0 {
+		config.BitDepth = 10
+		if fields[2]&0x20 != 0 {
+			config.BitDepth = 12
+		}
+	}
+	config.Monochrome = fields[2]&0x10 != 0
+	config.ChromaSubsamplingX = fields[2]&0x08 != 0
+	config.ChromaSubsamplingY = fields[2]&0x04 != 0
+	config.ChromaSamplePosition = fields[2] & 3
+	return &config, nil
+}
+
+// PaspBox is the pixel aspect ratio of a visual sample entry, the width of a
+// pixel relative to its height as HSpacing:VSpacing.
+type PaspBox struct {
+	HSpacing uint32 `json:"hSpacing"`
+	VSpacing uint32 `json:"vSpacing"`
+}
+
+// Ratio returns the pixel aspect ratio, or 0 if VSpacing is 0.
+func (b *PaspBox) Ratio() float64 {
+	if b.VSpacing == 0 {
+		return 0
+	}
+	return float64(b.HSpacing) / float64(b.VSpacing)
+}
+
+// readPaspBox parses a pasp payload. The reader must be positioned right
+// after the box header.
+func readPaspBox(r io.Reader) (*PaspBox, error) {
+	var box PaspBox
+	if err := binary.Read(r, binary.BigEndian, &box); err != nil {
+		return nil, fmt.Errorf(`[readPaspBox] failed reading spacing: %w`, err)
+	}
+	return &box, nil
+}
+
+// Chromaticity is a CIE 1931 xy chromaticity coordinate.
+type Chromaticity struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+// MasteringDisplay is the SMPTE ST 2086 mastering display color volume of a
+// mdcv box.
+type MasteringDisplay struct {
+	// Primaries are in the green, blue, red order of the box
+	Primaries  [3]Chromaticity `json:"primaries"`
+	WhitePoint Chromaticity    `json:"whitePoint"`
+
+	// Luminances are in cd/m²
+	MaxLuminance float64 `json:"maxLuminance"`
+	MinLuminance float64 `json:"minLuminance"`
+}
+
+func readMasteringDisplay(r io.Reader) (*MasteringDisplay, error) {
+	var (
+		fields struct {
+			Primaries    [3][2]uint16
+			WhitePoint   [2]uint16
+			MaxLuminance uint32
+			MinLuminance uint32
+		}
+		display MasteringDisplay
+	)
+	if err := binary.Read(r, binary.BigEndian, &fields); err != nil {
+		return nil, fmt.Errorf(`[readMasteringDisplay] failed reading mastering display: %w`, err)
+	}
+	// chromaticities in increments of 0.00002, luminances of 0.0001 cd/m²
+	chromaticity := func(xy [2]uint16) Chromaticity {
+		return Chromaticity{X: float64(xy[0]) * 0.00002, Y: float64(xy[1]) * 0.00002}
+	}
+	for i, xy := range fields.Primaries {
+		display.Primaries[i] = chromaticity(xy)
+	}
+	display.WhitePoint = chromaticity(fields.WhitePoint)
+	display.MaxLuminance = float64(fields.MaxLuminance) * 0.0001
+	display.MinLuminance = float64(fields.MinLuminance) * 0.0001
+	return &display, nil
+}
+
+// ContentLightLevel is the content light level information of a clli box,
+// in cd/m².
+type ContentLightLevel struct {
+	MaxCLL  uint16 `json:"maxCll"`
+	MaxFALL uint16 `json:"maxFall"`
+}
+
+func readContentLightLevel(r io.Reader) (*ContentLightLevel, error) {
+	var level ContentLightLevel
+	if err := binary.Read(r, binary.BigEndian, &level); err != nil {
+		return nil, fmt.Errorf(`[readContentLightLevel] failed reading content light level: %w`, err)
+	}
+	return &level, nil
+}
+
+type FtypBox struct {
+	MajorBrand       FourCC
+	MinorVersion     uint32
+	CompatibleBrands []FourCC
+}
+
+func readFtypBox(r io.Reader, payloadSize int64) (*FtypBox, error) {
+	var (
+		box    FtypBox
+		fields struct {
+			MajorBrand   FourCC
+			MinorVersion uint32
+		}
+	)
+	if err := binary.Read(r, binary.BigEndian, &fields); err != nil {
+		return nil, fmt.Errorf(`[readFtypBox] failed reading fields: %w`, err)
+	}
+	box.MajorBrand, box.MinorVersion = fields.MajorBrand, fields.MinorVersion
+	for remaining := payloadSize - 8; remaining >= 4; remaining -= 4 {
+		var brand FourCC
+		if err := binary.Read(r, binary.BigEndian, &brand); err != nil {
+			return nil, fmt.Errorf(`[readFtypBox] failed reading compatible brands: %w`, err)
+		}
+		box.CompatibleBrands = append(box.CompatibleBrands, brand)
+	}
+	return &box, nil
+}
+
+// hasBrand reports whether brand is the major brand or a compatible brand.
+func (box *FtypBox) hasBrand(brand string) bool {
+	if string(box.MajorBrand[:]) == brand {
+		return true
+	}
+	for _, b := range box.CompatibleBrands {
+		if string(b[:]) == brand {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,751 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadMvhdBox(t *testing.T) {
+	tests := []struct {
+		name      string
+		payload   []byte
+		version   uint8
+		timescale uint32
+		duration  uint64
+	}{
+		{
+			name:      "version 0",
+			payload:   bytes.Join([][]byte{u32(0), u32(1), u32(2), u32(600), u32(12000)}, nil),
+			version:   0,
+			timescale: 600,
+			duration:  12000,
+		},
+		{
+			name:      "version 1",
+			payload:   bytes.Join([][]byte{u32(1 << 24), u64(1), u64(2), u32(90000), u64(1 << 40)}, nil),
+			version:   1,
+			timescale: 90000,
+			duration:  1 << 40,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mvhd, err := readMvhdBox(bytes.NewReader(tt.payload))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if mvhd.Version != tt.version || mvhd.Timescale != tt.timescale || mvhd.Duration != tt.duration {
+				t.Errorf("got %+v, want version %d timescale %d duration %d", mvhd, tt.version, tt.timescale, tt.duration)
+			}
+		})
+	}
+}
+
+func TestInspect(t *testing.T) {
+	mvhd := fullBox("mvhd", 1, 0, u64(0), u64(0), u32(1000), u64(5000))
+	data := movie(mvhd, trak(visualSampleEntry("dvhe", 3840, 2160)))
+
+	info, err := inspect(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Timescale != 1000 || info.Duration != 5000 {
+		t.Errorf("got timescale %d duration %d", info.Timescale, info.Duration)
+	}
+	if info.DurationSeconds() != 5 {
+		t.Errorf("got %v seconds, want 5", info.DurationSeconds())
+	}
+	if len(info.Tracks) != 1 || len(info.Tracks[0].Codecs) != 1 || info.Tracks[0].Codecs[0] != "dvhe" {
+		t.Errorf("got tracks %+v", info.Tracks)
+	}
+
+	// The moov offset, and whether it precedes the media data
+	ftyp := box("ftyp", []byte("isom"), u32(0), []byte("isom"))
+	moov := box("moov", mvhd)
+	mdat := box("mdat", make([]byte, 16))
+	for _, tt := range []struct {
+		name      string
+		data      []byte
+		offset    int64
+		fastStart bool
+		line      string
+	}{
+		{"moov before mdat", bytes.Join([][]byte{ftyp, moov, mdat}, nil), 20, true, "  moov: at 20(0x14), before the media data\n"},
+		{"moov after mdat", bytes.Join([][]byte{ftyp, mdat, moov}, nil), 44, false, "  moov: at 44(0x2c), after the media data\n"},
+		{"no moov", bytes.Join([][]byte{ftyp, mdat}, nil), -1, false, "  moov: none\n"},
+	} {
+		info, err := inspect(bytes.NewReader(tt.data))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if info.MoovOffset != tt.offset || info.FastStart != tt.fastStart {
+			t.Errorf("%s: got moov at %d fast start %v, want %d %v", tt.name, info.MoovOffset, info.FastStart, tt.offset, tt.fastStart)
+		}
+		if out := captureStdout(t, func() { printInfo(info) }); !strings.Contains(out, tt.line) {
+			t.Errorf("%s: printed %q, want it to contain %q", tt.name, out, tt.line)
+		}
+	}
+
+	// The major brand and minor version of ftyp
+	ftyp = box("ftyp", []byte("mp42"), u32(512), []byte("mp42isomdby1"))
+	info, err = inspect(bytes.NewReader(bytes.Join([][]byte{ftyp, moov, mdat}, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.MajorBrand != "mp42" || info.MinorVersion != 512 || fmt.Sprint(info.CompatibleBrands) != "[mp42 isom dby1]" {
+		t.Errorf("got brand %q minor version %d compatible %v", info.MajorBrand, info.MinorVersion, info.CompatibleBrands)
+	}
+	line := "  brands: mp42 (minor version 512), compatible [mp42 isom dby1]\n"
+	if out := captureStdout(t, func() { printInfo(info) }); !strings.Contains(out, line) {
+		t.Errorf("printed %q, want it to contain %q", out, line)
+	}
+}
+
+func TestInspectFileGzip(t *testing.T) {
+	dir := t.TempDir()
+	t.Cleanup(func() { tempDir = "" })
+	tempDir = filepath.Join(dir, "tmp")
+	if err := os.Mkdir(tempDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	zw.Write(movie(trak(visualSampleEntry("dvhe", 3840, 2160))))
+	zw.Close()
+	name := filepath.Join(dir, "movie.mp4.gz")
+	if err := os.WriteFile(name, compressed.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := inspectFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(info.Tracks) != 1 || len(info.Tracks[0].Codecs) != 1 || info.Tracks[0].Codecs[0] != "dvhe" {
+		t.Errorf("got tracks %+v", info.Tracks)
+	}
+	if left, _ := os.ReadDir(tempDir); len(left) != 0 {
+		t.Errorf("temporary files left behind: %v", left)
+	}
+}
+
+func TestReadHdlrBox(t *testing.T) {
+	fields := bytes.Join([][]byte{u32(0), u32(0), []byte("vide"), make([]byte, 12)}, nil)
+	tests := []struct {
+		name string
+		tail []byte
+		want string
+	}{
+		{"null terminated", []byte("VideoHandler\x00"), "VideoHandler"},
+		{"counted", append([]byte{12}, "VideoHandler"...), "VideoHandler"},
+		{"counted with padding", append([]byte{5}, "Video\x00\x00"...), "Video"},
+		{"unterminated", []byte("VideoHandler"), "VideoHandler"},
+		{"empty", nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload := append(append([]byte{}, fields...), tt.tail...)
+			hdlr, err := readHdlrBox(bytes.NewReader(payload), int64(len(payload)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(hdlr.HandlerType[:]) != "vide" || hdlr.Name != tt.want {
+				t.Errorf("got %s %q, want vide %q", hdlr.HandlerType[:], hdlr.Name, tt.want)
+			}
+		})
+	}
+}
+
+func TestInspectFragments(t *testing.T) {
+	data := bytes.Join([][]byte{
+		movie(
+			trak(visualSampleEntry("dvhe", 1920, 1080), visualSampleEntry("dvh1", 1920, 1080)),
+			box("mvex", fullBox("trex", 0, 0, u32(1), u32(1), u32(0), u32(0), u32(0))),
+		),
+		box("moof", box("traf", fullBox("tfhd", 0, tfhdSampleDescriptionIndexPresent, u32(1), u32(2)))),
+		box("moof", box("traf", fullBox("tfhd", 0, tfhdBaseDataOffsetPresent|tfhdSampleDescriptionIndexPresent, u32(1), u64(0), u32(2)))),
+		box("moof", box("traf", fullBox("tfhd", 0, 0, u32(1)))),
+	}, nil)
+
+	info, err := inspect(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(info.Fragments) != 1 {
+		t.Fatalf("got fragments %+v", info.Fragments)
+	}
+	fragment := info.Fragments[0]
+	if fragment.TrackID != 1 || fragment.DefaultSampleDescriptionIndex != 1 || len(fragment.FragmentSampleDescriptionIndexes) != 1 || fragment.FragmentSampleDescriptionIndexes[0] != 2 {
+		t.Errorf("got %+v", fragment)
+	}
+}
+
+func TestReadElstBox(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{
+			name: "version 0",
+			data: bytes.Join([][]byte{u32(0), u32(2),
+				u32(1000), u32(0xffffffff), u16(1), u16(0),
+				u32(5000), u32(2002), u16(1), u16(0x8000),
+			}, nil),
+		},
+		{
+			name: "version 1",
+			data: bytes.Join([][]byte{u32(1 << 24), u32(2),
+				u64(1000), u64(0xffffffffffffffff), u16(1), u16(0),
+				u64(5000), u64(2002), u16(1), u16(0x8000),
+			}, nil),
+		},
+	}
+	want := []EditListEntry{
+		{SegmentDuration: 1000, MediaTime: -1, MediaRate: 1},
+		{SegmentDuration: 5000, MediaTime: 2002, MediaRate: 1.5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			elst, err := readElstBox(bytes.NewReader(tt.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(elst.Entries) != len(want) {
+				t.Fatalf("got %d entries", len(elst.Entries))
+			}
+			for i := range want {
+				if elst.Entries[i] != want[i] {
+					t.Errorf("entry %d: got %+v, want %+v", i, elst.Entries[i], want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeLanguage(t *testing.T) {
+	tests := []struct {
+		packed uint16
+		want   string
+	}{
+		{packed: ('e'-0x60)<<10 | ('n'-0x60)<<5 | ('g' - 0x60), want: "eng"},
+		{packed: 0x55c4, want: "und"},
+		{packed: 0x8000 | 0x15c7, want: "eng"}, // the padding bit is ignored
+		{packed: 0, want: ""},                  // Macintosh English
+	}
+	for _, tt := range tests {
+		if got := decodeLanguage(tt.packed); got != tt.want {
+			t.Errorf("decodeLanguage(%#x) = %q, want %q", tt.packed, got, tt.want)
+		}
+	}
+}
+
+func TestReadMdhdBox(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload []byte
+		want    MdhdBox
+	}{
+		{
+			name:    "version 0",
+			payload: bytes.Join([][]byte{u32(0), u32(1), u32(2), u32(24000), u32(240000), u16(0x15c7), u16(0)}, nil),
+			want:    MdhdBox{Version: 0, Timescale: 24000, Duration: 240000, Language: "eng"},
+		},
+		{
+			name:    "version 1",
+			payload: bytes.Join([][]byte{u32(1 << 24), u64(1), u64(2), u32(48000), u64(1 << 36), u16(0x1a41), u16(0)}, nil),
+			want:    MdhdBox{Version: 1, Timescale: 48000, Duration: 1 << 36, Language: "fra"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mdhd, err := readMdhdBox(bytes.NewReader(tt.payload))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *mdhd != tt.want {
+				t.Errorf("got %+v, want %+v", *mdhd, tt.want)
+			}
+		})
+	}
+}
+
+// tkhd builds a track header box of the given version.
+func tkhd(version uint8, flags uint32, trackID uint32, width, height uint16) []byte {
+	var times []byte
+	if version == 1 {
+		times = bytes.Join([][]byte{u64(1), u64(2), u32(trackID), u32(0), u64(3)}, nil)
+	} else {
+		times = bytes.Join([][]byte{u32(1), u32(2), u32(trackID), u32(0), u32(3)}, nil)
+	}
+	return fullBox("tkhd", version, flags, times, make([]byte, 8+8+36), u32(uint32(width)<<16), u32(uint32(height)<<16))
+}
+
+func TestReadTkhdBox(t *testing.T) {
+	for _, version := range []uint8{0, 1} {
+		data := tkhd(version, tkhdTrackEnabled|tkhdTrackInMovie, 7, 1920, 1080)
+		box, err := readTkhdBox(bytes.NewReader(data[8:]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if box.Version != version || box.TrackID != 7 || !box.Enabled() || box.Width != 1920 || box.Height != 1080 {
+			t.Errorf("version %d: got %+v", version, box)
+		}
+	}
+}
+
+func TestHeaderPayloadSize(t *testing.T) {
+	uuid := box("uuid", make([]byte, 16), []byte("payload"))
+	tests := []struct {
+		name        string
+		data        []byte
+		wantHeader  int64
+		wantPayload int64
+	}{
+		{name: "compact", data: box("free", make([]byte, 10)), wantHeader: 8, wantPayload: 10},
+		{name: "large", data: largeBox(box("free", make([]byte, 10))), wantHeader: 16, wantPayload: 10},
+		{name: "uuid", data: uuid, wantHeader: 24, wantPayload: 7},
+		{name: "large uuid", data: largeBox(uuid), wantHeader: 32, wantPayload: 7},
+		{name: "size 0", data: append(u32(0), []byte("mdat")...), wantHeader: 8, wantPayload: -1},
+		{name: "too small", data: append(u32(4), []byte("free")...), wantHeader: 8, wantPayload: -4},
+		{name: "uuid too small", data: box("uuid", make([]byte, 8)), wantHeader: 24, wantPayload: -8},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, err := readBoxHeader(bytes.NewReader(tt.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := h.HeaderLength(); got != tt.wantHeader {
+				t.Errorf("got header length %d, want %d", got, tt.wantHeader)
+			}
+			if got := h.PayloadSize(); got != tt.wantPayload {
+				t.Errorf("got payload size %d, want %d", got, tt.wantPayload)
+			}
+		})
+	}
+}
+
+func TestFindHeaderSkipsUuid(t *testing.T) {
+	data := bytes.Join([][]byte{
+		box("uuid", make([]byte, 16), []byte("payload")),
+		largeBox(box("uuid", make([]byte, 16))),
+		box("moov"),
+	}, nil)
+	h, err := findHeader(bytes.NewReader(data), MoovBoxType, int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := int64(len(data) - 8); h.Offset != want {
+		t.Errorf("found moov at %d, want %d", h.Offset, want)
+	}
+}
+
+func TestFindHeaderLimit(t *testing.T) {
+	free := box("free", make([]byte, 8))
+	moov := box("moov", make([]byte, 8))
+	data := bytes.Join([][]byte{free, moov, box("mdat", make([]byte, 8))}, nil)
+	end := int64(len(free) + len(moov))
+	tests := []struct {
+		name    string
+		data    []byte
+		boxType BoxType
+		limit   int64
+		want    string // the error expected, none if empty
+	}{
+		{name: "box ending at limit", data: data, boxType: MoovBoxType, limit: end},
+		{name: "box overrunning limit", data: data, boxType: MoovBoxType, limit: end - 4, want: "overruns the 28 bytes searched by 4"},
+		{name: "box past limit", data: data, boxType: MdatBoxType, limit: end, want: `cannot find box "mdat"`},
+		{name: "other box overrunning limit", data: data, boxType: MdatBoxType, limit: end - 4, want: `cannot find box "mdat"`},
+		{name: "header straddling limit", data: data, boxType: MoovBoxType, limit: int64(len(free)) + 4, want: "the last 4 bytes cannot hold a box header"},
+		{name: "64-bit size straddling limit", data: bytes.Join([][]byte{free, largeBox(moov)}, nil), boxType: MoovBoxType, limit: int64(len(free)) + 12, want: "64-bit size"},
+		{name: "limit of zero", data: data, boxType: FreeBoxType, limit: 0, want: `cannot find box "free"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &readExtent{memFile: memFile{data: tt.data}}
+			h, err := findHeader(r, tt.boxType, tt.limit)
+			if tt.want == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if h.Type != tt.boxType {
+					t.Errorf("found %s, want %s", h.Type, tt.boxType)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("got %v, want an error containing %q", err, tt.want)
+			}
+			maxRead := tt.limit
+			if strings.HasPrefix(tt.name, "64-bit") {
+				// The 64-bit size is read to tell the header overruns.
+				maxRead += 4
+			}
+			if r.end > maxRead {
+				t.Errorf("read up to %d, past the limit of %d", r.end, tt.limit)
+			}
+		})
+	}
+}
+
+func TestFindHeaderInvalidSizes(t *testing.T) {
+	moov := box("moov", make([]byte, 16))
+	for size := uint32(0); size < 8; size++ {
+		for _, limited := range []bool{false, true} {
+			// The box searched for carries the invalid size, followed by a
+			// valid one it must not be mistaken for.
+			data := append(box("moov", make([]byte, 8)), moov...)
+			binary.BigEndian.PutUint32(data, size)
+			limit := int64(-1)
+			if limited {
+				limit = int64(len(data))
+			}
+			r := bytes.NewReader(data)
+			h, err := findHeader(r, MoovBoxType, limit)
+			if size == 0 && !limited {
+				// Extending to the end of the file, as top level boxes may
+				if err != nil || h.Offset != 0 {
+					t.Errorf("size 0: got %v, %v, want the box at 0", h, err)
+				}
+				continue
+			}
+			if err == nil || !strings.Contains(err.Error(), "invalid size") {
+				t.Errorf("size %d, limit %d: got %v, %v, want an invalid size error", size, limit, h, err)
+			}
+			if cur, _ := r.Seek(0, io.SeekCurrent); cur > int64(len(data)) {
+				t.Errorf("size %d, limit %d: seeked to %d", size, limit, cur)
+			}
+		}
+	}
+
+	// 64-bit sizes smaller than their header or ending past the largest
+	// offset would seek backwards.
+	for _, size := range []uint64{0, 1, 8, 15, math.MaxInt64, math.MaxUint64} {
+		data := append(append([]byte{}, moov...), largeBox(box("free", make([]byte, 8)))...)
+		binary.BigEndian.PutUint64(data[len(moov)+8:], size)
+		if h, err := findHeader(bytes.NewReader(data), MdatBoxType, -1); err == nil || !strings.Contains(err.Error(), "invalid size") {
+			t.Errorf("64-bit size %d: got %v, %v, want an invalid size error", size, h, err)
+		}
+		if err := forEachBox(bytes.NewReader(data), -1, func(*Header) error { return nil }); err == nil {
+			t.Errorf("64-bit size %d: forEachBox accepted it", size)
+		}
+		if err := forEachBoxAt(bytes.NewReader(data), 0, -1, func(*Header) error { return nil }); err == nil {
+			t.Errorf("64-bit size %d: forEachBoxAt accepted it", size)
+		}
+	}
+}
+
+func TestReadHevcConfig(t *testing.T) {
+	// Main 10, Main tier, level 5.1, 4:2:0, 10-bit, 4 byte NAL unit lengths
+	record := []byte{
+		0x01, 0x02, 0x20, 0x00, 0x00, 0x00, 0xb0, 0x00, 0x00, 0x00, 0x00, 0x00, 0x99,
+		0xf0, 0x00, 0xfc, 0xfd, 0xfa, 0xfa, 0x00, 0x00, 0x0f, 0x00,
+	}
+	c, err := readHevcConfig(bytes.NewReader(record))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.ProfileName() != "Main 10" || c.HighTier || c.Level() != 5.1 || c.ChromaFormatName() != "4:2:0" || c.BitDepthLuma != 10 || c.BitDepthChroma != 10 || c.LengthSize != 4 {
+		t.Errorf("got %+v", c)
+	}
+
+	if _, err = readHevcConfig(bytes.NewReader(record[:10])); err == nil {
+		t.Errorf("reading a truncated record succeeded")
+	}
+}
+
+func TestReadAv1Config(t *testing.T) {
+	// Main profile, Main tier, level 5.1, 4:2:0, 10-bit
+	record := []byte{0x81, 0x0d, 0x4c, 0x00}
+	c, err := readAv1Config(bytes.NewReader(record))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Version != 1 || c.ProfileName() != "Main" || c.HighTier || c.LevelName() != "5.1" || c.ChromaFormatName() != "4:2:0" || c.BitDepth != 10 {
+		t.Errorf("got %+v", c)
+	}
+
+	if _, err = readAv1Config(bytes.NewReader(record[:3])); err == nil {
+		t.Errorf("reading a truncated record succeeded")
+	}
+	if _, err = readAv1Config(bytes.NewReader([]byte{0x01, 0x0d, 0x4c, 0x00})); err == nil {
+		t.Errorf("reading a record without the marker bit succeeded")
+	}
+}
+
+func TestInspectAv1(t *testing.T) {
+	data := movie(trak(visualSampleEntry("av01", 3840, 2160, box("av1C", []byte{0x81, 0x31, 0x60, 0x00}), box("colr", []byte("nclx"), make([]byte, 7)))))
+	info, err := inspect(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := info.Tracks[0].SampleEntries[0]
+	if entry.Codec != CodecAV01 || entry.Width != 3840 || fmt.Sprint(entry.Boxes) != "[av1C colr]" {
+		t.Fatalf("got sample entry %+v", entry)
+	}
+	if c := entry.AV1; c == nil || c.ProfileName() != "High" || c.LevelName() != "6.1" || c.ChromaFormatName() != "4:4:4" || c.BitDepth != 12 {
+		t.Errorf("got AV1 configuration %+v", entry.AV1)
+	}
+	if unknown, err := unknownBoxes(bytes.NewReader(data)); err != nil || len(unknown) != 0 {
+		t.Errorf("got unknown boxes %v, %v", unknown, err)
+	}
+}
+
+func TestReportImplausibleSize(t *testing.T) {
+	verbose = true
+	t.Cleanup(func() { verbose = false })
+
+	// A free box of 16 bytes whose size a broken muxer wrote little-endian,
+	// followed by the moov box searched for.
+	data := append(box("free", make([]byte, 8)), box("moov", make([]byte, 8))...)
+	binary.LittleEndian.PutUint32(data, 16)
+	hint := "[findHeader] box free at 0(0x0) has implausible size 268435456 with 32 bytes available, as little-endian it would be 16 which suggests a broken muxer\n"
+	out := captureStdout(t, func() {
+		findHeader(bytes.NewReader(data), MoovBoxType, int64(len(data)))
+	})
+	if !strings.Contains(out, hint) {
+		t.Errorf("limited search printed %q, want it to contain %q", out, hint)
+	}
+
+	// Measured up to the end of the reader, which is left where it was.
+	r := bytes.NewReader(data)
+	r.Seek(8, io.SeekStart)
+	h := &Header{Offset: 0, Size: binary.BigEndian.Uint32(data), Type: BoxType{'f', 'r', 'e', 'e'}}
+	if out := captureStdout(t, func() { reportImplausibleSize(r, h, -1) }); out != hint {
+		t.Errorf("unlimited: got %q, want %q", out, hint)
+	}
+	if cur, _ := r.Seek(0, io.SeekCurrent); cur != 8 {
+		t.Errorf("unlimited: left the reader at %d, want 8", cur)
+	}
+
+	for _, tc := range []struct {
+		name string
+		size uint32
+		want string
+	}{
+		{"plausible", 16, ""},
+		{"size 0 to the end", 0, ""},
+		{"64-bit size", 1, ""},
+		{"no little-endian hint", 0xffff0000, "[findHeader] box free at 0(0x0) has implausible size 4294901760 with 32 bytes available\n"},
+		{"too small", 4, "[findHeader] box free at 0(0x0) has implausible size 4 with 32 bytes available\n"},
+	} {
+		h := &Header{Offset: 0, Size: tc.size, Type: BoxType{'f', 'r', 'e', 'e'}}
+		if out := captureStdout(t, func() { reportImplausibleSize(bytes.NewReader(data), h, int64(len(data))) }); out != tc.want {
+			t.Errorf("%s: got %q, want %q", tc.name, out, tc.want)
+		}
+	}
+}
+
+func TestUnknownBoxes(t *testing.T) {
+	vendor := box("xvnd", []byte("vendor data"))
+	entry := visualSampleEntry("zzzz", 1280, 720)
+	data := movie(vendor, trak(visualSampleEntry("dvhe", 1920, 1080, hvcC()), entry))
+	vendorOffset := int64(bytes.Index(data, []byte("xvnd")) - 4)
+	entryOffset := int64(bytes.Index(data, []byte("zzzz")) - 4)
+
+	unknown, err := unknownBoxes(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, h := range unknown {
+		got = append(got, fmt.Sprintf("%s %d %d", h.Type, h.Offset, getBoxSize(&h)))
+	}
+	if want := []string{fmt.Sprintf("xvnd %d %d", vendorOffset, len(vendor)), fmt.Sprintf("zzzz %d %d", entryOffset, len(entry))}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got unknown boxes %v, want %v", got, want)
+	}
+
+	mp4file := filepath.Join(t.TempDir(), "movie.mp4")
+	if err := os.WriteFile(mp4file, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	printed := captureStdout(t, func() {
+		if err := printUnknownBoxes(mp4file); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if want := fmt.Sprintf("%s: unknown box \"xvnd\" at %d(%#x), %d bytes\n%s: unknown box \"zzzz\" at %d(%#x), %d bytes\n", mp4file, vendorOffset, vendorOffset, len(vendor), mp4file, entryOffset, entryOffset, len(entry)); printed != want {
+		t.Errorf("printed %q, want %q", printed, want)
+	}
+}
+
+func TestFindHeaderCursor(t *testing.T) {
+	uuid := box("uuid", make([]byte, 16), []byte("payload"))
+	tests := []struct {
+		name        string
+		target      []byte
+		wantHeader  int64
+		wantPayload int64
+	}{
+		{name: "compact", target: box("moov", []byte("payload")), wantHeader: 8, wantPayload: 8},
+		{name: "large", target: largeBox(box("moov", []byte("payload"))), wantHeader: 16, wantPayload: 16},
+		{name: "uuid", target: uuid, wantHeader: 8, wantPayload: 24},
+		{name: "large uuid", target: largeBox(uuid), wantHeader: 16, wantPayload: 32},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			skipped := box("free", make([]byte, 4))
+			data := bytes.Join([][]byte{skipped, tt.target}, nil)
+			boxType := BoxType{}
+			copy(boxType[:], tt.target[4:8])
+			start := int64(len(skipped))
+
+			r := bytes.NewReader(data)
+			h, err := findHeader(r, boxType, int64(len(data)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cur, _ := r.Seek(0, io.SeekCurrent); h.Offset != start || cur != start+tt.wantHeader {
+				t.Errorf("findHeader found the box at %d and left the cursor at %d, want %d and %d", h.Offset, cur, start, start+tt.wantHeader)
+			}
+
+			r = bytes.NewReader(data)
+			h, payloadOffset, err := FindBoxPayload(r, boxType, int64(len(data)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			cur, _ := r.Seek(0, io.SeekCurrent)
+			if h.Offset != start || payloadOffset != start+tt.wantPayload || cur != payloadOffset {
+				t.Errorf("FindBoxPayload found the box at %d with payload at %d and left the cursor at %d, want %d and %d", h.Offset, payloadOffset, cur, start, start+tt.wantPayload)
+			}
+			payload := make([]byte, 7)
+			if _, err = io.ReadFull(r, payload); err != nil || string(payload) != "payload" {
+				t.Errorf("read %q at the payload offset: %v", payload, err)
+			}
+		})
+	}
+}
+
+func TestFindStsdCursor(t *testing.T) {
+	data := trak(visualSampleEntry("dvhe", 1920, 1080))
+	r := bytes.NewReader(data)
+	trakHeader, err := readBoxHeader(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, payloadOffset, err := findStsd(r, trakHeader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cur, _ := r.Seek(0, io.SeekCurrent)
+	if want := int64(bytes.Index(data, []byte("stsd")) + 4); h.Type != StsdBoxType || payloadOffset != want || cur != want {
+		t.Errorf("got stsd payload at %d and cursor at %d, want %d", payloadOffset, cur, want)
+	}
+}
+
+// hdr10Boxes returns mdcv and clli boxes for a BT.2020 D65 1000 cd/m² display.
+func hdr10Boxes() [][]byte {
+	return [][]byte{
+		box("mdcv",
+			u16(8500), u16(39850), u16(6550), u16(2300), u16(35400), u16(14600),
+			u16(15635), u16(16450), u32(10000000), u32(50)),
+		box("clli", u16(1000), u16(400)),
+	}
+}
+
+func TestInspectHDRMetadata(t *testing.T) {
+	entry := visualSampleEntry("dvhe", 3840, 2160, append([][]byte{box("hvcC", make([]byte, 23)), box("dvcC", make([]byte, 24))}, hdr10Boxes()...)...)
+	info, err := inspect(bytes.NewReader(movie(trak(entry))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(info.Tracks) != 1 || len(info.Tracks[0].SampleEntries) != 1 {
+		t.Fatalf("got tracks %+v", info.Tracks)
+	}
+	got := info.Tracks[0].SampleEntries[0]
+	d, l := got.MasteringDisplay, got.ContentLightLevel
+	if d == nil || l == nil {
+		t.Fatalf("got entry %+v", got)
+	}
+	if p := d.Primaries; fmt.Sprintf("%.3f %.3f %.3f %.3f %.3f %.3f", p[2].X, p[2].Y, p[0].X, p[0].Y, p[1].X, p[1].Y) != "0.708 0.292 0.170 0.797 0.131 0.046" {
+		t.Errorf("got primaries %+v", p)
+	}
+	if fmt.Sprintf("%.4f %.4f %g %g", d.WhitePoint.X, d.WhitePoint.Y, d.MaxLuminance, d.MinLuminance) != "0.3127 0.3290 1000 0.005" {
+		t.Errorf("got white point %+v luminance %g-%g", d.WhitePoint, d.MinLuminance, d.MaxLuminance)
+	}
+	if l.MaxCLL != 1000 || l.MaxFALL != 400 {
+		t.Errorf("got content light level %+v", l)
+	}
+}
+
+func TestReadVisualSampleEntry(t *testing.T) {
+	entry := visualSampleEntry("dvhe", 3840, 2160)
+	fixed := entry[8:]
+	binary.BigEndian.PutUint16(fixed[40:], 1) // frame_count
+	copy(fixed[42:], "\x09DV Encoder")
+	binary.BigEndian.PutUint16(fixed[74:], 0x18)   // depth
+	binary.BigEndian.PutUint16(fixed[76:], 0xffff) // pre_defined
+
+	got, deviations, err := readVisualSampleEntry(bytes.NewReader(fixed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Width != 3840 || got.Height != 2160 || got.CompressorName != "DV Encode" || got.Depth != 0x18 || len(deviations) != 0 {
+		t.Errorf("got %+v with deviations %v", got, deviations)
+	}
+
+	// Off reserved and pre-defined fields and an overlong compressor name
+	// are reported, not fatal.
+	fixed[0], fixed[12], fixed[42] = 1, 1, 40
+	got, deviations, err = readVisualSampleEntry(bytes.NewReader(fixed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Width != 3840 || got.Height != 2160 || len(deviations) != 3 {
+		t.Errorf("got %+v with deviations %q", got, deviations)
+	}
+}
+
+func TestInspectPixelAspectRatio(t *testing.T) {
+	// anamorphic 1440x1080 stored, displayed as 1920x1080
+	entry := visualSampleEntry("dvhe", 1440, 1080, box("dvcC", make([]byte, 24)), box("pasp", u32(4), u32(3)))
+	info, err := inspect(bytes.NewReader(movie(trak(entry))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := info.Tracks[0].SampleEntries[0].PixelAspectRatio
+	if p == nil || p.HSpacing != 4 || p.VSpacing != 3 || math.Abs(p.Ratio()-4.0/3) > 1e-9 {
+		t.Errorf("got pixel aspect ratio %+v", p)
+	}
+
+	if _, err = readPaspBox(bytes.NewReader(u32(1))); err == nil {
+		t.Error("reading a truncated pasp succeeded")
+	}
+	if r := (&PaspBox{HSpacing: 1}).Ratio(); r != 0 {
+		t.Errorf("got ratio %g for a vertical spacing of 0", r)
+	}
+}
+
+func TestInspectNonStandardSampleEntry(t *testing.T) {
+	entry := visualSampleEntry("dvhe", 1920, 1080, box("hvcC", make([]byte, 23)), box("dvcC", make([]byte, 24)))
+	copy(entry[8:], "\xff\xff\xff\xff\xff\xff") // reserved
+	entry[8+8] = 0x7f                           // pre_defined
+
+	info, err := inspect(bytes.NewReader(movie(trak(entry))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(info.Tracks) != 1 || len(info.Tracks[0].SampleEntries) != 1 {
+		t.Fatalf("got tracks %+v", info.Tracks)
+	}
+	got := info.Tracks[0].SampleEntries[0]
+	if got.Width != 1920 || got.Height != 1080 || fmt.Sprint(got.Boxes) != "[hvcC dvcC]" {
+		t.Errorf("got entry %+v", got)
+	}
+
+	// An entry too short for its fixed fields is still listed.
+	short := box("dvhe", make([]byte, 20))
+	if info, err = inspect(bytes.NewReader(movie(trak(short)))); err != nil {
+		t.Fatal(err)
+	}
+	if codecs := info.Tracks[0].Codecs; fmt.Sprint(codecs) != "[dvhe]" {
+		t.Errorf("got codecs %v", codecs)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// checkCompatibleBrands warns if the ftyp box of r does not carry the dby1
+// brand, a common reason for Dolby Vision files to still fail to play once
+// their sample entries have been converted.
+func checkCompatibleBrands(r io.ReadSeeker) (err error) {
+	var (
+		h    *Header
+		ftyp *FtypBox
+	)
+
+	if _, err = r.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf(`[checkCompatibleBrands] failed to seek: %w`, err)
+	}
+	if h, err = readBoxHeader(r); err != nil {
+		return fmt.Errorf(`[checkCompatibleBrands] failed reading box header: %w`, err)
+	}
+	if h.Type != FtypBoxType {
+		fmt.Printf("Warning: file does not start with ftyp but %q, players may not recognize it as Dolby Vision\n", h.Type.String())
+		return nil
+	}
+	if ftyp, err = readFtypBox(r, h.PayloadSize()); err != nil {
+		return fmt.Errorf(`[checkCompatibleBrands] %w`, err)
+	}
+	if !ftyp.hasBrand(BrandDBY1) {
+		fmt.Printf("Warning: ftyp has no %s compatible brand (major %s, compatible %v), which many Dolby Vision players require\n", BrandDBY1, ftyp.MajorBrand[:], brandStrings(ftyp.CompatibleBrands))
+	} else if verbose {
+		fmt.Printf("[checkCompatibleBrands] ftyp has the %s brand\n", BrandDBY1)
+	}
+	return nil
+}
+
+// fileHasBrand reports whether the leading ftyp box of mp4file lists brand as
+// its major or a compatible brand. Files not starting with ftyp have no brand.
+func fileHasBrand(mp4file, brand string) (ok bool, err error) {
+	var (
+		r    *os.File
+		h    *Header
+		ftyp *FtypBox
+	)
+
+	if r, err = os.Open(mp4file); err != nil {
+		return false, fmt.Errorf(`[fileHasBrand] cannot open file "%s": %w`, mp4file, err)
+	}
+	defer r.Close()
+
+	if h, err = readBoxHeader(r); err != nil {
+		if isEndOfFile(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf(`[fileHasBrand] failed reading box header: %w`, err)
+	}
+	if h.Type != FtypBoxType {
+		return false, nil
+	}
+	if ftyp, err = readFtypBox(r, h.PayloadSize()); err != nil {
+		return false, fmt.Errorf(`[fileHasBrand] %w`, err)
+	}
+	return ftyp.hasBrand(brand), nil
+}
+
+func brandStrings(brands []FourCC) []string {
+	s := make([]string, len(brands))
+	for i, brand := range brands {
+		s[i] = string(brand[:])
+	}
+	return s
+}
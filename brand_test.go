@@ -0,0 +1,30 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCheckCompatibleBrands(t *testing.T) {
+	moov := box("moov", trak(visualSampleEntry("dvhe", 1920, 1080)))
+	for name, test := range map[string]struct {
+		data []byte
+		want string
+	}{
+		"dby1":             {movie(trak(visualSampleEntry("dvhe", 1920, 1080))), ""},
+		"dby1 major":       {append(box("ftyp", []byte("dby1"), u32(0), []byte("isom")), moov...), ""},
+		"no dby1":          {append(box("ftyp", []byte("isom"), u32(512), []byte("isommp42")), moov...), "Warning: ftyp has no dby1 compatible brand (major isom, compatible [isom mp42]), which many Dolby Vision players require\n"},
+		"no ftyp":          {append(box("free", make([]byte, 8)), moov...), "Warning: file does not start with ftyp but \"free\", players may not recognize it as Dolby Vision\n"},
+		"no brands at all": {append(box("ftyp", []byte("mp42"), u32(0)), moov...), "Warning: ftyp has no dby1 compatible brand (major mp42, compatible []), which many Dolby Vision players require\n"},
+	} {
+		r := bytes.NewReader(test.data)
+		printed := captureStdout(t, func() {
+			if err := checkCompatibleBrands(r); err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+		})
+		if printed != test.want {
+			t.Errorf("%s: printed %q, want %q", name, printed, test.want)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+)
+
+// Exit codes of -check, which differ from the other modes: like grep, 0 means
+// a match was found.
+const (
+	checkNeedsConversion = 0
+	checkUpToDate        = 1
+	checkError           = 2
+)
+
+// pendingConversions counts the sample entries of info that converting would
+// rename, honouring -track-id.
+func pendingConversions(info *FileInfo) (n int) {
+	for _, track := range info.Tracks {
+		if trackID != 0 && uint(track.TrackID) != trackID {
+			continue
+		}
+		for _, entry := range track.SampleEntries {
+			if matchesFrom(entry.Codec) {
+				n++
+			}
+		}
+	}
+	return
+}
+
+// runCheck reports for every file whether it needs converting without
+// modifying anything, and returns the exit code: checkNeedsConversion if any
+// file has -from sample entries, checkUpToDate if none has and checkError if
+// a file could not be read, whatever the other files hold.
+func runCheck(ctx context.Context, mp4files []string) int {
+	code := checkUpToDate
+	for i, mp4file := range mp4files {
+		if err := ctx.Err(); err != nil {
+			fmt.Fprintf(os.Stderr, "[runCheck] interrupted after %d of %d files: %v\n", i, len(mp4files), err)
+			return checkError
+		}
+		info, err := inspectFile(mp4file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", mp4file, err)
+			code = checkError
+			continue
+		}
+		if n := pendingConversions(info); n > 0 {
+			fmt.Printf("%s: needs conversion, %d %s sample entries\n", mp4file, n, codecFrom)
+			if code != checkError {
+				code = checkNeedsConversion
+			}
+		} else {
+			fmt.Printf("%s: no %s sample entries\n", mp4file, codecFrom)
+		}
+	}
+	return code
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRunCheck(t *testing.T) {
+	withCodecs(t, "dvhe", "dvh1")
+
+	dir := t.TempDir()
+	write := func(name string, data []byte) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	dvhe := write("dvhe.mp4", movie(trak(visualSampleEntry("dvhe", 1920, 1080, box("dvcC", make([]byte, 24))))))
+	dvh1 := write("dvh1.mp4", movie(trak(visualSampleEntry("dvh1", 1920, 1080, box("dvcC", make([]byte, 24))))))
+	broken := write("broken.mp4", box("ftyp", []byte("is")))
+
+	for _, tc := range []struct {
+		name  string
+		files []string
+		want  int
+	}{
+		{name: "needs conversion", files: []string{dvhe}, want: checkNeedsConversion},
+		{name: "up to date", files: []string{dvh1}, want: checkUpToDate},
+		{name: "any file needs conversion", files: []string{dvh1, dvhe}, want: checkNeedsConversion},
+		{name: "error wins", files: []string{dvhe, broken}, want: checkError},
+		{name: "missing file", files: []string{filepath.Join(dir, "missing.mp4")}, want: checkError},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := runCheck(context.Background(), tc.files); got != tc.want {
+				t.Errorf("got exit code %d, want %d", got, tc.want)
+			}
+		})
+	}
+
+	before, err := os.ReadFile(dvhe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runCheck(context.Background(), []string{dvhe})
+	if after, _ := os.ReadFile(dvhe); string(after) != string(before) {
+		t.Error("-check modified the file")
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// StcoBox is a chunk offset box with 32-bit offsets into the file.
+type StcoBox struct {
+	Version uint8
+	Flags   uint32
+	Offsets []uint32
+}
+
+// Co64Box is a chunk offset box with 64-bit offsets, needed once the media
+// data extends past 4 GiB.
+type Co64Box struct {
+	Version uint8
+	Flags   uint32
+	Offsets []uint64
+}
+
+// readChunkOffsetHeader reads the fields preceding the entries of a stco or
+// co64 payload of payloadSize bytes, checking the entries of width bytes fit.
+func readChunkOffsetHeader(r io.Reader, payloadSize int64, width int) (version uint8, flags uint32, count uint32, err error) {
+	if version, flags, err = readFullBoxHeader(r); err != nil {
+		return 0, 0, 0, fmt.Errorf(`[readChunkOffsetHeader] failed reading version: %w`, err)
+	}
+	if err = binary.Read(r, binary.BigEndian, &count); err != nil {
+		return 0, 0, 0, fmt.Errorf(`[readChunkOffsetHeader] failed reading entry count: %w`, err)
+	}
+	if uint64(payloadSize-8) < uint64(count)*uint64(width) {
+		return 0, 0, 0, fmt.Errorf(`[readChunkOffsetHeader] %d bytes are too small for %d entries`, payloadSize, count)
+	}
+	return
+}
+
+// readStcoBox parses a stco payload of payloadSize bytes. The reader must be
+// positioned right after the box header.
+func readStcoBox(r io.Reader, payloadSize int64) (*StcoBox, error) {
+	var (
+		box   StcoBox
+		count uint32
+		err   error
+	)
+	if box.Version, box.Flags, count, err = readChunkOffsetHeader(r, payloadSize, 4); err != nil {
+		return nil, fmt.Errorf(`[readStcoBox] %w`, err)
+	}
+	box.Offsets = make([]uint32, count)
+	if err = binary.Read(r, binary.BigEndian, box.Offsets); err != nil {
+		return nil, fmt.Errorf(`[readStcoBox] failed reading entries: %w`, err)
+	}
+	return &box, nil
+}
+
+// readCo64Box parses a co64 payload of payloadSize bytes. The reader must be
+// positioned right after the box header.
+func readCo64Box(r io.Reader, payloadSize int64) (*Co64Box, error) {
+	var (
+		box   Co64Box
+		count uint32
+		err   error
+	)
+	if box.Version, box.Flags, count, err = readChunkOffsetHeader(r, payloadSize, 8); err != nil {
+		return nil, fmt.Errorf(`[readCo64Box] %w`, err)
+	}
+	box.Offsets = make([]uint64, count)
+	if err = binary.Read(r, binary.BigEndian, box.Offsets); err != nil {
+		return nil, fmt.Errorf(`[readCo64Box] failed reading entries: %w`, err)
+	}
+	return &box, nil
+}
+
+// Relocate replaces every offset with the one returned by fn, failing if it
+// no longer fits 32 bits.
+func (b *StcoBox) Relocate(fn func(offset uint64) (uint64, error)) error {
+	for i, offset := range b.Offsets {
+		moved, err := fn(uint64(offset))
+		if err != nil {
+			return fmt.Errorf(`[StcoBox.Relocate] %w`, err)
+		}
+		if moved > math.MaxUint32 {
+			return fmt.Errorf(`[StcoBox.Relocate] offset %d of entry %d does not fit 32 bits, use co64`, moved, i)
+		}
+		b.Offsets[i] = uint32(moved)
+	}
+	return nil
+}
+
+// Relocate replaces every offset with the one returned by fn.
+func (b *Co64Box) Relocate(fn func(offset uint64) (uint64, error)) error {
+	for i, offset := range b.Offsets {
+		moved, err := fn(offset)
+		if err != nil {
+			return fmt.Errorf(`[Co64Box.Relocate] %w`, err)
+		}
+		b.Offsets[i] = moved
+	}
+	return nil
+}
+
+// Co64 returns the box with its offsets widened to 64 bits.
+func (b *StcoBox) Co64() *Co64Box {
+	box := &Co64Box{Version: b.Version, Flags: b.Flags, Offsets: make([]uint64, len(b.Offsets))}
+	for i, offset := range b.Offsets {
+		box.Offsets[i] = uint64(offset)
+	}
+	return box
+}
+
+// Payload returns the stco payload encoding the box.
+func (b *StcoBox) Payload() []byte {
+	payload := make([]byte, 8+4*len(b.Offsets))
+	binary.BigEndian.PutUint32(payload, uint32(b.Version)<<24|b.Flags&0x00ffffff)
+	binary.BigEndian.PutUint32(payload[4:], uint32(len(b.Offsets)))
+	for i, offset := range b.Offsets {
+		binary.BigEndian.PutUint32(payload[8+4*i:], offset)
+	}
+	return payload
+}
+
+// Payload returns the co64 payload encoding the box.
+func (b *Co64Box) Payload() []byte {
+	payload := make([]byte, 8+8*len(b.Offsets))
+	binary.BigEndian.PutUint32(payload, uint32(b.Version)<<24|b.Flags&0x00ffffff)
+	binary.BigEndian.PutUint32(payload[4:], uint32(len(b.Offsets)))
+	for i, offset := range b.Offsets {
+		binary.BigEndian.PutUint64(payload[8+8*i:], offset)
+	}
+	return payload
+}
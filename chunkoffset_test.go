@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"testing"
+)
+
+// moveBy returns a relocation function moving every offset by delta bytes.
+func moveBy(delta int64) func(offset uint64) (uint64, error) {
+	return func(offset uint64) (uint64, error) { return uint64(int64(offset) + delta), nil }
+}
+
+func TestStcoBoxRelocate(t *testing.T) {
+	data := stco(100, 2000, 30000)
+	box, err := readStcoBox(bytes.NewReader(data[8:]), int64(len(data)-8))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = box.Relocate(moveBy(math.MaxUint32 - 30000 + 1)); err == nil {
+		t.Errorf("relocating past 32 bits succeeded")
+	}
+	box, err = readStcoBox(bytes.NewReader(data[8:]), int64(len(data)-8))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = box.Relocate(moveBy(-100)); err != nil {
+		t.Fatal(err)
+	}
+	written := box.Payload()
+	if want := stco(0, 1900, 29900)[8:]; !bytes.Equal(written, want) {
+		t.Errorf("got payload % x, want % x", written, want)
+	}
+	readBack, err := readStcoBox(bytes.NewReader(written), int64(len(written)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(readBack.Offsets) != "[0 1900 29900]" {
+		t.Errorf("read back %v", readBack.Offsets)
+	}
+
+	co64 := readBack.Co64()
+	if err = co64.Relocate(moveBy(math.MaxUint32)); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(co64.Offsets) != fmt.Sprint([]uint64{math.MaxUint32, math.MaxUint32 + 1900, math.MaxUint32 + 29900}) {
+		t.Errorf("got co64 offsets %v", co64.Offsets)
+	}
+}
+
+func TestCo64BoxRelocate(t *testing.T) {
+	data := co64(1<<32, 1<<33)
+	box, err := readCo64Box(bytes.NewReader(data[8:]), int64(len(data)-8))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	failing := func(offset uint64) (uint64, error) { return 0, fmt.Errorf("offset %d not retained", offset) }
+	if err = box.Relocate(failing); err == nil {
+		t.Errorf("failing relocation succeeded")
+	}
+	if err = box.Relocate(moveBy(1 << 32)); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(box.Offsets) != fmt.Sprint([]uint64{1 << 33, 3 << 32}) {
+		t.Errorf("got offsets %v", box.Offsets)
+	}
+	if err = box.Relocate(moveBy(-1 << 32)); err != nil {
+		t.Fatal(err)
+	}
+	written := box.Payload()
+	if want := data[8:]; !bytes.Equal(written, want) {
+		t.Errorf("got payload % x, want % x", written, want)
+	}
+	readBack, err := readCo64Box(bytes.NewReader(written), int64(len(written)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(readBack.Offsets) != fmt.Sprint([]uint64{1 << 32, 1 << 33}) {
+		t.Errorf("read back %v", readBack.Offsets)
+	}
+}
+
+func TestReadChunkOffsetBoxTooSmall(t *testing.T) {
+	data := stco(1, 2, 3)
+	if _, err := readStcoBox(bytes.NewReader(data[8:]), int64(len(data)-12)); err == nil {
+		t.Errorf("reading stco with a truncated entry succeeded")
+	}
+	data = co64(1, 2)
+	if _, err := readCo64Box(bytes.NewReader(data[8:]), int64(len(data)-12)); err == nil {
+		t.Errorf("reading co64 with a truncated entry succeeded")
+	}
+}
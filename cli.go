@@ -0,0 +1,192 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"time"
+)
+
+// command is a subcommand with its own flag set. Running mp4dovi without a
+// command converts files and accepts the flags of every command.
+type command struct {
+	name    string
+	summary string
+	flags   func(fs *flag.FlagSet)
+	mode    *bool
+}
+
+var commands = []command{
+	{name: "convert", summary: "change the codec of matching sample entries (default)", flags: func(fs *flag.FlagSet) {
+		registerConvertFlags(fs)
+		registerFormatFlags(fs)
+	}},
+	{name: "inspect", summary: "print movie and track information", flags: registerInspectFlags, mode: &infoMode},
+	{name: "list", summary: "list the sample entry codecs of each file", flags: registerListFlags, mode: &listMode},
+	{name: "advise", summary: "tell whether converting each file is likely to help playback", flags: registerFormatFlags, mode: &adviseMode},
+	{name: "validate", summary: "check the box structure of each file", flags: registerValidateFlags, mode: &validateMode},
+	{name: "compare", summary: "compare sample entry codecs and track structure of two files", flags: func(*flag.FlagSet) {}, mode: &compareMode},
+}
+
+func registerCommonFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&verbose, "verbose", false, "enable verbose output")
+	fs.BoolVar(&showVersion, "version", false, "print the version of mp4dovi and exit")
+	fs.StringVar(&cpuProfile, "cpuprofile", "", "write a CPU profile of the run to this file, for go tool pprof")
+	fs.StringVar(&memProfile, "memprofile", "", "write a memory profile to this file after the run, for go tool pprof")
+	fs.Int64Var(&stripPrefix, "strip-prefix", 0, "skip the first N bytes of each file, such as a byte order mark or HTTP headers saved by a bad download, which converting drops from the file")
+}
+
+// printDefaults is like fs.PrintDefaults without the hiddenFlags.
+func printDefaults(fs *flag.FlagSet) {
+	visible := flag.NewFlagSet(fs.Name(), flag.ContinueOnError)
+	visible.SetOutput(fs.Output())
+	fs.VisitAll(func(f *flag.Flag) {
+		if !hiddenFlags[f.Name] {
+			visible.Var(f.Value, f.Name, f.Usage)
+			visible.Lookup(f.Name).DefValue = f.DefValue
+		}
+	})
+	visible.PrintDefaults()
+}
+
+func registerConvertFlags(fs *flag.FlagSet) {
+	fs.StringVar(&codecFrom, "from", "dvhe", "video codec to convert from, as a FourCC or a name such as dolby-vision-hevc-inband")
+	fs.StringVar(&codecTo, "to", "", "video codec to convert to, as a FourCC or a name such as dolby-vision-hevc (default inferred from -from, e.g. dvhe -> dvh1)")
+	fs.BoolVar(&checkMode, "check", false, "only tell whether files need converting, without modifying them: exit 0 if any file has -from sample entries, 1 if none has, 2 on errors")
+	fs.BoolVar(&ffmpegCommand, "emit-ffmpeg-command", false, "only print the ffmpeg command remuxing each file with its -from video streams tagged -to, for those preferring ffmpeg to write the file; nothing is modified")
+	fs.BoolVar(&lenientMatch, "lenient-match", false, "also match -from sample entries differing in case or in trailing space or NUL padding, as written by some broken muxers, e.g. DVHE for dvhe, also for -add-entry, -min-width, -min-height and -only-codec; FourCCs are case sensitive, so only use it for such files")
+	fs.StringVar(&ifBrand, "if-brand", "", "only convert files whose ftyp lists this major or compatible brand, e.g. dby1, skipping the others")
+	fs.StringVar(&onlyCodec, "only-codec", "", "only convert files with a sample entry of this codec, e.g. dvhe, found by reading each file first, skipping the others without opening them for writing")
+	fs.StringVar(&scope, "scope", scopeAll, "how far to convert each file: first-entry stops after the first changed sample entry, first-track after the first track with one, all converts every track")
+	fs.BoolVar(&safe, "safe", false, "recommended for first runs: only convert files whose -from sample entries have a valid dvcC or dvvC and their parameter sets out-of-band where -to requires them, skipping encrypted files, with the reason")
+	fs.BoolVar(&abortOnUnknown, "abort-on-unknown", false, "stop the batch at the first file with a video sample entry outside the Dolby Vision, HEVC and AVC codecs, taking it for the wrong file")
+	fs.UintVar(&minWidth, "min-width", 0, "only convert sample entries at least this many pixels wide, e.g. 3840 for 4K, leaving smaller ones unchanged")
+	fs.UintVar(&minHeight, "min-height", 0, "only convert sample entries at least this many pixels high, leaving smaller ones unchanged")
+	fs.UintVar(&trackID, "track-id", 0, "only convert the track with this track ID, as listed by inspect (default all tracks)")
+	fs.BoolVar(&interactive, "interactive", false, "ask for confirmation on stdin before converting each file with a -from sample entry; not asked when stdin is not a terminal")
+	fs.BoolVar(&interactive, "i", false, "shorthand for -interactive")
+	fs.BoolVar(&assumeYes, "y", false, "answer yes to every -interactive confirmation")
+	fs.IntVar(&limitChanges, "limit-changes", 0, "fail a file, undoing its changes, if more than N sample entries would be changed, guarding against over-matching; 0 for no limit")
+	fs.BoolVar(&force, "force", false, "skip all codec safety checks and rename every matching sample entry unconditionally; may produce unplayable files")
+	fs.BoolVar(&atomicWrite, "atomic", false, "patch a temporary copy and rename it over the original")
+	fs.StringVar(&tempDir, "temp-dir", "", "directory for the temporary copy used by -atomic, implies -atomic (default the source directory)")
+	fs.StringVar(&outDir, "out-dir", "", "write converted copies to this directory instead of modifying the files in place")
+	fs.BoolVar(&streamMode, "stream", false, "convert standard input to standard output in a single pass without seeking, holding only moov in memory, for pipes; takes no files")
+	fs.BoolVar(&repair, "repair", false, "RISKY: before converting, rewrite the declared size of containers not matching the boxes found in them, after backing up the file to file.bak")
+	fs.BoolVar(&strictStsdBounds, "strict-stsd-bounds", false, "fail on stsd boxes whose size does not match their entry count, claiming more sample entries than they can hold, holding more or fewer, or with entries ending past them")
+	fs.BoolVar(&keepOriginalFile, "keep-original", false, "move each file to be converted to file.orig and write the converted file under its original name; files left unchanged keep their original")
+	fs.StringVar(&renameOnChange, "rename-on-change", "", "after changing a file in place, insert this suffix before its extension, e.g. .dv-fixed renames movie.mp4 to movie.dv-fixed.mp4")
+	fs.StringVar(&nameTemplate, "name-template", "{name}{ext}", "file name of the copies written to -out-dir, with the placeholders {name}, {ext}, {from}, {to} and {index}")
+	fs.BoolVar(&patchFrma, "patch-frma", false, "convert the original format of encrypted (encv) sample entries instead of skipping them")
+	fs.BoolVar(&stripFree, "strip-free", false, "remove free/skip padding boxes, rewriting chunk offsets and box sizes (rewrites the whole file, implies -atomic)")
+	fs.BoolVar(&remux, "remux", false, "EXPERIMENTAL: rewrite the file in ftyp, moov, mdat order, rewriting chunk offsets and box sizes (implies -atomic)")
+	fs.BoolVar(&canonical, "canonical", false, "EXPERIMENTAL: rewrite every box header with a 32-bit size where possible and no size 0 boxes, fixing up chunk offsets (implies -atomic)")
+	fs.IntVar(&rewriteBufferSize, "rewrite-buffer", defaultRewriteBufferSize, "size in bytes of the buffer media data is streamed through by -strip-free, -remux, -canonical and -add-entry; only moov is held in memory")
+	fs.StringVar(&addEntry, "add-entry", "", "ADVANCED: instead of renaming, add a copy of every -from sample entry with this codec after the existing entries, e.g. hev1 alongside dvhe (rewrites the whole file, implies -atomic)")
+	fs.BoolVar(&compatBrandCheck, "compat-brand-check", false, "warn if ftyp lacks the dby1 compatible brand many Dolby Vision players require")
+	fs.BoolVar(&noVerify, "no-verify", false, "skip checking the structure, sample entry counts and size of every file after converting it")
+	fs.BoolVar(&noReadBack, "no-read-back", false, "skip reading back every changed FourCC right after writing it")
+	fs.BoolVar(&hexPreview, "hex-preview", false, "print the bytes around every changed FourCC before and after writing")
+	fs.BoolVar(&debugCRC, "debug-crc", false, "log a CRC32 of the top level boxes and the boxes leading to sample entries before and after converting (reads the whole file)")
+	fs.Int64Var(&patchAt, "patch-at", -1, "only replace the -from FourCC at this byte offset (decimal or 0x hex, e.g. from a previous run), without walking the boxes; the bytes there must match -from")
+	fs.BoolVar(&anywhere, "anywhere", false, "ADVANCED: rename every box of type -from to -to wherever it appears in the file, not only sample entries; only the 4 byte type is written")
+	fs.IntVar(&anywhereDepth, "anywhere-depth", 16, "with -anywhere, do not look deeper than this many levels of nested boxes, 0 for no limit")
+	fs.BoolVar(&allMoov, "all-moov", false, "convert the sample entries of every top level moov box, for broken muxers writing several, instead of only the first")
+	fs.BoolVar(&scanOnlyMoov, "scan-only-moov", false, "never read past the first moov box, also when checksumming with -debug-crc; everything after moov is left unread")
+	fs.Int64Var(&maxScanBytes, "max-scan-bytes", 0, "give up looking for moov after scanning this many bytes, 0 scans the whole file")
+	fs.BoolVar(&parallelBoxes, "parallel-boxes", false, "process the traks of a file concurrently, also when inspecting it, which may help with very large moov boxes (output of different traks may interleave)")
+	fs.BoolVar(&onePass, "one-pass", false, "scan all traks of a file before writing anything, then write every sample entry patch in a single pass over their offsets, which saves seeking back and forth on files with many tracks")
+	fs.BoolVar(&dedupe, "dedupe", true, "process files listed several times, also through other paths or symbolic links, only once")
+	fs.BoolVar(&nullSafe, "null-safe", false, "skip empty or incomplete files without a moov box, such as partial downloads, instead of stopping the batch")
+	fs.BoolVar(&summaryOnly, "summary-only", false, "print nothing per file, only how many files ended up in each status after the batch, and errors")
+	fs.StringVar(&emitManifest, "emit-manifest", "", "write the changes converting would make to this JSON manifest, as file, offset, from and to entries, without modifying any file")
+	fs.StringVar(&applyManifest, "apply-manifest", "", "write exactly the changes of a manifest from -emit-manifest, once every file is checked to still hold the planned from bytes")
+	fs.StringVar(&logFile, "log-file", "", "append a JSON line per processed file with its status, changes, timestamps and the tool version to this file")
+	fs.IntVar(&retries, "retries", 0, "retry a file up to N times on transient I/O errors such as timeouts")
+	fs.DurationVar(&retryDelay, "retry-delay", time.Second, "delay before the first retry, doubled after each attempt")
+}
+
+func registerInspectFlags(fs *flag.FlagSet) {
+	registerFormatFlags(fs)
+	registerSampleFlags(fs)
+	fs.BoolVar(&showOffsets, "show-offsets", false, "list every box with its start and payload offsets in hexadecimal")
+	fs.BoolVar(&trackCount, "track-count", false, "only print the number of trak boxes of each file, reading nothing but the top level boxes and the children of moov")
+	fs.BoolVar(&readTags, "tags", false, "also report the udta/meta/ilst metadata tags, such as the ©too application that wrote the file")
+}
+
+func registerListFlags(fs *flag.FlagSet) {
+	registerFormatFlags(fs)
+	registerSampleFlags(fs)
+}
+
+func registerSampleFlags(fs *flag.FlagSet) {
+	fs.IntVar(&sampleSize, "sample", 0, "only inspect the first N files and report how many contain each codec")
+	fs.BoolVar(&sampleRandom, "sample-random", false, "with -sample, pick the files at random instead of the first N")
+}
+
+func registerValidateFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&scanReport, "scan-report", false, "print the declared size of every container against its header, fields and children, failing on any unaccounted bytes or needless 64-bit sizes")
+	fs.BoolVar(&reportUnknownBoxes, "report-unknown-boxes", false, "also list the boxes of a type the tool does not know, with their offsets and sizes")
+}
+
+// registerLegacyFlags registers the mode flags predating subcommands, only
+// available without a command.
+func registerLegacyFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&infoMode, "info", false, "print movie and track information without modifying files (same as the inspect command)")
+	fs.BoolVar(&adviseMode, "advise", false, "tell whether converting each file is likely to help playback without modifying files (same as the advise command)")
+	fs.BoolVar(&compareMode, "compare", false, "compare sample entry codecs and track structure of two files (same as the compare command)")
+}
+
+func help() {
+	fmt.Printf("usage: mp4dovi [command] [options] files...\n\ncommands:\n")
+	for _, cmd := range commands {
+		fmt.Printf("  %-10s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Printf("\nRun \"mp4dovi <command> -h\" for the options of a command. Without a command files are converted\nand the options of all commands are accepted:\n")
+	printDefaults(flag.CommandLine)
+}
+
+// parseArgs parses the command line, dispatching on the optional command, and
+// returns the remaining file arguments.
+func parseArgs(args []string) []string {
+	if len(args) > 0 {
+		for _, cmd := range commands {
+			if args[0] != cmd.name {
+				continue
+			}
+			fs := flag.NewFlagSet("mp4dovi "+cmd.name, flag.ExitOnError)
+			registerCommonFlags(fs)
+			cmd.flags(fs)
+			fs.Usage = func() {
+				fmt.Printf("usage: mp4dovi %s [options] files...\n\n%s\n\n", cmd.name, cmd.summary)
+				printDefaults(fs)
+			}
+			flag.Usage = fs.Usage
+			if err := applyDefaults(fs); err != nil {
+				log.Fatal(err)
+			}
+			_ = fs.Parse(args[1:])
+			if cmd.mode != nil {
+				*cmd.mode = true
+			}
+			return fs.Args()
+		}
+	}
+
+	registerCommonFlags(flag.CommandLine)
+	registerConvertFlags(flag.CommandLine)
+	registerInspectFlags(flag.CommandLine)
+	registerLegacyFlags(flag.CommandLine)
+	flag.Usage = help
+	if err := applyDefaults(flag.CommandLine); err != nil {
+		log.Fatal(err)
+	}
+	_ = flag.CommandLine.Parse(args)
+	return flag.Args()
+}
+
+// converting reports whether this run modifies files, as opposed to the
+// read-only modes.
+func converting() bool {
+	return !infoMode && !compareMode && !listMode && !validateMode && !adviseMode && !checkMode && !ffmpegCommand && applyManifest == ""
+}
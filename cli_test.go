@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// withFlagDefaults restores, after the test, the options parseArgs sets to
+// their defaults when registering them.
+func withFlagDefaults(t *testing.T) {
+	t.Helper()
+	withCodecs(t, codecFrom, codecTo)
+	commandLine, usage := flag.CommandLine, flag.Usage
+	saved := struct {
+		dedupe                                                  bool
+		template, scope, format                                 string
+		bufferSize, depth                                       int
+		delay                                                   time.Duration
+		info, list, validate, advise, compare, offsets, scanned bool
+	}{dedupe, nameTemplate, scope, outputFormat, rewriteBufferSize, anywhereDepth, retryDelay, infoMode, listMode, validateMode, adviseMode, compareMode, showOffsets, scanReport}
+	t.Cleanup(func() {
+		flag.CommandLine, flag.Usage = commandLine, usage
+		dedupe, nameTemplate, scope, outputFormat = saved.dedupe, saved.template, saved.scope, saved.format
+		rewriteBufferSize, anywhereDepth, retryDelay = saved.bufferSize, saved.depth, saved.delay
+		infoMode, listMode, validateMode, adviseMode, compareMode = saved.info, saved.list, saved.validate, saved.advise, saved.compare
+		showOffsets, scanReport = saved.offsets, saved.scanned
+	})
+}
+
+func TestParseArgs(t *testing.T) {
+	for _, test := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"convert", "-from", "hev1", "-to", "hvc1", "a.mp4"}, "convert hev1 hvc1 text [a.mp4]"},
+		{[]string{"inspect", "-show-offsets", "a.mp4", "b.mp4"}, "inspect offsets text [a.mp4 b.mp4]"},
+		{[]string{"list", "-format", "json", "a.mp4"}, "list json [a.mp4]"},
+		{[]string{"advise", "a.mp4"}, "advise text [a.mp4]"},
+		{[]string{"validate", "-scan-report", "a.mp4"}, "validate scan report [a.mp4]"},
+		{[]string{"compare", "a.mp4", "b.mp4"}, "compare [a.mp4 b.mp4]"},
+		{[]string{"-from", "dvav", "a.mp4"}, "convert dvav  text [a.mp4]"},
+		{[]string{"-info", "-show-offsets", "-json", "convert"}, "inspect offsets json [convert]"},
+	} {
+		t.Run(fmt.Sprint(test.args), func(t *testing.T) {
+			withFlagDefaults(t)
+			flag.CommandLine = flag.NewFlagSet("mp4dovi", flag.ContinueOnError)
+			files := parseArgs(test.args)
+
+			var got string
+			switch {
+			case converting():
+				got = fmt.Sprintf("convert %s %s %s", codecFrom, codecTo, outputFormat)
+			case infoMode && showOffsets:
+				got = "inspect offsets " + outputFormat
+			case infoMode:
+				got = "inspect " + outputFormat
+			case listMode:
+				got = "list " + outputFormat
+			case adviseMode:
+				got = "advise " + outputFormat
+			case validateMode && scanReport:
+				got = "validate scan report"
+			case compareMode:
+				got = "compare"
+			}
+			if got = fmt.Sprint(got, " ", files); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseArgsVersion(t *testing.T) {
+	withFlagDefaults(t)
+	t.Cleanup(func() { showVersion = false })
+	flag.CommandLine = flag.NewFlagSet("mp4dovi", flag.ContinueOnError)
+	if files := parseArgs([]string{"-version"}); !showVersion || len(files) != 0 {
+		t.Errorf("got -version %v, files %v", showVersion, files)
+	}
+	if toolVersion() == "" {
+		t.Error("got an empty version")
+	}
+}
+
+func TestRunList(t *testing.T) {
+	t.Cleanup(func() { outputFormat = formatText })
+	dir := t.TempDir()
+	mp4file := filepath.Join(dir, "movie.mp4")
+	data := movie(trak(visualSampleEntry("dvhe", 1920, 1080)), trak(visualSampleEntry("hvc1", 1920, 1080), visualSampleEntry("hev1", 1280, 720)))
+	if err := os.WriteFile(mp4file, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	printed := captureStdout(t, func() {
+		if err := runList(context.Background(), []string{mp4file}); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if want := mp4file + ": dvhe, hvc1, hev1\n"; printed != want {
+		t.Errorf("printed %q, want %q", printed, want)
+	}
+
+	if err := runList(context.Background(), []string{mp4file, filepath.Join(dir, "missing.mp4")}); err == nil {
+		t.Error("listing a missing file succeeded")
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	CodecDVHE = "dvhe"
+	CodecDVH1 = "dvh1"
+	CodecDVAV = "dvav"
+	CodecDVA1 = "dva1"
+	CodecHEV1 = "hev1"
+	CodecHVC1 = "hvc1"
+	CodecAVC3 = "avc3"
+	CodecAVC1 = "avc1"
+
+	// CodecAV01 is only recognized for inspection, AV1 is never converted
+	CodecAV01 = "av01"
+)
+
+// BrandDBY1 is the ftyp brand of files carrying Dolby Vision.
+const BrandDBY1 = "dby1"
+
+// recommendedCodecs maps codecs Apple devices avoid to the ones they recommend.
+var recommendedCodecs = map[string]string{
+	CodecDVHE: CodecDVH1,
+	CodecDVAV: CodecDVA1,
+	CodecHEV1: CodecHVC1,
+	CodecAVC3: CodecAVC1,
+}
+
+// codecFamilies maps the video codecs known to -abort-on-unknown to their
+// family.
+var codecFamilies = map[string]string{
+	CodecDVHE: "Dolby Vision HEVC", CodecDVH1: "Dolby Vision HEVC",
+	CodecDVAV: "Dolby Vision AVC", CodecDVA1: "Dolby Vision AVC",
+	CodecHEV1: "HEVC", CodecHVC1: "HEVC",
+	CodecAVC3: "AVC", CodecAVC1: "AVC",
+}
+
+// errUnknownCodec is returned with -abort-on-unknown for files with a video
+// sample entry outside of codecFamilies.
+var errUnknownCodec = errors.New("unknown video codec")
+
+// unknownCodecs returns the video sample entries of info whose codec belongs
+// to no known family, as "track N: codec". Protected entries are classified by
+// their original format. Without a handler, tracks are taken for video unless
+// their entries are of a known audio codec.
+func unknownCodecs(info *FileInfo) (unknown []string) {
+	for i, track := range info.Tracks {
+		if track.HandlerType != "" && track.HandlerType != "vide" {
+			continue
+		}
+		for _, entry := range track.SampleEntries {
+			codec := entry.Codec
+			if entry.OriginalFormat != "" {
+				codec = entry.OriginalFormat
+			}
+			if track.HandlerType == "" && audioSampleEntryTypes[codec] {
+				continue
+			}
+			if _, ok := codecFamilies[codec]; !ok {
+				unknown = append(unknown, fmt.Sprintf("track %d: %s", i+1, codec))
+			}
+		}
+	}
+	return
+}
+
+// codecNames maps human-readable names to the codecs they stand for. The
+// -inband variants allow parameter sets to be carried in the stream only. No
+// name is 4 bytes long, as those are taken for a FourCC.
+var codecNames = map[string]string{
+	"dolby-vision-hevc-inband": CodecDVHE,
+	"dolby-vision-hevc":        CodecDVH1,
+	"dolby-vision-avc-inband":  CodecDVAV,
+	"dolby-vision-avc":         CodecDVA1,
+	"hevc-inband":              CodecHEV1,
+	"hevc-out-of-band":         CodecHVC1,
+	"avc-inband":               CodecAVC3,
+	"avc":                      CodecAVC1,
+}
+
+// resolveCodecNames replaces the human-readable codec names given to -from,
+// -to, -add-entry and -only-codec with their FourCC. Values of 4 bytes are
+// FourCCs and never looked up, names are matched case-insensitively, and other
+// values are left to validateCodecs.
+func resolveCodecNames() error {
+	for _, codec := range []struct {
+		flag  string
+		value *string
+	}{{"-from", &codecFrom}, {"-to", &codecTo}, {"-add-entry", &addEntry}, {"-only-codec", &onlyCodec}} {
+		if *codec.value == "" || isFourCC(*codec.value) {
+			continue
+		}
+		fourCC, ok := codecNames[strings.ToLower(*codec.value)]
+		if !ok {
+			names := make([]string, 0, len(codecNames))
+			for name := range codecNames {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			return fmt.Errorf(`%s "%s" is neither a 4 byte codec nor one of the codec names %s`, codec.flag, *codec.value, strings.Join(names, ", "))
+		}
+		*codec.value = fourCC
+	}
+	return nil
+}
+
+// resolveCodecTo fills in codecTo from recommendedCodecs when it was not given.
+func resolveCodecTo() error {
+	if codecTo != "" {
+		return nil
+	}
+	to, ok := recommendedCodecs[codecFrom]
+	if !ok {
+		return fmt.Errorf(`no known counterpart for codec "%s", please specify -to`, codecFrom)
+	}
+	codecTo = to
+	return nil
+}
+
+func isFourCC(codec string) bool {
+	return len(codec) == 4
+}
+
+func isPrintableFourCC(codec string) bool {
+	if !isFourCC(codec) {
+		return false
+	}
+	for i := 0; i < len(codec); i++ {
+		if codec[i] < 0x20 || codec[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// validateCodecs checks -from and -to before any file is touched. The length
+// check always applies since a FourCC of another size would corrupt the box
+// header; the remaining checks are safety guards skipped by -force.
+func validateCodecs() error {
+	if !isFourCC(codecFrom) || !isFourCC(codecTo) {
+		return fmt.Errorf(`codecs must be exactly 4 bytes, got -from "%s" and -to "%s"`, codecFrom, codecTo)
+	}
+	if addEntry != "" && !isFourCC(addEntry) {
+		return fmt.Errorf(`-add-entry must be exactly 4 bytes, got "%s"`, addEntry)
+	}
+	if force {
+		return nil
+	}
+	if !isPrintableFourCC(codecFrom) || !isPrintableFourCC(codecTo) {
+		return fmt.Errorf(`codecs must be printable ASCII, got -from %q and -to %q (use -force to override)`, codecFrom, codecTo)
+	}
+	if addEntry != "" && !isPrintableFourCC(addEntry) {
+		return fmt.Errorf(`-add-entry must be a printable 4 byte codec, got %q (use -force to override)`, addEntry)
+	}
+	if addEntry == codecFrom {
+		return fmt.Errorf(`-from and -add-entry are both "%s" (use -force to override)`, codecFrom)
+	}
+	if codecFrom == codecTo {
+		return fmt.Errorf(`-from and -to are both "%s" (use -force to override)`, codecFrom)
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolveCodecNames(t *testing.T) {
+	withCodecs(t, "", "")
+	t.Cleanup(func() { addEntry, onlyCodec = "", "" })
+
+	codecFrom, codecTo, addEntry, onlyCodec = "Dolby-Vision-HEVC-inband", "dolby-vision-hevc", "hevc-inband", "avc"
+	if err := resolveCodecNames(); err != nil {
+		t.Fatal(err)
+	}
+	if codecFrom != CodecDVHE || codecTo != CodecDVH1 || addEntry != CodecHEV1 || onlyCodec != CodecAVC1 {
+		t.Errorf("got -from %q -to %q -add-entry %q -only-codec %q", codecFrom, codecTo, addEntry, onlyCodec)
+	}
+
+	codecFrom, codecTo, addEntry, onlyCodec = "hevc-out-of-band", "dvh1", "", ""
+	if err := resolveCodecNames(); err != nil || codecFrom != CodecHVC1 || codecTo != CodecDVH1 {
+		t.Errorf("got -from %q -to %q, %v", codecFrom, codecTo, err)
+	}
+
+	// 4 byte values are FourCCs even if they read like a name.
+	codecFrom, codecTo = "hevc", "AVC "
+	if err := resolveCodecNames(); err != nil || codecFrom != "hevc" || codecTo != "AVC " {
+		t.Errorf("got -from %q -to %q, %v", codecFrom, codecTo, err)
+	}
+	for name := range codecNames {
+		if isFourCC(name) {
+			t.Errorf("codec name %q would be taken for a FourCC", name)
+		}
+	}
+
+	codecFrom = "dolby-vision"
+	if err := resolveCodecNames(); err == nil {
+		t.Error("expected an error for an unknown codec name")
+	}
+}
+
+func TestResolveCodecTo(t *testing.T) {
+	for _, test := range []struct {
+		from, to, want string
+	}{
+		{"dvhe", "", "dvh1"},
+		{"dvav", "", "dva1"},
+		{"hev1", "", "hvc1"},
+		{"avc3", "", "avc1"},
+		{"dvhe", "hev1", "hev1"},
+		{"dvh1", "", ""},
+	} {
+		withCodecs(t, test.from, test.to)
+		err := resolveCodecTo()
+		if test.want == "" {
+			if err == nil || !strings.Contains(err.Error(), "please specify -to") {
+				t.Errorf("-from %s: got -to %q and error %v, want -to required", test.from, codecTo, err)
+			}
+			continue
+		}
+		if err != nil || codecTo != test.want {
+			t.Errorf("-from %s -to %q: got -to %q and error %v, want %s", test.from, test.to, codecTo, err, test.want)
+		}
+	}
+}
+
+func TestUnknownCodecs(t *testing.T) {
+	info := &FileInfo{Tracks: []TrackInfo{
+		{HandlerType: "vide", SampleEntries: []SampleEntryInfo{{Codec: "dvhe"}, {Codec: "hvc1"}}},
+		{HandlerType: "soun", SampleEntries: []SampleEntryInfo{{Codec: "ec-3"}}},
+		{SampleEntries: []SampleEntryInfo{{Codec: "mp4a"}}},
+		{HandlerType: "vide", SampleEntries: []SampleEntryInfo{{Codec: "encv", OriginalFormat: "avc1"}}},
+	}}
+	if unknown := unknownCodecs(info); len(unknown) != 0 {
+		t.Errorf("got unknown codecs %v", unknown)
+	}
+
+	info.Tracks = append(info.Tracks,
+		TrackInfo{HandlerType: "vide", SampleEntries: []SampleEntryInfo{{Codec: "av01"}}},
+		TrackInfo{SampleEntries: []SampleEntryInfo{{Codec: "vp09"}}},
+	)
+	if got := fmt.Sprint(unknownCodecs(info)); got != "[track 5: av01 track 6: vp09]" {
+		t.Errorf("got unknown codecs %s", got)
+	}
+}
+
+func TestConvertAbortOnUnknown(t *testing.T) {
+	withCodecs(t, "dvhe", "dvh1")
+	t.Cleanup(func() { abortOnUnknown = false })
+	abortOnUnknown = true
+
+	mp4file := filepath.Join(t.TempDir(), "mixed.mp4")
+	data := movie(trak(visualSampleEntry("dvhe", 1920, 1080, hvcC(), box("dvcC", make([]byte, 24)))), trak(visualSampleEntry("av01", 1920, 1080)))
+	if err := os.WriteFile(mp4file, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	result := convertFile(context.Background(), mp4file)
+	if !errors.Is(result.Err, errUnknownCodec) || !strings.Contains(result.Err.Error(), "track 2: av01") {
+		t.Errorf("got %v, want %v naming the av01 track", result.Err, errUnknownCodec)
+	}
+	if got, _ := os.ReadFile(mp4file); !bytes.Equal(got, data) {
+		t.Error("file changed")
+	}
+}
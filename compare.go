@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+)
+
+// compareInfo lists the differences in track structure and sample entry codecs between a and b.
+func compareInfo(a, b *FileInfo) (diffs []string) {
+	if len(a.Tracks) != len(b.Tracks) {
+		diffs = append(diffs, fmt.Sprintf("track count: %d -> %d", len(a.Tracks), len(b.Tracks)))
+	}
+	for i := 0; i < len(a.Tracks) && i < len(b.Tracks); i++ {
+		ac, bc := a.Tracks[i].Codecs, b.Tracks[i].Codecs
+		if len(ac) != len(bc) {
+			diffs = append(diffs, fmt.Sprintf("track %d: sample entry count: %d -> %d", i+1, len(ac), len(bc)))
+		}
+		for j := 0; j < len(ac) && j < len(bc); j++ {
+			if ac[j] != bc[j] {
+				diffs = append(diffs, fmt.Sprintf("track %d: sample entry %d: %s -> %s", i+1, j+1, ac[j], bc[j]))
+			}
+		}
+	}
+	return
+}
+
+func runCompare(mp4files []string) (err error) {
+	var a, b *FileInfo
+
+	if len(mp4files) != 2 {
+		return fmt.Errorf(`[runCompare] -compare needs exactly 2 files, got %d`, len(mp4files))
+	}
+
+	if a, err = inspectFile(mp4files[0]); err != nil {
+		return fmt.Errorf(`[runCompare] failed inspecting file %s: %w`, mp4files[0], err)
+	}
+	if b, err = inspectFile(mp4files[1]); err != nil {
+		return fmt.Errorf(`[runCompare] failed inspecting file %s: %w`, mp4files[1], err)
+	}
+
+	fmt.Printf("--- %s\n+++ %s\n", a.File, b.File)
+	diffs := compareInfo(a, b)
+	if len(diffs) == 0 {
+		fmt.Println("no codec or track differences")
+	}
+	for _, diff := range diffs {
+		fmt.Println(diff)
+	}
+	return
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRunCompare(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, data []byte) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	original := write("original.mp4", movie(trak(visualSampleEntry("dvhe", 1920, 1080)), trak(visualSampleEntry("hev1", 1920, 1080))))
+	converted := write("converted.mp4", movie(trak(visualSampleEntry("dvh1", 1920, 1080)), trak(visualSampleEntry("hev1", 1920, 1080))))
+	extra := write("extra.mp4", movie(trak(visualSampleEntry("dvhe", 1920, 1080), visualSampleEntry("dvhe", 1280, 720))))
+
+	for _, test := range []struct {
+		a, b, want string
+	}{
+		{original, original, "--- " + original + "\n+++ " + original + "\nno codec or track differences\n"},
+		{original, converted, "--- " + original + "\n+++ " + converted + "\ntrack 1: sample entry 1: dvhe -> dvh1\n"},
+		{original, extra, "--- " + original + "\n+++ " + extra + "\ntrack count: 2 -> 1\ntrack 1: sample entry count: 1 -> 2\n"},
+	} {
+		printed := captureStdout(t, func() {
+			if err := runCompare([]string{test.a, test.b}); err != nil {
+				t.Fatal(err)
+			}
+		})
+		if printed != test.want {
+			t.Errorf("printed %q, want %q", printed, test.want)
+		}
+	}
+
+	if err := runCompare([]string{original}); err == nil {
+		t.Error("comparing a single file succeeded")
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// configFileNames are the configuration files looked for, in order, in the
+// current directory and then in the home directory.
+var configFileNames = []string{".mp4dovi.toml", ".mp4dovi.json"}
+
+// envPrefix prefixes the environment variables setting option defaults, e.g.
+// MP4DOVI_FROM for -from or MP4DOVI_OUT_DIR for -out-dir.
+const envPrefix = "MP4DOVI_"
+
+// findConfigFile returns the first configuration file found, or "" if none.
+func findConfigFile() string {
+	var dirs []string
+	if cwd, err := os.Getwd(); err == nil {
+		dirs = append(dirs, cwd)
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		dirs = append(dirs, home)
+	}
+	for _, dir := range dirs {
+		for _, name := range configFileNames {
+			path := filepath.Join(dir, name)
+			if _, err := os.Stat(path); err == nil {
+				return path
+			}
+		}
+	}
+	return ""
+}
+
+// readConfigFile reads the option defaults of a configuration file. JSON files
+// hold a single object, e.g. {"from": "dvhe", "atomic": true}. TOML files are
+// limited to top level key = value pairs with string, boolean or number
+// values, e.g. from = "dvhe".
+func readConfigFile(path string) (values map[string]string, err error) {
+	var data []byte
+
+	if data, err = os.ReadFile(path); err != nil {
+		return nil, fmt.Errorf(`[readConfigFile] cannot read "%s": %w`, path, err)
+	}
+	if strings.HasSuffix(path, ".json") {
+		// Numbers are kept as written, so that large integers such as
+		// 4000000 are not formatted as 4e+06.
+		var object map[string]any
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		if err = dec.Decode(&object); err == nil && dec.More() {
+			err = errors.New("unexpected data after the object")
+		}
+		if err != nil {
+			return nil, fmt.Errorf(`[readConfigFile] invalid JSON in "%s": %w`, path, err)
+		}
+		values = make(map[string]string, len(object))
+		for key, value := range object {
+			values[key] = fmt.Sprint(value)
+		}
+		return values, nil
+	}
+	if values, err = parseTOMLDefaults(string(data)); err != nil {
+		return nil, fmt.Errorf(`[readConfigFile] invalid TOML in "%s": %w`, path, err)
+	}
+	return values, nil
+}
+
+// parseTOMLDefaults parses the key = value subset of TOML used for option
+// defaults.
+func parseTOMLDefaults(data string) (values map[string]string, err error) {
+	values = make(map[string]string)
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		key, value, found := strings.Cut(text, "=")
+		if !found || strings.HasPrefix(text, "[") {
+			return nil, fmt.Errorf(`line %d: expected key = value, got %q`, line, text)
+		}
+		key, value = strings.Trim(strings.TrimSpace(key), `"`), strings.TrimSpace(value)
+		if value, err = parseTOMLValue(value); err != nil {
+			return nil, fmt.Errorf(`line %d: invalid value for "%s": %w`, line, key, err)
+		}
+		values[key] = value
+	}
+	return values, scanner.Err()
+}
+
+// parseTOMLValue parses a string, boolean or number value, followed by an
+// optional comment.
+func parseTOMLValue(text string) (value string, err error) {
+	end := -1
+	switch {
+	case strings.HasPrefix(text, `"`):
+		for i := 1; i < len(text) && end < 0; i++ {
+			switch text[i] {
+			case '\\':
+				i++
+			case '"':
+				end = i
+			}
+		}
+		if end < 0 {
+			return "", fmt.Errorf(`unterminated string %s`, text)
+		}
+		if value, err = strconv.Unquote(text[:end+1]); err != nil {
+			return "", err
+		}
+	case strings.HasPrefix(text, "'"):
+		if end = strings.IndexByte(text[1:], '\''); end < 0 {
+			return "", fmt.Errorf(`unterminated string %s`, text)
+		}
+		end++
+		value = text[1:end]
+	default:
+		value, _, _ = strings.Cut(text, "#")
+		return strings.TrimSpace(value), nil
+	}
+	if rest := strings.TrimSpace(text[end+1:]); rest != "" && !strings.HasPrefix(rest, "#") {
+		return "", fmt.Errorf(`unexpected %q after string`, rest)
+	}
+	return value, nil
+}
+
+// applyDefaults sets the defaults of the options of fs from the configuration
+// file and then from the MP4DOVI_ environment variables, so that the command
+// line overrides the environment, which overrides the configuration file.
+// Options the command does not have are ignored, as a configuration file is
+// shared by all commands.
+func applyDefaults(fs *flag.FlagSet) (err error) {
+	var values map[string]string
+
+	if path := findConfigFile(); path != "" {
+		if values, err = readConfigFile(path); err != nil {
+			return fmt.Errorf(`[applyDefaults] %w`, err)
+		}
+		for name, value := range values {
+			if fs.Lookup(name) == nil {
+				continue
+			}
+			if err = fs.Set(name, value); err != nil {
+				return fmt.Errorf(`[applyDefaults] invalid value %q for "%s" in "%s": %w`, value, name, path, err)
+			}
+		}
+	}
+
+	fs.VisitAll(func(f *flag.Flag) {
+		name := envPrefix + strings.ToUpper(strings.ReplaceAll(f.Name, "-", "_"))
+		if value, ok := os.LookupEnv(name); ok && err == nil {
+			if setErr := fs.Set(f.Name, value); setErr != nil {
+				err = fmt.Errorf(`[applyDefaults] invalid value %q for %s: %w`, value, name, setErr)
+			}
+		}
+	})
+	return
+}
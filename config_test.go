@@ -0,0 +1,102 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseTOMLDefaults(t *testing.T) {
+	values, err := parseTOMLDefaults(`# mp4dovi defaults
+from = "dvhe"
+to = 'dvh1' # literal string
+"out-dir" = "/tmp/dv # not a comment"
+atomic = true
+retries = 3 # comment
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"from": "dvhe", "to": "dvh1", "out-dir": "/tmp/dv # not a comment", "atomic": "true", "retries": "3"}
+	if fmt.Sprint(values) != fmt.Sprint(want) {
+		t.Errorf("got %v, want %v", values, want)
+	}
+
+	for _, invalid := range []string{"[convert]\nfrom = \"dvhe\"", "from", `from = "dvhe`, `from = "dvhe" x`} {
+		if _, err := parseTOMLDefaults(invalid); err == nil {
+			t.Errorf("parsing %q succeeded", invalid)
+		}
+	}
+}
+
+func TestReadConfigFileNumbers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".mp4dovi.json")
+	config := `{"max-scan-bytes": 4000000, "rewrite-buffer": 1048576, "limit-changes": 2, "ratio": 0.5}`
+	if err := os.WriteFile(path, []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	values, err := readConfigFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"max-scan-bytes": "4000000", "rewrite-buffer": "1048576", "limit-changes": "2", "ratio": "0.5"}
+	if fmt.Sprint(values) != fmt.Sprint(want) {
+		t.Errorf("got %v, want %v", values, want)
+	}
+
+	var maxScan int64
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.Int64Var(&maxScan, "max-scan-bytes", 0, "")
+	if err = fs.Set("max-scan-bytes", values["max-scan-bytes"]); err != nil || maxScan != 4000000 {
+		t.Errorf("setting -max-scan-bytes: got %d, %v", maxScan, err)
+	}
+
+	if err = os.WriteFile(path, []byte(`{"from": "dvhe"} {"to": "dvh1"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = readConfigFile(path); err == nil {
+		t.Error("reading a file with data after the object succeeded")
+	}
+}
+
+func TestApplyDefaultsPrecedence(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("HOME", t.TempDir())
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(cwd) })
+
+	config := `{"from": "hev1", "to": "hvc1", "retries": 2, "atomic": true, "unknown": 1}`
+	if err = os.WriteFile(filepath.Join(dir, ".mp4dovi.json"), []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("MP4DOVI_TO", "dvh1")
+	t.Setenv("MP4DOVI_RETRIES", "5")
+
+	var (
+		from, to string
+		retries  int
+		atomic   bool
+	)
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.StringVar(&from, "from", "dvhe", "")
+	fs.StringVar(&to, "to", "", "")
+	fs.IntVar(&retries, "retries", 0, "")
+	fs.BoolVar(&atomic, "atomic", false, "")
+	if err = applyDefaults(fs); err != nil {
+		t.Fatal(err)
+	}
+	if err = fs.Parse([]string{"-retries", "7"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprintf("%s %s %d %v", from, to, retries, atomic); got != "hev1 dvh1 7 true" {
+		t.Errorf("got %s, want the command line over the environment over the configuration file", got)
+	}
+}
@@ -0,0 +1,640 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// diffOffsets returns the offsets at which a and b differ.
+func diffOffsets(a, b []byte) (offsets []int) {
+	for i := range a {
+		if i >= len(b) || a[i] != b[i] {
+			offsets = append(offsets, i)
+		}
+	}
+	return
+}
+
+func TestConvertGoldenBytes(t *testing.T) {
+	withCodecs(t, "dvhe", "dvh1")
+
+	entry := visualSampleEntry("dvhe", 3840, 2160, hvcC(), box("dvcC", make([]byte, 24)))
+	tests := []struct {
+		name  string
+		entry []byte
+		data  []byte
+	}{
+		{name: "32-bit sample entry header", entry: entry},
+		{name: "64-bit sample entry header", entry: largeBox(entry)},
+		{name: "64-bit container headers", data: movie(largeBox(trak(entry)))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := tt.data
+			if data == nil {
+				data = movie(trak(tt.entry))
+			}
+			original := append([]byte{}, data...)
+
+			// the FourCC is the only place "dvhe" appears in the fixture
+			at := bytes.Index(original, []byte("dvhe"))
+
+			f := &memFile{data: data}
+			if err := convert(f); err != nil {
+				t.Fatal(err)
+			}
+			if len(f.data) != len(original) {
+				t.Fatalf("size changed from %d to %d", len(original), len(f.data))
+			}
+			// only the last byte differs between dvhe and dvh1
+			want := fmt.Sprint([]int{at + 3})
+			if got := fmt.Sprint(diffOffsets(original, f.data)); got != want {
+				t.Errorf("changed bytes at %s, want %s", got, want)
+			}
+			if !bytes.Equal(f.data[at:at+4], []byte("dvh1")) {
+				t.Errorf("got %q at %d, want dvh1", f.data[at:at+4], at)
+			}
+		})
+	}
+}
+
+func TestConvertLeavesOtherCodecsAlone(t *testing.T) {
+	withCodecs(t, "dvhe", "dvh1")
+
+	data := movie(trak(visualSampleEntry("hvc1", 1920, 1080)), trak(visualSampleEntry("avc1", 1920, 1080)))
+	original := append([]byte{}, data...)
+
+	f := &memFile{data: data}
+	if err := convert(f); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(f.data, original) {
+		t.Errorf("unexpected changes at %v", diffOffsets(original, f.data))
+	}
+}
+
+func TestConvertWritesWholeFourCC(t *testing.T) {
+	withCodecs(t, "hev1", "dvav")
+
+	data := movie(trak(largeBox(visualSampleEntry("hev1", 1920, 1080, hvcC()))))
+	original := append([]byte{}, data...)
+	at := bytes.Index(original, []byte("hev1"))
+
+	f := &memFile{data: data}
+	if err := convert(f); err != nil {
+		t.Fatal(err)
+	}
+	want := fmt.Sprint([]int{at, at + 1, at + 2, at + 3})
+	if got := fmt.Sprint(diffOffsets(original, f.data)); got != want {
+		t.Errorf("changed bytes at %s, want %s", got, want)
+	}
+}
+
+func TestConvertSampleEntryWithNestedBoxes(t *testing.T) {
+	withCodecs(t, "dvhe", "dvh1")
+
+	// The first entry wraps its configuration QuickTime style, including a
+	// nested box that happens to be called dvhe and must not be renamed.
+	nested := visualSampleEntry("dvhe", 1920, 1080,
+		box("wave", box("frma", []byte("hev1")), box("dvhe", make([]byte, 4)), box("chan", make([]byte, 12))),
+		hvcC(), box("dvcC", make([]byte, 24)),
+	)
+	data := movie(trak(nested, visualSampleEntry("avc1", 640, 360), visualSampleEntry("dvhe", 3840, 2160, hvcC())))
+	original := append([]byte{}, data...)
+
+	var entries []int
+	for at := 0; ; {
+		i := bytes.Index(original[at:], []byte("dvhe"))
+		if i < 0 {
+			break
+		}
+		entries = append(entries, at+i)
+		at += i + 4
+	}
+	if len(entries) != 3 {
+		t.Fatalf("fixture has %d dvhe FourCCs, want 3", len(entries))
+	}
+
+	f := &memFile{data: data}
+	if err := convert(f); err != nil {
+		t.Fatal(err)
+	}
+	// the first and last occurrences are sample entries, the middle one is nested
+	want := fmt.Sprint([]int{entries[0] + 3, entries[2] + 3})
+	if got := fmt.Sprint(diffOffsets(original, f.data)); got != want {
+		t.Errorf("changed bytes at %s, want %s", got, want)
+	}
+
+	info, err := inspect(bytes.NewReader(f.data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(info.Tracks[0].Codecs); got != "[dvh1 avc1 dvh1]" {
+		t.Errorf("got codecs %s, want [dvh1 avc1 dvh1]", got)
+	}
+	if got := fmt.Sprint(info.Tracks[0].SampleEntries[0].Boxes); got != "[wave hvcC dvcC]" {
+		t.Errorf("got boxes %s in the first entry, want [wave hvcC dvcC]", got)
+	}
+}
+
+func TestPatchFourCCAt(t *testing.T) {
+	withCodecs(t, "dvhe", "dvh1")
+
+	data := movie(trak(visualSampleEntry("dvhe", 1920, 1080, hvcC())))
+	original := append([]byte{}, data...)
+	at := int64(bytes.Index(original, []byte("dvhe")))
+
+	f := &memFile{data: data}
+	if err := patchFourCCAt(f, at+1); err == nil {
+		t.Errorf("patching at a wrong offset succeeded")
+	}
+	if !bytes.Equal(f.data, original) {
+		t.Fatalf("refused patch changed bytes at %v", diffOffsets(original, f.data))
+	}
+
+	if err := patchFourCCAt(f, at); err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(diffOffsets(original, f.data)); got != fmt.Sprint([]int{int(at) + 3}) {
+		t.Errorf("changed bytes at %s", got)
+	}
+}
+
+// readExtent is a memFile recording how far into the file it was read.
+type readExtent struct {
+	memFile
+	end int64
+}
+
+func (f *readExtent) Read(p []byte) (int, error) {
+	n, err := f.memFile.Read(p)
+	if f.offset > f.end {
+		f.end = f.offset
+	}
+	return n, err
+}
+
+func TestConvertScanOnlyMoov(t *testing.T) {
+	withCodecs(t, "dvhe", "dvh1")
+	t.Cleanup(func() { scanOnlyMoov, debugCRC = false, false })
+
+	ftyp := box("ftyp", []byte("isom"), u32(0), []byte("isomdby1"))
+	moov := box("moov", trak(visualSampleEntry("dvhe", 1920, 1080, hvcC())))
+	mdat := box("mdat", make([]byte, 4096))
+	tests := []struct {
+		name    string
+		data    []byte
+		maxRead int
+	}{
+		{name: "moov before mdat", data: bytes.Join([][]byte{ftyp, moov, mdat}, nil), maxRead: len(ftyp) + len(moov)},
+		// the mdat header is read to skip it, its payload is not
+		{name: "moov last", data: bytes.Join([][]byte{ftyp, mdat, moov}, nil), maxRead: len(ftyp) + len(mdat) + len(moov)},
+	}
+	for _, tt := range tests {
+		for _, crc := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s/debug-crc=%v", tt.name, crc), func(t *testing.T) {
+				scanOnlyMoov, debugCRC = true, crc
+				f := &readExtent{memFile: memFile{data: append([]byte{}, tt.data...)}}
+				if err := convert(f); err != nil {
+					t.Fatal(err)
+				}
+				if f.end > int64(tt.maxRead) {
+					t.Errorf("read up to %d, want at most %d", f.end, tt.maxRead)
+				}
+				if bytes.Contains(f.data, []byte("dvhe")) {
+					t.Errorf("dvhe entry left unconverted")
+				}
+			})
+		}
+	}
+}
+
+func TestConvertMaxScanBytes(t *testing.T) {
+	withCodecs(t, "dvhe", "dvh1")
+	t.Cleanup(func() { maxScanBytes = 0 })
+
+	ftyp := box("ftyp", []byte("isom"), u32(0), []byte("isomdby1"))
+	moov := box("moov", trak(visualSampleEntry("dvhe", 1920, 1080, hvcC())))
+	mdat := box("mdat", make([]byte, 1<<20))
+
+	// moov after an mdat larger than the limit is not looked for past it.
+	maxScanBytes = 4096
+	data := bytes.Join([][]byte{ftyp, mdat, moov}, nil)
+	f := &readExtent{memFile: memFile{data: append([]byte{}, data...)}}
+	err := convert(f)
+	if err == nil || !strings.Contains(err.Error(), `failed finding box "moov" within the first 4096 bytes (-max-scan-bytes)`) {
+		t.Fatalf("got %v, want moov not found within -max-scan-bytes", err)
+	}
+	if f.end > maxScanBytes {
+		t.Errorf("read up to %d, past -max-scan-bytes", f.end)
+	}
+	if !bytes.Equal(f.data, data) {
+		t.Error("file changed")
+	}
+
+	// moov within the limit is converted.
+	takeChanges()
+	f = &readExtent{memFile: memFile{data: bytes.Join([][]byte{ftyp, moov, mdat}, nil)}}
+	if err = convert(f); err != nil {
+		t.Fatal(err)
+	}
+	if changes := takeChanges(); len(changes) != 1 || bytes.Contains(f.data, []byte("dvhe")) {
+		t.Errorf("got changes %v, want dvhe converted", changes)
+	}
+}
+
+func TestBoxChecksumsAroundConvert(t *testing.T) {
+	withCodecs(t, "dvhe", "dvh1")
+	data := movie(trak(visualSampleEntry("dvhe", 1920, 1080, hvcC())), trak(visualSampleEntry("avc1", 640, 360)))
+	f := &memFile{data: append([]byte{}, data...)}
+	before, err := boxChecksums(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = convert(f); err != nil {
+		t.Fatal(err)
+	}
+	takeChanges()
+	after, err := boxChecksums(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the boxes holding the patched sample entry change.
+	secondTrak := int64(bytes.LastIndex(data, []byte("trak")) - 4)
+	var changed, unchanged []string
+	for i, b := range before {
+		a := after[i]
+		if a.Offset != b.Offset || a.Size != b.Size {
+			t.Fatalf("box %s moved from %d to %d", b.Path, b.Offset, a.Offset)
+		}
+		name := b.Path
+		if b.Offset >= secondTrak && strings.HasPrefix(b.Path, "moov/trak") {
+			name = "second " + name
+		}
+		if a.CRC != b.CRC {
+			changed = append(changed, name)
+		} else {
+			unchanged = append(unchanged, name)
+		}
+	}
+	if got := fmt.Sprint(changed); got != "[moov moov/trak moov/trak/mdia moov/trak/mdia/minf moov/trak/mdia/minf/stbl moov/trak/mdia/minf/stbl/stsd moov/trak/mdia/minf/stbl/stsd/dvhe]" {
+		t.Errorf("changed %s", got)
+	}
+	if got := fmt.Sprint(unchanged); got != "[ftyp second moov/trak second moov/trak/mdia second moov/trak/mdia/minf second moov/trak/mdia/minf/stbl second moov/trak/mdia/minf/stbl/stsd second moov/trak/mdia/minf/stbl/stsd/avc1 mdat]" {
+		t.Errorf("unchanged %s", got)
+	}
+
+	// Boxes are paired by offset, as the path of the entry changed.
+	entry := before[len(changed)]
+	printed := captureStdout(t, func() { printChecksumChanges(before, after[:len(after)-1]) })
+	for _, want := range []string{
+		fmt.Sprintf("[crc] ftyp at 0(0x0): %08x unchanged\n", before[0].CRC),
+		fmt.Sprintf("[crc] moov/trak/mdia/minf/stbl/stsd/dvhe at %d(%#x): %08x -> %08x (moov/trak/mdia/minf/stbl/stsd/dvh1) changed\n", entry.Offset, entry.Offset, entry.CRC, after[len(changed)].CRC),
+		fmt.Sprintf("[crc] mdat at %d(%#x): %08x -> missing\n", before[len(before)-1].Offset, before[len(before)-1].Offset, before[len(before)-1].CRC),
+	} {
+		if !strings.Contains(printed, want) {
+			t.Errorf("printed %q, want it to contain %q", printed, want)
+		}
+	}
+}
+
+func TestConvertAllMoov(t *testing.T) {
+	withCodecs(t, "dvhe", "dvh1")
+	t.Cleanup(func() { allMoov = false })
+
+	data := bytes.Join([][]byte{
+		box("ftyp", []byte("isom"), u32(0), []byte("isomdby1")),
+		box("moov", trak(visualSampleEntry("dvhe", 1920, 1080, hvcC()))),
+		box("mdat", make([]byte, 16)),
+		box("moov", trak(visualSampleEntry("avc1", 640, 360)), trak(visualSampleEntry("dvhe", 3840, 2160, hvcC()))),
+	}, nil)
+
+	for _, all := range []bool{false, true} {
+		t.Run(fmt.Sprintf("all-moov=%v", all), func(t *testing.T) {
+			allMoov = all
+			f := &memFile{data: append([]byte{}, data...)}
+			if err := convert(f); err != nil {
+				t.Fatal(err)
+			}
+			want := 1
+			if all {
+				want = 2
+			}
+			if got := bytes.Count(f.data, []byte("dvh1")); got != want {
+				t.Errorf("converted %d entries, want %d", got, want)
+			}
+		})
+	}
+}
+
+func TestConvertIncompleteFile(t *testing.T) {
+	withCodecs(t, "dvhe", "dvh1")
+	t.Cleanup(func() { allMoov = false })
+
+	ftyp := box("ftyp", []byte("isom"), u32(0), []byte("isomdby1"))
+	moov := box("moov", trak(visualSampleEntry("dvhe", 1920, 1080, hvcC())))
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "empty"},
+		{name: "ftyp only", data: ftyp},
+		{name: "truncated moov header", data: append(append([]byte{}, ftyp...), moov[:5]...)},
+		{name: "truncated mdat before moov", data: append(append([]byte{}, ftyp...), box("mdat", make([]byte, 64))[:20]...)},
+	}
+	for _, tt := range tests {
+		for _, all := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s/all-moov=%v", tt.name, all), func(t *testing.T) {
+				allMoov = all
+				err := convert(&memFile{data: append([]byte{}, tt.data...)})
+				if got := newFileResult("movie.mp4", err).Status; got != statusIncomplete {
+					t.Errorf("got status %q (%v), want %q", got, err, statusIncomplete)
+				}
+			})
+		}
+	}
+}
+
+func TestConvertManySampleGroups(t *testing.T) {
+	withCodecs(t, "dvhe", "dvh1")
+
+	groups := func(n int) (boxes [][]byte) {
+		for i := 0; i < n; i++ {
+			boxes = append(boxes,
+				fullBox("sgpd", 1, 0, []byte("roll"), u32(2), u32(1), u16(uint16(i))),
+				fullBox("sbgp", 0, 0, []byte("roll"), u32(1), u32(10), u32(1)),
+			)
+		}
+		return
+	}
+	stbl := append(groups(500), stsd(visualSampleEntry("dvhe", 1920, 1080, hvcC())))
+	stbl = append(stbl, groups(500)...)
+	data := movie(
+		box("trak", box("mdia", box("minf", box("stbl", stbl...)))),
+		box("trak", box("mdia", box("minf", box("stbl", append(groups(1000), stsd(visualSampleEntry("dvhe", 3840, 2160, hvcC())))...)))),
+	)
+
+	f := &memFile{data: data}
+	if err := convert(f); err != nil {
+		t.Fatal(err)
+	}
+	info, err := inspect(bytes.NewReader(f.data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(info.Tracks[0].Codecs, info.Tracks[1].Codecs); got != "[dvh1] [dvh1]" {
+		t.Errorf("got codecs %s, want [dvh1] [dvh1]", got)
+	}
+}
+
+func TestConvertTrackID(t *testing.T) {
+	withCodecs(t, "dvhe", "dvh1")
+	t.Cleanup(func() { trackID = 0 })
+
+	trakWithID := func(id uint32, entry []byte) []byte {
+		return box("trak", tkhd(0, tkhdTrackEnabled, id, 1920, 1080), box("mdia", box("minf", box("stbl", stsd(entry)))))
+	}
+	data := movie(trakWithID(1, visualSampleEntry("dvhe", 1920, 1080, hvcC())), trakWithID(2, visualSampleEntry("dvhe", 1920, 1080, hvcC())))
+
+	trackID = 2
+	f := &memFile{data: data}
+	if err := convert(f); err != nil {
+		t.Fatal(err)
+	}
+	info, err := inspect(bytes.NewReader(f.data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(info.Tracks[0].TrackID, info.Tracks[0].Codecs, info.Tracks[1].TrackID, info.Tracks[1].Codecs); got != "1 [dvhe] 2 [dvh1]" {
+		t.Errorf("got %s, want only track ID 2 converted", got)
+	}
+}
+
+func TestConvertAnywhere(t *testing.T) {
+	withCodecs(t, "free", "skip")
+	t.Cleanup(func() { anywhere, anywhereDepth = false, 0 })
+
+	data := movie(box("free", make([]byte, 4)), box("udta", box("free", make([]byte, 8))), trak(visualSampleEntry("dvhe", 1920, 1080, hvcC())))
+	original := append([]byte{}, data...)
+	// moov/free and moov/udta/free
+	first := bytes.Index(original, []byte("free"))
+	second := first + 4 + bytes.Index(original[first+4:], []byte("free"))
+
+	tests := []struct {
+		depth int
+		want  []int
+	}{
+		{depth: 0, want: []int{first, second}},
+		{depth: 3, want: []int{first, second}},
+		{depth: 2, want: []int{first}},
+		{depth: 1, want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint("depth ", tt.depth), func(t *testing.T) {
+			anywhere, anywhereDepth = true, tt.depth
+			f := &memFile{data: append([]byte{}, original...)}
+			if err := convert(f); err != nil {
+				t.Fatal(err)
+			}
+			var want []int
+			for _, at := range tt.want {
+				want = append(want, at, at+1, at+2, at+3)
+			}
+			if got := diffOffsets(original, f.data); fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Errorf("changed bytes at %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+// smoothStreamingMovie builds a Smooth Streaming ismv file: an init segment
+// with a dvhe track, fragments carrying a PIFF uuid box and a trailing mfra.
+func smoothStreamingMovie() []byte {
+	const tfxd = "\x6d\x1d\x9b\x05\x42\xd5\x44\xe6\x80\xe2\x14\x1d\xaf\xf7\x57\xb2"
+	fragment := func(sequence uint32) []byte {
+		return bytes.Join([][]byte{
+			box("moof",
+				fullBox("mfhd", 0, 0, u32(sequence)),
+				box("traf",
+					fullBox("tfhd", 0, 0, u32(1)),
+					box("uuid", []byte(tfxd), u32(1<<24), u64(uint64(sequence)*20000000), u64(20000000)),
+					fullBox("trun", 0, 0, u32(0)),
+				),
+			),
+			box("mdat", make([]byte, 32)),
+		}, nil)
+	}
+	return bytes.Join([][]byte{
+		box("ftyp", []byte("isml"), u32(1), []byte("pifficc "), []byte("isml")),
+		box("moov",
+			trak(visualSampleEntry("dvhe", 1920, 1080, hvcC(), box("dvcC", make([]byte, 24)))),
+			box("mvex", fullBox("trex", 0, 0, u32(1), u32(1), u32(0), u32(0), u32(0))),
+		),
+		fragment(1),
+		fragment(2),
+		box("mfra", fullBox("tfra", 1, 0, u32(1), u32(0), u32(0)), fullBox("mfro", 0, 0, u32(16))),
+	}, nil)
+}
+
+func TestConvertSmoothStreaming(t *testing.T) {
+	withCodecs(t, "dvhe", "dvh1")
+
+	data := smoothStreamingMovie()
+	name := filepath.Join(t.TempDir(), "movie.ismv")
+	if err := os.WriteFile(name, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := processFile(name); err != nil {
+		t.Fatal(err)
+	}
+	converted, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := bytes.Index(data, []byte("dvhe"))
+	if got := fmt.Sprint(diffOffsets(data, converted)); got != fmt.Sprint([]int{at + 3}) {
+		t.Errorf("changed bytes at %s, want only the init segment sample entry at %d", got, at)
+	}
+
+	info, err := inspect(bytes.NewReader(converted))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.hasBrand("isml") || len(info.Tracks) != 1 || fmt.Sprint(info.Tracks[0].Codecs) != "[dvh1]" || len(info.Fragments) != 1 {
+		t.Errorf("got %+v", info)
+	}
+	if problems, err := validate(bytes.NewReader(converted), int64(len(converted))); err != nil || len(problems) > 0 {
+		t.Errorf("got problems %v, %v", problems, err)
+	}
+	unknown, err := unknownBoxes(bytes.NewReader(converted))
+	if err != nil || len(unknown) > 0 {
+		t.Errorf("got unknown boxes %v, %v", unknown, err)
+	}
+}
+
+func TestConvertOnlyCodec(t *testing.T) {
+	withCodecs(t, "hev1", "hvc1")
+	t.Cleanup(func() { onlyCodec = "" })
+
+	dir := t.TempDir()
+	mixed := filepath.Join(dir, "mixed.mp4")
+	plain := filepath.Join(dir, "plain.mp4")
+	for name, data := range map[string][]byte{
+		mixed: movie(trak(visualSampleEntry("dvhe", 1920, 1080, hvcC(), box("dvcC", make([]byte, 24)))), trak(visualSampleEntry("hev1", 1920, 1080, hvcC()))),
+		plain: movie(trak(visualSampleEntry("hev1", 1920, 1080, hvcC()))),
+	} {
+		if err := os.WriteFile(name, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	onlyCodec = "dvhe"
+	if result := convertFile(context.Background(), plain); result.Status != statusSkipped || len(result.Changes) != 0 {
+		t.Errorf("got %+v, want %s skipped", result, plain)
+	}
+	if result := convertFile(context.Background(), mixed); result.Err != nil || len(result.Changes) != 1 {
+		t.Errorf("got %+v, want %s converted", result, mixed)
+	}
+}
+
+func TestConvertIfBrand(t *testing.T) {
+	withCodecs(t, "dvhe", "dvh1")
+	t.Cleanup(func() { ifBrand = "" })
+	ifBrand = BrandDBY1
+
+	dir := t.TempDir()
+	entry := visualSampleEntry("dvhe", 1920, 1080, hvcC(), box("dvcC", make([]byte, 24)))
+	branded := filepath.Join(dir, "branded.mp4")
+	unbranded := filepath.Join(dir, "unbranded.mp4")
+	major := filepath.Join(dir, "major.mp4")
+	noFtyp := filepath.Join(dir, "noftyp.mp4")
+	for name, data := range map[string][]byte{
+		branded:   movie(trak(entry)),
+		unbranded: append(box("ftyp", []byte("isom"), u32(0), []byte("isommp42")), movie(trak(entry))[24:]...),
+		major:     append(box("ftyp", []byte("dby1"), u32(0), []byte("isom")), movie(trak(entry))[24:]...),
+		noFtyp:    movie(trak(entry))[24:],
+	} {
+		if err := os.WriteFile(name, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, mp4file := range []string{unbranded, noFtyp} {
+		result := convertFile(context.Background(), mp4file)
+		if result.Status != statusSkipped || result.Reason != "ftyp does not carry the dby1 brand (-if-brand)" {
+			t.Errorf("got %+v, want %s skipped", result, mp4file)
+		}
+		if data, _ := os.ReadFile(mp4file); !bytes.Contains(data, []byte("dvhe")) {
+			t.Errorf("%s converted", mp4file)
+		}
+	}
+	for _, mp4file := range []string{branded, major} {
+		if result := convertFile(context.Background(), mp4file); result.Err != nil || len(result.Changes) != 1 {
+			t.Errorf("got %+v, want %s converted", result, mp4file)
+		}
+	}
+}
+
+// lossyFile is a memFile silently dropping writes, as flaky storage might.
+type lossyFile struct{ memFile }
+
+func (f *lossyFile) Write(p []byte) (int, error) {
+	f.offset += int64(len(p))
+	return len(p), nil
+}
+
+func TestConvertReadBack(t *testing.T) {
+	withCodecs(t, "dvhe", "dvh1")
+	t.Cleanup(func() { noReadBack = false })
+	data := movie(trak(visualSampleEntry("dvhe", 1920, 1080, hvcC(), box("dvcC", make([]byte, 24)))))
+
+	f := &lossyFile{memFile{data: append([]byte{}, data...)}}
+	if err := convert(f); !errors.Is(err, errReadBackMismatch) {
+		t.Errorf("got %v, want %v", err, errReadBackMismatch)
+	}
+
+	noReadBack = true
+	f = &lossyFile{memFile{data: append([]byte{}, data...)}}
+	if err := convert(f); err != nil {
+		t.Errorf("got %v with -no-read-back", err)
+	}
+	takeChanges()
+}
+
+func TestConvertStsdVersion(t *testing.T) {
+	withCodecs(t, "dvhe", "dvh1")
+	entry := visualSampleEntry("dvhe", 1920, 1080, hvcC(), box("dvcC", make([]byte, 24)))
+	movieWithStsd := func(version uint8) []byte {
+		return movie(box("trak", box("mdia", box("minf", box("stbl", fullBox("stsd", version, 0, u32(1), entry))))))
+	}
+
+	f := &memFile{data: movieWithStsd(1)}
+	if err := convert(f); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(f.data, []byte("dvh1")) {
+		t.Error("sample entry of a version 1 stsd not converted")
+	}
+	if problems, err := validate(bytes.NewReader(f.data), int64(len(f.data))); err != nil || len(problems) > 0 {
+		t.Errorf("got problems %v, %v", problems, err)
+	}
+
+	data := movieWithStsd(2)
+	f = &memFile{data: append([]byte{}, data...)}
+	if err := convert(f); !errors.Is(err, errUnsupportedStsdVersion) {
+		t.Errorf("got %v, want %v", err, errUnsupportedStsdVersion)
+	}
+	if !bytes.Equal(f.data, data) {
+		t.Errorf("file changed at %v", diffOffsets(data, f.data))
+	}
+	if problems, err := validate(bytes.NewReader(data), int64(len(data))); err != nil || len(problems) != 1 {
+		t.Errorf("got problems %v, %v, want the stsd version reported", problems, err)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"strings"
+)
+
+// boxChecksum is the CRC32 of a whole box, header included.
+type boxChecksum struct {
+	Path   string
+	Offset int64
+	Size   uint64
+	CRC    uint32
+}
+
+// errMoovDone stops a walk once moov has been visited with -scan-only-moov.
+var errMoovDone = errors.New("moov done")
+
+// checksumVisitor checksums every top level box and every box along the
+// moov/trak/mdia/minf/stbl/stsd chain, including the sample entries. With
+// -scan-only-moov only the first moov and its descendants are read.
+type checksumVisitor struct {
+	r         io.ReadSeeker
+	checksums []boxChecksum
+}
+
+func (v *checksumVisitor) EnterBox(path []BoxType, h Header) (descend bool, err error) {
+	if scanOnlyMoov && path[0] != MoovBoxType {
+		return false, nil
+	}
+
+	types := make([]string, len(path))
+	for i, t := range path {
+		types[i] = t.String()
+	}
+
+	if _, err = v.r.Seek(h.Offset, io.SeekStart); err != nil {
+		return false, fmt.Errorf(`[checksumVisitor] failed to seek: %w`, err)
+	}
+	hash := crc32.NewIEEE()
+	if _, err = io.CopyN(hash, v.r, int64(getBoxSize(&h))); err != nil {
+		return false, fmt.Errorf(`[checksumVisitor] failed reading box "%s": %w`, h.Type, err)
+	}
+	v.checksums = append(v.checksums, boxChecksum{
+		Path:   strings.Join(types, "/"),
+		Offset: h.Offset,
+		Size:   getBoxSize(&h),
+		CRC:    hash.Sum32(),
+	})
+
+	switch h.Type {
+	case MoovBoxType, TrakBoxType, MdiaBoxType, MinfBoxType, StblBoxType, StsdBoxType:
+		return true, nil
+	}
+	return false, nil
+}
+
+func (v *checksumVisitor) LeaveBox(path []BoxType, h Header) error {
+	if scanOnlyMoov && len(path) == 1 && h.Type == MoovBoxType {
+		return errMoovDone
+	}
+	return nil
+}
+
+func boxChecksums(r io.ReadSeeker) ([]boxChecksum, error) {
+	v := &checksumVisitor{r: r}
+	if err := Walk(r, v); err != nil && !errors.Is(err, errMoovDone) {
+		return nil, fmt.Errorf(`[boxChecksums] %w`, err)
+	}
+	return v.checksums, nil
+}
+
+// printChecksumChanges logs the checksums taken before and after a conversion,
+// pairing boxes by offset since a patched sample entry changes its path.
+func printChecksumChanges(before, after []boxChecksum) {
+	byOffset := make(map[int64]boxChecksum, len(after))
+	for _, c := range after {
+		byOffset[c.Offset] = c
+	}
+	for _, b := range before {
+		a, ok := byOffset[b.Offset]
+		switch {
+		case !ok:
+			fmt.Printf("[crc] %s at %d(%#x): %08x -> missing\n", b.Path, b.Offset, b.Offset, b.CRC)
+		case a.CRC != b.CRC || a.Path != b.Path:
+			fmt.Printf("[crc] %s at %d(%#x): %08x -> %08x (%s) changed\n", b.Path, b.Offset, b.Offset, b.CRC, a.CRC, a.Path)
+		default:
+			fmt.Printf("[crc] %s at %d(%#x): %08x unchanged\n", b.Path, b.Offset, b.Offset, b.CRC)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package main
+
+import "path/filepath"
+
+// dedupeFiles removes the files listed more than once, comparing their
+// absolute paths with symbolic links resolved, and keeps the first occurrence
+// of each. Paths that cannot be resolved, such as missing files, are compared
+// as given so that processing them reports the error.
+func dedupeFiles(mp4files []string) (unique []string, removed int) {
+	seen := make(map[string]bool, len(mp4files))
+	for _, mp4file := range mp4files {
+		key := mp4file
+		if abs, err := filepath.Abs(mp4file); err == nil {
+			key = abs
+			if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+				key = resolved
+			}
+		}
+		if seen[key] {
+			removed++
+			continue
+		}
+		seen[key] = true
+		unique = append(unique, mp4file)
+	}
+	return
+}
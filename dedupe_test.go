@@ -0,0 +1,30 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDedupeFiles(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.mp4")
+	b := filepath.Join(dir, "b.mp4")
+	for _, name := range []string{a, b} {
+		if err := os.WriteFile(name, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	link := filepath.Join(dir, "link.mp4")
+	if err := os.Symlink(a, link); err != nil {
+		t.Fatal(err)
+	}
+	missing := filepath.Join(dir, "missing.mp4")
+
+	files := []string{a, b, filepath.Join(dir, ".", "a.mp4"), link, missing, missing}
+	unique, removed := dedupeFiles(files)
+	if fmt.Sprint(unique) != fmt.Sprint([]string{a, b, missing}) || removed != 3 {
+		t.Errorf("got %v with %d removed", unique, removed)
+	}
+}
@@ -0,0 +1,39 @@
+// Mp4dovi changes the codec of the sample entries of MP4 files in place, such
+// as from dvhe to dvh1 for Dolby Vision files to play on Apple devices, and
+// inspects, lists, validates and compares them. See the README for its
+// commands and options.
+//
+// # Box API
+//
+// The identifiers below are the API other tools may rely on once the box code
+// is published as a library package. The other exported names, such as the
+// types of the JSON output of inspect, and everything unexported may change
+// at any time. The API is:
+//
+//   - FourCC, BoxType and the box type variables such as MoovBoxType
+//   - Header, with HeaderLength and PayloadSize
+//   - Walk, WalkWithOptions, Visitor, WalkOptions and DefaultWalkOptions
+//   - Boxes, iterating over sibling boxes
+//   - FindBoxPayload, finding a sibling box by type
+//   - ForEachSampleEntry and SampleEntry, patching sample entries
+//
+// Their guarantees are:
+//
+//   - Exported signatures and struct fields are not changed or removed.
+//     New behavior comes with new functions, options or fields.
+//   - Offsets are absolute file offsets, and sizes are those written in the
+//     file. The boxes found lie within the limit passed in and nothing is
+//     written beyond it. The header of a box crossing the limit, up to its
+//     64-bit size and extended type, may still be read before the box is
+//     rejected.
+//   - Errors wrap their cause with %w, so errors.Is matches io.EOF when a
+//     read fails at the end of the file. Their text may change.
+//   - Readers may be left at any position when a function returns, except
+//     where its documentation says otherwise.
+//   - An identifier that is superseded gets a "Deprecated:" paragraph
+//     naming its replacement. It keeps working for at least one minor
+//     release before it is removed.
+//
+// The package is still a command, so it cannot be imported yet. The examples
+// of the API compile and run with the tests.
+package main
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// cloneBox returns a deep copy of b marked as a new box.
+func cloneBox(b *Box) *Box {
+	clone := &Box{Type: b.Type, Large: b.Large, Container: b.Container, Offset: -1}
+	clone.Fields = append([]byte(nil), b.Fields...)
+	for _, child := range b.Children {
+		clone.Children = append(clone.Children, cloneBox(child))
+	}
+	return clone
+}
+
+// duplicateSampleEntries appends a copy of every sample entry of type from
+// below b, renamed to as, after the last entry of its stsd box and updates the
+// entry count. Appending keeps the existing entries at their index, so the
+// sample_description_index of stsc, trex and tfhd still points at the same
+// entry. With lenient, entries differing from from in case or padding are
+// copied too. Sample description boxes already holding an entry of type as are
+// left alone so running twice adds nothing. It returns the number of entries
+// added.
+func duplicateSampleEntries(b *Box, from, as BoxType, lenient bool) (added int, err error) {
+	err = b.Visit(nil, func(path []BoxType, b *Box) error {
+		if b.Type != StsdBoxType || !b.Container {
+			return nil
+		}
+		if len(b.Fields) < 8 {
+			return fmt.Errorf(`[duplicateSampleEntries] box "%s" is too small`, b.Type)
+		}
+		for _, entry := range b.Children {
+			if entry.Type == as {
+				return nil
+			}
+		}
+		children := append(make([]*Box, 0, 2*len(b.Children)), b.Children...)
+		for _, entry := range b.Children {
+			if !sameFourCC(entry.Type.String(), from.String(), lenient) {
+				continue
+			}
+			clone := cloneBox(entry)
+			clone.Type = as
+			children = append(children, clone)
+			added++
+			fmt.Printf("Added %v sample entry %d copied from %v at %d(%#x)\n", as, len(children), entry.Type, entry.Offset, entry.Offset)
+			recordChange("added sample entry", entry.Offset, entry.Type.String(), as.String())
+		}
+		if len(children) == len(b.Children) {
+			return nil
+		}
+		b.Children = children
+		binary.BigEndian.PutUint32(b.Fields[4:], uint32(len(children)))
+		return nil
+	})
+	return
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func duplicateOptions() rewriteOptions {
+	return rewriteOptions{AddEntryFrom: BoxType{'d', 'v', 'h', 'e'}, AddEntryAs: BoxType{'h', 'e', 'v', '1'}}
+}
+
+func TestRewriteFileAddEntry(t *testing.T) {
+	ftyp := box("ftyp", []byte("isom"), u32(0), []byte("isomdby1"))
+	dvcC := box("dvcC", make([]byte, 24))
+	chunkedTrak := func(table []byte) []byte {
+		return box("trak", box("mdia", box("minf", box("stbl",
+			stsd(visualSampleEntry("dvhe", 1920, 1080, dvcC), visualSampleEntry("avc1", 640, 360)),
+			table,
+		))))
+	}
+	tests := []struct {
+		name  string
+		build func(offsets []uint64) []byte
+	}{
+		{
+			name: "stco with moov before mdat",
+			build: func(offsets []uint64) []byte {
+				return bytes.Join([][]byte{
+					ftyp,
+					box("moov", chunkedTrak(stco(uint32(offsets[0]), uint32(offsets[1]), uint32(offsets[2])))),
+					mdatWithChunks(),
+				}, nil)
+			},
+		},
+		{
+			name: "co64 with large moov before mdat",
+			build: func(offsets []uint64) []byte {
+				return bytes.Join([][]byte{
+					ftyp,
+					largeBox(box("moov", chunkedTrak(co64(offsets...)))),
+					mdatWithChunks(),
+				}, nil)
+			},
+		},
+		{
+			name: "moov after mdat",
+			build: func(offsets []uint64) []byte {
+				return bytes.Join([][]byte{
+					ftyp,
+					mdatWithChunks(),
+					box("moov", chunkedTrak(stco(uint32(offsets[0]), uint32(offsets[1]), uint32(offsets[2])))),
+				}, nil)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := buildChunked(t, tt.build)
+			assertChunksIntact(t, data)
+
+			var out bytes.Buffer
+			if _, err := rewriteFile(&out, bytes.NewReader(data), duplicateOptions()); err != nil {
+				t.Fatal(err)
+			}
+			added := len(visualSampleEntry("hev1", 1920, 1080, dvcC))
+			if out.Len() != len(data)+added {
+				t.Errorf("got %d bytes, want %d", out.Len(), len(data)+added)
+			}
+			assertChunksIntact(t, out.Bytes())
+
+			problems, err := validate(bytes.NewReader(out.Bytes()), int64(out.Len()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(problems) > 0 {
+				t.Errorf("rewritten file is invalid: %v", problems)
+			}
+
+			info, err := inspect(bytes.NewReader(out.Bytes()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(info.Tracks) != 1 {
+				t.Fatalf("got %d tracks", len(info.Tracks))
+			}
+			if got := info.Tracks[0].Codecs; len(got) != 3 || got[0] != "dvhe" || got[1] != "avc1" || got[2] != "hev1" {
+				t.Errorf("got codecs %v, want [dvhe avc1 hev1]", got)
+			}
+			if !bytes.Contains(out.Bytes(), visualSampleEntry("hev1", 1920, 1080, dvcC)) {
+				t.Errorf("added entry is not a copy of the original")
+			}
+
+			// A second pass finds the entry already present.
+			var again bytes.Buffer
+			if _, err = rewriteFile(&again, bytes.NewReader(out.Bytes()), duplicateOptions()); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(again.Bytes(), out.Bytes()) {
+				t.Errorf("second pass changed the file")
+			}
+		})
+	}
+}
+
+func TestDuplicateSampleEntriesCount(t *testing.T) {
+	data := movie(trak(visualSampleEntry("dvhe", 1920, 1080)), trak(visualSampleEntry("hvc1", 1920, 1080)))
+	var out bytes.Buffer
+	if _, err := rewriteFile(&out, bytes.NewReader(data), duplicateOptions()); err != nil {
+		t.Fatal(err)
+	}
+	info, err := inspect(bytes.NewReader(out.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := info.Tracks[0].Codecs; len(got) != 2 {
+		t.Errorf("first track: got codecs %v, want [dvhe hev1]", got)
+	}
+	if got := info.Tracks[1].Codecs; len(got) != 1 {
+		t.Errorf("second track: got codecs %v, want [hvc1]", got)
+	}
+	problems, err := validate(bytes.NewReader(out.Bytes()), int64(out.Len()))
+	if err != nil || len(problems) > 0 {
+		t.Errorf("rewritten file is invalid: %v %v", problems, err)
+	}
+}
+
+func TestDuplicateSampleEntriesKeepsIndexes(t *testing.T) {
+	// stsc points its second chunk run at sample description 2, the avc1
+	// entry, which must stay the second entry once hev1 is added.
+	stsc := fullBox("stsc", 0, 0, u32(2), u32(1), u32(1), u32(1), u32(2), u32(1), u32(2))
+	data := movie(box("trak", box("mdia", box("minf", box("stbl",
+		stsd(visualSampleEntry("dvhe", 1920, 1080), visualSampleEntry("avc1", 640, 360)),
+		stsc,
+	)))))
+	var out bytes.Buffer
+	if _, err := rewriteFile(&out, bytes.NewReader(data), duplicateOptions()); err != nil {
+		t.Fatal(err)
+	}
+	info, err := inspect(bytes.NewReader(out.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := info.Tracks[0].Codecs; len(got) != 3 || got[0] != "dvhe" || got[1] != "avc1" || got[2] != "hev1" {
+		t.Errorf("got codecs %v, want [dvhe avc1 hev1]", got)
+	}
+	if !bytes.Contains(out.Bytes(), stsc) {
+		t.Errorf("stsc changed")
+	}
+}
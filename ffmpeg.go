@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// ffmpegCommandFor returns the ffmpeg command remuxing the file of info into a
+// copy with the video streams holding -from sample entries tagged -to, the
+// same relabeling as converting it. ok is false if no stream needs it.
+func ffmpegCommandFor(info *FileInfo) (command string, ok bool) {
+	args := []string{"ffmpeg", "-i", shellQuote(info.File), "-map", "0", "-c", "copy"}
+
+	// ffmpeg numbers the video streams in track order, counting the video
+	// tracks only.
+	video := 0
+	for _, track := range info.Tracks {
+		if !isVideoTrack(&track) {
+			continue
+		}
+		for _, codec := range track.Codecs {
+			if matchesFrom(codec) {
+				args = append(args, fmt.Sprintf("-tag:v:%d", video), shellQuote(codecTo))
+				ok = true
+				break
+			}
+		}
+		video++
+	}
+	if !ok {
+		return "", false
+	}
+	// ffmpeg only writes the dvcC or dvvC configuration of Dolby Vision
+	// tracks with unofficial extensions allowed.
+	if codecTo == CodecDVH1 || codecTo == CodecDVA1 {
+		args = append(args, "-strict", "unofficial")
+	}
+	ext := filepath.Ext(info.File)
+	args = append(args, shellQuote(strings.TrimSuffix(info.File, ext)+"."+codecTo+ext))
+	return strings.Join(args, " "), true
+}
+
+// isVideoTrack reports whether track is a video track, as told by its handler
+// or, without one, by its sample entries.
+func isVideoTrack(track *TrackInfo) bool {
+	if track.HandlerType != "" {
+		return track.HandlerType == "vide"
+	}
+	for _, codec := range track.Codecs {
+		if visualSampleEntryTypes[codec] {
+			return true
+		}
+	}
+	return false
+}
+
+// shellQuote quotes s for POSIX shells, unless it is made of characters that
+// need no quoting.
+func shellQuote(s string) string {
+	if s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_./:+,=@%") == "" {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// runFFmpegCommand prints for every file the ffmpeg command relabeling its
+// -from video streams as -to, without modifying anything.
+func runFFmpegCommand(ctx context.Context, mp4files []string) (err error) {
+	for i, mp4file := range mp4files {
+		var info *FileInfo
+		if err = ctx.Err(); err != nil {
+			return fmt.Errorf(`[runFFmpegCommand] interrupted after %d of %d files: %w`, i, len(mp4files), err)
+		}
+		if info, err = inspectFile(mp4file); err != nil {
+			return fmt.Errorf(`[runFFmpegCommand] failed inspecting file %s: %w`, mp4file, err)
+		}
+		if command, ok := ffmpegCommandFor(info); ok {
+			fmt.Println(command)
+		} else {
+			fmt.Printf("# %s: no %s video stream, nothing to relabel\n", mp4file, codecFrom)
+		}
+	}
+	return
+}
@@ -0,0 +1,42 @@
+package main
+
+import "testing"
+
+func TestFFmpegCommandFor(t *testing.T) {
+	withCodecs(t, "dvhe", "dvh1")
+	info := &FileInfo{File: "Holiday Movie.mp4", Tracks: []TrackInfo{
+		{HandlerType: "vide", Codecs: []string{"hvc1"}},
+		{HandlerType: "soun", Codecs: []string{"ec-3"}},
+		{HandlerType: "vide", Codecs: []string{"dvhe"}},
+		{Codecs: []string{"dvhe"}},
+	}}
+	command, ok := ffmpegCommandFor(info)
+	if want := "ffmpeg -i 'Holiday Movie.mp4' -map 0 -c copy -tag:v:1 dvh1 -tag:v:2 dvh1 -strict unofficial 'Holiday Movie.dvh1.mp4'"; !ok || command != want {
+		t.Errorf("got %q, %v, want %q", command, ok, want)
+	}
+
+	withCodecs(t, "hev1", "hvc1")
+	info = &FileInfo{File: "clip.mov", Tracks: []TrackInfo{{HandlerType: "vide", Codecs: []string{"hev1"}}}}
+	if command, ok = ffmpegCommandFor(info); !ok || command != "ffmpeg -i clip.mov -map 0 -c copy -tag:v:0 hvc1 clip.hvc1.mov" {
+		t.Errorf("got %q, %v", command, ok)
+	}
+
+	info.Tracks[0].Codecs = []string{"avc1"}
+	if command, ok = ffmpegCommandFor(info); ok {
+		t.Errorf("got %q for a file without -from streams", command)
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	for s, want := range map[string]string{
+		"movie.mp4":        "movie.mp4",
+		"/media/a-b_c.mp4": "/media/a-b_c.mp4",
+		"it's here.mp4":    `'it'\''s here.mp4'`,
+		"$(rm -rf ~).mp4":  "'$(rm -rf ~).mp4'",
+		"":                 "''",
+	} {
+		if got := shellQuote(s); got != want {
+			t.Errorf("shellQuote(%q) = %s, want %s", s, got, want)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// Output formats of -format.
+const (
+	formatText  = "text"
+	formatJSON  = "json"
+	formatCSV   = "csv"
+	formatTable = "table"
+)
+
+var outputFormats = []string{formatText, formatJSON, formatCSV, formatTable}
+
+// validateFormat checks the value of -format.
+func validateFormat() error {
+	for _, format := range outputFormats {
+		if outputFormat == format {
+			return nil
+		}
+	}
+	return fmt.Errorf(`[validateFormat] unknown -format "%s", expected one of %v`, outputFormat, outputFormats)
+}
+
+// registerFormatFlags registers -format along with -json and -table, its
+// shorthands predating it.
+func registerFormatFlags(fs *flag.FlagSet) {
+	fs.StringVar(&outputFormat, "format", formatText, "output format: text, json, csv, or table, a table aligned in columns")
+	for _, format := range []string{formatJSON, formatTable} {
+		fs.BoolFunc(format, "shorthand for -format "+format, func(value string) error {
+			set, err := strconv.ParseBool(value)
+			if set {
+				outputFormat = format
+			}
+			return err
+		})
+	}
+	fs.BoolVar(&jsonSchema, "json-schema", false, "print the JSON Schema of the -format json output of the command and exit, for tools validating it")
+}
+
+// record is a result of a run, such as the information or the outcome of a
+// file, which can be reported in every format.
+type record interface {
+	printText()
+
+	// columns names the fields of row for csv and table
+	columns() []string
+	row() []string
+}
+
+// reporter writes the records of a run in one of the -format formats. Text
+// is written as records are reported, the other formats may wait for finish.
+type reporter interface {
+	report(r record) error
+	finish() error
+}
+
+// newReporter returns a reporter of records in format to w, which must be
+// os.Stdout for text.
+func newReporter(w io.Writer, format string) reporter {
+	switch format {
+	case formatJSON:
+		return &jsonReporter{w: w, records: []record{}}
+	case formatCSV:
+		return &csvReporter{w: csv.NewWriter(w)}
+	case formatTable:
+		return &tableReporter{w: tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)}
+	}
+	return textReporter{}
+}
+
+type textReporter struct{}
+
+func (textReporter) report(r record) error {
+	r.printText()
+	return nil
+}
+
+func (textReporter) finish() error {
+	return nil
+}
+
+// jsonReporter encodes all records as an indented array.
+type jsonReporter struct {
+	w       io.Writer
+	records []record
+}
+
+func (rep *jsonReporter) report(r record) error {
+	rep.records = append(rep.records, r)
+	return nil
+}
+
+func (rep *jsonReporter) finish() error {
+	enc := json.NewEncoder(rep.w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(rep.records); err != nil {
+		return fmt.Errorf(`[jsonReporter] failed encoding JSON: %w`, err)
+	}
+	return nil
+}
+
+// csvReporter writes a row per record after a header row of its columns.
+type csvReporter struct {
+	w      *csv.Writer
+	header bool
+}
+
+func (rep *csvReporter) report(r record) error {
+	if !rep.header {
+		rep.header = true
+		if err := rep.w.Write(r.columns()); err != nil {
+			return fmt.Errorf(`[csvReporter] %w`, err)
+		}
+	}
+	if err := rep.w.Write(r.row()); err != nil {
+		return fmt.Errorf(`[csvReporter] %w`, err)
+	}
+	return nil
+}
+
+func (rep *csvReporter) finish() error {
+	rep.w.Flush()
+	if err := rep.w.Error(); err != nil {
+		return fmt.Errorf(`[csvReporter] %w`, err)
+	}
+	return nil
+}
+
+// tableReporter aligns the records in columns under their upper case names.
+type tableReporter struct {
+	w      *tabwriter.Writer
+	header bool
+}
+
+func (rep *tableReporter) report(r record) error {
+	if !rep.header {
+		rep.header = true
+		fmt.Fprintln(rep.w, strings.ToUpper(strings.Join(r.columns(), "\t")))
+	}
+	fmt.Fprintln(rep.w, strings.Join(r.row(), "\t"))
+	return nil
+}
+
+func (rep *tableReporter) finish() error {
+	if err := rep.w.Flush(); err != nil {
+		return fmt.Errorf(`[tableReporter] %w`, err)
+	}
+	return nil
+}
+
+// commaList joins values for a csv or table cell, "-" standing for none.
+func commaList(values []string) string {
+	if len(values) == 0 {
+		return "-"
+	}
+	return strings.Join(values, ",")
+}
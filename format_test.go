@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"testing"
+)
+
+func TestReportResultsCSV(t *testing.T) {
+	results := []FileResult{
+		{File: "a,b.mp4", Status: statusDone, Codecs: []string{"dvhe", "mp4a"}, Changes: []Change{{Kind: "sample entry", From: "dvhe", To: "dvh1"}}},
+		{File: "c.mp4", Status: statusFailed, Err: errors.New("broken")},
+	}
+	var out bytes.Buffer
+	if err := reportResults(&out, formatCSV, results); err != nil {
+		t.Fatal(err)
+	}
+	want := `file,codecs,action,status
+"a,b.mp4","dvhe,mp4a",sample entry dvhe→dvh1 ×1,done
+c.mp4,-,none,failed: broken
+`
+	if out.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", out.String(), want)
+	}
+}
+
+func TestReportJSON(t *testing.T) {
+	var out bytes.Buffer
+	rep := newReporter(&out, formatJSON)
+	if err := rep.finish(); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "[]\n" {
+		t.Errorf("got %q for no records, want an empty array", out.String())
+	}
+
+	out.Reset()
+	rep = newReporter(&out, formatJSON)
+	for _, r := range []record{ListEntry{File: "a.mp4", Codecs: []string{"dvhe"}}, FileResult{File: "b.mp4", Status: statusSkipped, Reason: "filtered"}} {
+		if err := rep.report(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := rep.finish(); err != nil {
+		t.Fatal(err)
+	}
+	want := `[
+  {
+    "file": "a.mp4",
+    "codecs": [
+      "dvhe"
+    ]
+  },
+  {
+    "file": "b.mp4",
+    "status": "skipped",
+    "reason": "filtered",
+    "action": "skipped: filtered",
+    "changes": []
+  }
+]
+`
+	if out.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", out.String(), want)
+	}
+}
+
+func TestFormatFlags(t *testing.T) {
+	t.Cleanup(func() { outputFormat = formatText })
+	for _, test := range []struct {
+		args []string
+		want string
+	}{
+		{nil, formatText},
+		{[]string{"-format", "csv"}, formatCSV},
+		{[]string{"-json"}, formatJSON},
+		{[]string{"-table"}, formatTable},
+		{[]string{"-table=false"}, formatText},
+	} {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		registerFormatFlags(fs)
+		if err := fs.Parse(test.args); err != nil {
+			t.Fatal(err)
+		}
+		if outputFormat != test.want {
+			t.Errorf("%v: got -format %s, want %s", test.args, outputFormat, test.want)
+		}
+		if err := validateFormat(); err != nil {
+			t.Error(err)
+		}
+	}
+	outputFormat = "xml"
+	if err := validateFormat(); err == nil {
+		t.Error("accepted -format xml")
+	}
+}
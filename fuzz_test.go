@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+// parseBoxes runs the read-only traversals over data: the scan for moov and
+// its children used by convert, the Boxes iterator and Walk.
+func parseBoxes(data []byte) {
+	r := bytes.NewReader(data)
+	if h, err := findHeader(r, MoovBoxType, -1); err == nil && getBoxSize(h) >= getHeaderSize(h) {
+		_ = forEachBox(r, int64(getBoxSize(h)-getHeaderSize(h)), func(trak *Header) error {
+			if trak.Type != TrakBoxType {
+				return nil
+			}
+			_, _, err := findStsd(r, trak)
+			return err
+		})
+	}
+
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		panic(err)
+	}
+	for _, err := range Boxes(r, -1) {
+		if err != nil {
+			break
+		}
+	}
+
+	_ = Walk(r, BoxCounter{})
+	_, _ = inspect(r)
+}
+
+func FuzzParseBoxes(f *testing.F) {
+	f.Add([]byte{})
+	f.Add(movie(trak(visualSampleEntry("dvhe", 1920, 1080, box("dvcC", make([]byte, 24))))))
+	f.Add(movie(largeBox(trak(largeBox(visualSampleEntry("hev1", 1920, 1080))))))
+	f.Add(box("moov", box("trak", box("mdia", []byte{0, 0, 0, 0, 'm', 'i', 'n', 'f'}))))
+	f.Add(append(box("ftyp", []byte("isom")), 0, 0, 0, 0, 'm', 'd', 'a', 't'))
+	// boxes cut short by the end of the file
+	f.Add(largeBox(box("moov", box("trak", box("mdia", largeBox(fullBox("hdlr", 0, 0, make([]byte, 20), []byte("name")))))))[:60])
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			parseBoxes(data)
+		}()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("parsing %d bytes did not terminate", len(data))
+		}
+	})
+}
+
+func TestParseBoxesSmallSizes(t *testing.T) {
+	for size := uint32(0); size < 8; size++ {
+		header := make([]byte, 8)
+		binary.BigEndian.PutUint32(header, size)
+		copy(header[4:], "trak")
+		data := box("moov", header, make([]byte, 16))
+
+		err := forEachBox(bytes.NewReader(data[8:]), int64(len(data)-8), func(*Header) error { return nil })
+		if err == nil {
+			t.Errorf("size %d: forEachBox accepted an invalid size", size)
+		}
+		if _, err = findHeader(bytes.NewReader(data[8:]), StsdBoxType, int64(len(data)-8)); err == nil || errors.Is(err, io.EOF) {
+			t.Errorf("size %d: findHeader returned %v, want an invalid size error", size, err)
+		}
+	}
+}
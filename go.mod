@@ -1,3 +1,3 @@
 module github.com/rixtox/mp4dovi
 
-go 1.17
+go 1.23
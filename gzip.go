@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// errGzipInput is returned when converting a gzip-compressed file, which can
+// only be inspected.
+var errGzipInput = errors.New("gzip-compressed files can only be inspected, decompress them before converting")
+
+// isGzip reports whether r starts with the gzip magic number, leaving r
+// positioned at its start.
+func isGzip(r io.ReadSeeker) (ok bool, err error) {
+	magic := make([]byte, len(gzipMagic))
+	if _, err = io.ReadFull(r, magic); err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return false, fmt.Errorf(`[isGzip] failed reading magic number: %w`, err)
+	}
+	if _, err = r.Seek(0, io.SeekStart); err != nil {
+		return false, fmt.Errorf(`[isGzip] failed to seek: %w`, err)
+	}
+	return bytes.Equal(magic, gzipMagic), nil
+}
+
+// isGzipFile reports whether mp4file is gzip-compressed.
+func isGzipFile(mp4file string) (ok bool, err error) {
+	var r *os.File
+
+	if r, err = os.Open(mp4file); err != nil {
+		return false, fmt.Errorf(`[isGzipFile] cannot open file "%s": %w`, mp4file, err)
+	}
+	defer r.Close()
+	return isGzip(r)
+}
+
+// openForInspection opens mp4file for reading. A gzip-compressed file, such
+// as an archived movie.mp4.gz, is decompressed to a temporary file first since
+// gzip streams cannot be seeked; closing the returned file removes it.
+func openForInspection(mp4file string) (r io.ReadSeekCloser, err error) {
+	var (
+		f   *os.File
+		zr  *gzip.Reader
+		tmp *os.File
+		ok  bool
+	)
+
+	if f, err = os.Open(mp4file); err != nil {
+		return nil, fmt.Errorf(`[openForInspection] cannot open file "%s": %w`, mp4file, err)
+	}
+	if ok, err = isGzip(f); err != nil || !ok {
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf(`[openForInspection] %w`, err)
+		}
+		return f, nil
+	}
+	defer f.Close()
+
+	if zr, err = gzip.NewReader(f); err != nil {
+		return nil, fmt.Errorf(`[openForInspection] cannot read gzip header of "%s": %w`, mp4file, err)
+	}
+	defer zr.Close()
+
+	if tmp, err = os.CreateTemp(tempDir, filepath.Base(mp4file)+".*.mp4"); err != nil {
+		return nil, fmt.Errorf(`[openForInspection] cannot create temporary file: %w`, err)
+	}
+	r = &removeOnClose{tmp}
+	if verbose {
+		fmt.Printf("[openForInspection] decompressing %s to %s\n", mp4file, tmp.Name())
+	}
+	if _, err = io.Copy(tmp, zr); err == nil {
+		_, err = tmp.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		r.Close()
+		return nil, fmt.Errorf(`[openForInspection] failed decompressing "%s": %w`, mp4file, err)
+	}
+	return r, nil
+}
+
+// removeOnClose is a temporary file removed when closed.
+type removeOnClose struct {
+	*os.File
+}
+
+func (f *removeOnClose) Close() error {
+	err := f.File.Close()
+	if removeErr := os.Remove(f.Name()); err == nil {
+		err = removeErr
+	}
+	return err
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const hexPreviewContext = 16
+
+// printHexPreview prints the bytes around the FourCC at offset in hex, with
+// the FourCC itself in brackets. The cursor of r is left where it was.
+func printHexPreview(r io.ReadSeeker, label string, offset int64) (err error) {
+	var cur int64
+
+	if cur, err = r.Seek(0, io.SeekCurrent); err != nil {
+		return fmt.Errorf(`[printHexPreview] failed to get current offset with seek: %w`, err)
+	}
+	defer func() {
+		if _, seekErr := r.Seek(cur, io.SeekStart); seekErr != nil && err == nil {
+			err = fmt.Errorf(`[printHexPreview] failed to restore offset: %w`, seekErr)
+		}
+	}()
+
+	start := offset - hexPreviewContext
+	if start < 0 {
+		start = 0
+	}
+	if _, err = r.Seek(start, io.SeekStart); err != nil {
+		return fmt.Errorf(`[printHexPreview] failed to seek: %w`, err)
+	}
+	buf := make([]byte, offset-start+4+hexPreviewContext)
+	n, err := io.ReadFull(r, buf)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return fmt.Errorf(`[printHexPreview] failed reading: %w`, err)
+	}
+	err = nil
+
+	// The FourCC is cut short, or missing, only in truncated files.
+	buf = buf[:n]
+	at := min(int(offset-start), n)
+	end := min(at+4, n)
+	preview := strings.TrimSpace(hex.EncodeToString(buf[:at]) + " [" + hex.EncodeToString(buf[at:end]) + "] " + hex.EncodeToString(buf[end:]))
+	fmt.Printf("  %-6s %08x: %s\n", label, start, preview)
+	return
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestPrintHexPreview(t *testing.T) {
+	data := []byte("\x00\x00\x00\x10dvhe0123456789abcdefghijklmnopqrstuvwxyz")
+	for _, test := range []struct {
+		name   string
+		data   []byte
+		offset int64
+		want   string
+	}{
+		{"near start", data, 4, "  before 00000000: 00000010 [64766865] 30313233343536373839616263646566\n"},
+		{"middle", data, 20, "  before 00000004: 64766865303132333435363738396162 [63646566] 6768696a6b6c6d6e6f70717273747576\n"},
+		{"near end", data, int64(len(data) - 6), "  before 00000016: 65666768696a6b6c6d6e6f7071727374 [75767778] 797a\n"},
+		{"at end", data, int64(len(data) - 4), "  before 00000018: 6768696a6b6c6d6e6f70717273747576 [7778797a]\n"},
+		{"truncated", data, int64(len(data) - 2), "  before 0000001a: 696a6b6c6d6e6f707172737475767778 [797a]\n"},
+	} {
+		r := bytes.NewReader(test.data)
+		if _, err := r.Seek(7, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		printed := captureStdout(t, func() {
+			if err := printHexPreview(r, "before", test.offset); err != nil {
+				t.Fatal(err)
+			}
+		})
+		if printed != test.want {
+			t.Errorf("%s: printed %q, want %q", test.name, printed, test.want)
+		}
+		if cur, _ := r.Seek(0, io.SeekCurrent); cur != 7 {
+			t.Errorf("%s: left the cursor at %d, want 7", test.name, cur)
+		}
+	}
+}
@@ -0,0 +1,633 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+)
+
+// SampleEntryInfo describes a sample entry and the boxes it carries.
+type SampleEntryInfo struct {
+	Codec  string `json:"codec"`
+	Offset int64  `json:"offset"`
+
+	// Fixed fields of visual sample entries
+	Width          uint16 `json:"width,omitempty"`
+	Height         uint16 `json:"height,omitempty"`
+	CompressorName string `json:"compressorName,omitempty"`
+
+	// Types of the child boxes, such as the hvcC or dvcC configuration
+	Boxes []string `json:"boxes"`
+
+	// From the sinf of protected sample entries such as encv
+	OriginalFormat   string `json:"originalFormat,omitempty"`
+	ProtectionScheme string `json:"protectionScheme,omitempty"`
+
+	DolbyVision *DolbyVisionConfig `json:"dolbyVision,omitempty"`
+	HEVC        *HevcConfig        `json:"hevc,omitempty"`
+	AV1         *Av1Config         `json:"av1,omitempty"`
+
+	// From the vexu and hfov boxes of stereo and spatial video
+	Spatial *SpatialVideo `json:"spatial,omitempty"`
+
+	PixelAspectRatio  *PaspBox           `json:"pixelAspectRatio,omitempty"`
+	MasteringDisplay  *MasteringDisplay  `json:"masteringDisplay,omitempty"`
+	ContentLightLevel *ContentLightLevel `json:"contentLightLevel,omitempty"`
+}
+
+func (entry *SampleEntryInfo) hasBox(boxTypes ...string) bool {
+	for _, b := range entry.Boxes {
+		for _, t := range boxTypes {
+			if b == t {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type TrackInfo struct {
+	// From the track header
+	TrackID uint32  `json:"trackId,omitempty"`
+	Enabled bool    `json:"enabled"`
+	Width   float64 `json:"width,omitempty"`
+	Height  float64 `json:"height,omitempty"`
+
+	HandlerType   string            `json:"handlerType,omitempty"`
+	HandlerName   string            `json:"handlerName,omitempty"`
+	Codecs        []string          `json:"codecs"`
+	SampleEntries []SampleEntryInfo `json:"sampleEntries"`
+
+	// From the media header
+	Timescale uint32 `json:"timescale,omitempty"`
+	Duration  uint64 `json:"duration,omitempty"`
+	Language  string `json:"language,omitempty"`
+
+	EditList []EditListEntry `json:"editList,omitempty"`
+
+	// Meta boxes of the track, such as those holding thumbnails
+	Meta []MetaInfo `json:"meta,omitempty"`
+}
+
+// FragmentInfo describes which sample descriptions the fragments of a track use.
+type FragmentInfo struct {
+	TrackID                       uint32 `json:"trackId"`
+	DefaultSampleDescriptionIndex uint32 `json:"defaultSampleDescriptionIndex"`
+
+	// Indexes overriding the default in track fragment headers
+	FragmentSampleDescriptionIndexes []uint32 `json:"fragmentSampleDescriptionIndexes,omitempty"`
+}
+
+type FileInfo struct {
+	File string `json:"file"`
+
+	// MoovOffset is the offset of the first moov box, -1 if there is none.
+	// FastStart is set if it precedes the media data.
+	MoovOffset int64 `json:"moovOffset"`
+	FastStart  bool  `json:"fastStart"`
+
+	MajorBrand       string   `json:"majorBrand,omitempty"`
+	MinorVersion     uint32   `json:"minorVersion,omitempty"`
+	CompatibleBrands []string `json:"compatibleBrands,omitempty"`
+
+	Timescale uint32         `json:"timescale"`
+	Duration  uint64         `json:"duration"`
+	Tracks    []TrackInfo    `json:"tracks"`
+	Fragments []FragmentInfo `json:"fragments,omitempty"`
+
+	// Protected is set if the file is protected with Common Encryption, as
+	// told by protected sample entries or pssh boxes, described by Protection
+	Protected  bool            `json:"protected"`
+	Protection *ProtectionInfo `json:"protection,omitempty"`
+
+	// Meta boxes at the top level or in moov, such as those holding thumbnails
+	Meta []MetaInfo `json:"meta,omitempty"`
+
+	// Encoder is the application that wrote the file from the ©too tag of
+	// the movie with -tags
+	Encoder string `json:"encoder,omitempty"`
+
+	// Boxes lists every box of the file with -show-offsets
+	Boxes []BoxOffset `json:"boxes,omitempty"`
+}
+
+// protect marks the file as protected and returns its protection details.
+func (info *FileInfo) protect() *ProtectionInfo {
+	info.Protected = true
+	if info.Protection == nil {
+		info.Protection = &ProtectionInfo{}
+	}
+	return info.Protection
+}
+
+func (info *FileInfo) fragment(trackID uint32) *FragmentInfo {
+	for i := range info.Fragments {
+		if info.Fragments[i].TrackID == trackID {
+			return &info.Fragments[i]
+		}
+	}
+	info.Fragments = append(info.Fragments, FragmentInfo{TrackID: trackID})
+	return &info.Fragments[len(info.Fragments)-1]
+}
+
+// hasBrand reports whether brand is the major or a compatible brand of the file.
+func (info *FileInfo) hasBrand(brand string) bool {
+	if info.MajorBrand == brand {
+		return true
+	}
+	for _, b := range info.CompatibleBrands {
+		if b == brand {
+			return true
+		}
+	}
+	return false
+}
+
+// DurationSeconds returns the movie duration in seconds, or 0 if the timescale is unknown.
+func (info *FileInfo) DurationSeconds() float64 {
+	if info.Timescale == 0 {
+		return 0
+	}
+	return float64(info.Duration) / float64(info.Timescale)
+}
+
+// infoVisitor collects a FileInfo while walking a file.
+type infoVisitor struct {
+	r    io.ReadSeeker
+	info *FileInfo
+	mdat bool
+}
+
+func (v *infoVisitor) currentTrack() *TrackInfo {
+	if len(v.info.Tracks) == 0 {
+		return nil
+	}
+	return &v.info.Tracks[len(v.info.Tracks)-1]
+}
+
+func (v *infoVisitor) currentSampleEntry() *SampleEntryInfo {
+	track := v.currentTrack()
+	if track == nil || len(track.SampleEntries) == 0 {
+		return nil
+	}
+	return &track.SampleEntries[len(track.SampleEntries)-1]
+}
+
+func (v *infoVisitor) EnterBox(path []BoxType, h Header) (descend bool, err error) {
+	if len(path) == 1 {
+		switch {
+		case h.Type == MdatBoxType:
+			v.mdat = true
+		case h.Type == MoovBoxType && v.info.MoovOffset < 0:
+			v.info.MoovOffset = h.Offset
+			v.info.FastStart = !v.mdat
+		}
+	}
+
+	switch h.Type {
+	case FtypBoxType:
+		if len(path) != 1 || v.info.MajorBrand != "" {
+			return false, nil
+		}
+		var ftyp *FtypBox
+		if ftyp, err = readFtypBox(v.r, h.PayloadSize()); err != nil {
+			return false, err
+		}
+		v.info.MajorBrand, v.info.MinorVersion = string(ftyp.MajorBrand[:]), ftyp.MinorVersion
+		for _, brand := range ftyp.CompatibleBrands {
+			v.info.CompatibleBrands = append(v.info.CompatibleBrands, string(brand[:]))
+		}
+		return false, nil
+	case MoovBoxType, MdiaBoxType, MinfBoxType, StblBoxType, StsdBoxType, MvexBoxType, MoofBoxType, TrafBoxType, EdtsBoxType:
+		return true, nil
+	case UdtaBoxType:
+		// Only the user data of the movie and of its tracks holds tags
+		return readTags && len(path) >= 2 && (path[len(path)-2] == MoovBoxType || path[len(path)-2] == TrakBoxType), nil
+	case MetaBoxType:
+		parent := MoovBoxType
+		if len(path) >= 2 {
+			parent = path[len(path)-2]
+		}
+		// The meta box of udta belongs to the movie or track holding it.
+		if parent == UdtaBoxType && len(path) >= 3 {
+			parent = path[len(path)-3]
+		}
+		track := v.currentTrack()
+		if parent != MoovBoxType && (parent != TrakBoxType || track == nil) {
+			return false, nil
+		}
+		// What a malformed meta box holds is reported as far as it parses,
+		// as it does not affect the sample entries.
+		meta, metaErr := inspectMeta(v.r, path, h)
+		if metaErr != nil && verbose {
+			fmt.Printf("[inspect] meta at %d(%#x): %v, ignored\n", h.Offset, h.Offset, metaErr)
+		}
+		if parent == TrakBoxType {
+			track.Meta = append(track.Meta, *meta)
+		} else {
+			v.info.Meta = append(v.info.Meta, *meta)
+			for _, tag := range meta.Tags {
+				if tag.Key == tagKey(ToolTagType) && v.info.Encoder == "" {
+					v.info.Encoder = tag.Value
+				}
+			}
+		}
+		return false, nil
+	case ElstBoxType:
+		track := v.currentTrack()
+		if track == nil {
+			return false, nil
+		}
+		var elst *ElstBox
+		if elst, err = readElstBox(v.r); err != nil {
+			return false, err
+		}
+		track.EditList = elst.Entries
+		return false, nil
+	case TrexBoxType:
+		var trex *TrexBox
+		if trex, err = readTrexBox(v.r); err != nil {
+			return false, err
+		}
+		v.info.fragment(trex.TrackID).DefaultSampleDescriptionIndex = trex.DefaultSampleDescriptionIndex
+		return false, nil
+	case TfhdBoxType:
+		var tfhd *TfhdBox
+		if tfhd, err = readTfhdBox(v.r); err != nil {
+			return false, err
+		}
+		if tfhd.SampleDescriptionIndex == 0 {
+			return false, nil
+		}
+		fragment := v.info.fragment(tfhd.TrackID)
+		for _, index := range fragment.FragmentSampleDescriptionIndexes {
+			if index == tfhd.SampleDescriptionIndex {
+				return false, nil
+			}
+		}
+		fragment.FragmentSampleDescriptionIndexes = append(fragment.FragmentSampleDescriptionIndexes, tfhd.SampleDescriptionIndex)
+		return false, nil
+	case PsshBoxType:
+		var pssh *PsshBox
+		if pssh, err = readPsshBox(v.r); err != nil {
+			return false, err
+		}
+		v.info.protect().addSystem(pssh.SystemIDString())
+		return false, nil
+	case TrakBoxType:
+		v.info.Tracks = append(v.info.Tracks, TrackInfo{Codecs: []string{}, SampleEntries: []SampleEntryInfo{}})
+		return true, nil
+	case MvhdBoxType:
+		var mvhd *MvhdBox
+		if mvhd, err = readMvhdBox(v.r); err != nil {
+			return false, err
+		}
+		v.info.Timescale = mvhd.Timescale
+		v.info.Duration = mvhd.Duration
+		return false, nil
+	case TkhdBoxType:
+		track := v.currentTrack()
+		if track == nil || len(path) < 2 || path[len(path)-2] != TrakBoxType {
+			return false, nil
+		}
+		var tkhd *TkhdBox
+		if tkhd, err = readTkhdBox(v.r); err != nil {
+			return false, err
+		}
+		track.TrackID = tkhd.TrackID
+		track.Enabled = tkhd.Enabled()
+		track.Width, track.Height = tkhd.Width, tkhd.Height
+		return false, nil
+	case MdhdBoxType:
+		track := v.currentTrack()
+		if track == nil || len(path) < 2 || path[len(path)-2] != MdiaBoxType {
+			return false, nil
+		}
+		var mdhd *MdhdBox
+		if mdhd, err = readMdhdBox(v.r); err != nil {
+			return false, err
+		}
+		track.Timescale = mdhd.Timescale
+		track.Duration = mdhd.Duration
+		track.Language = mdhd.Language
+		return false, nil
+	case HdlrBoxType:
+		track := v.currentTrack()
+		if track == nil || len(path) < 2 || path[len(path)-2] != MdiaBoxType {
+			return false, nil
+		}
+		var hdlr *HdlrBox
+		if hdlr, err = readHdlrBox(v.r, h.PayloadSize()); err != nil {
+			return false, err
+		}
+		track.HandlerType = string(hdlr.HandlerType[:])
+		track.HandlerName = hdlr.Name
+		return false, nil
+	}
+	if len(path) >= 2 && path[len(path)-2] == StsdBoxType {
+		track := v.currentTrack()
+		if track == nil {
+			return false, nil
+		}
+		entry := SampleEntryInfo{Codec: h.Type.String(), Offset: h.Offset, Boxes: []string{}}
+		if visualSampleEntryTypes[entry.Codec] {
+			visual, deviations, err := readVisualSampleEntry(v.r)
+			if err == nil {
+				entry.Width, entry.Height, entry.CompressorName = visual.Width, visual.Height, visual.CompressorName
+			} else {
+				deviations = []string{err.Error()}
+			}
+			if verbose {
+				for _, deviation := range deviations {
+					fmt.Printf("[inspect] sample entry %s at %d(%#x): %s, ignored\n", h.Type, h.Offset, h.Offset, deviation)
+				}
+			}
+		}
+		track.Codecs = append(track.Codecs, h.Type.String())
+		track.SampleEntries = append(track.SampleEntries, entry)
+		return true, nil
+	}
+	if len(path) >= 3 && path[len(path)-3] == StsdBoxType {
+		entry := v.currentSampleEntry()
+		if entry == nil {
+			return false, nil
+		}
+		entry.Boxes = append(entry.Boxes, h.Type.String())
+		switch h.Type.String() {
+		case "dvcC", "dvvC", "dvwC":
+			if entry.DolbyVision, err = readDolbyVisionConfig(v.r); err != nil {
+				return false, err
+			}
+		case "hvcC":
+			if entry.HEVC, err = readHevcConfig(v.r); err != nil {
+				return false, err
+			}
+		case "av1C":
+			if entry.AV1, err = readAv1Config(v.r); err != nil {
+				return false, err
+			}
+		case "pasp":
+			if entry.PixelAspectRatio, err = readPaspBox(v.r); err != nil {
+				return false, err
+			}
+		case "mdcv":
+			if entry.MasteringDisplay, err = readMasteringDisplay(v.r); err != nil {
+				return false, err
+			}
+		case "clli":
+			if entry.ContentLightLevel, err = readContentLightLevel(v.r); err != nil {
+				return false, err
+			}
+		case "sinf":
+			v.info.protect()
+			return true, nil
+		case "vexu", "hfov":
+			if entry.Spatial == nil {
+				entry.Spatial = &SpatialVideo{}
+			}
+			return readSpatialBox(v.r, &h, entry.Spatial)
+		}
+	}
+	if inVexu(path) {
+		if entry := v.currentSampleEntry(); entry != nil && entry.Spatial != nil {
+			return readSpatialBox(v.r, &h, entry.Spatial)
+		}
+		return false, nil
+	}
+	if len(path) >= 4 && path[len(path)-4] == StsdBoxType && path[len(path)-2] == SinfBoxType {
+		entry := v.currentSampleEntry()
+		if entry == nil {
+			return false, nil
+		}
+		switch h.Type {
+		case FrmaBoxType:
+			var format BoxType
+			if err = binary.Read(v.r, binary.BigEndian, &format); err != nil {
+				return false, fmt.Errorf(`[infoVisitor] failed reading original format: %w`, err)
+			}
+			entry.OriginalFormat = format.String()
+		case SchmBoxType:
+			var schm *SchmBox
+			if schm, err = readSchmBox(v.r); err != nil {
+				return false, err
+			}
+			entry.ProtectionScheme = schm.SchemeType.String()
+			v.info.protect().addScheme(entry.ProtectionScheme)
+		}
+	}
+	return false, nil
+}
+
+func (v *infoVisitor) LeaveBox(path []BoxType, h Header) error {
+	return nil
+}
+
+func inspect(r io.ReadSeeker) (info *FileInfo, err error) {
+	info = &FileInfo{MoovOffset: -1, Tracks: []TrackInfo{}}
+
+	if err = Walk(r, &infoVisitor{r: r, info: info}); err != nil {
+		return nil, fmt.Errorf(`[inspect] failed walking boxes: %w`, err)
+	}
+	return
+}
+
+// inspectFile inspects mp4file, decompressing it first if it is gzip-compressed.
+// With -parallel-boxes the traks are inspected concurrently, and with
+// -strip-prefix the file is inspected from the first box.
+func inspectFile(mp4file string) (info *FileInfo, err error) {
+	var r io.ReadSeekCloser
+
+	if r, err = openForInspection(mp4file); err != nil {
+		return nil, fmt.Errorf(`[inspectFile] %w`, err)
+	}
+	defer r.Close()
+
+	if r, err = skipPrefix(r, mp4file); err != nil {
+		return nil, fmt.Errorf(`[inspectFile] %w`, err)
+	}
+
+	if f, ok := r.(*os.File); ok && parallelBoxes {
+		var stat os.FileInfo
+		if stat, err = f.Stat(); err != nil {
+			return nil, fmt.Errorf(`[inspectFile] cannot stat file "%s": %w`, mp4file, err)
+		}
+		info, err = inspectAt(f, stat.Size())
+	} else {
+		info, err = inspect(r)
+	}
+	if err != nil {
+		return nil, err
+	}
+	info.File = mp4file
+	return
+}
+
+// printSampleEntryConfig prints the stream characteristics described by the
+// configuration boxes of a sample entry, if any.
+func printSampleEntryConfig(entry *SampleEntryInfo) {
+	if entry.HEVC == nil && entry.DolbyVision == nil && entry.AV1 == nil {
+		printPixelAspectRatio(entry)
+		printSpatialVideo(entry)
+		printHDRMetadata(entry)
+		return
+	}
+	fmt.Printf("    %s:", entry.Codec)
+	if c := entry.AV1; c != nil {
+		tier := "Main"
+		if c.HighTier {
+			tier = "High"
+		}
+		fmt.Printf(" AV1 %s profile, %s tier, level %s, %s, %d-bit", c.ProfileName(), tier, c.LevelName(), c.ChromaFormatName(), c.BitDepth)
+	}
+	if c := entry.HEVC; c != nil {
+		tier := "Main"
+		if c.HighTier {
+			tier = "High"
+		}
+		fmt.Printf(" HEVC %s profile, %s tier, level %.3g, %s, %d-bit luma, %d-bit chroma", c.ProfileName(), tier, c.Level(), c.ChromaFormatName(), c.BitDepthLuma, c.BitDepthChroma)
+	}
+	if c := entry.DolbyVision; c != nil {
+		if entry.HEVC != nil {
+			fmt.Printf(";")
+		}
+		fmt.Printf(" Dolby Vision profile %d level %d", c.Profile, c.Level)
+	}
+	fmt.Println()
+	printPixelAspectRatio(entry)
+	printSpatialVideo(entry)
+	printHDRMetadata(entry)
+}
+
+// printPixelAspectRatio prints the pixel aspect ratio of a sample entry,
+// unless it has none or its pixels are square.
+func printPixelAspectRatio(entry *SampleEntryInfo) {
+	if p := entry.PixelAspectRatio; p != nil && p.HSpacing != p.VSpacing {
+		fmt.Printf("    %s: pixel aspect ratio %d:%d (%.4g)\n", entry.Codec, p.HSpacing, p.VSpacing, p.Ratio())
+	}
+}
+
+// printHDRMetadata prints the HDR10 static metadata of a sample entry, if any.
+func printHDRMetadata(entry *SampleEntryInfo) {
+	if d := entry.MasteringDisplay; d != nil {
+		p, w := d.Primaries, d.WhitePoint
+		fmt.Printf("    %s: mastering display R(%.4f,%.4f) G(%.4f,%.4f) B(%.4f,%.4f) white point (%.4f,%.4f), luminance %.4f-%g cd/m²\n",
+			entry.Codec, p[2].X, p[2].Y, p[0].X, p[0].Y, p[1].X, p[1].Y, w.X, w.Y, d.MinLuminance, d.MaxLuminance)
+	}
+	if l := entry.ContentLightLevel; l != nil {
+		fmt.Printf("    %s: content light level MaxCLL %d cd/m², MaxFALL %d cd/m²\n", entry.Codec, l.MaxCLL, l.MaxFALL)
+	}
+}
+
+func printInfo(info *FileInfo) {
+	fmt.Printf("%s:\n", info.File)
+	if info.MajorBrand != "" {
+		fmt.Printf("  brands: %s (minor version %d), compatible %v\n", info.MajorBrand, info.MinorVersion, info.CompatibleBrands)
+	}
+	if info.Encoder != "" {
+		fmt.Printf("  encoder: %s\n", info.Encoder)
+	}
+	switch {
+	case info.MoovOffset < 0:
+		fmt.Printf("  moov: none\n")
+	case info.FastStart:
+		fmt.Printf("  moov: at %d(%#x), before the media data\n", info.MoovOffset, info.MoovOffset)
+	default:
+		fmt.Printf("  moov: at %d(%#x), after the media data\n", info.MoovOffset, info.MoovOffset)
+	}
+	fmt.Printf("  timescale: %d\n", info.Timescale)
+	fmt.Printf("  duration: %d (%.3fs)\n", info.Duration, info.DurationSeconds())
+	printProtection(info.Protection)
+	for i, track := range info.Tracks {
+		fmt.Printf("  track %d: %v", i+1, track.Codecs)
+		if track.TrackID != 0 {
+			fmt.Printf(" ID %d", track.TrackID)
+			if !track.Enabled {
+				fmt.Printf(" (disabled)")
+			}
+		}
+		if track.HandlerType != "" {
+			fmt.Printf(" handler %s %q", track.HandlerType, track.HandlerName)
+		}
+		if track.Language != "" {
+			fmt.Printf(" language %s", track.Language)
+		}
+		fmt.Println()
+		for _, entry := range track.SampleEntries {
+			printSampleEntryConfig(&entry)
+		}
+		for _, edit := range track.EditList {
+			fmt.Printf("    edit: duration %d media time %d rate %g\n", edit.SegmentDuration, edit.MediaTime, edit.MediaRate)
+		}
+		for _, meta := range track.Meta {
+			printMeta("    ", &meta)
+		}
+	}
+	for _, meta := range info.Meta {
+		printMeta("  ", &meta)
+	}
+	for _, fragment := range info.Fragments {
+		fmt.Printf("  fragments of track ID %d: default sample description %d", fragment.TrackID, fragment.DefaultSampleDescriptionIndex)
+		if len(fragment.FragmentSampleDescriptionIndexes) > 0 {
+			fmt.Printf(", overridden with %v", fragment.FragmentSampleDescriptionIndexes)
+		}
+		fmt.Println()
+	}
+	if len(info.Boxes) > 0 {
+		printBoxOffsets(info.Boxes)
+	}
+}
+
+func runInfo(ctx context.Context, mp4files []string) (err error) {
+	if trackCount {
+		return runTrackCount(ctx, mp4files)
+	}
+	total := len(mp4files)
+	mp4files = sampleFiles(mp4files)
+
+	infos := make([]*FileInfo, 0, len(mp4files))
+	rep := newReporter(os.Stdout, outputFormat)
+	for i, mp4file := range mp4files {
+		var info *FileInfo
+		if err = ctx.Err(); err != nil {
+			return fmt.Errorf(`[runInfo] interrupted after %d of %d files: %w`, i, len(mp4files), err)
+		}
+		if info, err = inspectFile(mp4file); err != nil {
+			return fmt.Errorf(`[runInfo] failed inspecting file %s: %w`, mp4file, err)
+		}
+		if showOffsets {
+			if info.Boxes, err = boxOffsetsFile(mp4file); err != nil {
+				return fmt.Errorf(`[runInfo] failed listing boxes of file %s: %w`, mp4file, err)
+			}
+		}
+		infos = append(infos, info)
+		if err = rep.report(info); err != nil {
+			return fmt.Errorf(`[runInfo] %w`, err)
+		}
+	}
+	if err = rep.finish(); err != nil {
+		return fmt.Errorf(`[runInfo] %w`, err)
+	}
+	if sampleSize > 0 && outputFormat == formatText {
+		printSampleSummary(infos, total)
+	}
+	return
+}
+
+func (info *FileInfo) printText() {
+	printInfo(info)
+}
+
+func (info *FileInfo) columns() []string {
+	return []string{"file", "brand", "duration", "tracks", "codecs", "protected"}
+}
+
+func (info *FileInfo) row() []string {
+	brand := info.MajorBrand
+	if brand == "" {
+		brand = "-"
+	}
+	return []string{info.File, brand, fmt.Sprintf("%.3f", info.DurationSeconds()), strconv.Itoa(len(info.Tracks)), commaList(info.codecs()), strconv.FormatBool(info.Protected)}
+}
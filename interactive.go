@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+)
+
+// stdin is shared by all prompts so that buffered answers are not lost
+// between files.
+var stdin = bufio.NewReader(os.Stdin)
+
+// confirm asks question on out and reports whether the answer read from in
+// is yes. Anything else, including the end of the input, means no.
+func confirm(in *bufio.Reader, out io.Writer, question string) bool {
+	fmt.Fprintf(out, "%s [y/N] ", question)
+	answer, err := in.ReadString('\n')
+	if err != nil && answer == "" {
+		fmt.Fprintln(out)
+		return false
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	}
+	return false
+}
+
+// isTerminal reports whether f is a character device such as a terminal.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// confirmConversion asks whether to convert mp4file with -interactive, unless
+// -y is set or stdin is not a terminal. Files without a -from sample entry
+// are not changed and are converted without asking.
+func confirmConversion(mp4file string) (ok bool, err error) {
+	if !interactive || assumeYes || !isTerminal(os.Stdin) {
+		return true, nil
+	}
+	if !anywhere {
+		var info *FileInfo
+		if info, err = inspectFile(mp4file); err != nil {
+			return false, fmt.Errorf(`[confirmConversion] %w`, err)
+		}
+		if !slices.ContainsFunc(info.codecs(), matchesFrom) {
+			return true, nil
+		}
+	}
+	return confirm(stdin, os.Stdout, fmt.Sprintf("Convert %s→%s in %s?", codecFrom, codecTo, mp4file)), nil
+}
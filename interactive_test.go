@@ -0,0 +1,29 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestConfirm(t *testing.T) {
+	tests := []struct {
+		input string
+		want  bool
+	}{
+		{input: "y\n", want: true},
+		{input: "YES\n", want: true},
+		{input: " y \r\n", want: true},
+		{input: "y", want: true},
+		{input: "\n", want: false},
+		{input: "n\n", want: false},
+		{input: "maybe\n", want: false},
+		{input: "", want: false},
+	}
+	for _, tt := range tests {
+		if got := confirm(bufio.NewReader(strings.NewReader(tt.input)), io.Discard, "Convert?"); got != tt.want {
+			t.Errorf("answer %q: got %v, want %v", tt.input, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"iter"
+)
+
+var errStopIteration = errors.New("iteration stopped")
+
+// Boxes returns an iterator over the sibling boxes starting at the current
+// offset of r, within limit bytes or up to the end of r if limit is negative.
+// The reader is positioned right after the header of each yielded box. Any
+// error is yielded once as the last element; reaching the end of r with a
+// negative limit ends the iteration without an error.
+func Boxes(r io.ReadSeeker, limit int64) iter.Seq2[Header, error] {
+	return func(yield func(Header, error) bool) {
+		err := forEachBox(r, limit, func(h *Header) error {
+			if !yield(*h, nil) {
+				return errStopIteration
+			}
+			return nil
+		})
+		if err == nil || errors.Is(err, errStopIteration) {
+			return
+		}
+		if limit < 0 && errors.Is(err, io.EOF) {
+			return
+		}
+		yield(Header{}, err)
+	}
+}
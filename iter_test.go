@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func ExampleBoxes() {
+	data := movie(trak(visualSampleEntry("dvhe", 1920, 1080)))
+
+	for h, err := range Boxes(bytes.NewReader(data), -1) {
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		fmt.Println(h.Type, getBoxSize(&h))
+	}
+	// Output:
+	// ftyp 24
+	// moov 142
+	// mdat 24
+}
+
+func TestBoxesLimit(t *testing.T) {
+	data := movie(trak(visualSampleEntry("dvhe", 1920, 1080)))
+
+	var types []string
+	for h, err := range Boxes(bytes.NewReader(data), 24+134) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		types = append(types, h.Type.String())
+	}
+	if fmt.Sprint(types) != "[ftyp moov]" {
+		t.Errorf("got %v", types)
+	}
+}
+
+func TestBoxesPropagatesErrors(t *testing.T) {
+	data := movie()
+	var got error
+	for _, err := range Boxes(bytes.NewReader(data[:len(data)-20]), int64(len(data))) {
+		got = err
+	}
+	if got == nil {
+		t.Error("expected an error for a truncated file")
+	}
+}
+
+func TestBoxesStopsEarly(t *testing.T) {
+	data := movie()
+	n := 0
+	for range Boxes(bytes.NewReader(data), -1) {
+		n++
+		break
+	}
+	if n != 1 {
+		t.Errorf("got %d iterations", n)
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// jsonSchemaDraft is the JSON Schema dialect -json-schema describes the output
+// in.
+const jsonSchemaDraft = "https://json-schema.org/draft/2020-12/schema"
+
+// schemaGenerator derives JSON Schemas from the structs encoding/json encodes,
+// following their json tags. Named structs are described once in $defs.
+type schemaGenerator struct {
+	defs map[string]any
+
+	// names overrides the $defs name of a type
+	names map[reflect.Type]string
+
+	// enums lists the only values of string types
+	enums map[reflect.Type][]string
+
+	err error
+}
+
+func newSchemaGenerator() *schemaGenerator {
+	statuses := make([]string, len(summaryOrder))
+	for i, status := range summaryOrder {
+		statuses[i] = string(status)
+	}
+	return &schemaGenerator{
+		defs:  make(map[string]any),
+		names: map[reflect.Type]string{reflect.TypeFor[fileResultJSON](): "FileResult"},
+		enums: map[reflect.Type][]string{reflect.TypeFor[fileStatus](): statuses},
+	}
+}
+
+// schema returns the schema of the values of type t.
+func (g *schemaGenerator) schema(t reflect.Type) map[string]any {
+	switch t.Kind() {
+	case reflect.Pointer:
+		return g.schema(t.Elem())
+	case reflect.Struct:
+		if t == reflect.TypeFor[time.Time]() {
+			return map[string]any{"type": "string", "format": "date-time"}
+		}
+		name := g.names[t]
+		if name == "" {
+			name = t.Name()
+		}
+		if _, ok := g.defs[name]; !ok {
+			// Set first, as the struct may refer to itself
+			g.defs[name] = nil
+			g.defs[name] = g.object(t)
+		}
+		return map[string]any{"$ref": "#/$defs/" + name}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string", "contentEncoding": "base64"}
+		}
+		return map[string]any{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.String:
+		if values, ok := g.enums[t]; ok {
+			return map[string]any{"type": "string", "enum": values}
+		}
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]any{"type": "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer", "minimum": 0}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	}
+	if g.err == nil {
+		g.err = fmt.Errorf(`[schemaGenerator] no JSON Schema for type %s`, t)
+	}
+	return map[string]any{}
+}
+
+// object returns the schema of the struct t. Fields tagged omitempty are
+// optional, pointers, slices and maps without it may be null.
+func (g *schemaGenerator) object(t reflect.Type) map[string]any {
+	properties := make(map[string]any)
+	required := []string{}
+	for _, field := range reflect.VisibleFields(t) {
+		if !field.IsExported() || field.Anonymous {
+			continue
+		}
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = field.Name
+		}
+		schema := g.schema(field.Type)
+		omitEmpty := strings.Contains(","+options+",", ",omitempty,")
+		switch field.Type.Kind() {
+		case reflect.Pointer, reflect.Slice, reflect.Map:
+			if !omitEmpty && field.Type != reflect.TypeFor[[]byte]() {
+				schema = map[string]any{"anyOf": []any{schema, map[string]any{"type": "null"}}}
+			}
+		}
+		properties[name] = schema
+		if !omitEmpty {
+			required = append(required, name)
+		}
+	}
+	return map[string]any{"type": "object", "properties": properties, "required": required}
+}
+
+// jsonRecord returns the type of the records the command of this run reports
+// with -format json.
+func jsonRecord() (command string, t reflect.Type, err error) {
+	switch {
+	case infoMode && trackCount:
+		return "inspect -track-count", reflect.TypeFor[TrackCount](), nil
+	case infoMode:
+		return "inspect", reflect.TypeFor[FileInfo](), nil
+	case listMode:
+		return "list", reflect.TypeFor[ListEntry](), nil
+	case adviseMode:
+		return "advise", reflect.TypeFor[Advice](), nil
+	case converting():
+		return "convert", reflect.TypeFor[fileResultJSON](), nil
+	}
+	return "", nil, fmt.Errorf(`[jsonRecord] this command has no JSON output`)
+}
+
+// writeJSONSchema writes the JSON Schema of the -format json output of this
+// run, an array of records, for -json-schema.
+func writeJSONSchema(w io.Writer) error {
+	command, t, err := jsonRecord()
+	if err != nil {
+		return fmt.Errorf(`[writeJSONSchema] %w`, err)
+	}
+	g := newSchemaGenerator()
+	items := g.schema(t)
+	if g.err != nil {
+		return fmt.Errorf(`[writeJSONSchema] %w`, g.err)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err = enc.Encode(map[string]any{
+		"$schema": jsonSchemaDraft,
+		"title":   fmt.Sprintf("mp4dovi %s -format json", command),
+		"type":    "array",
+		"items":   items,
+		"$defs":   g.defs,
+	}); err != nil {
+		return fmt.Errorf(`[writeJSONSchema] failed encoding JSON: %w`, err)
+	}
+	return nil
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+)
+
+// validateSchema checks value, as decoded by encoding/json, against the part
+// of JSON Schema writeJSONSchema uses, resolving $ref in root.
+func validateSchema(root, schema map[string]any, value any, path string) error {
+	if ref, ok := schema["$ref"].(string); ok {
+		def, ok := root["$defs"].(map[string]any)[strings.TrimPrefix(ref, "#/$defs/")].(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s: unresolved %s", path, ref)
+		}
+		return validateSchema(root, def, value, path)
+	}
+	if anyOf, ok := schema["anyOf"].([]any); ok {
+		var errs []error
+		for _, s := range anyOf {
+			err := validateSchema(root, s.(map[string]any), value, path)
+			if err == nil {
+				return nil
+			}
+			errs = append(errs, err)
+		}
+		return errors.Join(errs...)
+	}
+	if enum, ok := schema["enum"].([]any); ok {
+		found := false
+		for _, v := range enum {
+			found = found || v == value
+		}
+		if !found {
+			return fmt.Errorf("%s: %v is not one of %v", path, value, enum)
+		}
+	}
+
+	switch schema["type"] {
+	case nil:
+		return nil
+	case "null":
+		if value != nil {
+			return fmt.Errorf("%s: got %v, want null", path, value)
+		}
+	case "string":
+		if _, ok := value.(string); !ok {
+			return fmt.Errorf("%s: got %v, want a string", path, value)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("%s: got %v, want a boolean", path, value)
+		}
+	case "number", "integer":
+		n, ok := value.(float64)
+		if !ok || schema["type"] == "integer" && n != math.Trunc(n) {
+			return fmt.Errorf("%s: got %v, want an %s", path, value, schema["type"])
+		}
+		if min, ok := schema["minimum"].(float64); ok && n < min {
+			return fmt.Errorf("%s: got %v, want at least %v", path, n, min)
+		}
+	case "array":
+		items, ok := value.([]any)
+		if !ok {
+			return fmt.Errorf("%s: got %v, want an array", path, value)
+		}
+		for i, item := range items {
+			if err := validateSchema(root, schema["items"].(map[string]any), item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	case "object":
+		object, ok := value.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s: got %v, want an object", path, value)
+		}
+		for _, name := range schema["required"].([]any) {
+			if _, ok := object[name.(string)]; !ok {
+				return fmt.Errorf("%s: missing required %s", path, name)
+			}
+		}
+		properties, _ := schema["properties"].(map[string]any)
+		for name, v := range object {
+			s, ok := properties[name].(map[string]any)
+			if !ok {
+				if s, ok = schema["additionalProperties"].(map[string]any); !ok {
+					return fmt.Errorf("%s: %s is not in the schema", path, name)
+				}
+			}
+			if err := validateSchema(root, s, v, path+"."+name); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("%s: unknown type %v", path, schema["type"])
+	}
+	return nil
+}
+
+// schemaFor returns the schema -json-schema prints for the command whose
+// mode flag is mode, nil for convert.
+func schemaFor(t *testing.T, mode *bool) map[string]any {
+	t.Helper()
+	if mode != nil {
+		*mode = true
+		defer func() { *mode = false }()
+	}
+	var out bytes.Buffer
+	if err := writeJSONSchema(&out); err != nil {
+		t.Fatal(err)
+	}
+	var schema map[string]any
+	if err := json.Unmarshal(out.Bytes(), &schema); err != nil {
+		t.Fatal(err)
+	}
+	if schema["$schema"] != jsonSchemaDraft || schema["type"] != "array" {
+		t.Errorf("got schema %v", schema)
+	}
+	return schema
+}
+
+// validateRecords checks the JSON reported for records against schema.
+func validateRecords(t *testing.T, schema map[string]any, records ...record) {
+	t.Helper()
+	var out bytes.Buffer
+	rep := newReporter(&out, formatJSON)
+	for _, r := range records {
+		rep.report(r)
+	}
+	if err := rep.finish(); err != nil {
+		t.Fatal(err)
+	}
+	var value any
+	if err := json.Unmarshal(out.Bytes(), &value); err != nil {
+		t.Fatal(err)
+	}
+	if err := validateSchema(schema, schema, value, "$"); err != nil {
+		t.Errorf("output does not match its schema: %v\n%s", err, out.Bytes())
+	}
+}
+
+func TestJSONSchemaMatchesOutput(t *testing.T) {
+	t.Run("convert", func(t *testing.T) {
+		schema := schemaFor(t, nil)
+		validateRecords(t, schema,
+			FileResult{File: "a.mp4", Status: statusDone, Codecs: []string{"dvhe"}, Changes: []Change{{Kind: "sample entry", Offset: 112, From: "dvhe", To: "dvh1"}}, RenamedTo: "a.dv.mp4"},
+			FileResult{File: "b.mp4", Status: statusSkipped, Reason: "filtered"},
+			FileResult{File: "c.mp4", Status: statusFailed, Err: errors.New("broken")},
+		)
+
+		var value any
+		json.Unmarshal([]byte(`[{"file": "a.mp4", "status": "converted", "action": "none", "changes": []}]`), &value)
+		if err := validateSchema(schema, schema, value, "$"); err == nil {
+			t.Error("schema accepts an unknown status")
+		}
+		json.Unmarshal([]byte(`[{"file": "a.mp4", "status": "done", "changes": []}]`), &value)
+		if err := validateSchema(schema, schema, value, "$"); err == nil {
+			t.Error("schema accepts a result without its action")
+		}
+	})
+
+	t.Run("inspect", func(t *testing.T) {
+		t.Cleanup(func() { readTags = false })
+		readTags = true
+		var records []record
+		for _, data := range [][]byte{thumbnailMovie(), taggedMovie(), protectedMovie("edef8ba979d64acea3c827dcd51d21ed"), multiTrackMovie(2, 2)} {
+			info, err := inspect(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Boxes, err = boxOffsets(bytes.NewReader(data)); err != nil {
+				t.Fatal(err)
+			}
+			records = append(records, info)
+		}
+		validateRecords(t, schemaFor(t, &infoMode), records...)
+	})
+
+	t.Run("list and advise", func(t *testing.T) {
+		validateRecords(t, schemaFor(t, &listMode), ListEntry{File: "a.mp4", Codecs: []string{"dvhe"}}, ListEntry{File: "b.mp4"})
+		info, err := inspect(bytes.NewReader(multiTrackMovie(1, 1)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		validateRecords(t, schemaFor(t, &adviseMode), advise(info))
+	})
+}
+
+func TestJSONSchemaNoJSONOutput(t *testing.T) {
+	t.Cleanup(func() { validateMode = false })
+	validateMode = true
+	if err := writeJSONSchema(&bytes.Buffer{}); err == nil {
+		t.Error("got a schema for validate, which has no JSON output")
+	}
+}
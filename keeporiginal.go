@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// originalSuffix is appended to the name of a file converted with
+// -keep-original to name the preserved original.
+const originalSuffix = ".orig"
+
+// keepOriginal moves mp4file to mp4file.orig and copies it back to its
+// original name, where it is then converted, so the untouched original keeps
+// its inode and timestamps under a predictable name. An existing .orig file,
+// such as one left by a previous run, is never overwritten.
+func keepOriginal(mp4file string) (orig string, err error) {
+	var info os.FileInfo
+
+	orig = mp4file + originalSuffix
+	if _, err = os.Lstat(orig); err == nil {
+		return "", fmt.Errorf(`[keepOriginal] cannot keep the original of "%s": "%s" already exists`, mp4file, orig)
+	} else if !os.IsNotExist(err) {
+		return "", fmt.Errorf(`[keepOriginal] cannot stat "%s": %w`, orig, err)
+	}
+	if info, err = os.Stat(mp4file); err != nil {
+		return "", fmt.Errorf(`[keepOriginal] cannot stat file "%s": %w`, mp4file, err)
+	}
+
+	if err = os.Rename(mp4file, orig); err != nil {
+		return "", fmt.Errorf(`[keepOriginal] cannot rename "%s" to "%s": %w`, mp4file, orig, err)
+	}
+	if err = copyFile(mp4file, orig, info.Mode().Perm()); err != nil {
+		os.Remove(mp4file)
+		if restoreErr := os.Rename(orig, mp4file); restoreErr != nil {
+			return "", fmt.Errorf(`[keepOriginal] %w, and the original could not be moved back from "%s": %v`, err, orig, restoreErr)
+		}
+		return "", fmt.Errorf(`[keepOriginal] %w`, err)
+	}
+	return orig, nil
+}
+
+// restoreOriginal moves the original kept by keepOriginal back over mp4file,
+// used when the file failed to convert or was left unchanged.
+func restoreOriginal(mp4file, orig string) error {
+	if err := os.Rename(orig, mp4file); err != nil {
+		return fmt.Errorf(`[restoreOriginal] cannot rename "%s" to "%s": %w`, orig, mp4file, err)
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConvertKeepOriginal(t *testing.T) {
+	withCodecs(t, "dvhe", "dvh1")
+	keepOriginalFile = true
+	t.Cleanup(func() { keepOriginalFile = false })
+
+	dvhe := movie(trak(visualSampleEntry("dvhe", 1920, 1080, hvcC(), box("dvcC", make([]byte, 24)))))
+	hvc1 := movie(trak(visualSampleEntry("hvc1", 1920, 1080)))
+
+	t.Run("converted", func(t *testing.T) {
+		name := filepath.Join(t.TempDir(), "movie.mp4")
+		if err := os.WriteFile(name, dvhe, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		result := convertFile(context.Background(), name)
+		if result.Err != nil || result.Original != name+".orig" {
+			t.Fatalf("got %+v", result)
+		}
+		if orig, err := os.ReadFile(name + ".orig"); err != nil || !bytes.Equal(orig, dvhe) {
+			t.Errorf("original not kept: %v", err)
+		}
+		converted, err := os.ReadFile(name)
+		if err != nil || !bytes.Contains(converted, []byte("dvh1")) {
+			t.Errorf("file not converted: %v", err)
+		}
+	})
+
+	t.Run("unchanged", func(t *testing.T) {
+		name := filepath.Join(t.TempDir(), "movie.mp4")
+		if err := os.WriteFile(name, hvc1, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if result := convertFile(context.Background(), name); result.Err != nil || result.Original != "" {
+			t.Fatalf("got %+v", result)
+		}
+		if _, err := os.Lstat(name + ".orig"); !os.IsNotExist(err) {
+			t.Errorf("original kept for an unchanged file: %v", err)
+		}
+		if data, err := os.ReadFile(name); err != nil || !bytes.Equal(data, hvc1) {
+			t.Errorf("file changed: %v", err)
+		}
+	})
+
+	t.Run("collision", func(t *testing.T) {
+		name := filepath.Join(t.TempDir(), "movie.mp4")
+		if err := os.WriteFile(name, dvhe, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name+".orig", []byte("earlier"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if result := convertFile(context.Background(), name); result.Err == nil {
+			t.Fatalf("got %+v, want an error", result)
+		}
+		if data, _ := os.ReadFile(name); !bytes.Equal(data, dvhe) {
+			t.Error("file changed despite the collision")
+		}
+		if data, _ := os.ReadFile(name + ".orig"); string(data) != "earlier" {
+			t.Error("existing .orig file overwritten")
+		}
+	})
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// lenientFourCC returns fourCC as compared by -lenient-match, in lower case
+// without the spaces or NUL bytes padding it.
+func lenientFourCC(fourCC string) string {
+	return strings.ToLower(strings.TrimRight(fourCC, " \x00"))
+}
+
+// sameFourCC reports whether fourCC is want, or only differs from it in case
+// or padding when lenient is set.
+func sameFourCC(fourCC, want string, lenient bool) bool {
+	if fourCC == want {
+		return true
+	}
+	return lenient && lenientFourCC(fourCC) == lenientFourCC(want)
+}
+
+// matchesFrom reports whether fourCC is the -from codec. FourCCs are case
+// sensitive, so a FourCC differing in case or padding, as written by
+// some broken muxers, only matches with -lenient-match.
+func matchesFrom(fourCC string) bool {
+	return sameFourCC(fourCC, codecFrom, lenientMatch)
+}
+
+// lenientNote tells, for the messages of a change of fourCC, that it only
+// matched -from with -lenient-match.
+func lenientNote(fourCC string) string {
+	if fourCC == codecFrom {
+		return ""
+	}
+	return fmt.Sprintf(" (matched -from %s with -lenient-match)", codecFrom)
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMatchesFrom(t *testing.T) {
+	t.Cleanup(func() { lenientMatch = false })
+	for _, test := range []struct {
+		from, fourCC   string
+		exact, lenient bool
+	}{
+		{"dvhe", "dvhe", true, true},
+		{"dvhe", "DVHE", false, true},
+		{"dvhe", "dvHe", false, true},
+		{"dvhe", "dvh1", false, false},
+		{"avc ", "AVC\x00", false, true},
+		{"avc ", "avc1", false, false},
+	} {
+		withCodecs(t, test.from, "dvh1")
+		for _, lenientMatch = range []bool{false, true} {
+			if got, want := matchesFrom(test.fourCC), test.exact || lenientMatch && test.lenient; got != want {
+				t.Errorf("-from %q, -lenient-match=%v: %q matched %v, want %v", test.from, lenientMatch, test.fourCC, got, want)
+			}
+		}
+	}
+}
+
+func TestConvertLenientMatch(t *testing.T) {
+	withCodecs(t, "dvhe", "dvh1")
+	t.Cleanup(func() { lenientMatch = false })
+	takeChanges()
+
+	data := movie(trak(visualSampleEntry("DVHE", 1920, 1080, hvcC())), trak(visualSampleEntry("dvhe", 1920, 1080, hvcC())))
+	f := &memFile{data: append([]byte{}, data...)}
+	if err := convert(f); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(f.data, []byte("DVHE")) {
+		t.Error("DVHE converted without -lenient-match")
+	}
+	takeChanges()
+
+	lenientMatch = true
+	f = &memFile{data: append([]byte{}, data...)}
+	if err := convert(f); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(f.data, []byte("DVHE")) || bytes.Contains(f.data, []byte("dvhe")) {
+		t.Error("sample entries left unconverted")
+	}
+	// The changes tell the FourCC found rather than -from.
+	if changes := takeChanges(); fmt.Sprint(changes) != fmt.Sprintf("[{sample entry %d DVHE dvh1} {sample entry %d dvhe dvh1}]", bytes.Index(data, []byte("DVHE")), bytes.Index(data, []byte("dvhe"))) {
+		t.Errorf("got changes %v", changes)
+	}
+}
+
+func TestRewriteFileAddEntryLenient(t *testing.T) {
+	takeChanges()
+	data := movie(trak(visualSampleEntry("DVHE", 1920, 1080, hvcC())))
+	for _, lenient := range []bool{false, true} {
+		opts := duplicateOptions()
+		opts.LenientMatch = lenient
+		var out bytes.Buffer
+		if _, err := rewriteFile(&out, bytes.NewReader(data), opts); err != nil {
+			t.Fatal(err)
+		}
+		info, err := inspect(bytes.NewReader(out.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := "[DVHE]"
+		if lenient {
+			want = "[DVHE hev1]"
+		}
+		if got := fmt.Sprint(info.Tracks[0].Codecs); got != want {
+			t.Errorf("-lenient-match=%v: got codecs %s, want %s", lenient, got, want)
+		}
+	}
+	// The change tells the FourCC copied rather than -from.
+	if changes := takeChanges(); fmt.Sprint(changes) != fmt.Sprintf("[{added sample entry %d DVHE hev1}]", bytes.Index(data, []byte("DVHE"))-4) {
+		t.Errorf("got changes %v", changes)
+	}
+}
+
+func TestConvertMinResolutionLenient(t *testing.T) {
+	withCodecs(t, "dvhe", "dvh1")
+	t.Cleanup(func() { lenientMatch, minWidth = false, 0 })
+	lenientMatch, minWidth = true, 3840
+	takeChanges()
+	takeBelowThreshold()
+
+	data := movie(trak(visualSampleEntry("DVHE", 1920, 1080, hvcC())), trak(visualSampleEntry("DVHE", 3840, 2160, hvcC())))
+	f := &memFile{data: append([]byte{}, data...)}
+	if err := convert(f); err != nil {
+		t.Fatal(err)
+	}
+	info, err := inspect(bytes.NewReader(f.data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(info.Tracks[0].Codecs, info.Tracks[1].Codecs); got != "[DVHE] [dvh1]" {
+		t.Errorf("got codecs %s, want the entry below -min-width left unchanged", got)
+	}
+	if n := takeBelowThreshold(); n != 1 {
+		t.Errorf("got %d entries below the threshold, want 1", n)
+	}
+	takeChanges()
+}
+
+func TestFileHasCodecLenient(t *testing.T) {
+	t.Cleanup(func() { lenientMatch = false })
+	mp4file := filepath.Join(t.TempDir(), "movie.mp4")
+	if err := os.WriteFile(mp4file, movie(trak(visualSampleEntry("DVHE", 1920, 1080, hvcC()))), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, lenientMatch = range []bool{false, true} {
+		if ok, err := fileHasCodec(mp4file, "dvhe"); err != nil || ok != lenientMatch {
+			t.Errorf("-lenient-match=%v: -only-codec dvhe matched %v, %v", lenientMatch, ok, err)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// errTooManyChanges is returned for files exceeding -limit-changes.
+var errTooManyChanges = errors.New("too many changes")
+
+// enforceChangeLimit undoes the changes recorded after the first since if
+// there are more than -limit-changes of them, writing back the original
+// FourCC of each in reverse order. Every change made by convert is a 4 byte
+// FourCC replacement, so this restores the file exactly.
+func enforceChangeLimit(w io.WriteSeeker, since int) (err error) {
+	n := changeCount() - since
+	if n <= limitChanges {
+		return nil
+	}
+	fmt.Printf("Limit of %d changes exceeded with %d changes, undoing them (-limit-changes)\n", limitChanges, n)
+	changes := dropChangesSince(since)
+	for i := len(changes) - 1; i >= 0; i-- {
+		c := changes[i]
+		if _, err = w.Seek(c.Offset, io.SeekStart); err != nil {
+			return fmt.Errorf(`[enforceChangeLimit] failed to seek: %w`, err)
+		}
+		if _, err = w.Write([]byte(c.From)); err != nil {
+			return fmt.Errorf(`[enforceChangeLimit] failed to restore "%s" at %d(%#x): %w`, c.From, c.Offset, c.Offset, err)
+		}
+	}
+	return fmt.Errorf(`[enforceChangeLimit] %d changes exceed -limit-changes %d: %w`, n, limitChanges, errTooManyChanges)
+}
+
+// enforceAddedEntryLimit fails if more than -limit-changes sample entries
+// were added by -add-entry after the first since changes, dropping them from
+// the record. Nothing is undone: the rewritten copy holding them is discarded
+// before it replaces the file.
+func enforceAddedEntryLimit(since int) error {
+	n := changeCount() - since
+	if n <= limitChanges {
+		return nil
+	}
+	fmt.Printf("Limit of %d changes exceeded with %d added sample entries, leaving the file unchanged (-limit-changes)\n", limitChanges, n)
+	dropChangesSince(since)
+	return fmt.Errorf(`[enforceAddedEntryLimit] %d changes exceed -limit-changes %d: %w`, n, limitChanges, errTooManyChanges)
+}
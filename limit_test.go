@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConvertLimitChanges(t *testing.T) {
+	withCodecs(t, "dvhe", "dvh1")
+	t.Cleanup(func() { limitChanges = 0 })
+	takeChanges()
+
+	data := multiTrackMovie(3, 2)
+
+	limitChanges = 2
+	f := &memFile{data: append([]byte{}, data...)}
+	if err := convert(f); !errors.Is(err, errTooManyChanges) {
+		t.Fatalf("got %v, want %v", err, errTooManyChanges)
+	}
+	if !bytes.Equal(f.data, data) {
+		t.Errorf("changes left at %v", diffOffsets(data, f.data))
+	}
+	if changes := takeChanges(); len(changes) != 0 {
+		t.Errorf("undone changes still recorded: %v", changes)
+	}
+
+	limitChanges = 3
+	f = &memFile{data: append([]byte{}, data...)}
+	if err := convert(f); err != nil {
+		t.Fatal(err)
+	}
+	if changes := takeChanges(); len(changes) != 3 || bytes.Contains(f.data, []byte("dvhe")) {
+		t.Errorf("got changes %v", changes)
+	}
+}
+
+func TestProcessFileAddEntryLimitChanges(t *testing.T) {
+	withCodecs(t, "dvhe", "dvh1")
+	t.Cleanup(func() { limitChanges, addEntry = 0, "" })
+	addEntry = "hev1"
+	takeChanges()
+
+	data := multiTrackMovie(3, 2)
+	mp4file := filepath.Join(t.TempDir(), "movie.mp4")
+	if err := os.WriteFile(mp4file, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	limitChanges = 2
+	if err := processFile(mp4file); !errors.Is(err, errTooManyChanges) {
+		t.Fatalf("got %v, want %v", err, errTooManyChanges)
+	}
+	if got, _ := os.ReadFile(mp4file); !bytes.Equal(got, data) {
+		t.Error("file changed")
+	}
+	if changes := takeChanges(); len(changes) != 0 {
+		t.Errorf("discarded changes still recorded: %v", changes)
+	}
+	if left, _ := filepath.Glob(filepath.Join(filepath.Dir(mp4file), ".*.tmp")); len(left) != 0 {
+		t.Errorf("temporary files left: %v", left)
+	}
+
+	limitChanges = 3
+	if err := processFile(mp4file); err != nil {
+		t.Fatal(err)
+	}
+	if changes := takeChanges(); len(changes) != 3 {
+		t.Errorf("got changes %v", changes)
+	}
+	if got, _ := os.ReadFile(mp4file); bytes.Count(got, []byte("hev1")) != 3 {
+		t.Error("sample entries not added")
+	}
+}
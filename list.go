@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+)
+
+type ListEntry struct {
+	File   string   `json:"file"`
+	Codecs []string `json:"codecs"`
+}
+
+// codecs returns the sample entry codecs of all tracks in order.
+func (info *FileInfo) codecs() []string {
+	codecs := []string{}
+	for _, track := range info.Tracks {
+		codecs = append(codecs, track.Codecs...)
+	}
+	return codecs
+}
+
+// fileHasCodec reports whether any track of mp4file has a sample entry of
+// type codec, reading the file without modifying it.
+func fileHasCodec(mp4file, codec string) (bool, error) {
+	info, err := inspectFile(mp4file)
+	if err != nil {
+		return false, fmt.Errorf(`[fileHasCodec] %w`, err)
+	}
+	for _, c := range info.codecs() {
+		if sameFourCC(c, codec, lenientMatch) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func runList(ctx context.Context, mp4files []string) (err error) {
+	total := len(mp4files)
+	mp4files = sampleFiles(mp4files)
+
+	infos := make([]*FileInfo, 0, len(mp4files))
+	rep := newReporter(os.Stdout, outputFormat)
+	for i, mp4file := range mp4files {
+		var info *FileInfo
+		if err = ctx.Err(); err != nil {
+			return fmt.Errorf(`[runList] interrupted after %d of %d files: %w`, i, len(mp4files), err)
+		}
+		if info, err = inspectFile(mp4file); err != nil {
+			return fmt.Errorf(`[runList] failed inspecting file %s: %w`, mp4file, err)
+		}
+		infos = append(infos, info)
+		if err = rep.report(ListEntry{File: mp4file, Codecs: info.codecs()}); err != nil {
+			return fmt.Errorf(`[runList] %w`, err)
+		}
+	}
+	if err = rep.finish(); err != nil {
+		return fmt.Errorf(`[runList] %w`, err)
+	}
+	if sampleSize > 0 && outputFormat == formatText {
+		printSampleSummary(infos, total)
+	}
+	return
+}
+
+func (entry ListEntry) printText() {
+	fmt.Printf("%s: %s\n", entry.File, strings.Join(entry.Codecs, ", "))
+}
+
+func (entry ListEntry) columns() []string {
+	return []string{"file", "codecs"}
+}
+
+func (entry ListEntry) row() []string {
+	return []string{entry.File, commaList(entry.Codecs)}
+}
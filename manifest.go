@@ -0,0 +1,327 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// errManifestMismatch is returned by -apply-manifest when a file no longer
+// holds the bytes its manifest was planned from.
+var errManifestMismatch = errors.New("file changed since the manifest was planned")
+
+// ManifestEntry is a change of the bytes at Offset of File from From to To,
+// as planned by -emit-manifest. The bytes are written as Latin-1 text, which
+// keeps FourCCs readable.
+type ManifestEntry struct {
+	File   string `json:"file"`
+	Offset int64  `json:"offset"`
+	From   string `json:"from"`
+	To     string `json:"to"`
+}
+
+// plannedPatches are the entries of the files planned so far with
+// -emit-manifest.
+var plannedPatches []ManifestEntry
+
+// latin1 returns b as Latin-1 text, each byte being the rune of its value.
+func latin1(b []byte) string {
+	var s strings.Builder
+	for _, c := range b {
+		s.WriteRune(rune(c))
+	}
+	return s.String()
+}
+
+// latin1Bytes is the inverse of latin1.
+func latin1Bytes(s string) ([]byte, error) {
+	b := make([]byte, 0, len(s))
+	for _, r := range s {
+		if r > 0xff {
+			return nil, fmt.Errorf(`[latin1Bytes] %q is not Latin-1 text`, s)
+		}
+		b = append(b, byte(r))
+	}
+	return b, nil
+}
+
+// dryRunFile is a file opened read only, whose writes are kept in memory on
+// top of it instead, so that converting it tells what would be written.
+type dryRunFile struct {
+	f    *os.File
+	size int64
+	pos  int64
+
+	// written holds the bytes written, by offset
+	written map[int64]byte
+}
+
+func newDryRunFile(f *os.File) (*dryRunFile, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf(`[newDryRunFile] cannot stat file "%s": %w`, f.Name(), err)
+	}
+	return &dryRunFile{f: f, size: info.Size(), written: make(map[int64]byte)}, nil
+}
+
+func (d *dryRunFile) Read(p []byte) (int, error) {
+	if d.pos >= d.size {
+		return 0, io.EOF
+	}
+	n, err := d.f.ReadAt(p, d.pos)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	for i := range p[:n] {
+		if c, ok := d.written[d.pos+int64(i)]; ok {
+			p[i] = c
+		}
+	}
+	d.pos += int64(n)
+	return n, err
+}
+
+func (d *dryRunFile) Write(p []byte) (int, error) {
+	for i, c := range p {
+		d.written[d.pos+int64(i)] = c
+	}
+	d.pos += int64(len(p))
+	return len(p), nil
+}
+
+func (d *dryRunFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += d.pos
+	case io.SeekEnd:
+		offset += d.size
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf(`[dryRunFile] negative offset %d`, offset)
+	}
+	d.pos = offset
+	return offset, nil
+}
+
+// entries returns the runs of bytes written to mp4file, in file order, leaving
+// out those holding the bytes of the file again, as after -limit-changes undid
+// them.
+func (d *dryRunFile) entries(mp4file string) (entries []ManifestEntry, err error) {
+	offsets := make([]int64, 0, len(d.written))
+	for offset := range d.written {
+		offsets = append(offsets, offset)
+	}
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+	for i := 0; i < len(offsets); {
+		j := i + 1
+		for j < len(offsets) && offsets[j] == offsets[j-1]+1 {
+			j++
+		}
+		to := make([]byte, j-i)
+		for k := range to {
+			to[k] = d.written[offsets[i+k]]
+		}
+		from := make([]byte, len(to))
+		if _, err = d.f.ReadAt(from, offsets[i]); err != nil {
+			return nil, fmt.Errorf(`[dryRunFile] failed reading %d bytes at %d(%#x): %w`, len(from), offsets[i], offsets[i], err)
+		}
+		if !bytes.Equal(from, to) {
+			entries = append(entries, ManifestEntry{File: mp4file, Offset: offsets[i], From: latin1(from), To: latin1(to)})
+		}
+		i = j
+	}
+	return entries, nil
+}
+
+// planFile converts mp4file without modifying it, for -emit-manifest, adding
+// what would be written to the plannedPatches. The messages of the conversion
+// are left out unless -verbose is set, since nothing is changed.
+func planFile(mp4file string) (err error) {
+	var (
+		f       *os.File
+		d       *dryRunFile
+		abs     string
+		entries []ManifestEntry
+	)
+
+	if abs, err = filepath.Abs(mp4file); err != nil {
+		return fmt.Errorf(`[planFile] %w`, err)
+	}
+	if f, err = os.Open(mp4file); err != nil {
+		return fmt.Errorf(`[planFile] cannot open file "%s": %w`, mp4file, err)
+	}
+	defer f.Close()
+	if d, err = newDryRunFile(f); err != nil {
+		return fmt.Errorf(`[planFile] %w`, err)
+	}
+
+	fmt.Printf("Planning %s ...\n", mp4file)
+	if !verbose {
+		var restore func()
+		if restore, err = muteStdout(); err != nil {
+			return fmt.Errorf(`[planFile] %w`, err)
+		}
+		err = convert(d)
+		restore()
+	} else {
+		err = convert(d)
+	}
+	if err != nil {
+		return fmt.Errorf(`[planFile] %w`, err)
+	}
+
+	if entries, err = d.entries(abs); err != nil {
+		return fmt.Errorf(`[planFile] "%s": %w`, mp4file, err)
+	}
+	plannedPatches = append(plannedPatches, entries...)
+	fmt.Printf("Planned %d patches to %s\n", len(entries), mp4file)
+	return nil
+}
+
+// writeManifest writes the plannedPatches to manifestFile as JSON.
+func writeManifest(manifestFile string) (err error) {
+	data, err := json.MarshalIndent(append([]ManifestEntry{}, plannedPatches...), "", "  ")
+	if err != nil {
+		return fmt.Errorf(`[writeManifest] failed encoding JSON: %w`, err)
+	}
+	if err = os.WriteFile(manifestFile, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf(`[writeManifest] cannot write "%s": %w`, manifestFile, err)
+	}
+	fmt.Printf("Wrote a manifest of %d patches to %s\n", len(plannedPatches), manifestFile)
+	return nil
+}
+
+// manifestConflicts returns the options -emit-manifest cannot be combined
+// with, since they write other files or change more than the bytes patched.
+func manifestConflicts() (conflicts []string) {
+	for _, option := range []struct {
+		name string
+		set  bool
+	}{
+		{"-atomic", atomicWrite || tempDir != ""},
+		{"-out-dir", outDir != ""},
+		{"-keep-original", keepOriginalFile},
+		{"-rename-on-change", renameOnChange != ""},
+		{"-repair", repair},
+		{"-strip-free", stripFree},
+		{"-remux", remux},
+		{"-canonical", canonical},
+		{"-add-entry", addEntry != ""},
+		{"-strip-prefix", stripPrefix > 0},
+		{"-stream", streamMode},
+		{"-apply-manifest", applyManifest != ""},
+	} {
+		if option.set {
+			conflicts = append(conflicts, option.name)
+		}
+	}
+	return
+}
+
+// readManifest reads the entries of manifestFile.
+func readManifest(manifestFile string) (entries []ManifestEntry, err error) {
+	data, err := os.ReadFile(manifestFile)
+	if err != nil {
+		return nil, fmt.Errorf(`[readManifest] cannot read "%s": %w`, manifestFile, err)
+	}
+	if err = json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf(`[readManifest] "%s" is not a manifest: %w`, manifestFile, err)
+	}
+	return entries, nil
+}
+
+// manifestPatch is a ManifestEntry decoded to bytes.
+type manifestPatch struct {
+	offset   int64
+	from, to []byte
+}
+
+// checkManifestFile fails unless f holds the from bytes of every patch.
+func checkManifestFile(f *os.File, patches []manifestPatch) error {
+	for _, p := range patches {
+		got := make([]byte, len(p.from))
+		if _, err := f.ReadAt(got, p.offset); err != nil && !isEndOfFile(err) {
+			return fmt.Errorf(`[checkManifestFile] failed reading "%s" at %d(%#x): %w`, f.Name(), p.offset, p.offset, err)
+		}
+		if !bytes.Equal(got, p.from) {
+			return fmt.Errorf(`[checkManifestFile] "%s" has %q at %d(%#x), not %q: %w`, f.Name(), got, p.offset, p.offset, p.from, errManifestMismatch)
+		}
+	}
+	return nil
+}
+
+// runApplyManifest writes the patches of manifestFile, for -apply-manifest.
+// Every file is checked to still hold the bytes the patches were planned
+// from before any is written, so a stale manifest changes nothing.
+func runApplyManifest(manifestFile string) (err error) {
+	entries, err := readManifest(manifestFile)
+	if err != nil {
+		return fmt.Errorf(`[runApplyManifest] %w`, err)
+	}
+
+	var files []string
+	patches := make(map[string][]manifestPatch)
+	for _, entry := range entries {
+		p := manifestPatch{offset: entry.Offset}
+		if p.from, err = latin1Bytes(entry.From); err == nil {
+			p.to, err = latin1Bytes(entry.To)
+		}
+		if err != nil {
+			return fmt.Errorf(`[runApplyManifest] patch of "%s" at %d(%#x): %w`, entry.File, entry.Offset, entry.Offset, err)
+		}
+		if len(p.from) != len(p.to) || entry.Offset < 0 {
+			return fmt.Errorf(`[runApplyManifest] invalid patch of "%s" at %d(%#x) from %q to %q`, entry.File, entry.Offset, entry.Offset, entry.From, entry.To)
+		}
+		if patches[entry.File] == nil {
+			files = append(files, entry.File)
+		}
+		patches[entry.File] = append(patches[entry.File], p)
+	}
+
+	opened := make([]*os.File, 0, len(files))
+	defer func() {
+		for _, f := range opened {
+			f.Close()
+		}
+	}()
+	for _, mp4file := range files {
+		var f *os.File
+		if f, err = os.OpenFile(mp4file, os.O_RDWR, 0); err != nil {
+			return fmt.Errorf(`[runApplyManifest] cannot open file "%s": %w`, mp4file, err)
+		}
+		opened = append(opened, f)
+		if err = checkManifestFile(f, patches[mp4file]); err != nil {
+			return fmt.Errorf(`[runApplyManifest] nothing written: %w`, err)
+		}
+	}
+
+	for i, mp4file := range files {
+		f := opened[i]
+		for _, p := range patches[mp4file] {
+			if _, err = f.WriteAt(p.to, p.offset); err != nil {
+				return fmt.Errorf(`[runApplyManifest] failed writing "%s" at %d(%#x): %w`, mp4file, p.offset, p.offset, err)
+			}
+			if noReadBack {
+				continue
+			}
+			got := make([]byte, len(p.to))
+			if _, err = f.ReadAt(got, p.offset); err != nil {
+				return fmt.Errorf(`[runApplyManifest] failed reading back "%s" at %d(%#x): %w`, mp4file, p.offset, p.offset, err)
+			}
+			if !bytes.Equal(got, p.to) {
+				return fmt.Errorf(`[runApplyManifest] wrote %q to "%s" at %d(%#x) but read back %q: %w`, p.to, mp4file, p.offset, p.offset, got, errReadBackMismatch)
+			}
+		}
+		if err = f.Sync(); err != nil {
+			return fmt.Errorf(`[runApplyManifest] failed to sync "%s": %w`, mp4file, err)
+		}
+		fmt.Printf("Applied %d patches to %s\n", len(patches[mp4file]), mp4file)
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDryRunFile(t *testing.T) {
+	f := writeTempFile(t, []byte("0123456789"))
+	d, err := newDryRunFile(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Seek(2, io.SeekStart)
+	d.Write([]byte("ab"))
+	d.Seek(6, io.SeekStart)
+	d.Write([]byte("xy"))
+	d.Seek(6, io.SeekStart)
+	d.Write([]byte("67")) // undone
+
+	got := make([]byte, 10)
+	d.Seek(0, io.SeekStart)
+	if n, err := d.Read(got); err != nil || string(got[:n]) != "01ab456789" {
+		t.Errorf("read %q, %v", got[:n], err)
+	}
+	entries, err := d.entries("movie.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []ManifestEntry{{"movie.mp4", 2, "23", "ab"}}; len(entries) != 1 || entries[0] != want[0] {
+		t.Errorf("got %v, want %v", entries, want)
+	}
+	if data, _ := os.ReadFile(f.Name()); string(data) != "0123456789" {
+		t.Errorf("file modified to %q", data)
+	}
+}
+
+func TestLatin1(t *testing.T) {
+	b := []byte{'d', 'v', 0xa9, 0xff}
+	if got, err := latin1Bytes(latin1(b)); err != nil || !bytes.Equal(got, b) {
+		t.Errorf("got %q, %v, want %q", got, err, b)
+	}
+	if _, err := latin1Bytes("dv€1"); err == nil {
+		t.Error("non Latin-1 text accepted")
+	}
+}
+
+// plannedFiles writes two movies with dvhe entries, returning their names
+// along with their contents once converted.
+func plannedFiles(t *testing.T) (files []string, converted [][]byte) {
+	dir := t.TempDir()
+	for i, entries := range [][][]byte{
+		{visualSampleEntry("dvhe", 1920, 1080, hvcC())},
+		{visualSampleEntry("dvhe", 1920, 1080, hvcC()), visualSampleEntry("dvhe", 3840, 2160, hvcC())},
+	} {
+		data := movie(trak(entries...))
+		name := filepath.Join(dir, []string{"a.mp4", "b.mp4"}[i])
+		if err := os.WriteFile(name, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		f := &memFile{data: append([]byte{}, data...)}
+		if err := convert(f); err != nil {
+			t.Fatal(err)
+		}
+		files, converted = append(files, name), append(converted, f.data)
+	}
+	return
+}
+
+func TestEmitAndApplyManifest(t *testing.T) {
+	withCodecs(t, "dvhe", "dvh1")
+	files, converted := plannedFiles(t)
+	manifestFile := filepath.Join(t.TempDir(), "manifest.json")
+	emitManifest = manifestFile
+	t.Cleanup(func() {
+		emitManifest, plannedPatches = "", nil
+		takeChanges()
+	})
+
+	var originals [][]byte
+	for _, mp4file := range files {
+		data, _ := os.ReadFile(mp4file)
+		originals = append(originals, data)
+		if err := processFile(mp4file); err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := os.ReadFile(mp4file); !bytes.Equal(got, data) {
+			t.Errorf("%s modified while planning", mp4file)
+		}
+	}
+	if err := writeManifest(manifestFile); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := readManifest(manifestFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 || entries[0].File != files[0] || entries[0].From != "dvhe" || entries[0].To != "dvh1" {
+		t.Fatalf("got %+v, want the 3 dvhe entries", entries)
+	}
+
+	if err = runApplyManifest(manifestFile); err != nil {
+		t.Fatal(err)
+	}
+	for i, mp4file := range files {
+		if got, _ := os.ReadFile(mp4file); !bytes.Equal(got, converted[i]) {
+			t.Errorf("%s differs from the file converted in place", mp4file)
+		}
+	}
+
+	// With one of the files converted since, none is written.
+	for i, mp4file := range files {
+		os.WriteFile(mp4file, originals[i], 0o644)
+	}
+	os.WriteFile(files[1], converted[1], 0o644)
+	if err = runApplyManifest(manifestFile); !errors.Is(err, errManifestMismatch) {
+		t.Fatalf("got %v, want %v", err, errManifestMismatch)
+	}
+	if got, _ := os.ReadFile(files[0]); !bytes.Equal(got, originals[0]) {
+		t.Error("file patched although another one no longer matches the manifest")
+	}
+}
@@ -0,0 +1,424 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+)
+
+var (
+	MetaBoxType = BoxType{'m', 'e', 't', 'a'}
+	IinfBoxType = BoxType{'i', 'i', 'n', 'f'}
+	InfeBoxType = BoxType{'i', 'n', 'f', 'e'}
+	IlocBoxType = BoxType{'i', 'l', 'o', 'c'}
+	PitmBoxType = BoxType{'p', 'i', 't', 'm'}
+)
+
+// MetaItem is an item of a meta box, such as a thumbnail image, as described
+// by its item info and item location entries.
+type MetaItem struct {
+	ID   uint32 `json:"id"`
+	Type string `json:"type,omitempty"`
+	Name string `json:"name,omitempty"`
+
+	// ConstructionMethod is 0 if the item is stored at Offset in the file, 1
+	// in the idat box of the meta box and 2 in another item
+	ConstructionMethod uint8  `json:"constructionMethod,omitempty"`
+	Offset             uint64 `json:"offset,omitempty"`
+	Length             uint64 `json:"length,omitempty"`
+	Extents            int    `json:"extents,omitempty"`
+}
+
+// MetaInfo describes a meta box and the items it holds. Only reported, the
+// items are never patched.
+type MetaInfo struct {
+	Path        string     `json:"path"`
+	Offset      int64      `json:"offset"`
+	HandlerType string     `json:"handlerType,omitempty"`
+	PrimaryItem uint32     `json:"primaryItem,omitempty"`
+	Items       []MetaItem `json:"items,omitempty"`
+
+	// Tags of the ilst box with -tags
+	Tags []MetaTag `json:"tags,omitempty"`
+}
+
+// item returns the item with the given ID, adding it if there is none yet.
+func (m *MetaInfo) item(id uint32) *MetaItem {
+	for i := range m.Items {
+		if m.Items[i].ID == id {
+			return &m.Items[i]
+		}
+	}
+	m.Items = append(m.Items, MetaItem{ID: id})
+	return &m.Items[len(m.Items)-1]
+}
+
+// readIinfBox parses the infe entries of an iinf payload of payloadSize bytes
+// into items. The reader must be positioned right after the box header.
+func readIinfBox(r io.Reader, payloadSize int64) (items []MetaItem, err error) {
+	var (
+		version uint8
+		count   uint32
+	)
+	if payloadSize < 0 {
+		return nil, fmt.Errorf(`[readIinfBox] invalid payload size %d`, payloadSize)
+	}
+	lr := &io.LimitedReader{R: r, N: payloadSize}
+	r = lr
+	if version, _, err = readFullBoxHeader(r); err != nil {
+		return nil, fmt.Errorf(`[readIinfBox] failed reading version: %w`, err)
+	}
+	if version == 0 {
+		var count16 uint16
+		err = binary.Read(r, binary.BigEndian, &count16)
+		count = uint32(count16)
+	} else {
+		err = binary.Read(r, binary.BigEndian, &count)
+	}
+	if err != nil {
+		return nil, fmt.Errorf(`[readIinfBox] failed reading entry count: %w`, err)
+	}
+
+	for i := uint32(0); i < count; i++ {
+		var header struct {
+			Size uint32
+			Type BoxType
+		}
+		if err = binary.Read(r, binary.BigEndian, &header); err != nil {
+			return items, fmt.Errorf(`[readIinfBox] failed reading entry %d: %w`, i+1, err)
+		}
+		if header.Type != InfeBoxType || header.Size < 8 {
+			return items, fmt.Errorf(`[readIinfBox] entry %d is a "%s" box of size %d, not infe`, i+1, header.Type, header.Size)
+		}
+		// Sizes are checked against the bytes left before allocating, as
+		// they come from the file.
+		if int64(header.Size)-8 > lr.N {
+			return items, fmt.Errorf(`[readIinfBox] entry %d of size %d overruns the %d bytes left in iinf`, i+1, header.Size, lr.N+8)
+		}
+		payload := make([]byte, header.Size-8)
+		if _, err = io.ReadFull(r, payload); err != nil {
+			return items, fmt.Errorf(`[readIinfBox] failed reading entry %d: %w`, i+1, err)
+		}
+		var item MetaItem
+		if item, err = parseInfe(payload); err != nil {
+			return items, fmt.Errorf(`[readIinfBox] entry %d: %w`, i+1, err)
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// parseInfe parses the payload of an infe box. Versions 2 and 3 carry an item
+// type, earlier versions only a name and a content type.
+func parseInfe(payload []byte) (item MetaItem, err error) {
+	if len(payload) < 8 {
+		return item, fmt.Errorf(`[parseInfe] %d bytes are too short`, len(payload))
+	}
+	version, fields := payload[0], payload[4:]
+	switch {
+	case version == 3:
+		if len(fields) < 10 {
+			return item, fmt.Errorf(`[parseInfe] %d bytes are too short for version 3`, len(payload))
+		}
+		item.ID = binary.BigEndian.Uint32(fields)
+		item.Type, fields = string(fields[6:10]), fields[10:]
+	case version == 2:
+		if len(fields) < 8 {
+			return item, fmt.Errorf(`[parseInfe] %d bytes are too short for version 2`, len(payload))
+		}
+		item.ID = uint32(binary.BigEndian.Uint16(fields))
+		item.Type, fields = string(fields[4:8]), fields[8:]
+	default:
+		item.ID, fields = uint32(binary.BigEndian.Uint16(fields)), fields[4:]
+	}
+	if end := bytes.IndexByte(fields, 0); end >= 0 {
+		fields = fields[:end]
+	}
+	item.Name = string(fields)
+	return item, nil
+}
+
+// IlocExtent is a contiguous part of the data of an item.
+type IlocExtent struct {
+	Offset uint64
+	Length uint64
+}
+
+// IlocItem is where the data of an item is stored.
+type IlocItem struct {
+	ID                 uint32
+	ConstructionMethod uint8
+	BaseOffset         uint64
+	Extents            []IlocExtent
+}
+
+// readIlocBox parses an iloc payload of payloadSize bytes. The reader must be
+// positioned right after the box header.
+func readIlocBox(r io.Reader, payloadSize int64) (items []IlocItem, err error) {
+	var (
+		version uint8
+		sizes   [2]byte
+		count   uint32
+	)
+	if payloadSize < 0 {
+		return nil, fmt.Errorf(`[readIlocBox] invalid payload size %d`, payloadSize)
+	}
+	lr := &io.LimitedReader{R: r, N: payloadSize}
+	r = lr
+	if version, _, err = readFullBoxHeader(r); err != nil {
+		return nil, fmt.Errorf(`[readIlocBox] failed reading version: %w`, err)
+	}
+	if version > 2 {
+		return nil, fmt.Errorf(`[readIlocBox] unsupported version %d`, version)
+	}
+	if _, err = io.ReadFull(r, sizes[:]); err != nil {
+		return nil, fmt.Errorf(`[readIlocBox] failed reading field sizes: %w`, err)
+	}
+	offsetSize, lengthSize, baseOffsetSize, indexSize := sizes[0]>>4, sizes[0]&0xf, sizes[1]>>4, sizes[1]&0xf
+	if version == 0 {
+		indexSize = 0
+	}
+
+	// Fields are 0, 4 or 8 bytes long.
+	readUint := func(size uint8) (uint64, error) {
+		switch size {
+		case 0:
+			return 0, nil
+		case 4:
+			var v uint32
+			err := binary.Read(r, binary.BigEndian, &v)
+			return uint64(v), err
+		case 8:
+			var v uint64
+			err := binary.Read(r, binary.BigEndian, &v)
+			return v, err
+		}
+		return 0, fmt.Errorf(`invalid field size %d`, size)
+	}
+
+	if version < 2 {
+		var count16 uint16
+		err = binary.Read(r, binary.BigEndian, &count16)
+		count = uint32(count16)
+	} else {
+		err = binary.Read(r, binary.BigEndian, &count)
+	}
+	if err != nil {
+		return nil, fmt.Errorf(`[readIlocBox] failed reading item count: %w`, err)
+	}
+
+	// Counts come from the file, so they are checked against the bytes left
+	// before looping: an item takes at least its ID, data reference index,
+	// base offset and extent count, and an extent its index, offset and
+	// length.
+	itemSize := int64(2+2+2) + int64(baseOffsetSize)
+	if version == 2 {
+		itemSize += 2
+	}
+	if version > 0 {
+		itemSize += 2
+	}
+	extentSize := int64(indexSize) + int64(offsetSize) + int64(lengthSize)
+	if int64(count)*itemSize > lr.N {
+		return nil, fmt.Errorf(`[readIlocBox] %d items do not fit in the %d bytes left`, count, lr.N)
+	}
+
+	for i := uint32(0); i < count; i++ {
+		var (
+			item               IlocItem
+			dataReferenceIndex uint16
+			extentCount        uint16
+		)
+		if version < 2 {
+			var id16 uint16
+			err = binary.Read(r, binary.BigEndian, &id16)
+			item.ID = uint32(id16)
+		} else {
+			err = binary.Read(r, binary.BigEndian, &item.ID)
+		}
+		if err == nil && version > 0 {
+			var method uint16
+			err = binary.Read(r, binary.BigEndian, &method)
+			item.ConstructionMethod = uint8(method & 0xf)
+		}
+		if err == nil {
+			err = binary.Read(r, binary.BigEndian, &dataReferenceIndex)
+		}
+		if err == nil {
+			item.BaseOffset, err = readUint(baseOffsetSize)
+		}
+		if err == nil {
+			err = binary.Read(r, binary.BigEndian, &extentCount)
+		}
+		if err == nil && extentCount > 0 && extentSize == 0 {
+			err = fmt.Errorf(`%d extents without index, offset or length`, extentCount)
+		}
+		if err == nil && int64(extentCount)*extentSize > lr.N {
+			err = fmt.Errorf(`%d extents do not fit in the %d bytes left`, extentCount, lr.N)
+		}
+		for j := uint16(0); err == nil && j < extentCount; j++ {
+			var extent IlocExtent
+			// the extent index is only meaningful with construction method 2
+			if _, err = readUint(indexSize); err != nil {
+				break
+			}
+			if extent.Offset, err = readUint(offsetSize); err != nil {
+				break
+			}
+			if extent.Length, err = readUint(lengthSize); err != nil {
+				break
+			}
+			item.Extents = append(item.Extents, extent)
+		}
+		if err != nil {
+			return items, fmt.Errorf(`[readIlocBox] failed reading item %d: %w`, i+1, err)
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// metaVisitor collects a MetaInfo from the children of a meta box.
+type metaVisitor struct {
+	r    io.Reader
+	meta *MetaInfo
+}
+
+func (v *metaVisitor) EnterBox(path []BoxType, h Header) (descend bool, err error) {
+	if len(path) < 2 || path[len(path)-2] != MetaBoxType {
+		return false, nil
+	}
+	switch h.Type {
+	case HdlrBoxType:
+		var hdlr *HdlrBox
+		if hdlr, err = readHdlrBox(v.r, h.PayloadSize()); err != nil {
+			return false, err
+		}
+		v.meta.HandlerType = string(hdlr.HandlerType[:])
+	case PitmBoxType:
+		var version uint8
+		if version, _, err = readFullBoxHeader(v.r); err != nil {
+			return false, fmt.Errorf(`[metaVisitor] failed reading pitm version: %w`, err)
+		}
+		if version == 0 {
+			var id uint16
+			err = binary.Read(v.r, binary.BigEndian, &id)
+			v.meta.PrimaryItem = uint32(id)
+		} else {
+			err = binary.Read(v.r, binary.BigEndian, &v.meta.PrimaryItem)
+		}
+		if err != nil {
+			return false, fmt.Errorf(`[metaVisitor] failed reading primary item: %w`, err)
+		}
+	case IinfBoxType:
+		items, err := readIinfBox(v.r, h.PayloadSize())
+		for _, item := range items {
+			entry := v.meta.item(item.ID)
+			entry.Type, entry.Name = item.Type, item.Name
+		}
+		if err != nil {
+			return false, err
+		}
+	case IlstBoxType:
+		if !readTags {
+			return false, nil
+		}
+		tags, err := readIlstBox(v.r, h.PayloadSize())
+		v.meta.Tags = append(v.meta.Tags, tags...)
+		if err != nil {
+			return false, err
+		}
+	case IlocBoxType:
+		locations, err := readIlocBox(v.r, h.PayloadSize())
+		for _, location := range locations {
+			entry := v.meta.item(location.ID)
+			entry.ConstructionMethod = location.ConstructionMethod
+			entry.Extents = len(location.Extents)
+			entry.Length = 0
+			for i, extent := range location.Extents {
+				if i == 0 {
+					entry.Offset = location.BaseOffset + extent.Offset
+				}
+				entry.Length += extent.Length
+			}
+		}
+		if err != nil {
+			return false, err
+		}
+	}
+	return false, nil
+}
+
+func (v *metaVisitor) LeaveBox(path []BoxType, h Header) error {
+	return nil
+}
+
+// inspectMeta describes the meta box h found at path by walking its children.
+// ISO meta boxes are full boxes, while the QuickTime ones found in udta start
+// with their children right away; they are told apart by the first 4 bytes,
+// which are the version and flags, 0, or the size of the first child. What
+// could be parsed is returned along with any error.
+func inspectMeta(r io.ReadSeeker, path []BoxType, h Header) (meta *MetaInfo, err error) {
+	types := make([]string, len(path))
+	for i, t := range path {
+		types[i] = t.String()
+	}
+	meta = &MetaInfo{Path: strings.Join(types, "/"), Offset: h.Offset}
+
+	start, limit := h.Offset+h.HeaderLength(), h.PayloadSize()
+	if limit < 4 {
+		return meta, fmt.Errorf(`[inspectMeta] meta at %d(%#x) is too small or of size 0`, h.Offset, h.Offset)
+	}
+	var first uint32
+	if _, err = r.Seek(start, io.SeekStart); err != nil {
+		return meta, fmt.Errorf(`[inspectMeta] failed to seek: %w`, err)
+	}
+	if err = binary.Read(r, binary.BigEndian, &first); err != nil {
+		return meta, fmt.Errorf(`[inspectMeta] failed reading meta at %d(%#x): %w`, h.Offset, h.Offset, err)
+	}
+	if first == 0 {
+		start, limit = start+4, limit-4
+	}
+
+	w := &walker{r: r, visitor: &metaVisitor{r: r, meta: meta}, opts: DefaultWalkOptions}
+	if err = w.walkBoxes(path, start, limit); err != nil {
+		return meta, fmt.Errorf(`[inspectMeta] %w`, err)
+	}
+	return meta, nil
+}
+
+// printMeta prints a meta box and its items, indented by indent.
+func printMeta(indent string, meta *MetaInfo) {
+	fmt.Printf("%smeta: %s at %d(%#x)", indent, meta.Path, meta.Offset, meta.Offset)
+	if meta.HandlerType != "" {
+		fmt.Printf(" handler %s", meta.HandlerType)
+	}
+	if meta.PrimaryItem != 0 {
+		fmt.Printf(" primary item %d", meta.PrimaryItem)
+	}
+	fmt.Println()
+	for _, item := range meta.Items {
+		fmt.Printf("%s  item %d:", indent, item.ID)
+		if item.Type != "" {
+			fmt.Printf(" %s", item.Type)
+		}
+		if item.Name != "" {
+			fmt.Printf(" %q", item.Name)
+		}
+		switch {
+		case item.Extents == 0:
+		case item.ConstructionMethod == 0:
+			fmt.Printf(" %d bytes at %d(%#x)", item.Length, item.Offset, item.Offset)
+		case item.ConstructionMethod == 1:
+			fmt.Printf(" %d bytes in idat", item.Length)
+		default:
+			fmt.Printf(" %d bytes in another item", item.Length)
+		}
+		fmt.Println()
+	}
+	for _, tag := range meta.Tags {
+		fmt.Printf("%s  tag %s: %q\n", indent, tag.Key, tag.Value)
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// thumbnailMovie builds a movie with an ISO meta box in moov holding a JPEG
+// thumbnail and Exif item, and a QuickTime meta box in its trak.
+func thumbnailMovie() []byte {
+	infe := func(id uint16, itemType, name string) []byte {
+		return fullBox("infe", 2, 0, u16(id), u16(0), []byte(itemType), []byte(name), []byte{0})
+	}
+	iso := fullBox("meta", 0, 0,
+		fullBox("hdlr", 0, 0, u32(0), []byte("pict"), make([]byte, 12), []byte{0}),
+		fullBox("pitm", 0, 0, u16(1)),
+		fullBox("iinf", 0, 0, u16(2), infe(1, "jpeg", "Thumbnail"), infe(2, "Exif", "")),
+		fullBox("iloc", 1, 0, []byte{0x44, 0x00}, u16(2),
+			u16(1), u16(0), u16(0), u16(2), u32(1000), u32(300), u32(1400), u32(200),
+			u16(2), u16(1), u16(0), u16(1), u32(8), u32(64)),
+	)
+	qt := box("meta", fullBox("hdlr", 0, 0, []byte("mhlr"), []byte("mdir"), make([]byte, 12), []byte{0}), box("ilst"))
+	track := box("trak", box("mdia", box("minf", box("stbl", stsd(visualSampleEntry("dvhe", 1920, 1080))))), qt)
+	return movie(track, iso)
+}
+
+func TestInspectMeta(t *testing.T) {
+	info, err := inspect(bytes.NewReader(thumbnailMovie()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(info.Meta) != 1 {
+		t.Fatalf("got meta %+v, want one in moov", info.Meta)
+	}
+	meta := info.Meta[0]
+	if meta.Path != "moov/meta" || meta.HandlerType != "pict" || meta.PrimaryItem != 1 {
+		t.Errorf("got meta %+v", meta)
+	}
+	if got := fmt.Sprintf("%+v", meta.Items); got != "[{ID:1 Type:jpeg Name:Thumbnail ConstructionMethod:0 Offset:1000 Length:500 Extents:2} {ID:2 Type:Exif Name: ConstructionMethod:1 Offset:8 Length:64 Extents:1}]" {
+		t.Errorf("got items %s", got)
+	}
+
+	track := info.Tracks[0]
+	if len(track.Meta) != 1 || track.Meta[0].Path != "moov/trak/meta" || track.Meta[0].HandlerType != "mdir" || len(track.Meta[0].Items) != 0 {
+		t.Errorf("got track meta %+v, want a QuickTime meta without items", track.Meta)
+	}
+	if fmt.Sprint(track.Codecs) != "[dvhe]" {
+		t.Errorf("got codecs %v", track.Codecs)
+	}
+
+	data := thumbnailMovie()
+	parallel, err := inspectAt(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantJSON, _ := json.Marshal(info)
+	gotJSON, _ := json.Marshal(parallel)
+	if !bytes.Equal(gotJSON, wantJSON) {
+		t.Errorf("inspectAt got %s, want %s", gotJSON, wantJSON)
+	}
+}
+
+func TestInspectMalformedMeta(t *testing.T) {
+	oversizedInfe := append(u32(0xffffffff), []byte("infe")...)
+	for name, malformed := range map[string][]byte{
+		"truncated iloc": fullBox("iloc", 1, 0, []byte{0x44, 0x00}, u16(5), u16(1)),
+		"oversized infe": fullBox("iinf", 0, 0, u16(1), oversizedInfe, make([]byte, 16)),
+		// Extents without sizes take no bytes, so their count is all that
+		// bounds them.
+		"sizeless extents": fullBox("iloc", 1, 0, []byte{0x00, 0x00}, u16(1), u16(1), u16(0), u16(0), u16(0xffff)),
+		"too many items":   fullBox("iloc", 2, 0, []byte{0x44, 0x00}, u32(0xffffffff), u32(1), u16(0), u16(0), u16(0)),
+		"too many extents": fullBox("iloc", 1, 0, []byte{0x44, 0x00}, u16(1), u16(1), u16(0), u16(0), u16(0xffff), u32(0), u32(8)),
+	} {
+		data := movie(trak(visualSampleEntry("dvhe", 1920, 1080)),
+			fullBox("meta", 0, 0, fullBox("pitm", 0, 0, u16(3)), malformed))
+		info, err := inspect(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("%s: got %v, want a malformed meta box ignored", name, err)
+		}
+		if len(info.Meta) != 1 || info.Meta[0].PrimaryItem != 3 || len(info.Meta[0].Items) != 0 {
+			t.Errorf("%s: got meta %+v, want what parsed before the malformed box", name, info.Meta)
+		}
+		if fmt.Sprint(info.Tracks[0].Codecs) != "[dvhe]" {
+			t.Errorf("%s: got codecs %v", name, info.Tracks[0].Codecs)
+		}
+	}
+
+	// Sizes and counts are rejected before anything is allocated for them.
+	for _, test := range []struct {
+		read func() error
+		want string
+	}{
+		{func() error {
+			_, err := readIinfBox(bytes.NewReader(bytes.Join([][]byte{{0, 0, 0, 0}, u16(1), oversizedInfe}, nil)), 14)
+			return err
+		}, "entry 1 of size 4294967295 overruns the 8 bytes left in iinf"},
+		{func() error {
+			_, err := readIlocBox(bytes.NewReader(bytes.Join([][]byte{{1, 0, 0, 0}, {0, 0}, u16(1), u16(1), u16(0), u16(0), u16(0xffff)}, nil)), 16)
+			return err
+		}, "65535 extents without index, offset or length"},
+		{func() error {
+			_, err := readIlocBox(bytes.NewReader(bytes.Join([][]byte{{2, 0, 0, 0}, {0x44, 0}, u32(0xffffffff)}, nil)), 10)
+			return err
+		}, "4294967295 items do not fit in the 0 bytes left"},
+	} {
+		if err := test.read(); err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("got %v, want %q", err, test.want)
+		}
+	}
+}
+
+func TestParseInfe(t *testing.T) {
+	for _, test := range []struct {
+		payload []byte
+		want    string
+	}{
+		{bytes.Join([][]byte{{2, 0, 0, 0}, u16(7), u16(0), []byte("hvc1Image\x00")}, nil), "{ID:7 Type:hvc1 Name:Image}"},
+		{bytes.Join([][]byte{{3, 0, 0, 0}, u32(70000), u16(0), []byte("mime\x00image/jpeg\x00")}, nil), "{ID:70000 Type:mime Name:}"},
+		{bytes.Join([][]byte{{0, 0, 0, 0}, u16(1), u16(0), []byte("cover\x00image/png\x00")}, nil), "{ID:1 Type: Name:cover}"},
+	} {
+		item, err := parseInfe(test.payload)
+		if err != nil {
+			t.Errorf("%x: %v", test.payload, err)
+			continue
+		}
+		if got := fmt.Sprintf("%+v", struct {
+			ID   uint32
+			Type string
+			Name string
+		}{item.ID, item.Type, item.Name}); got != test.want {
+			t.Errorf("%x: got %s, want %s", test.payload, got, test.want)
+		}
+	}
+	if _, err := parseInfe([]byte{3, 0, 0, 0, 0, 1}); err == nil {
+		t.Error("expected an error for a truncated infe")
+	}
+}
@@ -1,12 +1,19 @@
 package main
 
 import (
+	"context"
 	"encoding/binary"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"log"
+	"math"
+	"math/bits"
 	"os"
+	"os/signal"
+	"strings"
+	"time"
 )
 
 type FourCC [4]byte
@@ -19,6 +26,15 @@ var (
 	MinfBoxType = BoxType{'m', 'i', 'n', 'f'}
 	StblBoxType = BoxType{'s', 't', 'b', 'l'}
 	StsdBoxType = BoxType{'s', 't', 's', 'd'}
+	MvhdBoxType = BoxType{'m', 'v', 'h', 'd'}
+	HdlrBoxType = BoxType{'h', 'd', 'l', 'r'}
+	MdhdBoxType = BoxType{'m', 'd', 'h', 'd'}
+	TkhdBoxType = BoxType{'t', 'k', 'h', 'd'}
+	TrexBoxType = BoxType{'t', 'r', 'e', 'x'}
+	TfhdBoxType = BoxType{'t', 'f', 'h', 'd'}
+	ElstBoxType = BoxType{'e', 'l', 's', 't'}
+	EncvBoxType = BoxType{'e', 'n', 'c', 'v'}
+	FrmaBoxType = BoxType{'f', 'r', 'm', 'a'}
 )
 
 type Header struct {
@@ -27,11 +43,87 @@ type Header struct {
 
 	// Present only if Size == 1
 	ExtendedSize uint64
+
+	// Absolute file offset of the first byte of the box header
+	Offset int64
+}
+
+func (t BoxType) String() string {
+	return string(t[:])
 }
 
 var codecFrom string
 var codecTo string
+var lenientMatch bool
 var verbose bool
+var infoMode bool
+var outputFormat = formatText
+var jsonSchema bool
+var compareMode bool
+var atomicWrite bool
+var tempDir string
+var patchFrma bool
+var stripFree bool
+var remux bool
+var debugCRC bool
+var force bool
+var sampleSize int
+var sampleRandom bool
+var showOffsets bool
+var trackCount bool
+var readTags bool
+var hexPreview bool
+var retries int
+var retryDelay time.Duration
+var maxScanBytes int64
+var listMode bool
+var validateMode bool
+var outDir string
+var nameTemplate string
+var addEntry string
+var parallelBoxes bool
+var onePass bool
+var adviseMode bool
+var reportUnknownBoxes bool
+var scanOnlyMoov bool
+var allMoov bool
+var nullSafe bool
+var canonical bool
+var compatBrandCheck bool
+var logFile string
+var renameOnChange string
+var keepOriginalFile bool
+var checkMode bool
+var ffmpegCommand bool
+var summaryOnly bool
+var abortOnUnknown bool
+var safe bool
+var limitChanges int
+var onlyCodec string
+var cpuProfile string
+var memProfile string
+var noReadBack bool
+var trackID uint
+var minWidth uint
+var minHeight uint
+var repair bool
+var strictStsdBounds bool
+var streamMode bool
+var scope = scopeAll
+var ifBrand string
+var anywhere bool
+var anywhereDepth int
+var rewriteBufferSize int
+var noVerify bool
+var dedupe bool
+var showVersion bool
+var interactive bool
+var assumeYes bool
+var scanReport bool
+var stripPrefix int64
+var emitManifest string
+var applyManifest string
+var patchAt int64 = -1 // disabled unless set, 0 is a valid offset
 
 func getBoxSize(header *Header) uint64 {
 	if header.Size == 1 {
@@ -54,9 +146,49 @@ func getHeaderTypeOffset(header *Header) int64 {
 	return -4
 }
 
+// UuidBoxType is the type of boxes identified by an extended type.
+var UuidBoxType = BoxType{'u', 'u', 'i', 'd'}
+
+// HeaderLength returns the length of the box header: 8 bytes, 16 with a
+// 64-bit size, plus the 16 byte extended type of uuid boxes. Unlike
+// getHeaderSize it includes the extended type, which readBoxHeader leaves
+// unread.
+func (h *Header) HeaderLength() int64 {
+	length := int64(getHeaderSize(h))
+	if h.Type == UuidBoxType {
+		length += 16
+	}
+	return length
+}
+
+// PayloadSize returns the size of the box content after its header, which is
+// where the fields or the children of the box are. It is negative for a box
+// of size 0, whose size is only known from the end of the file, and for a
+// box too small for its own header.
+func (h *Header) PayloadSize() int64 {
+	if h.Size == 0 {
+		return -1
+	}
+	return int64(getBoxSize(h)) - h.HeaderLength()
+}
+
+// validBoxSize reports whether the size of the box h covers its header and
+// ends at an offset that can be seeked to, so that skipping the box never
+// seeks backwards or wraps around. A size of 0 is left to the caller.
+func validBoxSize(h *Header) bool {
+	if h.Size == 0 {
+		return true
+	}
+	size := getBoxSize(h)
+	return size >= getHeaderSize(h) && size <= uint64(math.MaxInt64-h.Offset)
+}
+
 func readBoxHeader(r io.ReadSeeker) (*Header, error) {
 	var header Header
 	var err error
+	if header.Offset, err = r.Seek(0, io.SeekCurrent); err != nil {
+		return nil, err
+	}
 	err = binary.Read(r, binary.BigEndian, &header.Size)
 	if err != nil {
 		return nil, err
@@ -76,30 +208,108 @@ func readBoxHeader(r io.ReadSeeker) (*Header, error) {
 	return &header, nil
 }
 
+// reportImplausibleSize prints a diagnostic when a 32-bit box size cannot fit
+// in the remaining bytes, along with the little-endian reading of the size if
+// that one would fit, which hints at a broken muxer. Parsing stays big-endian.
+// remaining is the number of bytes left from the start of the box, or -1 to
+// measure up to the end of r.
+func reportImplausibleSize(r io.ReadSeeker, h *Header, remaining int64) {
+	if h.Size == 0 || h.Size == 1 {
+		return
+	}
+	if remaining < 0 {
+		cur, err := r.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return
+		}
+		end, err := r.Seek(0, io.SeekEnd)
+		if _, seekErr := r.Seek(cur, io.SeekStart); err != nil || seekErr != nil {
+			return
+		}
+		remaining = end - h.Offset
+	}
+	if h.Size >= 8 && int64(h.Size) <= remaining {
+		return
+	}
+	fmt.Printf("[findHeader] box %s at %d(%#x) has implausible size %d with %d bytes available", h.Type, h.Offset, h.Offset, h.Size, remaining)
+	if swapped := bits.ReverseBytes32(h.Size); swapped >= 8 && int64(swapped) <= remaining {
+		fmt.Printf(", as little-endian it would be %d which suggests a broken muxer", swapped)
+	}
+	fmt.Println()
+}
+
+// findHeader scans the boxes starting at the current position of r, over at
+// most limit bytes or up to the end of r if limit is negative, and returns
+// the header of the first box of type boxType. On success r is left right
+// after the size and type fields of that box, and its 64-bit size if it has
+// one, which is the start of its payload except for the extended type of uuid
+// boxes. Prefer FindBoxPayload, which makes that position explicit. Nothing
+// past limit is read but the 64-bit size of a box found overrunning it, and
+// a box of type boxType overrunning limit is an error.
 func findHeader(r io.ReadSeeker, boxType BoxType, limit int64) (header *Header, err error) {
 	var h *Header
 	for offset := int64(0); limit < 0 || offset < limit; offset += int64(getBoxSize(h)) {
+		// The header of a box must fit the bytes left, or reading it would
+		// read past limit into the boxes after it.
+		if limit >= 0 && limit-offset < 8 {
+			return nil, fmt.Errorf(`[findHeader] cannot find box "%s": the last %d bytes cannot hold a box header`, boxType, limit-offset)
+		}
 		if h, err = readBoxHeader(r); err != nil {
 			return nil, fmt.Errorf(`[findHeader] failed reading box header: %w`, err)
 		}
+		if limit >= 0 && offset+int64(getHeaderSize(h)) > limit {
+			return nil, fmt.Errorf(`[findHeader] cannot find box "%s": the 64-bit size of box "%s" at %d(%#x) is past the end`, boxType, h.Type, h.Offset, h.Offset)
+		}
+		// Checked before the type, so that no box found has a payload of a
+		// negative size. Only top level boxes may extend to the end of the
+		// file with a size of 0.
+		if !validBoxSize(h) || h.Size == 0 && limit >= 0 {
+			return nil, fmt.Errorf(`[findHeader] invalid size %d for box "%s" at %d(%#x)`, getBoxSize(h), h.Type, h.Offset, h.Offset)
+		}
 
 		if verbose {
 			fmt.Printf("[findHeader] inspecting %s at %d(%#x)\n", string(h.Type[:]), offset, offset)
+			remaining := int64(-1)
+			if limit >= 0 {
+				remaining = limit - offset
+			}
+			reportImplausibleSize(r, h, remaining)
 		}
 
 		if h.Type == boxType {
+			if limit >= 0 && offset+int64(getBoxSize(h)) > limit {
+				return nil, fmt.Errorf(`[findHeader] box "%s" at %d(%#x) overruns the %d bytes searched by %d`, h.Type, h.Offset, h.Offset, limit, offset+int64(getBoxSize(h))-limit)
+			}
 			if verbose {
 				fmt.Printf("[findHeader] found %s at %d(%#x)\n", string(h.Type[:]), offset, offset)
 			}
 			return h, nil
 		}
-		if _, err = r.Seek(int64(getBoxSize(h)-getHeaderSize(h)), io.SeekCurrent); err != nil {
-			return nil, fmt.Errorf(`[findHeader] failed seeking after box "%s": %s`, h.Type, err)
+		// A top level box of size 0 extends to the end of the file, so no
+		// box can follow it.
+		if h.Size == 0 && limit < 0 {
+			return nil, fmt.Errorf(`[findHeader] cannot find box "%s" before box "%s" at %d(%#x) extending to the end of the file: %w`, boxType, h.Type, h.Offset, h.Offset, io.EOF)
+		}
+		if _, err = r.Seek(h.Offset+int64(getBoxSize(h)), io.SeekStart); err != nil {
+			return nil, fmt.Errorf(`[findHeader] failed seeking after box "%s": %w`, h.Type, err)
 		}
 	}
 	return nil, fmt.Errorf(`[findHeader] cannot find box "%s"`, boxType)
 }
 
+// FindBoxPayload is like findHeader but also returns the offset of the payload
+// of the box found, which r is positioned at.
+func FindBoxPayload(r io.ReadSeeker, boxType BoxType, limit int64) (h *Header, payloadOffset int64, err error) {
+	if h, err = findHeader(r, boxType, limit); err != nil {
+		return nil, 0, err
+	}
+	payloadOffset = h.Offset + h.HeaderLength()
+	if _, err = r.Seek(payloadOffset, io.SeekStart); err != nil {
+		return nil, 0, fmt.Errorf(`[FindBoxPayload] failed to seek to the payload of box "%s": %w`, boxType, err)
+	}
+	return
+}
+
 func forEachBox(r io.ReadSeeker, limit int64, fn func(header *Header) error) (err error) {
 	var h *Header
 	var start int64
@@ -119,70 +329,393 @@ func forEachBox(r io.ReadSeeker, limit int64, fn func(header *Header) error) (er
 			fmt.Printf("[forEachBox] inspecting %s at %d(%#x)\n", string(h.Type[:]), offset, offset)
 		}
 
+		// Without a limit a box of size 0 extends to the end of the file and
+		// is the last one, anywhere else it would never advance.
+		last := h.Size == 0 && limit < 0
+		if !last && (h.PayloadSize() < 0 || !validBoxSize(h)) {
+			return fmt.Errorf(`[forEachBox] invalid size %d for box "%s" at %d(%#x)`, getBoxSize(h), h.Type, offset, offset)
+		}
+
 		if err = fn(h); err != nil {
 			return fmt.Errorf(`[forEachBox] callback failed: %w`, err)
 		}
+		if last {
+			return
+		}
+	}
+	return
+}
+
+// findOriginalFormat locates the frma box of a protected sample entry and
+// returns its header along with the original sample entry format.
+func findOriginalFormat(r io.ReadSeeker, entry *Header) (frma *Header, format BoxType, err error) {
+	var sinf *Header
+
+	if _, err = r.Seek(entry.Offset+int64(getHeaderSize(entry))+visualSampleEntryFieldsSize, io.SeekStart); err != nil {
+		return nil, format, fmt.Errorf(`[findOriginalFormat] failed to seek: %w`, err)
+	}
+
+	if sinf, err = findHeader(r, SinfBoxType, entry.PayloadSize()-visualSampleEntryFieldsSize); err != nil {
+		return nil, format, fmt.Errorf(`[findOriginalFormat] failed finding box "%s": %w`, SinfBoxType, err)
+	}
+
+	if frma, err = findHeader(r, FrmaBoxType, sinf.PayloadSize()); err != nil {
+		return nil, format, fmt.Errorf(`[findOriginalFormat] failed finding box "%s": %w`, FrmaBoxType, err)
+	}
+
+	if err = binary.Read(r, binary.BigEndian, &format); err != nil {
+		return nil, format, fmt.Errorf(`[findOriginalFormat] failed reading original format: %w`, err)
 	}
 	return
 }
 
-func sampleEntryHandler(rw *os.File) func(*Header) error {
+// encryptedEntryHandler handles encv sample entries. Renaming encv itself
+// breaks decryption, so the original format in frma is patched instead, but
+// only when asked to with -patch-frma.
+func encryptedEntryHandler(rw io.ReadWriteSeeker, h *Header) (err error) {
+	var (
+		frma   *Header
+		format BoxType
+	)
+
+	if frma, format, err = findOriginalFormat(rw, h); err != nil {
+		return fmt.Errorf(`[encryptedEntryHandler] failed reading encrypted sample entry at %d(%#x): %w`, h.Offset, h.Offset, err)
+	}
+
+	if !matchesFrom(format.String()) {
+		return
+	}
+
+	if !patchFrma {
+		fmt.Printf("Warning: skipping encrypted sample entry %s with original format %s at %d(%#x), use -patch-frma to convert its original format\n", h.Type, format, h.Offset, h.Offset)
+		return
+	}
+
+	formatOffset := frma.Offset + int64(getHeaderSize(frma))
+	if hexPreview {
+		if err = printHexPreview(rw, "before", formatOffset); err != nil {
+			return fmt.Errorf(`[encryptedEntryHandler] %w`, err)
+		}
+	}
+	if _, err = rw.Seek(formatOffset, io.SeekStart); err != nil {
+		return fmt.Errorf(`[encryptedEntryHandler] failed to seek: %w`, err)
+	}
+	if err = binary.Write(rw, binary.BigEndian, []byte(codecTo)); err != nil {
+		return fmt.Errorf(`[encryptedEntryHandler] failed to write original format "%s": %w`, codecTo, err)
+	}
+	if err = readBackFourCC(rw, formatOffset, codecTo); err != nil {
+		return fmt.Errorf(`[encryptedEntryHandler] %w`, err)
+	}
+	fmt.Printf("Changed original format of encrypted sample entry from %v to %v at %d(%#x)%s\n", format, codecTo, formatOffset, formatOffset, lenientNote(format.String()))
+	recordChange("original format", formatOffset, format.String(), codecTo)
+	if hexPreview {
+		if err = printHexPreview(rw, "after", formatOffset); err != nil {
+			return fmt.Errorf(`[encryptedEntryHandler] %w`, err)
+		}
+	}
+	return
+}
+
+func sampleEntryHandler(rw io.ReadWriteSeeker) func(*Header) error {
 	return func(h *Header) (err error) {
-		if string(h.Type[:]) == codecFrom {
+		if h.Type == EncvBoxType {
+			return encryptedEntryHandler(rw, h)
+		}
+		if matchesFrom(h.Type.String()) {
+			typeOffset := h.Offset + int64(getHeaderSize(h)) + getHeaderTypeOffset(h)
+			if !force && needsParameterSets(codecFrom, codecTo) {
+				if err = checkParameterSets(rw, h); err != nil {
+					return fmt.Errorf(`[sampleEntryHandler] %w (use -force to override)`, err)
+				}
+			}
+			if hexPreview {
+				if err = printHexPreview(rw, "before", typeOffset); err != nil {
+					return fmt.Errorf(`[sampleEntryHandler] %w`, err)
+				}
+			}
 			if _, err = rw.Seek(getHeaderTypeOffset(h), io.SeekCurrent); err != nil {
 				return fmt.Errorf(`[sampleEntryHandler] failed to seek back: %w`, err)
 			}
 			if err = binary.Write(rw, binary.BigEndian, []byte(codecTo)); err != nil {
 				return fmt.Errorf(`[sampleEntryHandler] failed to write box header type "%s": %w`, codecTo, err)
 			}
-			fmt.Printf("Changed codec from %v to %v\n", codecFrom, codecTo)
+			if err = readBackFourCC(rw, typeOffset, codecTo); err != nil {
+				return fmt.Errorf(`[sampleEntryHandler] %w`, err)
+			}
+			fmt.Printf("Changed codec from %v to %v at %d(%#x)%s\n", h.Type, codecTo, typeOffset, typeOffset, lenientNote(h.Type.String()))
+			recordChange("sample entry", typeOffset, h.Type.String(), codecTo)
+			if hexPreview {
+				if err = printHexPreview(rw, "after", typeOffset); err != nil {
+					return fmt.Errorf(`[sampleEntryHandler] %w`, err)
+				}
+			}
 		}
 		return
 	}
 }
 
-func trakHandler(rw *os.File) func(*Header) error {
+// findStsd descends from a trak header through mdia/minf/stbl and returns the
+// stsd header and the offset of its payload, which r is positioned at.
+func findStsd(r io.ReadSeeker, trak *Header) (h *Header, payloadOffset int64, err error) {
+	if h, payloadOffset, err = findStblChild(r, trak, StsdBoxType); err != nil {
+		return nil, 0, fmt.Errorf(`[findStsd] %w`, err)
+	}
+	return
+}
+
+// findStblChild descends from a trak header, with r positioned at its
+// payload, through mdia/minf/stbl to the stbl child of the given type and
+// returns its header and the offset of its payload, which r is positioned at.
+func findStblChild(r io.ReadSeeker, trak *Header, boxType BoxType) (h *Header, payloadOffset int64, err error) {
+	h = trak
+	for _, t := range []BoxType{MdiaBoxType, MinfBoxType, StblBoxType, boxType} {
+		if h, payloadOffset, err = FindBoxPayload(r, t, h.PayloadSize()); err != nil {
+			return nil, 0, fmt.Errorf(`[findStblChild] failed finding box "%s": %w`, t, err)
+		}
+	}
+	return
+}
+
+func trakHandler(rw io.ReadWriteSeeker, s *scopeState) func(*Header) error {
 	return func(trak *Header) (err error) {
-		var h *Header
+		var (
+			h          *Header
+			stsdOffset int64
+			entryCount uint32
+			limit      int64
+		)
 
 		if trak.Type != TrakBoxType {
 			return
 		}
 
-		if h, err = findHeader(rw, MdiaBoxType, int64(getBoxSize(trak)-getHeaderSize(trak))); err != nil {
-			return fmt.Errorf(`[trakHandler] failed finding box "%s": %w`, MdiaBoxType, err)
+		if trackID != 0 {
+			var tkhd *TkhdBox
+			if _, _, err = FindBoxPayload(rw, TkhdBoxType, trak.PayloadSize()); err != nil {
+				return fmt.Errorf(`[trakHandler] failed finding box "%s": %w`, TkhdBoxType, err)
+			}
+			if tkhd, err = readTkhdBox(rw); err != nil {
+				return fmt.Errorf(`[trakHandler] %w`, err)
+			}
+			if uint(tkhd.TrackID) != trackID {
+				if verbose {
+					fmt.Printf("[trakHandler] skipping track ID %d at %d(%#x)\n", tkhd.TrackID, trak.Offset, trak.Offset)
+				}
+				return
+			}
+			if _, err = rw.Seek(trak.Offset+int64(getHeaderSize(trak)), io.SeekStart); err != nil {
+				return fmt.Errorf(`[trakHandler] failed to seek: %w`, err)
+			}
 		}
 
-		if h, err = findHeader(rw, MinfBoxType, int64(getBoxSize(h)-getHeaderSize(h))); err != nil {
-			return fmt.Errorf(`[trakHandler] failed finding box "%s": %w`, MinfBoxType, err)
+		if h, stsdOffset, err = findStsd(rw, trak); err != nil {
+			return fmt.Errorf(`[trakHandler] failed locating sample descriptions: %w`, err)
 		}
 
-		if h, err = findHeader(rw, StblBoxType, int64(getBoxSize(h)-getHeaderSize(h))); err != nil {
-			return fmt.Errorf(`[trakHandler] failed finding box "%s": %w`, StblBoxType, err)
+		if _, entryCount, err = readStsdHeader(rw); err != nil {
+			return fmt.Errorf(`[trakHandler] stsd at %d(%#x): %w`, h.Offset, h.Offset, err)
 		}
-
-		if h, err = findHeader(rw, StsdBoxType, int64(getBoxSize(h)-getHeaderSize(h))); err != nil {
-			return fmt.Errorf(`[trakHandler] failed finding box "%s": %w`, StsdBoxType, err)
+		if limit, err = stsdEntriesLimit(h, entryCount); err != nil {
+			return fmt.Errorf(`[trakHandler] %w`, err)
 		}
 
-		// skip Version(1 byte) + Flags(3 bytes) + Number of entries(4 bytes) in stsd
-		if _, err = rw.Seek(8, io.SeekCurrent); err != nil {
-			return fmt.Errorf(`[trakHandler] failed to seek: %w`, err)
+		// With several sample descriptions, tell which are referenced by the
+		// chunks, since converting an unused one changes nothing on playback.
+		var stsc *StscBox
+		if entryCount > 1 {
+			stsc = sampleDescriptionUsage(rw, trak, entryCount)
+			if _, err = rw.Seek(stsdOffset+8, io.SeekStart); err != nil {
+				return fmt.Errorf(`[trakHandler] failed to seek: %w`, err)
+			}
 		}
 
-		if err = forEachBox(rw, int64(getBoxSize(h)-getHeaderSize(h)), sampleEntryHandler(rw)); err != nil {
+		var index uint32
+		handler := s.entries(sampleEntryHandler(rw))
+		s.enterTrack()
+		defer s.leaveTrack()
+		if err = forEachBox(rw, limit, func(entry *Header) error {
+			index++
+			if err := checkStsdEntry(h, entry, index, entryCount); err != nil {
+				return err
+			}
+			if stsc != nil && matchesFrom(entry.Type.String()) && !stsc.Uses(index) {
+				fmt.Printf("Warning: sample entry %s at %d(%#x) is sample description %d, which no chunk uses\n", entry.Type, entry.Offset, entry.Offset, index)
+			}
+			if matchesFrom(entry.Type.String()) || entry.Type == EncvBoxType {
+				if below, err := belowResolution(rw, entry); err != nil || below {
+					return err
+				}
+			}
+			return handler(entry)
+		}); err != nil {
 			return fmt.Errorf(`[trakHandler] failed processing sample entry list: %w`, err)
 		}
+		if err = checkStsdEntryCount(h, index, entryCount); err != nil {
+			return fmt.Errorf(`[trakHandler] %w`, err)
+		}
 
 		return
 	}
 }
 
+// convert patches every matching sample entry under the first moov box of rw,
+// every top level moov box with -all-moov, or only the FourCC at -patch-at.
+func convert(rw io.ReadWriteSeeker) (err error) {
+	var h *Header
+
+	if debugCRC {
+		var before []boxChecksum
+		if before, err = boxChecksums(rw); err != nil {
+			return fmt.Errorf(`[convert] %w`, err)
+		}
+		defer func() {
+			if err != nil {
+				return
+			}
+			var after []boxChecksum
+			if after, err = boxChecksums(rw); err != nil {
+				err = fmt.Errorf(`[convert] %w`, err)
+				return
+			}
+			printChecksumChanges(before, after)
+		}()
+	}
+
+	if limitChanges > 0 {
+		since := changeCount()
+		defer func() {
+			if err == nil {
+				err = enforceChangeLimit(rw, since)
+			}
+		}()
+	}
+
+	// The brands are only advisory, a broken ftyp is left to the scan below.
+	if compatBrandCheck {
+		if err = checkCompatibleBrands(rw); err != nil {
+			fmt.Printf("Warning: cannot check compatible brands: %v\n", err)
+		}
+	}
+
+	if patchAt >= 0 {
+		return patchFourCCAt(rw, patchAt)
+	}
+	if anywhere {
+		return patchAnywhere(rw)
+	}
+
+	if err = checkPrefix(rw); err != nil {
+		return fmt.Errorf(`[convert] %w`, err)
+	}
+
+	s := newScopeState()
+	defer func() {
+		if err == nil {
+			s.report()
+		}
+	}()
+
+	if _, err = rw.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf(`[convert] failed to seek: %w`, err)
+	}
+
+	scanLimit := int64(-1)
+	if maxScanBytes > 0 {
+		scanLimit = maxScanBytes
+	}
+
+	if allMoov {
+		moovs := 0
+		for h, err := range Boxes(rw, scanLimit) {
+			if err != nil && moovs == 0 && isEndOfFile(err) {
+				return fmt.Errorf(`[convert] %w: %w`, errIncompleteFile, err)
+			}
+			if err != nil {
+				return fmt.Errorf(`[convert] failed scanning top level boxes: %w`, err)
+			}
+			if h.Type != MoovBoxType {
+				continue
+			}
+			if verbose {
+				fmt.Printf("[convert] processing moov %d at %d(%#x)\n", moovs+1, h.Offset, h.Offset)
+			}
+			if err = convertMoov(rw, &h, s); err != nil {
+				return fmt.Errorf(`[convert] %w`, err)
+			}
+			moovs++
+		}
+		if moovs == 0 {
+			return fmt.Errorf(`[convert] %w`, errIncompleteFile)
+		}
+		return
+	}
+
+	if h, err = findHeader(rw, MoovBoxType, scanLimit); err != nil {
+		if isEndOfFile(err) {
+			return fmt.Errorf(`[convert] %w: %w`, errIncompleteFile, err)
+		}
+		if scanLimit >= 0 {
+			return fmt.Errorf(`[convert] failed finding box "%s" within the first %d bytes (-max-scan-bytes): %w`, MoovBoxType, scanLimit, err)
+		}
+		return fmt.Errorf(`[convert] failed finding box "%s": %w`, MoovBoxType, err)
+	}
+
+	if err = convertMoov(rw, h, s); err != nil {
+		return fmt.Errorf(`[convert] %w`, err)
+	}
+	return
+}
+
+// convertMoov patches every matching sample entry in the traks of the moov box
+// described by h, within the scope s.
+func convertMoov(rw io.ReadWriteSeeker, h *Header, s *scopeState) (err error) {
+	if h.PayloadSize() < 0 {
+		return fmt.Errorf(`[convertMoov] unsupported size %d for box "%s" at %d(%#x)`, getBoxSize(h), h.Type, h.Offset, h.Offset)
+	}
+	// How far a scope reaches depends on the order of the traks, so they are
+	// only converted concurrently without one.
+	if f, ok := rw.(fileAt); ok && parallelBoxes && s == nil {
+		var size int64
+		if size, err = rw.Seek(0, io.SeekEnd); err != nil {
+			return fmt.Errorf(`[convertMoov] failed to seek: %w`, err)
+		}
+		return convertTraksParallel(f, size, h)
+	}
+	if onePass {
+		return convertMoovOnePass(rw, h, s)
+	}
+	return convertMoovInPlace(rw, h, s)
+}
+
+// convertMoovInPlace converts the traks of the moov box h one after the
+// other, writing each patch as its sample entry is found.
+func convertMoovInPlace(rw io.ReadWriteSeeker, h *Header, s *scopeState) (err error) {
+	if _, err = rw.Seek(h.Offset+int64(getHeaderSize(h)), io.SeekStart); err != nil {
+		return fmt.Errorf(`[convertMoovInPlace] failed to seek: %w`, err)
+	}
+	// Everything that is ever changed lives under moov, so the scan ends
+	// with it and the boxes after moov are never read.
+	if err = forEachBox(rw, h.PayloadSize(), trakHandler(rw, s)); err != nil {
+		return fmt.Errorf(`[convertMoovInPlace] failed processing moov children: %w`, err)
+	}
+	return
+}
+
+// writesCopy reports whether files are converted into a temporary copy
+// renamed over them, rather than in place.
+func writesCopy() bool {
+	return atomicWrite || tempDir != "" || outDir != "" || stripFree || remux || addEntry != "" || canonical || stripPrefix > 0
+}
+
 func processFile(mp4file string) (err error) {
-	var (
-		rw *os.File
-		h  *Header
-	)
+	var rw *os.File
+
+	if emitManifest != "" {
+		return planFile(mp4file)
+	}
+	if writesCopy() {
+		return processFileAtomic(mp4file)
+	}
 
 	if rw, err = os.OpenFile(mp4file, os.O_RDWR, 0); err != nil {
 		return fmt.Errorf(`[processFile] cannot open file "%s": %w`, mp4file, err)
@@ -197,47 +730,386 @@ func processFile(mp4file string) (err error) {
 
 	fmt.Printf("Processing %s ...\n", mp4file)
 
-	if _, err = rw.Seek(0, io.SeekStart); err != nil {
-		return fmt.Errorf(`[processFile] failed to seek: %w`, err)
+	if err = convert(rw); err != nil {
+		return fmt.Errorf(`[processFile] %w`, err)
 	}
+	return
+}
 
-	if h, err = findHeader(rw, MoovBoxType, -1); err != nil {
-		return fmt.Errorf(`[processFile] failed finding box "%s": %w`, MoovBoxType, err)
+// convertFile processes a file of the batch, skipping it if it does not match
+// the file filters, verifying the result unless -no-verify is set and renaming
+// it afterwards with -rename-on-change. With -keep-original the original is
+// moved back if the file fails to convert or is left unchanged.
+func convertFile(ctx context.Context, mp4file string) (result FileResult) {
+	var (
+		err error
+		ok  bool
+	)
+
+	if ifBrand != "" {
+		if ok, err = fileHasBrand(mp4file, ifBrand); err != nil {
+			return newFileResult(mp4file, err)
+		}
+		if !ok {
+			return skipFile(mp4file, fmt.Sprintf("ftyp does not carry the %s brand (-if-brand)", ifBrand))
+		}
 	}
 
-	if err = forEachBox(rw, int64(getBoxSize(h)-getHeaderSize(h)), trakHandler(rw)); err != nil {
-		return fmt.Errorf(`[processFile] failed processing moov children: %w`, err)
+	if onlyCodec != "" {
+		if ok, err = fileHasCodec(mp4file, onlyCodec); err != nil {
+			return newFileResult(mp4file, err)
+		}
+		if !ok {
+			return skipFile(mp4file, fmt.Sprintf("no %s sample entry (-only-codec)", onlyCodec))
+		}
+	}
+
+	if abortOnUnknown {
+		var info *FileInfo
+		if info, err = inspectFile(mp4file); err != nil {
+			return newFileResult(mp4file, err)
+		}
+		if unknown := unknownCodecs(info); len(unknown) > 0 {
+			return newFileResult(mp4file, fmt.Errorf(`[convertFile] "%s" has %s (-abort-on-unknown): %w`, mp4file, strings.Join(unknown, ", "), errUnknownCodec))
+		}
+	}
+
+	var compressed bool
+	if compressed, err = isGzipFile(mp4file); err != nil {
+		return newFileResult(mp4file, err)
+	}
+	if compressed {
+		return newFileResult(mp4file, fmt.Errorf(`[convertFile] "%s": %w`, mp4file, errGzipInput))
+	}
+
+	if safe {
+		var reasons []string
+		if reasons, err = unsafeReasons(mp4file); err != nil {
+			return newFileResult(mp4file, err)
+		}
+		if len(reasons) > 0 {
+			return skipFile(mp4file, "unsafe to convert (-safe): "+strings.Join(reasons, "; "))
+		}
+	}
+
+	if ok, err = confirmConversion(mp4file); err != nil {
+		return newFileResult(mp4file, err)
+	}
+	if !ok {
+		return skipFile(mp4file, "conversion declined (-interactive)")
+	}
+
+	// Only files that passed the filters and were confirmed are repaired.
+	if repair {
+		if _, err = repairFile(mp4file); err != nil {
+			return newFileResult(mp4file, err)
+		}
 	}
-	return
-}
 
-func run(mp4files []string) (err error) {
-	for _, mp4file := range mp4files {
-		if err = processFile(mp4file); err != nil {
-			return fmt.Errorf(`[run] failed processing file %s: %w`, mp4file, err)
+	// Nothing is written while planning a manifest.
+	var baseline *verifyBaseline
+	if !noVerify && emitManifest == "" {
+		if baseline, err = newVerifyBaseline(mp4file); err != nil {
+			return newFileResult(mp4file, err)
+		}
+	}
+
+	var orig string
+	if keepOriginalFile {
+		if orig, err = keepOriginal(mp4file); err != nil {
+			return newFileResult(mp4file, err)
+		}
+	}
+
+	takeChanges()
+	takeBelowThreshold()
+	result = newFileResult(mp4file, processFileWithRetries(ctx, mp4file))
+	result.Changes = takeChanges()
+	if below := takeBelowThreshold(); result.Err == nil && len(result.Changes) == 0 && below > 0 {
+		result = skipFile(mp4file, fmt.Sprintf("%d sample entries below -min-width %d -min-height %d", below, minWidth, minHeight))
+	}
+	if result.Err == nil && baseline != nil {
+		dst := mp4file
+		if outDir != "" {
+			dst = outputPaths[mp4file]
+		}
+		if err = baseline.verify(dst, stripFree || remux || addEntry != "" || canonical || stripPrefix > 0); err != nil {
+			result.Status, result.Err = statusFailed, err
+		}
+	}
+	if orig != "" {
+		if result.Err != nil || len(result.Changes) == 0 {
+			if err = restoreOriginal(mp4file, orig); err != nil && result.Err == nil {
+				result.Status, result.Err = statusFailed, err
+			} else if err != nil {
+				fmt.Printf("Warning: %v\n", err)
+			}
+		} else {
+			result.Original = orig
+			fmt.Printf("Kept the original of %s as %s\n", mp4file, orig)
+		}
+	}
+	if result.Err == nil && renameOnChange != "" && len(result.Changes) > 0 {
+		if result.RenamedTo, err = renameWithSuffix(mp4file); err != nil {
+			result.Status, result.Err = statusFailed, err
+		} else {
+			fmt.Printf("Renamed %s to %s\n", mp4file, result.RenamedTo)
 		}
 	}
 	return
 }
 
-func help() {
-	fmt.Printf("usage: mp4dovi [options] files...\n")
-	flag.PrintDefaults()
+func run(ctx context.Context, mp4files []string) (err error) {
+	if compareMode {
+		return runCompare(mp4files)
+	}
+	if listMode {
+		return runList(ctx, mp4files)
+	}
+	if validateMode {
+		return runValidate(ctx, mp4files)
+	}
+	if infoMode {
+		return runInfo(ctx, mp4files)
+	}
+	if adviseMode {
+		return runAdvise(ctx, mp4files)
+	}
+	if ffmpegCommand {
+		return runFFmpegCommand(ctx, mp4files)
+	}
+	if outDir != "" {
+		if outputPaths, err = planOutputPaths(mp4files); err != nil {
+			return fmt.Errorf(`[run] %w`, err)
+		}
+	}
+	var audit *auditLog
+	if logFile != "" {
+		if audit, err = openAuditLog(logFile); err != nil {
+			return fmt.Errorf(`[run] %w`, err)
+		}
+		defer audit.Close()
+	}
+
+	results := make([]FileResult, 0, len(mp4files))
+	denied := 0
+	if outputFormat != formatText {
+		defer func() {
+			if reportErr := reportResults(os.Stdout, outputFormat, results); reportErr != nil && err == nil {
+				err = fmt.Errorf(`[run] %w`, reportErr)
+			}
+		}()
+	}
+	// Skipped files are still told about with -summary-only, as errors. The
+	// JSON and CSV reports are meant for parsing, so nothing else may go to
+	// standard output either.
+	notices := io.Writer(os.Stdout)
+	if summaryOnly || outputFormat == formatJSON || outputFormat == formatCSV {
+		var restore func()
+		if restore, err = muteStdout(); err != nil {
+			return fmt.Errorf(`[run] %w`, err)
+		}
+		defer func() {
+			restore()
+			if summaryOnly {
+				printSummary(results)
+			}
+		}()
+		notices = os.Stderr
+	}
+	for i, mp4file := range mp4files {
+		// Files are only ever checked between writes, so an interrupt never
+		// leaves a file half processed.
+		if err = ctx.Err(); err != nil {
+			return fmt.Errorf(`[run] interrupted after %d of %d files, %s and later files were not processed: %w`, i, len(mp4files), mp4file, err)
+		}
+		started := time.Now()
+		var codecsBefore []string
+		if outputFormat != formatText {
+			if info, err := inspectFile(mp4file); err == nil {
+				codecsBefore = info.codecs()
+			}
+		}
+		result := convertFile(ctx, mp4file)
+		if outputFormat != formatText {
+			// The codecs found before converting, as the file may be gone
+			// afterwards with -rename-on-change.
+			result.Codecs = codecsBefore
+		}
+		results = append(results, result)
+		if audit != nil {
+			if err = audit.write(result, started, time.Now()); err != nil {
+				return fmt.Errorf(`[run] %w`, err)
+			}
+		}
+		if result.Status == statusIncomplete && nullSafe {
+			fmt.Fprintf(notices, "Skipping %s: %v\n", mp4file, errIncompleteFile)
+			continue
+		}
+		// Unreadable files do not stop the batch, as expected on shared
+		// drives, but still fail the run once the other files are done.
+		if result.Status == statusAccessDenied {
+			fmt.Fprintf(notices, "Skipping %s: %s: %v\n", mp4file, statusAccessDenied, result.Err)
+			denied++
+			continue
+		}
+		if result.Err != nil {
+			return fmt.Errorf(`[run] failed processing file %s: %w`, mp4file, result.Err)
+		}
+	}
+	for _, result := range results {
+		if result.Status != statusDone && !summaryOnly {
+			printSummary(results)
+			break
+		}
+	}
+	if emitManifest != "" {
+		if err = writeManifest(emitManifest); err != nil {
+			return fmt.Errorf(`[run] %w`, err)
+		}
+	}
+	if denied > 0 {
+		return fmt.Errorf(`[run] %d of %d files could not be accessed`, denied, len(mp4files))
+	}
+	return
 }
 
 func main() {
-	flag.StringVar(&codecFrom, "from", "dvhe", "video codec to convert from")
-	flag.StringVar(&codecTo, "to", "dvh1", "video codec to convert to")
-	flag.BoolVar(&verbose, "verbose", false, "enable verbose output")
-	flag.Parse()
-
-	files := flag.Args()
-	if len(files) < 1 {
-		help()
+	files := parseArgs(os.Args[1:])
+	if showVersion {
+		fmt.Printf("mp4dovi %s\n", toolVersion())
+		return
+	}
+	if jsonSchema {
+		if err := writeJSONSchema(os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if len(files) < 1 && !streamMode && applyManifest == "" {
+		flag.Usage()
+		if checkMode {
+			os.Exit(checkError)
+		}
 		os.Exit(1)
 	}
 
-	if err := run(files); err != nil {
+	if err := resolveCodecNames(); err != nil {
+		log.Fatal(err)
+	}
+	if err := validateFormat(); err != nil {
+		log.Fatal(err)
+	}
+	if stripPrefix < 0 {
+		log.Fatalf("-strip-prefix %d is negative", stripPrefix)
+	}
+	if ffmpegCommand {
+		if err := resolveCodecTo(); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if converting() {
+		if err := resolveCodecTo(); err != nil {
+			log.Fatal(err)
+		}
+		if err := validateCodecs(); err != nil {
+			log.Fatal(err)
+		}
+		if onlyCodec != "" && len(onlyCodec) != 4 {
+			log.Fatalf("-only-codec %q is not a 4 character code", onlyCodec)
+		}
+		if allMoov && scanOnlyMoov {
+			log.Fatal("-all-moov and -scan-only-moov cannot be combined")
+		}
+		if onePass && parallelBoxes {
+			log.Fatal("-one-pass and -parallel-boxes cannot be combined")
+		}
+		if safe && (force || anywhere || patchAt >= 0) {
+			log.Fatal("-safe cannot be combined with -force, -anywhere or -patch-at, which bypass its checks")
+		}
+		if anywhere && (patchAt >= 0 || trackID != 0 || allMoov) {
+			log.Fatal("-anywhere cannot be combined with -patch-at, -track-id or -all-moov")
+		}
+		if err := validateScope(); err != nil {
+			log.Fatal(err)
+		}
+		if scope != scopeAll && (anywhere || patchAt >= 0) {
+			log.Fatal("-scope cannot be combined with -anywhere or -patch-at")
+		}
+		if (minWidth > 0 || minHeight > 0) && (anywhere || patchAt >= 0) {
+			log.Fatal("-min-width and -min-height cannot be combined with -anywhere or -patch-at")
+		}
+		if renameOnChange != "" && outDir != "" {
+			log.Fatal("-rename-on-change only applies to files converted in place and cannot be combined with -out-dir")
+		}
+		if summaryOnly && (outputFormat != formatText || interactive) {
+			log.Fatal("-summary-only cannot be combined with -format or -interactive, which print per file")
+		}
+		if repair && outDir != "" {
+			log.Fatal("-repair modifies the files in place and cannot be combined with -out-dir")
+		}
+		if keepOriginalFile && outDir != "" {
+			log.Fatal("-keep-original only applies to files converted in place and cannot be combined with -out-dir")
+		}
+		if conflicts := manifestConflicts(); emitManifest != "" && len(conflicts) > 0 {
+			log.Fatalf("-emit-manifest only plans the bytes to patch in place, it cannot be combined with %s", strings.Join(conflicts, ", "))
+		}
+		if dedupe {
+			var removed int
+			// Like the notices of run, this stays off standard output
+			// when it carries a JSON or CSV report.
+			notices := io.Writer(os.Stdout)
+			if summaryOnly || outputFormat == formatJSON || outputFormat == formatCSV {
+				notices = os.Stderr
+			}
+			if files, removed = dedupeFiles(files); removed > 0 {
+				fmt.Fprintf(notices, "Removed %d duplicate input files\n", removed)
+			}
+		}
+	}
+
+	if applyManifest != "" && len(files) > 0 {
+		log.Fatal("-apply-manifest patches the files listed in the manifest and takes no files")
+	}
+	if streamMode {
+		if !converting() || len(files) > 0 {
+			log.Fatal("-stream converts standard input to standard output and takes no files")
+		}
+		if conflicts := streamConflicts(); len(conflicts) > 0 {
+			log.Fatalf("-stream reads its input once and writes standard output only, it cannot be combined with %s", strings.Join(conflicts, ", "))
+		}
+	}
+
+	// The first SIGINT stops the batch after the current file, a second one
+	// terminates immediately.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	stopProfiling, err := startProfiling()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if checkMode {
+		code := runCheck(ctx, files)
+		stopProfiling()
+		os.Exit(code)
+	}
+	if streamMode {
+		err = runStream()
+	} else if applyManifest != "" {
+		err = runApplyManifest(applyManifest)
+	} else {
+		err = run(ctx, files)
+	}
+	stopProfiling()
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			log.Print(err)
+			os.Exit(130)
+		}
 		log.Fatal(err)
 	}
 }
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+)
+
+// box builds a box with a 32-bit size header around the concatenated payloads.
+func box(boxType string, payloads ...[]byte) []byte {
+	payload := bytes.Join(payloads, nil)
+	b := make([]byte, 8, 8+len(payload))
+	binary.BigEndian.PutUint32(b, uint32(8+len(payload)))
+	copy(b[4:], boxType)
+	return append(b, payload...)
+}
+
+// fullBox builds a FullBox with the given version and flags.
+func fullBox(boxType string, version uint8, flags uint32, payloads ...[]byte) []byte {
+	vf := make([]byte, 4)
+	binary.BigEndian.PutUint32(vf, uint32(version)<<24|flags&0x00ffffff)
+	return box(boxType, append([][]byte{vf}, payloads...)...)
+}
+
+func u16(v uint16) []byte {
+	b := make([]byte, 2)
+	binary.BigEndian.PutUint16(b, v)
+	return b
+}
+
+func u32(v uint32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, v)
+	return b
+}
+
+func u64(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return b
+}
+
+// visualSampleEntry builds a minimal visual sample entry with optional child boxes.
+func visualSampleEntry(boxType string, width, height uint16, children ...[]byte) []byte {
+	fixed := make([]byte, 78)
+	binary.BigEndian.PutUint16(fixed[6:], 1) // data_reference_index
+	binary.BigEndian.PutUint16(fixed[24:], width)
+	binary.BigEndian.PutUint16(fixed[26:], height)
+	return box(boxType, append([][]byte{fixed}, children...)...)
+}
+
+// hvcC builds a HEVC decoder configuration holding one VPS, SPS and PPS, as
+// required to convert to codecs with out-of-band parameter sets.
+func hvcC() []byte {
+	arrays := [][]byte{make([]byte, 22), {3}}
+	for _, nal := range []byte{hevcNalVPS, hevcNalSPS, hevcNalPPS} {
+		arrays = append(arrays, []byte{0x80 | nal}, u16(1), u16(2), []byte{nal << 1, 1})
+	}
+	return box("hvcC", arrays...)
+}
+
+// stsd builds a sample description box holding the given entries.
+func stsd(entries ...[]byte) []byte {
+	return fullBox("stsd", 0, 0, append([][]byte{u32(uint32(len(entries)))}, entries...)...)
+}
+
+// trak builds a minimal track containing the mdia/minf/stbl/stsd chain.
+func trak(entries ...[]byte) []byte {
+	return box("trak", box("mdia", box("minf", box("stbl", stsd(entries...)))))
+}
+
+// movie builds ftyp + moov(children) + mdat.
+func movie(moovChildren ...[]byte) []byte {
+	return bytes.Join([][]byte{
+		box("ftyp", []byte("isom"), u32(0), []byte("isomdby1")),
+		box("moov", moovChildren...),
+		box("mdat", make([]byte, 16)),
+	}, nil)
+}
+
+// largeBox builds a box using the 64-bit size header.
+func largeBox(b []byte) []byte {
+	out := make([]byte, 16, len(b)+8)
+	binary.BigEndian.PutUint32(out, 1)
+	copy(out[4:8], b[4:8])
+	binary.BigEndian.PutUint64(out[8:], uint64(len(b)+8))
+	return append(out, b[8:]...)
+}
+
+// memFile is an in-memory io.ReadWriteSeeker.
+type memFile struct {
+	data   []byte
+	offset int64
+}
+
+func (f *memFile) Read(p []byte) (int, error) {
+	if f.offset >= int64(len(f.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, f.data[f.offset:])
+	f.offset += int64(n)
+	return n, nil
+}
+
+func (f *memFile) Write(p []byte) (int, error) {
+	if end := f.offset + int64(len(p)); end > int64(len(f.data)) {
+		f.data = append(f.data, make([]byte, end-int64(len(f.data)))...)
+	}
+	n := copy(f.data[f.offset:], p)
+	f.offset += int64(n)
+	return n, nil
+}
+
+func (f *memFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += int64(len(f.data))
+	}
+	if offset < 0 {
+		return 0, errors.New("negative offset")
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+func ExampleFindBoxPayload() {
+	data := movie(trak(visualSampleEntry("dvhe", 1920, 1080)))
+	r := bytes.NewReader(data)
+
+	// Find moov among the top level boxes, then trak among its children.
+	moov, moovPayload, err := FindBoxPayload(r, MoovBoxType, -1)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println(moov.Type, moov.Offset, moovPayload, moov.PayloadSize())
+
+	trak, trakPayload, err := FindBoxPayload(r, TrakBoxType, moov.PayloadSize())
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println(trak.Type, trak.Offset, trakPayload, trak.PayloadSize())
+	// Output:
+	// moov 24 32 134
+	// trak 32 40 126
+}
+
+// withCodecs sets -from and -to for the duration of a test.
+func withCodecs(t *testing.T, from, to string) {
+	t.Helper()
+	oldFrom, oldTo := codecFrom, codecTo
+	codecFrom, codecTo = from, to
+	t.Cleanup(func() { codecFrom, codecTo = oldFrom, oldTo })
+}
+
+// captureStdout returns what f prints to standard output.
+func captureStdout(t *testing.T, f func()) string {
+	t.Helper()
+	out, err := os.CreateTemp(t.TempDir(), "stdout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	stdout := os.Stdout
+	os.Stdout = out
+	defer func() { os.Stdout = stdout }()
+	f()
+	printed, err := os.ReadFile(out.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(printed)
+}
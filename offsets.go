@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// BoxOffset locates a box of a file for -show-offsets.
+type BoxOffset struct {
+	Path          string `json:"path"`
+	Offset        int64  `json:"offset"`
+	PayloadOffset int64  `json:"payloadOffset"`
+
+	// Size is 0 for a last box extending to the end of the file
+	Size uint64 `json:"size"`
+}
+
+// offsetVisitor collects the offsets of every box Walk can descend into.
+type offsetVisitor struct {
+	boxes []BoxOffset
+}
+
+func (v *offsetVisitor) EnterBox(path []BoxType, h Header) (descend bool, err error) {
+	types := make([]string, len(path))
+	for i, t := range path {
+		types[i] = t.String()
+	}
+	v.boxes = append(v.boxes, BoxOffset{
+		Path:          strings.Join(types, "/"),
+		Offset:        h.Offset,
+		PayloadOffset: h.Offset + h.HeaderLength(),
+		Size:          getBoxSize(&h),
+	})
+	return true, nil
+}
+
+func (v *offsetVisitor) LeaveBox(path []BoxType, h Header) error {
+	return nil
+}
+
+// boxOffsets returns the offsets of every box of r in file order.
+func boxOffsets(r io.ReadSeeker) ([]BoxOffset, error) {
+	v := &offsetVisitor{}
+	if err := Walk(r, v); err != nil {
+		return nil, fmt.Errorf(`[boxOffsets] %w`, err)
+	}
+	return v.boxes, nil
+}
+
+// boxOffsetsFile is boxOffsets for mp4file, decompressed first if needed.
+func boxOffsetsFile(mp4file string) ([]BoxOffset, error) {
+	r, err := openForInspection(mp4file)
+	if err != nil {
+		return nil, fmt.Errorf(`[boxOffsetsFile] %w`, err)
+	}
+	defer r.Close()
+	return boxOffsets(r)
+}
+
+// printBoxOffsets prints every box indented by its depth, with its start and
+// payload offsets in hex as hex editors show them.
+func printBoxOffsets(boxes []BoxOffset) {
+	fmt.Printf("  boxes:\n")
+	for _, b := range boxes {
+		depth := strings.Count(b.Path, "/")
+		name := b.Path[strings.LastIndexByte(b.Path, '/')+1:]
+		fmt.Printf("    %-24s start 0x%08x  payload 0x%08x  size %d\n", strings.Repeat("  ", depth)+name, b.Offset, b.PayloadOffset, b.Size)
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestBoxOffsets(t *testing.T) {
+	data := append(movie(trak(visualSampleEntry("dvhe", 1920, 1080, box("dvcC", make([]byte, 24))))), largeBox(box("free", make([]byte, 4)))...)
+
+	boxes, err := boxOffsets(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	byPath := make(map[string]BoxOffset)
+	for _, b := range boxes {
+		byPath[b.Path] = b
+	}
+	if boxes[0].Path != "ftyp" || boxes[1] != byPath["moov"] || boxes[1].Offset != 24 || boxes[1].PayloadOffset != 32 {
+		t.Errorf("got first boxes %+v", boxes[:2])
+	}
+	entry, ok := byPath["moov/trak/mdia/minf/stbl/stsd/dvhe"]
+	if !ok {
+		t.Fatalf("no sample entry in %+v", boxes)
+	}
+	if dvcc := byPath["moov/trak/mdia/minf/stbl/stsd/dvhe/dvcC"]; dvcc.Offset != entry.PayloadOffset+visualSampleEntryFieldsSize {
+		t.Errorf("got dvcC at %#x, want right after the fields of the entry at %#x", dvcc.Offset, entry.PayloadOffset)
+	}
+	if free := boxes[len(boxes)-1]; free.Path != "free" || free.PayloadOffset-free.Offset != 16 || free.Size != 20 {
+		t.Errorf("got large free box %+v", free)
+	}
+}
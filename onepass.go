@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// patchPlan is a moov box read into memory, which the conversion scans and
+// patches there, remembering where it wrote so that only those bytes are
+// written to the file afterwards.
+type patchPlan struct {
+	*boxBuffer
+
+	// patches are the offset and length of every write
+	patches [][2]int64
+}
+
+func (p *patchPlan) Write(b []byte) (int, error) {
+	offset := p.pos
+	n, err := p.boxBuffer.Write(b)
+	if n > 0 {
+		p.patches = append(p.patches, [2]int64{offset, int64(n)})
+	}
+	return n, err
+}
+
+// apply writes the patched bytes to w in ascending offset order, reading each
+// back unless -no-read-back is set.
+func (p *patchPlan) apply(w io.ReadWriteSeeker) (err error) {
+	sort.Slice(p.patches, func(i, j int) bool { return p.patches[i][0] < p.patches[j][0] })
+	for _, pt := range p.patches {
+		data := p.data[pt[0]-p.base : pt[0]-p.base+pt[1]]
+		if _, err = w.Seek(pt[0], io.SeekStart); err != nil {
+			return fmt.Errorf(`[patchPlan] failed to seek: %w`, err)
+		}
+		if _, err = w.Write(data); err != nil {
+			return fmt.Errorf(`[patchPlan] failed writing %q at %d(%#x): %w`, data, pt[0], pt[0], err)
+		}
+		if noReadBack {
+			continue
+		}
+		got := make([]byte, len(data))
+		if _, err = w.Seek(pt[0], io.SeekStart); err != nil {
+			return fmt.Errorf(`[patchPlan] failed to seek: %w`, err)
+		}
+		if _, err = io.ReadFull(w, got); err != nil {
+			return fmt.Errorf(`[patchPlan] failed reading back %d(%#x): %w`, pt[0], pt[0], err)
+		}
+		if !bytes.Equal(got, data) {
+			return fmt.Errorf(`[patchPlan] wrote %q at %d(%#x) but read back %q: %w`, data, pt[0], pt[0], got, errReadBackMismatch)
+		}
+	}
+	return nil
+}
+
+// convertMoovOnePass converts the traks of the moov box h like convertMoov,
+// for -one-pass: moov is read with a single read and scanned in memory,
+// collecting the FourCC patches of every trak, which are then written in a
+// tight loop over their offsets. Nothing is written if the scan fails. A moov
+// too large to hold in memory is converted in place as without -one-pass.
+func convertMoovOnePass(rw io.ReadWriteSeeker, h *Header, s *scopeState) (err error) {
+	if h.Size == 0 || getBoxSize(h) > maxStreamMoovSize {
+		if verbose {
+			fmt.Printf("[convertMoovOnePass] moov at %d(%#x) of size %d converted in place\n", h.Offset, h.Offset, getBoxSize(h))
+		}
+		return convertMoovInPlace(rw, h, s)
+	}
+	plan := &patchPlan{boxBuffer: &boxBuffer{data: make([]byte, getBoxSize(h)), base: h.Offset}}
+	if _, err = rw.Seek(h.Offset, io.SeekStart); err != nil {
+		return fmt.Errorf(`[convertMoovOnePass] failed to seek: %w`, err)
+	}
+	if _, err = io.ReadFull(rw, plan.data); err != nil {
+		return fmt.Errorf(`[convertMoovOnePass] failed reading moov at %d(%#x): %w`, h.Offset, h.Offset, err)
+	}
+
+	since := changeCount()
+	plan.pos = h.Offset + int64(getHeaderSize(h))
+	if err = forEachBox(plan, h.PayloadSize(), trakHandler(plan, s)); err != nil {
+		// The changes of the scan were never written
+		dropChangesSince(since)
+		return fmt.Errorf(`[convertMoovOnePass] failed processing moov children: %w`, err)
+	}
+	if verbose {
+		fmt.Printf("[convertMoovOnePass] writing %d patches\n", len(plan.patches))
+	}
+	if err = plan.apply(rw); err != nil {
+		return fmt.Errorf(`[convertMoovOnePass] %w`, err)
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+)
+
+func TestConvertOnePass(t *testing.T) {
+	withCodecs(t, "dvhe", "dvh1")
+	t.Cleanup(func() { onePass, scope = false, scopeAll })
+	takeChanges()
+
+	for _, s := range []string{scopeAll, scopeFirstTrack} {
+		scope = s
+		data := multiTrackMovie(32, 3)
+		onePass = false
+		want := &memFile{data: append([]byte{}, data...)}
+		if err := convert(want); err != nil {
+			t.Fatal(err)
+		}
+		wantChanges := takeChanges()
+
+		onePass = true
+		got := &memFile{data: append([]byte{}, data...)}
+		if err := convert(got); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got.data, want.data) {
+			t.Errorf("-scope %s: one pass conversion differs at %v", s, diffOffsets(want.data, got.data))
+		}
+		if changes := takeChanges(); fmt.Sprint(changes) != fmt.Sprint(wantChanges) {
+			t.Errorf("-scope %s: got changes %v, want %v", s, changes, wantChanges)
+		}
+	}
+}
+
+func TestConvertOnePassFailing(t *testing.T) {
+	withCodecs(t, "dvhe", "dvh1")
+	t.Cleanup(func() { onePass = false })
+	onePass = true
+	takeChanges()
+
+	// The last track has no hvcC, failing after the others were scanned
+	data := movie(trak(visualSampleEntry("dvhe", 1920, 1080, hvcC())), trak(visualSampleEntry("dvhe", 1920, 1080)))
+	f := &memFile{data: append([]byte{}, data...)}
+	if err := convert(f); err == nil {
+		t.Fatal("converted a track without parameter sets")
+	}
+	if !bytes.Equal(f.data, data) {
+		t.Errorf("failed conversion wrote at %v", diffOffsets(data, f.data))
+	}
+	if changes := takeChanges(); len(changes) != 0 {
+		t.Errorf("got changes %v, want none written", changes)
+	}
+}
+
+func TestPatchPlan(t *testing.T) {
+	f := &memFile{data: []byte("0123456789")}
+	plan := &patchPlan{boxBuffer: &boxBuffer{data: []byte("3456"), base: 3}}
+	plan.Seek(5, io.SeekStart)
+	plan.Write([]byte("ab"))
+	plan.Seek(3, io.SeekStart)
+	plan.Write([]byte("c"))
+	if _, err := plan.Write([]byte("defg")); err == nil {
+		t.Error("wrote past the end of the box")
+	}
+
+	if string(f.data) != "0123456789" {
+		t.Errorf("patches written before apply: %q", f.data)
+	}
+	if err := plan.apply(f); err != nil {
+		t.Fatal(err)
+	}
+	if string(f.data) != "012c4ab789" {
+		t.Errorf("got %q after apply", f.data)
+	}
+}
+
+// BenchmarkConvertPatch measures converting every track of a large moov,
+// renaming the entries back and forth, with and without -one-pass.
+func BenchmarkConvertPatch(b *testing.B) {
+	stdout := os.Stdout
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		b.Fatal(err)
+	}
+	os.Stdout = devNull
+	oldFrom, oldTo := codecFrom, codecTo
+	b.Cleanup(func() {
+		os.Stdout = stdout
+		devNull.Close()
+		codecFrom, codecTo, onePass = oldFrom, oldTo, false
+	})
+
+	for _, traks := range []int{4, 64, 512} {
+		f := writeTempFile(b, multiTrackMovie(traks, 16))
+		codecFrom, codecTo = "dvhe", "dvh1"
+		for _, one := range []bool{false, true} {
+			b.Run(fmt.Sprintf("traks=%d/one-pass=%v", traks, one), func(b *testing.B) {
+				onePass = one
+				for i := 0; i < b.N; i++ {
+					if err := convert(f); err != nil {
+						b.Fatal(err)
+					}
+					codecFrom, codecTo = codecTo, codecFrom
+					takeChanges()
+				}
+			})
+		}
+	}
+}
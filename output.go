@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// outputPaths maps every input file to its copy in -out-dir, planned by run
+// before converting the first file.
+var outputPaths map[string]string
+
+// nameTemplatePlaceholders lists the placeholders allowed in -name-template.
+var nameTemplatePlaceholders = []string{"name", "ext", "from", "to", "index"}
+
+// validateNameTemplate checks that template only uses known placeholders, at
+// least one, has balanced braces and names a file rather than a path.
+func validateNameTemplate(template string) error {
+	if template == "" {
+		return fmt.Errorf(`[validateNameTemplate] empty name template`)
+	}
+	if strings.ContainsRune(template, '/') || strings.ContainsRune(template, filepath.Separator) {
+		return fmt.Errorf(`[validateNameTemplate] name template "%s" must not contain path separators`, template)
+	}
+	placeholders := 0
+	for rest := template; rest != ""; {
+		open := strings.IndexAny(rest, "{}")
+		if open < 0 {
+			break
+		}
+		if rest[open] == '}' {
+			return fmt.Errorf(`[validateNameTemplate] unbalanced "}" in name template "%s"`, template)
+		}
+		end := strings.IndexByte(rest[open:], '}')
+		if end < 0 {
+			return fmt.Errorf(`[validateNameTemplate] unterminated placeholder in name template "%s"`, template)
+		}
+		placeholder := rest[open+1 : open+end]
+		known := false
+		for _, p := range nameTemplatePlaceholders {
+			known = known || p == placeholder
+		}
+		if !known {
+			return fmt.Errorf(`[validateNameTemplate] unknown placeholder {%s} in name template "%s", expected one of %v`, placeholder, template, nameTemplatePlaceholders)
+		}
+		rest = rest[open+end+1:]
+		placeholders++
+	}
+	if placeholders == 0 {
+		return fmt.Errorf(`[validateNameTemplate] name template "%s" has no placeholder, every copy would get the same name`, template)
+	}
+	return nil
+}
+
+// expandNameTemplate returns the output file name of mp4file, the index-th
+// file (starting at 1) of the batch.
+func expandNameTemplate(template, mp4file string, index int) string {
+	base := filepath.Base(mp4file)
+	ext := filepath.Ext(base)
+	return strings.NewReplacer(
+		"{name}", strings.TrimSuffix(base, ext),
+		"{ext}", ext,
+		"{from}", codecFrom,
+		"{to}", codecTo,
+		"{index}", strconv.Itoa(index),
+	).Replace(template)
+}
+
+// planOutputPaths maps every file to its copy in -out-dir. Two files sharing an
+// output path, an output overwriting one of the inputs or an already existing
+// file are reported as collisions.
+func planOutputPaths(mp4files []string) (paths map[string]string, err error) {
+	if err = validateNameTemplate(nameTemplate); err != nil {
+		return nil, err
+	}
+
+	inputs := make(map[string]string, len(mp4files))
+	for _, mp4file := range mp4files {
+		var abs string
+		if abs, err = filepath.Abs(mp4file); err != nil {
+			return nil, fmt.Errorf(`[planOutputPaths] %w`, err)
+		}
+		inputs[abs] = mp4file
+	}
+
+	paths = make(map[string]string, len(mp4files))
+	owners := make(map[string]string, len(mp4files))
+	for i, mp4file := range mp4files {
+		var abs string
+		output := filepath.Join(outDir, expandNameTemplate(nameTemplate, mp4file, i+1))
+		if abs, err = filepath.Abs(output); err != nil {
+			return nil, fmt.Errorf(`[planOutputPaths] %w`, err)
+		}
+		if owner, ok := owners[abs]; ok {
+			return nil, fmt.Errorf(`[planOutputPaths] %s and %s would both be written to %s`, owner, mp4file, output)
+		}
+		if input, ok := inputs[abs]; ok {
+			return nil, fmt.Errorf(`[planOutputPaths] the copy of %s would overwrite input file %s`, mp4file, input)
+		}
+		if _, err = os.Lstat(output); err == nil {
+			return nil, fmt.Errorf(`[planOutputPaths] the copy of %s would overwrite existing file %s`, mp4file, output)
+		} else if !os.IsNotExist(err) {
+			return nil, fmt.Errorf(`[planOutputPaths] cannot stat "%s": %w`, output, err)
+		}
+		err = nil
+		owners[abs] = mp4file
+		paths[mp4file] = output
+	}
+	return
+}
+
+// renameWithSuffix renames a converted file, inserting -rename-on-change
+// before its extension, so movie.mp4 becomes movie.dv-fixed.mp4. If that name
+// is taken a counter is added rather than overwriting the other file, as in
+// movie.dv-fixed (1).mp4.
+func renameWithSuffix(mp4file string) (renamed string, err error) {
+	ext := filepath.Ext(mp4file)
+	base := strings.TrimSuffix(mp4file, ext)
+	for i := 0; ; i++ {
+		renamed = base + renameOnChange + ext
+		if i > 0 {
+			renamed = fmt.Sprintf("%s%s (%d)%s", base, renameOnChange, i, ext)
+		}
+		if _, err = os.Lstat(renamed); os.IsNotExist(err) {
+			break
+		} else if err != nil {
+			return "", fmt.Errorf(`[renameWithSuffix] cannot stat "%s": %w`, renamed, err)
+		}
+	}
+	if err = os.Rename(mp4file, renamed); err != nil {
+		return "", fmt.Errorf(`[renameWithSuffix] cannot rename "%s" to "%s": %w`, mp4file, renamed, err)
+	}
+	return renamed, nil
+}
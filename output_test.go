@@ -0,0 +1,100 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateNameTemplate(t *testing.T) {
+	for template, want := range map[string]string{
+		"{name}{ext}":        "",
+		"{name}_{to}.mp4":    "",
+		"{index}.mp4":        "",
+		"":                   "empty name template",
+		"movie.mp4":          "has no placeholder",
+		"dv/{name}{ext}":     "must not contain path separators",
+		"{name}{ext}}":       `unbalanced "}"`,
+		"{name{ext}":         "unknown placeholder {name{ext}",
+		"{name}.{container}": "unknown placeholder {container}",
+		"{name":              "unterminated placeholder",
+	} {
+		err := validateNameTemplate(template)
+		if want == "" && err != nil || want != "" && (err == nil || !strings.Contains(err.Error(), want)) {
+			t.Errorf("%q: got %v, want %q", template, err, want)
+		}
+	}
+}
+
+func TestPlanOutputPaths(t *testing.T) {
+	withCodecs(t, "dvhe", "dvh1")
+	t.Cleanup(func() { outDir, nameTemplate = "", "{name}{ext}" })
+	in := t.TempDir()
+	existing := t.TempDir()
+	if err := os.WriteFile(filepath.Join(existing, "taken.mp4"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, test := range map[string]struct {
+		outDir, template string
+		files            []string
+		want             []string // output paths, or the error message
+	}{
+		"placeholders":   {"out", "{name}_{to}.{index}{ext}", []string{"a/movie.mp4", "b/show.mov"}, []string{"out/movie_dvh1.1.mp4", "out/show_dvh1.2.mov"}},
+		"same basename":  {"out", "{name}{ext}", []string{"a/movie.mp4", "b/movie.mp4"}, []string{"a/movie.mp4 and b/movie.mp4 would both be written to out/movie.mp4"}},
+		"index":          {"out", "{name}.{index}{ext}", []string{"a/movie.mp4", "b/movie.mp4"}, []string{"out/movie.1.mp4", "out/movie.2.mp4"}},
+		"input":          {filepath.Join(in, "a"), "{name}{ext}", []string{filepath.Join(in, "a", "movie.mp4")}, []string{"would overwrite input file"}},
+		"existing":       {existing, "taken{ext}", []string{"movie.mp4"}, []string{"would overwrite existing file"}},
+		"no placeholder": {"out", "movie.mp4", []string{"movie.mp4"}, []string{"has no placeholder"}},
+		"separator":      {"out", "dv/{name}{ext}", []string{"movie.mp4"}, []string{"must not contain path separators"}},
+	} {
+		outDir, nameTemplate = test.outDir, test.template
+		paths, err := planOutputPaths(test.files)
+		if err != nil {
+			if len(test.want) != 1 || !strings.Contains(err.Error(), filepath.FromSlash(test.want[0])) {
+				t.Errorf("%s: got error %v, want %v", name, err, test.want)
+			}
+			continue
+		}
+		for i, file := range test.files {
+			if i >= len(test.want) || paths[file] != filepath.FromSlash(test.want[i]) {
+				t.Errorf("%s: got %v, want %v", name, paths, test.want)
+				break
+			}
+		}
+	}
+}
+
+func TestRenameWithSuffix(t *testing.T) {
+	t.Cleanup(func() { renameOnChange = "" })
+	renameOnChange = ".dv-fixed"
+	dir := t.TempDir()
+	mp4file := filepath.Join(dir, "movie.mp4")
+	for _, name := range []string{"movie.mp4", "movie.dv-fixed.mp4", "movie.dv-fixed (1).mp4"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	renamed, err := renameWithSuffix(mp4file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(dir, "movie.dv-fixed (2).mp4"); renamed != want {
+		t.Errorf("renamed to %s, want %s", renamed, want)
+	}
+	if data, err := os.ReadFile(renamed); err != nil || string(data) != "movie.mp4" {
+		t.Errorf("got %q and error %v, want the renamed file", data, err)
+	}
+	for _, name := range []string{"movie.dv-fixed.mp4", "movie.dv-fixed (1).mp4"} {
+		if data, err := os.ReadFile(filepath.Join(dir, name)); err != nil || string(data) != name {
+			t.Errorf("%s overwritten: %v", name, err)
+		}
+	}
+
+	// The file is gone, so renaming it fails.
+	if _, err := renameWithSuffix(mp4file); err == nil || !strings.Contains(err.Error(), "cannot rename") {
+		t.Errorf("got %v, want the rename error", err)
+	}
+}
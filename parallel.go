@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"sync"
+)
+
+// fileAt is a file that can be read and written at arbitrary offsets
+// concurrently, such as *os.File.
+type fileAt interface {
+	io.ReaderAt
+	io.WriterAt
+}
+
+// cursor is an io.ReadWriteSeeker with its own offset into a shared fileAt,
+// letting goroutines seek independently over the same file handle.
+type cursor struct {
+	f      fileAt
+	offset int64
+	size   int64
+}
+
+func (c *cursor) Read(p []byte) (n int, err error) {
+	n, err = c.f.ReadAt(p, c.offset)
+	c.offset += int64(n)
+	if n > 0 && errors.Is(err, io.EOF) {
+		err = nil
+	}
+	return
+}
+
+func (c *cursor) Write(p []byte) (n int, err error) {
+	n, err = c.f.WriteAt(p, c.offset)
+	c.offset += int64(n)
+	return
+}
+
+func (c *cursor) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += c.offset
+	case io.SeekEnd:
+		offset += c.size
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf(`[cursor] negative offset %d`, offset)
+	}
+	c.offset = offset
+	return offset, nil
+}
+
+// convertTraksParallel patches the traks of the moov box found at moov. The
+// trak headers are enumerated first, reading only, then every trak is
+// converted by its own goroutine using its own cursor. Traks never overlap, so
+// the writes of one goroutine are never seen by another.
+func convertTraksParallel(f fileAt, size int64, moov *Header) (err error) {
+	var traks []*Header
+
+	c := &cursor{f: f, offset: moov.Offset + int64(getHeaderSize(moov)), size: size}
+	err = forEachBox(c, moov.PayloadSize(), func(h *Header) error {
+		if h.Type == TrakBoxType {
+			traks = append(traks, h)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf(`[convertTraksParallel] failed enumerating moov children: %w`, err)
+	}
+
+	var (
+		wg   sync.WaitGroup
+		next = make(chan int)
+		errs = make([]error, len(traks))
+	)
+	for w := 0; w < runtime.GOMAXPROCS(0) && w < len(traks); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				c := &cursor{f: f, offset: traks[i].Offset + int64(getHeaderSize(traks[i])), size: size}
+				errs[i] = trakHandler(c, nil)(traks[i])
+			}
+		}()
+	}
+	for i := range traks {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			return fmt.Errorf(`[convertTraksParallel] failed processing trak at %d(%#x): %w`, traks[i].Offset, traks[i].Offset, err)
+		}
+	}
+	return nil
+}
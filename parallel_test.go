@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// multiTrackMovie builds a movie with traks tracks of entries sample entries
+// each, the first entry of every track being dvhe.
+func multiTrackMovie(traks, entries int) []byte {
+	moov := make([][]byte, 0, traks)
+	for i := 0; i < traks; i++ {
+		stsdEntries := [][]byte{visualSampleEntry("dvhe", 1920, 1080, hvcC(), box("dvcC", make([]byte, 24)))}
+		for j := 1; j < entries; j++ {
+			stsdEntries = append(stsdEntries, visualSampleEntry("avc1", 1920, 1080, box("avcC", make([]byte, 64))))
+		}
+		moov = append(moov, trak(stsdEntries...))
+	}
+	return movie(moov...)
+}
+
+func writeTempFile(tb testing.TB, data []byte) *os.File {
+	tb.Helper()
+	name := filepath.Join(tb.TempDir(), "movie.mp4")
+	if err := os.WriteFile(name, data, 0o644); err != nil {
+		tb.Fatal(err)
+	}
+	f, err := os.OpenFile(name, os.O_RDWR, 0)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { f.Close() })
+	return f
+}
+
+func TestConvertParallelBoxes(t *testing.T) {
+	withCodecs(t, "dvhe", "dvh1")
+	data := multiTrackMovie(32, 3)
+
+	sequential := &memFile{data: append([]byte{}, data...)}
+	if err := convert(sequential); err != nil {
+		t.Fatal(err)
+	}
+
+	parallelBoxes = true
+	t.Cleanup(func() { parallelBoxes = false })
+	f := writeTempFile(t, data)
+	if err := convert(f); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, sequential.data) {
+		t.Errorf("parallel conversion differs from sequential conversion at %v", diffOffsets(sequential.data, got))
+	}
+	if bytes.Contains(got, []byte("dvhe")) {
+		t.Errorf("dvhe entries left unconverted")
+	}
+}
+
+// BenchmarkConvertScan measures scanning a large moov without changing any
+// entry, as happens when converting already converted files.
+func BenchmarkConvertScan(b *testing.B) {
+	oldFrom, oldTo := codecFrom, codecTo
+	codecFrom, codecTo = "dvav", "dva1"
+	b.Cleanup(func() { codecFrom, codecTo, parallelBoxes = oldFrom, oldTo, false })
+
+	for _, traks := range []int{4, 64, 512} {
+		f := writeTempFile(b, multiTrackMovie(traks, 16))
+		for _, parallel := range []bool{false, true} {
+			b.Run(fmt.Sprintf("traks=%d/parallel=%v", traks, parallel), func(b *testing.B) {
+				parallelBoxes = parallel
+				for i := 0; i < b.N; i++ {
+					if err := convert(f); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// HvccBoxType is the HEVC decoder configuration of HEVC sample entries.
+var HvccBoxType = BoxType{'h', 'v', 'c', 'C'}
+
+// NAL unit types of the HEVC parameter sets.
+const (
+	hevcNalVPS = 32
+	hevcNalSPS = 33
+	hevcNalPPS = 34
+)
+
+// errInBandParameterSets is returned when converting a sample entry to a codec
+// requiring out-of-band parameter sets that its hvcC does not hold.
+var errInBandParameterSets = errors.New("parameter sets are only in-band")
+
+// outOfBandCodecs maps the HEVC codecs whose parameter sets may be in-band only
+// to those requiring them in hvcC.
+var outOfBandCodecs = map[string]map[string]bool{
+	CodecHEV1: {CodecHVC1: true, CodecDVH1: true},
+	CodecDVHE: {CodecHVC1: true, CodecDVH1: true},
+}
+
+// needsParameterSets reports whether renaming sample entries of codec from to
+// codec to requires the parameter sets to be in hvcC.
+func needsParameterSets(from, to string) bool {
+	return outOfBandCodecs[from][to]
+}
+
+// readHevcParameterSets counts the NAL units of every type in the arrays of a
+// hvcC payload of payloadSize bytes. The reader must be positioned right after
+// the box header.
+func readHevcParameterSets(r io.Reader, payloadSize int64) (counts map[uint8]int, err error) {
+	var (
+		header    [22]byte
+		numArrays uint8
+	)
+	r = io.LimitReader(r, payloadSize)
+	if _, err = io.ReadFull(r, header[:]); err != nil {
+		return nil, fmt.Errorf(`[readHevcParameterSets] failed reading configuration record: %w`, err)
+	}
+	if err = binary.Read(r, binary.BigEndian, &numArrays); err != nil {
+		return nil, fmt.Errorf(`[readHevcParameterSets] failed reading number of arrays: %w`, err)
+	}
+	counts = make(map[uint8]int)
+	for i := uint8(0); i < numArrays; i++ {
+		var array struct {
+			// array_completeness(1) reserved(1) NAL_unit_type(6)
+			Type     uint8
+			NumNalus uint16
+		}
+		if err = binary.Read(r, binary.BigEndian, &array); err != nil {
+			return nil, fmt.Errorf(`[readHevcParameterSets] failed reading array %d: %w`, i+1, err)
+		}
+		for j := uint16(0); j < array.NumNalus; j++ {
+			var length uint16
+			if err = binary.Read(r, binary.BigEndian, &length); err != nil {
+				return nil, fmt.Errorf(`[readHevcParameterSets] failed reading NAL unit length in array %d: %w`, i+1, err)
+			}
+			if _, err = io.CopyN(io.Discard, r, int64(length)); err != nil {
+				if errors.Is(err, io.EOF) {
+					err = io.ErrUnexpectedEOF
+				}
+				return nil, fmt.Errorf(`[readHevcParameterSets] failed reading NAL unit in array %d: %w`, i+1, err)
+			}
+			counts[array.Type&0x3f]++
+		}
+	}
+	return counts, nil
+}
+
+// checkParameterSets returns errInBandParameterSets unless the sample entry h
+// has a hvcC holding the VPS, SPS and PPS, without which it cannot be renamed
+// to a codec requiring them out-of-band. rs is left positioned at the payload
+// of the entry.
+func checkParameterSets(rs io.ReadSeeker, h *Header) (err error) {
+	payloadOffset := h.Offset + h.HeaderLength()
+	defer func() {
+		if _, seekErr := rs.Seek(payloadOffset, io.SeekStart); seekErr != nil && err == nil {
+			err = fmt.Errorf(`[checkParameterSets] failed to seek back: %w`, seekErr)
+		}
+	}()
+
+	childrenSize := h.PayloadSize() - visualSampleEntryFieldsSize
+	if childrenSize < 8 {
+		return fmt.Errorf(`[checkParameterSets] sample entry %s at %d(%#x) has no hvcC: %w`, h.Type, h.Offset, h.Offset, errInBandParameterSets)
+	}
+	if _, err = rs.Seek(payloadOffset+visualSampleEntryFieldsSize, io.SeekStart); err != nil {
+		return fmt.Errorf(`[checkParameterSets] failed to seek: %w`, err)
+	}
+	hvcc, _, err := FindBoxPayload(rs, HvccBoxType, childrenSize)
+	if err != nil {
+		return fmt.Errorf(`[checkParameterSets] sample entry %s at %d(%#x) has no hvcC: %w`, h.Type, h.Offset, h.Offset, errInBandParameterSets)
+	}
+	counts, err := readHevcParameterSets(rs, hvcc.PayloadSize())
+	if err != nil {
+		return fmt.Errorf(`[checkParameterSets] %w`, err)
+	}
+	var missing []string
+	for _, nal := range []struct {
+		name string
+		typ  uint8
+	}{{"VPS", hevcNalVPS}, {"SPS", hevcNalSPS}, {"PPS", hevcNalPPS}} {
+		if counts[nal.typ] == 0 {
+			missing = append(missing, nal.name)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf(`[checkParameterSets] hvcC of sample entry %s at %d(%#x) has no %v: %w`, h.Type, h.Offset, h.Offset, missing, errInBandParameterSets)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestReadHevcParameterSets(t *testing.T) {
+	record := hvcC()[8:]
+	counts, err := readHevcParameterSets(bytes.NewReader(record), int64(len(record)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(counts); got != "map[32:1 33:1 34:1]" {
+		t.Errorf("got NAL unit counts %s", got)
+	}
+
+	// the limit ends the record within the PPS
+	if _, err = readHevcParameterSets(bytes.NewReader(record), int64(len(record)-1)); err == nil {
+		t.Error("expected an error for a truncated record")
+	}
+}
+
+func TestConvertParameterSetsGuard(t *testing.T) {
+	withCodecs(t, "hev1", "hvc1")
+	t.Cleanup(func() { force = false })
+
+	spsOnly := box("hvcC", make([]byte, 22), []byte{2, 0x80 | hevcNalSPS}, u16(1), u16(2), []byte{0x42, 1}, []byte{0x80 | hevcNalPPS}, u16(0))
+	for _, test := range []struct {
+		name    string
+		entry   []byte
+		force   bool
+		wantErr bool
+	}{
+		{"parameter sets in hvcC", visualSampleEntry("hev1", 1920, 1080, hvcC()), false, false},
+		{"no hvcC", visualSampleEntry("hev1", 1920, 1080, box("colr", []byte("nclx"), make([]byte, 7))), false, true},
+		{"no children", visualSampleEntry("hev1", 1920, 1080), false, true},
+		{"empty arrays", visualSampleEntry("hev1", 1920, 1080, box("hvcC", make([]byte, 23))), false, true},
+		{"no VPS", visualSampleEntry("hev1", 1920, 1080, spsOnly), false, true},
+		{"no hvcC with -force", visualSampleEntry("hev1", 1920, 1080), true, false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			force = test.force
+			data := movie(trak(test.entry))
+			f := &memFile{data: append([]byte{}, data...)}
+			err := convert(f)
+			if test.wantErr {
+				if !errors.Is(err, errInBandParameterSets) {
+					t.Errorf("got %v, want %v", err, errInBandParameterSets)
+				}
+				if !bytes.Equal(f.data, data) {
+					t.Errorf("file changed at %v", diffOffsets(data, f.data))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if at := bytes.Index(f.data, []byte("hvc1")); at < 0 {
+				t.Error("sample entry not converted")
+			}
+		})
+	}
+
+	withCodecs(t, "hev1", "dvav")
+	f := &memFile{data: movie(trak(visualSampleEntry("hev1", 1920, 1080)))}
+	if err := convert(f); err != nil {
+		t.Errorf("got %v converting to a codec allowing in-band parameter sets", err)
+	}
+}
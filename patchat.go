@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// patchFourCCAt replaces the -from FourCC found at offset with -to, without
+// walking the box structure. The bytes at offset are checked first so a stale
+// offset never corrupts an unrelated part of the file.
+func patchFourCCAt(rw io.ReadWriteSeeker, offset int64) (err error) {
+	current := make([]byte, 4)
+
+	if _, err = rw.Seek(offset, io.SeekStart); err != nil {
+		return fmt.Errorf(`[patchFourCCAt] failed to seek: %w`, err)
+	}
+	if _, err = io.ReadFull(rw, current); err != nil {
+		return fmt.Errorf(`[patchFourCCAt] failed reading FourCC at %d(%#x): %w`, offset, offset, err)
+	}
+	if !matchesFrom(string(current)) {
+		return fmt.Errorf(`[patchFourCCAt] expected "%s" at %d(%#x) but found %q, refusing to patch`, codecFrom, offset, offset, current)
+	}
+
+	if hexPreview {
+		if err = printHexPreview(rw, "before", offset); err != nil {
+			return fmt.Errorf(`[patchFourCCAt] %w`, err)
+		}
+	}
+	if _, err = rw.Seek(offset, io.SeekStart); err != nil {
+		return fmt.Errorf(`[patchFourCCAt] failed to seek: %w`, err)
+	}
+	if _, err = rw.Write([]byte(codecTo)); err != nil {
+		return fmt.Errorf(`[patchFourCCAt] failed to write "%s": %w`, codecTo, err)
+	}
+	if err = readBackFourCC(rw, offset, codecTo); err != nil {
+		return fmt.Errorf(`[patchFourCCAt] %w`, err)
+	}
+	fmt.Printf("Changed codec from %s to %v at %d(%#x)%s\n", current, codecTo, offset, offset, lenientNote(string(current)))
+	recordChange("sample entry", offset, string(current), codecTo)
+	if hexPreview {
+		if err = printHexPreview(rw, "after", offset); err != nil {
+			return fmt.Errorf(`[patchFourCCAt] %w`, err)
+		}
+	}
+	return
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// prefixScanSize is how far into a file a box is looked for when it does not
+// start with one, as after bytes prepended by a bad download.
+const prefixScanSize = 4096
+
+// errPrefixedFile is returned for files whose boxes start after a prefix of
+// other bytes, which players do not skip.
+var errPrefixedFile = errors.New("file does not start with a box")
+
+// topLevelBoxTypes are the boxes MP4 files start with. Finding one later in a
+// file tells where its boxes start.
+var topLevelBoxTypes = map[string]bool{
+	"ftyp": true, "styp": true, "moov": true, "mdat": true, "free": true, "skip": true,
+	"wide": true, "pdin": true, "sidx": true, "moof": true,
+}
+
+// FilePrefix describes the bytes found before the first box of a file.
+type FilePrefix struct {
+	Size int64
+
+	// Kind tells what the prefix looks like, such as a UTF-8 byte order
+	// mark or HTTP response headers
+	Kind string
+}
+
+func (p *FilePrefix) String() string {
+	return fmt.Sprintf("%d-byte %s prefix", p.Size, p.Kind)
+}
+
+// startsWithBox reports whether b starts with the header of a top level box.
+func startsWithBox(b []byte) bool {
+	if len(b) < 8 || !topLevelBoxTypes[string(b[4:8])] {
+		return false
+	}
+	size := binary.BigEndian.Uint32(b)
+	return size == 0 || size == 1 || size >= 8
+}
+
+// detectPrefix returns the prefix of the file starting with head, nil if head
+// starts with a box or if no box is found in it at all.
+func detectPrefix(head []byte) *FilePrefix {
+	if startsWithBox(head) {
+		return nil
+	}
+	for i := 1; i+8 <= len(head); i++ {
+		if !startsWithBox(head[i:]) {
+			continue
+		}
+		p := &FilePrefix{Size: int64(i), Kind: "garbage"}
+		switch prefix := head[:i]; {
+		case bytes.Equal(prefix, []byte{0xef, 0xbb, 0xbf}):
+			p.Kind = "UTF-8 byte order mark"
+		case bytes.Equal(prefix, []byte{0xfe, 0xff}) || bytes.Equal(prefix, []byte{0xff, 0xfe}):
+			p.Kind = "UTF-16 byte order mark"
+		case bytes.HasPrefix(prefix, []byte("HTTP/")):
+			p.Kind = "HTTP response header"
+		case isText(prefix):
+			p.Kind = "text"
+		}
+		return p
+	}
+	return nil
+}
+
+// isText reports whether b only holds printable ASCII and white space.
+func isText(b []byte) bool {
+	for _, c := range b {
+		if (c < 0x20 || c > 0x7e) && c != '\t' && c != '\n' && c != '\r' {
+			return false
+		}
+	}
+	return true
+}
+
+// prefixError returns the error telling to strip prefix p, found after the
+// -strip-prefix bytes if any.
+func prefixError(p *FilePrefix) error {
+	return fmt.Errorf(`file has a %s; strip it first with -strip-prefix %d: %w`, p, stripPrefix+p.Size, errPrefixedFile)
+}
+
+// checkPrefix fails if r, read from its start, has a prefix before its first
+// box. Only the first box header is read from files starting with a box. r is
+// left at its start.
+func checkPrefix(r io.ReadSeeker) (err error) {
+	head := make([]byte, prefixScanSize)
+	if _, err = r.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf(`[checkPrefix] failed to seek: %w`, err)
+	}
+	n, err := io.ReadFull(r, head[:8])
+	if err == nil && !startsWithBox(head) {
+		var more int
+		more, err = io.ReadFull(r, head[8:])
+		n += more
+	}
+	if err != nil && !isEndOfFile(err) {
+		return fmt.Errorf(`[checkPrefix] failed reading file start: %w`, err)
+	}
+	if _, err = r.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf(`[checkPrefix] failed to seek: %w`, err)
+	}
+	if p := detectPrefix(head[:n]); p != nil {
+		return fmt.Errorf(`[checkPrefix] %w`, prefixError(p))
+	}
+	return nil
+}
+
+// stripPrefixReader returns the part of f, a file of size bytes, after the
+// -strip-prefix bytes, provided a box starts there.
+func stripPrefixReader(f *os.File, size int64) (*io.SectionReader, error) {
+	if stripPrefix > size {
+		return nil, fmt.Errorf(`[stripPrefixReader] -strip-prefix %d exceeds the %d bytes of "%s"`, stripPrefix, size, f.Name())
+	}
+	head := make([]byte, min(size, max(prefixScanSize, stripPrefix+8)))
+	if _, err := f.ReadAt(head, 0); err != nil && !isEndOfFile(err) {
+		return nil, fmt.Errorf(`[stripPrefixReader] failed reading "%s": %w`, f.Name(), err)
+	}
+	if !startsWithBox(head[stripPrefix:]) {
+		if p := detectPrefix(head); p != nil {
+			return nil, fmt.Errorf(`[stripPrefixReader] no box starts after the %d bytes of -strip-prefix in "%s", which has a %s: %w`, stripPrefix, f.Name(), p, errPrefixedFile)
+		}
+		return nil, fmt.Errorf(`[stripPrefixReader] no box starts after the %d bytes of -strip-prefix in "%s": %w`, stripPrefix, f.Name(), errPrefixedFile)
+	}
+	return io.NewSectionReader(f, stripPrefix, size-stripPrefix), nil
+}
+
+// skipPrefix returns r, opened for inspecting mp4file, read from after the
+// -strip-prefix bytes, failing if it has a prefix before its first box from
+// there. Closing the returned reader closes r.
+func skipPrefix(r io.ReadSeekCloser, mp4file string) (io.ReadSeekCloser, error) {
+	if stripPrefix > 0 {
+		size, err := r.Seek(0, io.SeekEnd)
+		if err != nil {
+			return nil, fmt.Errorf(`[skipPrefix] failed to seek: %w`, err)
+		}
+		if size < stripPrefix {
+			return nil, fmt.Errorf(`[skipPrefix] -strip-prefix %d exceeds the %d bytes of "%s"`, stripPrefix, size, mp4file)
+		}
+		r = struct {
+			io.ReadSeeker
+			io.Closer
+		}{io.NewSectionReader(r.(io.ReaderAt), stripPrefix, size-stripPrefix), r}
+	}
+	if err := checkPrefix(r); err != nil {
+		return nil, fmt.Errorf(`[skipPrefix] "%s": %w`, mp4file, err)
+	}
+	return r, nil
+}
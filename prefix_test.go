@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDetectPrefix(t *testing.T) {
+	file := movie(trak(visualSampleEntry("dvhe", 1920, 1080)))
+	for name, test := range map[string]struct {
+		prefix string
+		want   *FilePrefix
+	}{
+		"none":         {"", nil},
+		"UTF-8 BOM":    {"\xef\xbb\xbf", &FilePrefix{3, "UTF-8 byte order mark"}},
+		"UTF-16 BOM":   {"\xff\xfe", &FilePrefix{2, "UTF-16 byte order mark"}},
+		"HTTP headers": {"HTTP/1.1 200 OK\r\nContent-Type: video/mp4\r\n\r\n", &FilePrefix{44, "HTTP response header"}},
+		"text":         {"<html>\n", &FilePrefix{7, "text"}},
+		"garbage":      {"\x00\x01\x02\x9f", &FilePrefix{4, "garbage"}},
+	} {
+		got := detectPrefix(append([]byte(test.prefix), file...))
+		if (got == nil) != (test.want == nil) || got != nil && *got != *test.want {
+			t.Errorf("%s: got %v, want %v", name, got, test.want)
+		}
+	}
+
+	// Files whose boxes are not found at all are left to parsing.
+	if got := detectPrefix(bytes.Repeat([]byte{0xff}, 64)); got != nil {
+		t.Errorf("no box: got %v", got)
+	}
+}
+
+func TestConvertPrefixedFile(t *testing.T) {
+	withCodecs(t, "dvhe", "dvh1")
+	data := movie(trak(visualSampleEntry("dvhe", 1920, 1080, hvcC(), box("dvcC", make([]byte, 24)))))
+	err := convert(&memFile{data: append([]byte("\xef\xbb\xbf"), data...)})
+	if !errors.Is(err, errPrefixedFile) || !strings.Contains(err.Error(), "3-byte UTF-8 byte order mark prefix; strip it first with -strip-prefix 3") {
+		t.Fatalf("got %v, want the prefix diagnostic", err)
+	}
+}
+
+func TestStripPrefix(t *testing.T) {
+	withCodecs(t, "dvhe", "dvh1")
+	stripPrefix = 3
+	t.Cleanup(func() { stripPrefix = 0 })
+
+	data := movie(trak(visualSampleEntry("dvhe", 1920, 1080, hvcC(), box("dvcC", make([]byte, 24)))))
+	want := &memFile{data: append([]byte{}, data...)}
+	if err := convert(want); err != nil {
+		t.Fatal(err)
+	}
+	prefixed := append([]byte("\xef\xbb\xbf"), data...)
+
+	mp4file := filepath.Join(t.TempDir(), "movie.mp4")
+	if err := os.WriteFile(mp4file, prefixed, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := processFile(mp4file); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(mp4file); !bytes.Equal(got, want.data) {
+		t.Error("converted file differs from the file converted without its prefix")
+	}
+
+	var out bytes.Buffer
+	if err := streamConvert(&out, onlyReader{bytes.NewReader(prefixed)}); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out.Bytes(), want.data) {
+		t.Error("streamed output differs from the file converted without its prefix")
+	}
+
+	// Stripping the wrong number of bytes tells the size of the prefix.
+	for _, n := range []int64{1, 4} {
+		stripPrefix = n
+		if err := os.WriteFile(mp4file, prefixed, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := processFile(mp4file); !errors.Is(err, errPrefixedFile) || !strings.Contains(err.Error(), "which has a 3-byte UTF-8 byte order mark prefix") {
+			t.Errorf("-strip-prefix %d: got %v, want the prefix size", n, err)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/pprof"
+)
+
+// hiddenFlags are left out of the usage, as they are only meant for
+// investigating performance.
+var hiddenFlags = map[string]bool{"cpuprofile": true, "memprofile": true}
+
+// startProfiling starts writing a CPU profile to -cpuprofile if set. The
+// returned function stops it and writes a heap profile to -memprofile if set;
+// it must be called before exiting, as deferred calls do not run on os.Exit.
+func startProfiling() (stop func(), err error) {
+	var cpu *os.File
+	if cpuProfile != "" {
+		if cpu, err = os.Create(cpuProfile); err != nil {
+			return nil, fmt.Errorf(`[startProfiling] cannot create CPU profile "%s": %w`, cpuProfile, err)
+		}
+		if err = pprof.StartCPUProfile(cpu); err != nil {
+			cpu.Close()
+			return nil, fmt.Errorf(`[startProfiling] cannot start CPU profile: %w`, err)
+		}
+	}
+	return func() {
+		if cpu != nil {
+			pprof.StopCPUProfile()
+			if err := cpu.Close(); err != nil {
+				fmt.Fprintf(os.Stderr, "[startProfiling] cannot close CPU profile %q: %v\n", cpuProfile, err)
+			}
+		}
+		if memProfile != "" {
+			if err := writeHeapProfile(memProfile); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+			}
+		}
+	}, nil
+}
+
+// writeHeapProfile writes a profile of the memory still in use to path.
+func writeHeapProfile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf(`[writeHeapProfile] cannot create memory profile "%s": %w`, path, err)
+	}
+	defer f.Close()
+	runtime.GC()
+	if err = pprof.WriteHeapProfile(f); err != nil {
+		return fmt.Errorf(`[writeHeapProfile] cannot write memory profile "%s": %w`, path, err)
+	}
+	return f.Close()
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+var (
+	PsshBoxType = BoxType{'p', 's', 's', 'h'}
+	SchmBoxType = BoxType{'s', 'c', 'h', 'm'}
+)
+
+// protectionSystems names the DRM systems of well-known pssh system IDs.
+var protectionSystems = map[string]string{
+	"edef8ba9-79d6-4ace-a3c8-27dcd51d21ed": "Widevine",
+	"9a04f079-9840-4286-ab92-e65be0885f95": "PlayReady",
+	"94ce86fb-07ff-4f43-adb8-93d2fa968ca2": "FairPlay",
+	"1077efec-c0b2-4d02-ace3-3c1e52e2fb4b": "W3C Common",
+	"e2719d58-a985-b3c9-781a-b030af78d30e": "ClearKey",
+	"5e629af5-38da-4063-8977-97ffbd9902d4": "Marlin",
+}
+
+// PsshBox is a protection system specific header box, carrying the data a DRM
+// system needs to acquire the keys of the file.
+type PsshBox struct {
+	Version  uint8
+	SystemID [16]byte
+}
+
+// SystemIDString formats the system ID as a UUID.
+func (b *PsshBox) SystemIDString() string {
+	id := b.SystemID
+	return fmt.Sprintf("%x-%x-%x-%x-%x", id[0:4], id[4:6], id[6:8], id[8:10], id[10:16])
+}
+
+// readPsshBox parses the fields of a pssh box we report on. The reader must be
+// positioned right after the box header.
+func readPsshBox(r io.Reader) (*PsshBox, error) {
+	var (
+		box PsshBox
+		err error
+	)
+	if box.Version, _, err = readFullBoxHeader(r); err != nil {
+		return nil, fmt.Errorf(`[readPsshBox] failed reading version: %w`, err)
+	}
+	if err = binary.Read(r, binary.BigEndian, &box.SystemID); err != nil {
+		return nil, fmt.Errorf(`[readPsshBox] failed reading system ID: %w`, err)
+	}
+	return &box, nil
+}
+
+// SchmBox is a scheme type box, naming the protection scheme of a protected
+// sample entry, such as cenc or cbcs for Common Encryption.
+type SchmBox struct {
+	SchemeType    BoxType
+	SchemeVersion uint32
+}
+
+// readSchmBox parses a schm box. The reader must be positioned right after the
+// box header.
+func readSchmBox(r io.Reader) (*SchmBox, error) {
+	var box SchmBox
+	if _, _, err := readFullBoxHeader(r); err != nil {
+		return nil, fmt.Errorf(`[readSchmBox] failed reading version: %w`, err)
+	}
+	if err := binary.Read(r, binary.BigEndian, &box); err != nil {
+		return nil, fmt.Errorf(`[readSchmBox] failed reading scheme: %w`, err)
+	}
+	return &box, nil
+}
+
+// ProtectionInfo tells whether and how a file is protected with Common
+// Encryption. Renaming the sample entries of protected files does not help
+// players that cannot decrypt them and breaks them for those that can.
+type ProtectionInfo struct {
+	// Schemes are the protection schemes of the sample entries, such as cenc
+	Schemes []string `json:"schemes,omitempty"`
+
+	// Systems are the IDs of the DRM systems with a pssh box
+	Systems []string `json:"systems,omitempty"`
+}
+
+// addScheme records a protection scheme, once.
+func (p *ProtectionInfo) addScheme(scheme string) {
+	for _, s := range p.Schemes {
+		if s == scheme {
+			return
+		}
+	}
+	p.Schemes = append(p.Schemes, scheme)
+}
+
+// addSystem records a DRM system ID, once.
+func (p *ProtectionInfo) addSystem(id string) {
+	for _, s := range p.Systems {
+		if s == id {
+			return
+		}
+	}
+	p.Systems = append(p.Systems, id)
+}
+
+// printProtection prints the protection of a file, if any.
+func printProtection(p *ProtectionInfo) {
+	if p == nil {
+		return
+	}
+	fmt.Printf("  protection: CENC-protected")
+	if len(p.Schemes) > 0 {
+		fmt.Printf(", schemes %v", p.Schemes)
+	}
+	if len(p.Systems) > 0 {
+		names := make([]string, len(p.Systems))
+		for i, id := range p.Systems {
+			if names[i] = protectionSystems[id]; names[i] == "" {
+				names[i] = id
+			}
+		}
+		fmt.Printf(", DRM systems %v", names)
+	}
+	fmt.Println()
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// protectedMovie builds a movie with a cenc encrypted dvhe track and pssh
+// boxes of the given system IDs.
+func protectedMovie(systemIDs ...string) []byte {
+	sinf := box("sinf", box("frma", []byte("dvhe")), fullBox("schm", 0, 0, []byte("cenc"), u32(0x10000)), box("schi", fullBox("tenc", 0, 0, make([]byte, 20))))
+	moov := [][]byte{trak(visualSampleEntry("encv", 3840, 2160, box("dvcC", make([]byte, 24)), sinf))}
+	for _, id := range systemIDs {
+		systemID, _ := hex.DecodeString(id)
+		moov = append(moov, fullBox("pssh", 0, 0, systemID, u32(0)))
+	}
+	return movie(moov...)
+}
+
+func TestInspectProtection(t *testing.T) {
+	data := protectedMovie("edef8ba979d64acea3c827dcd51d21ed", "00112233445566778899aabbccddeeff")
+	info, err := inspect(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.Protected || info.Protection == nil {
+		t.Fatalf("got %+v, want protected", info)
+	}
+	if got := fmt.Sprint(info.Protection.Schemes, info.Protection.Systems); got != "[cenc] [edef8ba9-79d6-4ace-a3c8-27dcd51d21ed 00112233-4455-6677-8899-aabbccddeeff]" {
+		t.Errorf("got protection %s", got)
+	}
+	if entry := info.Tracks[0].SampleEntries[0]; entry.OriginalFormat != "dvhe" || entry.ProtectionScheme != "cenc" || fmt.Sprint(entry.Boxes) != "[dvcC sinf]" {
+		t.Errorf("got sample entry %+v", entry)
+	}
+
+	parallel, err := inspectAt(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := json.Marshal(info)
+	if got, _ := json.Marshal(parallel); !bytes.Equal(got, want) {
+		t.Errorf("inspectAt got %s, want %s", got, want)
+	}
+
+	clear, err := inspect(bytes.NewReader(movie(trak(visualSampleEntry("dvhe", 3840, 2160)))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if clear.Protected || clear.Protection != nil {
+		t.Errorf("got %+v, want unprotected", clear)
+	}
+}
+
+func TestConvertPatchFrma(t *testing.T) {
+	withCodecs(t, "dvhe", "dvh1")
+	t.Cleanup(func() { patchFrma = false })
+	data := protectedMovie()
+	frma := bytes.Index(data, []byte("frma")) + 4
+
+	f := &memFile{data: append([]byte{}, data...)}
+	printed := captureStdout(t, func() {
+		if err := convert(f); err != nil {
+			t.Fatal(err)
+		}
+	})
+	takeChanges()
+	if !bytes.Equal(f.data, data) {
+		t.Error("file changed without -patch-frma")
+	}
+	if !strings.Contains(printed, "Warning: skipping encrypted sample entry encv with original format dvhe") {
+		t.Errorf("printed %q, want the -patch-frma warning", printed)
+	}
+
+	patchFrma = true
+	f = &memFile{data: append([]byte{}, data...)}
+	if err := convert(f); err != nil {
+		t.Fatal(err)
+	}
+	if changes := takeChanges(); fmt.Sprint(changes) != fmt.Sprintf("[{original format %d dvhe dvh1}]", frma) {
+		t.Errorf("got changes %v", changes)
+	}
+	want := append([]byte{}, data...)
+	copy(want[frma:], "dvh1")
+	if !bytes.Equal(f.data, want) {
+		t.Error("got changes other than the 4 bytes of the original format")
+	}
+}
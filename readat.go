@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"sync"
+)
+
+// readBoxHeaderAt reads the header of the box at offset. Unlike readBoxHeader
+// it keeps no cursor, so goroutines may read headers of the same file
+// concurrently.
+func readBoxHeaderAt(r io.ReaderAt, offset int64) (*Header, error) {
+	var buf [16]byte
+	if _, err := r.ReadAt(buf[:8], offset); err != nil {
+		return nil, err
+	}
+	h := &Header{Offset: offset, Size: binary.BigEndian.Uint32(buf[:4])}
+	copy(h.Type[:], buf[4:8])
+	if h.Size == 1 {
+		if _, err := r.ReadAt(buf[8:], offset+8); err != nil {
+			if errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		h.ExtendedSize = binary.BigEndian.Uint64(buf[8:])
+	}
+	return h, nil
+}
+
+// forEachBoxAt calls fn with the header of every sibling box starting at
+// offset, within limit bytes or up to the end of r if limit is negative. It
+// is the io.ReaderAt counterpart of forEachBox for read-only traversals, and
+// like Boxes it ends without an error at the end of r when limit is negative.
+func forEachBoxAt(r io.ReaderAt, offset, limit int64, fn func(h *Header) error) error {
+	for start := offset; limit < 0 || offset < start+limit; {
+		h, err := readBoxHeaderAt(r, offset)
+		if err != nil {
+			if limit < 0 && errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf(`[forEachBoxAt] failed reading box header at %d(%#x): %w`, offset, offset, err)
+		}
+
+		// Without a limit a box of size 0 extends to the end of the file and
+		// is the last one, anywhere else it would never advance.
+		last := h.Size == 0 && limit < 0
+		if !last && (h.PayloadSize() < 0 || !validBoxSize(h)) {
+			return fmt.Errorf(`[forEachBoxAt] invalid size %d for box "%s" at %d(%#x)`, getBoxSize(h), h.Type, offset, offset)
+		}
+		if err = fn(h); err != nil {
+			return fmt.Errorf(`[forEachBoxAt] callback failed: %w`, err)
+		}
+		if last {
+			return nil
+		}
+		offset += int64(getBoxSize(h))
+	}
+	return nil
+}
+
+// inspectAt is like inspect, but inspects the traks concurrently from a
+// single file handle of size bytes. Everything but the traks is walked first,
+// leaving a placeholder for every trak; then every trak is walked by its own
+// goroutine with its own cursor over r, filling in its placeholder.
+func inspectAt(r io.ReaderAt, size int64) (info *FileInfo, err error) {
+	var traks []*Header
+
+	err = forEachBoxAt(r, 0, -1, func(moov *Header) error {
+		if moov.Type != MoovBoxType {
+			return nil
+		}
+		limit := moov.PayloadSize()
+		if moov.Size == 0 {
+			limit = size - moov.Offset - moov.HeaderLength()
+		}
+		return forEachBoxAt(r, moov.Offset+moov.HeaderLength(), limit, func(h *Header) error {
+			if h.Type == TrakBoxType {
+				traks = append(traks, h)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf(`[inspectAt] failed enumerating traks: %w`, err)
+	}
+
+	info = &FileInfo{MoovOffset: -1, Tracks: []TrackInfo{}}
+	sr := io.NewSectionReader(r, 0, size)
+	opts := WalkOptions{NoDescend: append([]BoxType{TrakBoxType}, DefaultWalkOptions.NoDescend...)}
+	if err = WalkWithOptions(sr, &infoVisitor{r: sr, info: info}, opts); err != nil {
+		return nil, fmt.Errorf(`[inspectAt] failed walking boxes: %w`, err)
+	}
+	if len(info.Tracks) != len(traks) {
+		return nil, fmt.Errorf(`[inspectAt] found %d traks but walked %d`, len(traks), len(info.Tracks))
+	}
+
+	var (
+		wg   sync.WaitGroup
+		next = make(chan int)
+		errs = make([]error, len(traks))
+
+		// protected sample entries found in every trak
+		protections = make([]*ProtectionInfo, len(traks))
+	)
+	for w := 0; w < runtime.GOMAXPROCS(0) && w < len(traks); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				sr := io.NewSectionReader(r, 0, size)
+				track := &FileInfo{MoovOffset: -1, Tracks: []TrackInfo{}}
+				walker := &walker{r: sr, visitor: &infoVisitor{r: sr, info: track}, opts: DefaultWalkOptions}
+				if errs[i] = walker.walkBoxes([]BoxType{MoovBoxType}, traks[i].Offset, int64(getBoxSize(traks[i]))); errs[i] == nil {
+					info.Tracks[i], protections[i] = track.Tracks[0], track.Protection
+				}
+			}
+		}()
+	}
+	for i := range traks {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf(`[inspectAt] failed walking trak at %d(%#x): %w`, traks[i].Offset, traks[i].Offset, err)
+		}
+		if p := protections[i]; p != nil {
+			merged := info.protect()
+			for _, scheme := range p.Schemes {
+				merged.addScheme(scheme)
+			}
+		}
+	}
+	return info, nil
+}
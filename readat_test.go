@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+func TestForEachBoxAt(t *testing.T) {
+	data := append(movie(trak(visualSampleEntry("dvhe", 1920, 1080))), largeBox(box("free", make([]byte, 4)))...)
+
+	var types []string
+	err := forEachBoxAt(bytes.NewReader(data), 0, -1, func(h *Header) error {
+		types = append(types, fmt.Sprintf("%s %d", h.Type, getBoxSize(h)))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(types); got != "[ftyp 24 moov 142 mdat 24 free 20]" {
+		t.Errorf("got boxes %s", got)
+	}
+
+	if err = forEachBoxAt(bytes.NewReader(data[:len(data)-2]), 0, -1, func(*Header) error { return nil }); err != nil {
+		t.Errorf("got %v for a truncated last box, want nil as its header is complete", err)
+	}
+	if err = forEachBoxAt(bytes.NewReader(data[:len(data)-10]), 0, -1, func(*Header) error { return nil }); err == nil {
+		t.Error("expected an error for a truncated 64-bit header")
+	}
+
+	types = nil
+	err = forEachBoxAt(bytes.NewReader(data), 24, 142, func(h *Header) error {
+		types = append(types, h.Type.String())
+		return nil
+	})
+	if err != nil || fmt.Sprint(types) != "[moov]" {
+		t.Errorf("got boxes %v, %v within the limit", types, err)
+	}
+}
+
+func TestInspectAt(t *testing.T) {
+	for name, data := range map[string][]byte{
+		"many traks":         multiTrackMovie(24, 3),
+		"smooth streaming":   smoothStreamingMovie(),
+		"hdr":                movie(trak(visualSampleEntry("dvhe", 3840, 2160, append([][]byte{box("hvcC", make([]byte, 23))}, hdr10Boxes()...)...))),
+		"no traks":           movie(),
+		"size 0 moov at end": append(box("ftyp", []byte("isom"), u32(0)), 0, 0, 0, 0, 'm', 'o', 'o', 'v'),
+	} {
+		t.Run(name, func(t *testing.T) {
+			want, err := inspect(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := inspectAt(bytes.NewReader(data), int64(len(data)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			wantJSON, _ := json.Marshal(want)
+			gotJSON, _ := json.Marshal(got)
+			if !bytes.Equal(gotJSON, wantJSON) {
+				t.Errorf("got %s, want %s", gotJSON, wantJSON)
+			}
+		})
+	}
+}
+
+// BenchmarkInspectTraks compares inspecting many-track files through a single
+// seek cursor with inspecting their traks concurrently through io.ReaderAt.
+func BenchmarkInspectTraks(b *testing.B) {
+	for _, traks := range []int{4, 64, 512} {
+		f := writeTempFile(b, multiTrackMovie(traks, 16))
+		stat, err := f.Stat()
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Run(fmt.Sprintf("traks=%d/seek", traks), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := f.Seek(0, 0); err != nil {
+					b.Fatal(err)
+				}
+				if _, err := inspect(f); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("traks=%d/readat", traks), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := inspectAt(f, stat.Size()); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// errReadBackMismatch is returned when a FourCC just written reads back
+// differently, as seen with flaky storage.
+var errReadBackMismatch = errors.New("written FourCC reads back differently")
+
+// readBackFourCC reads the 4 bytes at offset back after they were written,
+// unless -no-read-back is set, failing if they differ from want. The reader is
+// left right after them, where the write left it. Writes to a moov held in
+// memory with -one-pass are only read back once written to the file.
+func readBackFourCC(rs io.ReadSeeker, offset int64, want string) error {
+	if _, planned := rs.(*patchPlan); noReadBack || planned {
+		return nil
+	}
+	got := make([]byte, 4)
+	if _, err := rs.Seek(offset, io.SeekStart); err != nil {
+		return fmt.Errorf(`[readBackFourCC] failed to seek: %w`, err)
+	}
+	if _, err := io.ReadFull(rs, got); err != nil {
+		return fmt.Errorf(`[readBackFourCC] failed reading back FourCC at %d(%#x): %w`, offset, offset, err)
+	}
+	if !bytes.Equal(got, []byte(want)) {
+		return fmt.Errorf(`[readBackFourCC] wrote "%s" at %d(%#x) but read back %q: %w`, want, offset, offset, got, errReadBackMismatch)
+	}
+	return nil
+}
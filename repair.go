@@ -0,0 +1,260 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+)
+
+// backupSuffix is appended to the name of the copy -repair makes of a file
+// before writing to it.
+const backupSuffix = ".bak"
+
+// fileLevel stands for the file itself as the parent of top level boxes.
+var fileLevel BoxType
+
+// boxParents lists the only boxes known to hold boxes of a type. A box found
+// where a container whose size is wrong seems to go on, but whose type
+// belongs to other parents, is taken for the sibling following it.
+var boxParents = map[BoxType][]BoxType{
+	FtypBoxType: {fileLevel},
+	MoovBoxType: {fileLevel},
+	MdatBoxType: {fileLevel},
+	MoofBoxType: {fileLevel},
+	MfraBoxType: {fileLevel},
+	MvhdBoxType: {MoovBoxType},
+	MvexBoxType: {MoovBoxType},
+	TrakBoxType: {MoovBoxType},
+	TkhdBoxType: {TrakBoxType},
+	EdtsBoxType: {TrakBoxType},
+	MdiaBoxType: {TrakBoxType},
+	UdtaBoxType: {MoovBoxType, TrakBoxType},
+	MdhdBoxType: {MdiaBoxType},
+	MinfBoxType: {MdiaBoxType},
+	DinfBoxType: {MinfBoxType},
+	StblBoxType: {MinfBoxType},
+	StsdBoxType: {StblBoxType},
+	StscBoxType: {StblBoxType},
+	StcoBoxType: {StblBoxType},
+	Co64BoxType: {StblBoxType},
+	ElstBoxType: {EdtsBoxType},
+}
+
+// errUnrepairable is returned when the boxes of a file are too broken for
+// -repair to tell where they end.
+var errUnrepairable = errors.New("box structure cannot be repaired")
+
+// SizeRepair is a container whose declared size does not match its children.
+type SizeRepair struct {
+	Path     string
+	Offset   int64
+	Declared uint64
+	Actual   uint64
+
+	// large is set for a 64-bit size field
+	large bool
+}
+
+// sizeRepairer computes the size of every container of a file from the boxes
+// found in it, without writing anything.
+type sizeRepairer struct {
+	r       io.ReadSeeker
+	repairs []SizeRepair
+}
+
+// plausibleChild reports whether the box h, found at the end of the boxes of
+// the container at the end of path, can be one of its children, the boxes of
+// the parent of the container ending at bound.
+func plausibleChild(path []BoxType, h *Header, bound int64) bool {
+	if h.Size == 0 || getBoxSize(h) < getHeaderSize(h) || h.Offset+int64(getBoxSize(h)) > bound {
+		return false
+	}
+	for _, c := range h.Type {
+		if (c < 0x20 || c > 0x7e) && c != 0xa9 {
+			return false
+		}
+	}
+	parent := fileLevel
+	if len(path) > 0 {
+		parent = path[len(path)-1]
+	}
+	if visualSampleEntryTypes[h.Type.String()] || audioSampleEntryTypes[h.Type.String()] {
+		return parent == StsdBoxType
+	}
+	parents, known := boxParents[h.Type]
+	if !known {
+		return true
+	}
+	for _, p := range parents {
+		if p == parent {
+			return true
+		}
+	}
+	return false
+}
+
+// plausibleSibling reports whether the box h can follow the box at the end of
+// path, as a child of its parent or, if it is the last one, of an ancestor.
+func plausibleSibling(path []BoxType, h *Header, bound int64) bool {
+	for i := len(path) - 1; i >= 0; i-- {
+		if plausibleChild(path[:i], h, bound) {
+			return true
+		}
+	}
+	return false
+}
+
+// boxAt reads the header of the box at offset into h, reporting whether there
+// is one.
+func (s *sizeRepairer) boxAt(offset int64, h **Header) bool {
+	if _, err := s.r.Seek(offset, io.SeekStart); err != nil {
+		return false
+	}
+	var err error
+	*h, err = readBoxHeader(s.r)
+	return err == nil
+}
+
+// boxSize returns the actual size of the box h at the end of path, whose
+// parent ends at bound: the size of the boxes found in it for a container
+// descended into by Walk, the declared size otherwise. Containers whose size
+// differs are added to the repairs, children before their parents.
+func (s *sizeRepairer) boxSize(path []BoxType, h *Header, bound int64) (size uint64, err error) {
+	skip, ok := childOffset(path, h)
+	if !ok || !DefaultWalkOptions.allows(h.Type) || h.Size == 0 {
+		return getBoxSize(h), nil
+	}
+	declaredEnd := h.Offset + int64(getBoxSize(h))
+	offset := h.Offset + int64(getHeaderSize(h)) + skip
+	for offset != declaredEnd && bound-offset >= 8 {
+		var child *Header
+		if !s.boxAt(offset, &child) || !plausibleChild(path, child, bound) {
+			break
+		}
+		var childSize uint64
+		if childSize, err = s.boxSize(append(path[:len(path):len(path)], child.Type), child, bound); err != nil {
+			return 0, err
+		}
+		offset += int64(childSize)
+	}
+
+	// Data that does not parse as boxes, such as the padding some writers end
+	// containers with, is left to the container when the box following it is
+	// where its declared size says.
+	if offset < declaredEnd && declaredEnd <= bound {
+		var next *Header
+		if declaredEnd == bound || s.boxAt(declaredEnd, &next) && plausibleSibling(path, next, bound) {
+			offset = declaredEnd
+		}
+	}
+
+	size = uint64(offset - h.Offset)
+	if size != getBoxSize(h) {
+		if h.Size != 1 && size > math.MaxUint32 {
+			return 0, fmt.Errorf(`[boxSize] size %d of box "%s" at %d(%#x) does not fit its 32-bit size field: %w`, size, h.Type, h.Offset, h.Offset, errUnrepairable)
+		}
+		types := make([]string, len(path))
+		for i, t := range path {
+			types[i] = t.String()
+		}
+		s.repairs = append(s.repairs, SizeRepair{Path: strings.Join(types, "/"), Offset: h.Offset, Declared: getBoxSize(h), Actual: size, large: h.Size == 1})
+	}
+	return size, nil
+}
+
+// findSizeRepairs returns the containers of r, a file of size bytes, whose
+// declared size does not match the boxes found in them. Top level boxes are
+// trusted to end within the file.
+func findSizeRepairs(r io.ReadSeeker, size int64) (repairs []SizeRepair, err error) {
+	s := &sizeRepairer{r: r}
+	for offset := int64(0); offset < size; {
+		var (
+			h       *Header
+			boxSize uint64
+		)
+		if _, err = r.Seek(offset, io.SeekStart); err != nil {
+			return nil, fmt.Errorf(`[findSizeRepairs] failed to seek: %w`, err)
+		}
+		// What follows a box not fitting the file, as in truncated files, is
+		// left for converting to report.
+		if h, err = readBoxHeader(r); err != nil || !plausibleChild(nil, h, size) {
+			if verbose {
+				fmt.Printf("[findSizeRepairs] not repairing past %d(%#x)\n", offset, offset)
+			}
+			return s.repairs, nil
+		}
+		if boxSize, err = s.boxSize([]BoxType{h.Type}, h, size); err != nil {
+			return nil, fmt.Errorf(`[findSizeRepairs] %w`, err)
+		}
+		offset += int64(boxSize)
+	}
+	return s.repairs, nil
+}
+
+// applySizeRepairs writes the actual size of every repaired container to its
+// size field.
+func applySizeRepairs(w io.WriteSeeker, repairs []SizeRepair) (err error) {
+	for _, repair := range repairs {
+		offset, value := repair.Offset, any(uint32(repair.Actual))
+		if repair.large {
+			offset, value = repair.Offset+8, repair.Actual
+		}
+		if _, err = w.Seek(offset, io.SeekStart); err != nil {
+			return fmt.Errorf(`[applySizeRepairs] failed to seek: %w`, err)
+		}
+		if err = binary.Write(w, binary.BigEndian, value); err != nil {
+			return fmt.Errorf(`[applySizeRepairs] failed writing size of "%s" at %d(%#x): %w`, repair.Path, repair.Offset, repair.Offset, err)
+		}
+	}
+	return nil
+}
+
+// repairFile fixes the declared sizes of the containers of mp4file not
+// matching their children, for -repair, after copying the file to
+// mp4file.bak. Files needing no repair are neither copied nor opened for
+// writing, and an existing backup is never overwritten.
+func repairFile(mp4file string) (repairs []SizeRepair, err error) {
+	var (
+		f    *os.File
+		info os.FileInfo
+	)
+	if f, err = os.Open(mp4file); err != nil {
+		return nil, fmt.Errorf(`[repairFile] cannot open file "%s": %w`, mp4file, err)
+	}
+	if info, err = f.Stat(); err == nil {
+		repairs, err = findSizeRepairs(f, info.Size())
+	}
+	f.Close()
+	if err != nil {
+		return nil, fmt.Errorf(`[repairFile] "%s": %w`, mp4file, err)
+	}
+	if len(repairs) == 0 {
+		return nil, nil
+	}
+
+	backup := mp4file + backupSuffix
+	if _, err = os.Lstat(backup); err == nil {
+		return nil, fmt.Errorf(`[repairFile] cannot back up "%s": "%s" already exists`, mp4file, backup)
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf(`[repairFile] cannot stat "%s": %w`, backup, err)
+	}
+	if err = copyFile(backup, mp4file, info.Mode().Perm()); err != nil {
+		return nil, fmt.Errorf(`[repairFile] %w`, err)
+	}
+	if f, err = os.OpenFile(mp4file, os.O_RDWR, 0); err != nil {
+		return nil, fmt.Errorf(`[repairFile] cannot open file "%s": %w`, mp4file, err)
+	}
+	defer f.Close()
+	if err = applySizeRepairs(f, repairs); err != nil {
+		return nil, fmt.Errorf(`[repairFile] %w, the original is in "%s"`, err, backup)
+	}
+	for _, repair := range repairs {
+		fmt.Printf("Repaired size of %s at %d(%#x) from %d to %d\n", repair.Path, repair.Offset, repair.Offset, repair.Declared, repair.Actual)
+	}
+	fmt.Printf("Backed up %s to %s before repairing it\n", mp4file, backup)
+	return repairs, nil
+}
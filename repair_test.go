@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// corruptSize adds delta to the declared size of the first box of type
+// boxType in data.
+func corruptSize(t *testing.T, data []byte, boxType string, delta int) []byte {
+	t.Helper()
+	data = append([]byte{}, data...)
+	i := bytes.Index(data, []byte(boxType)) - 4
+	if i < 0 {
+		t.Fatalf("no %s box", boxType)
+	}
+	binary.BigEndian.PutUint32(data[i:], uint32(int(binary.BigEndian.Uint32(data[i:]))+delta))
+	return data
+}
+
+func TestFindSizeRepairs(t *testing.T) {
+	entry := visualSampleEntry("dvhe", 1920, 1080, hvcC(), box("dvcC", make([]byte, 24)))
+	good := movie(trak(entry), trak(visualSampleEntry("avc1", 1280, 720)), box("udta", box("name", []byte("x")), u32(0)))
+
+	for _, test := range []struct {
+		name    string
+		boxType string
+		delta   int
+		want    []string
+	}{
+		{"stbl too large", "stbl", 4, []string{"moov/trak/mdia/minf/stbl"}},
+		{"trak too small", "trak", -8, []string{"moov/trak"}},
+		{"moov too large", "moov", 3, []string{"moov"}},
+		{"sample entry too small", "dvhe", -20, []string{"moov/trak/mdia/minf/stbl/stsd/dvhe"}},
+		{"intact", "moov", 0, nil},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			data := corruptSize(t, good, test.boxType, test.delta)
+			repairs, err := findSizeRepairs(bytes.NewReader(data), int64(len(data)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var paths []string
+			for _, repair := range repairs {
+				paths = append(paths, repair.Path)
+				if int(repair.Declared)-int(repair.Actual) != test.delta {
+					t.Errorf("%s: got size %d repaired to %d, want it off by %d", repair.Path, repair.Declared, repair.Actual, test.delta)
+				}
+			}
+			if !reflect.DeepEqual(paths, test.want) {
+				t.Errorf("got repairs of %v, want %v", paths, test.want)
+			}
+
+			f := &memFile{data: data}
+			if err = applySizeRepairs(f, repairs); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(f.data, good) {
+				t.Error("repaired file differs from the intact one")
+			}
+		})
+	}
+}
+
+func TestFindSizeRepairsKeepsTrailingData(t *testing.T) {
+	// Data that does not parse as boxes, up to where the declared size says
+	// the next box is, belongs to the container.
+	data := movie(box("udta", box("name", []byte("x")), []byte{0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0, 0, 0}))
+	repairs, err := findSizeRepairs(bytes.NewReader(data), int64(len(data)))
+	if err != nil || len(repairs) != 0 {
+		t.Errorf("got repairs %+v and error %v, want none", repairs, err)
+	}
+}
+
+func TestRepairFile(t *testing.T) {
+	good := movie(trak(visualSampleEntry("dvhe", 1920, 1080, hvcC(), box("dvcC", make([]byte, 24)))))
+	broken := corruptSize(t, good, "minf", 6)
+	mp4file := filepath.Join(t.TempDir(), "broken.mp4")
+	if err := os.WriteFile(mp4file, broken, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if problems, err := validate(bytes.NewReader(broken), int64(len(broken))); len(problems) == 0 && err == nil {
+		t.Fatal("corrupted fixture validates")
+	}
+
+	repairs, err := repairFile(mp4file)
+	if err != nil || len(repairs) != 1 {
+		t.Fatalf("got repairs %+v and error %v", repairs, err)
+	}
+	if got, _ := os.ReadFile(mp4file); !bytes.Equal(got, good) {
+		t.Error("repaired file differs from the intact one")
+	}
+	if backup, _ := os.ReadFile(mp4file + backupSuffix); !bytes.Equal(backup, broken) {
+		t.Error("backup differs from the original")
+	}
+
+	// An existing backup is never overwritten.
+	if err = os.WriteFile(mp4file, broken, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = repairFile(mp4file); err == nil {
+		t.Error("overwrote the existing backup")
+	}
+	if got, _ := os.ReadFile(mp4file); !bytes.Equal(got, broken) {
+		t.Error("file repaired without a backup")
+	}
+}
+
+func TestConvertFileRepair(t *testing.T) {
+	withCodecs(t, "dvhe", "dvh1")
+	t.Cleanup(func() { repair = false })
+	repair = true
+	good := movie(trak(visualSampleEntry("dvhe", 1920, 1080, hvcC(), box("dvcC", make([]byte, 24)))))
+	mp4file := filepath.Join(t.TempDir(), "broken.mp4")
+	if err := os.WriteFile(mp4file, corruptSize(t, good, "mdia", 5), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if result := convertFile(context.Background(), mp4file); result.Err != nil || len(result.Changes) != 1 {
+		t.Fatalf("got changes %v and error %v", result.Changes, result.Err)
+	}
+	got, err := os.ReadFile(mp4file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := bytes.Replace(good, []byte("dvhe"), []byte("dvh1"), 1); !bytes.Equal(got, want) {
+		t.Error("file not repaired and converted")
+	}
+}
+
+func TestConvertFileRepairAfterFilters(t *testing.T) {
+	withCodecs(t, "dvhe", "dvh1")
+	t.Cleanup(func() { repair, ifBrand = false, "" })
+	repair, ifBrand = true, "zzzz"
+	broken := corruptSize(t, movie(trak(visualSampleEntry("dvhe", 1920, 1080, hvcC(), box("dvcC", make([]byte, 24))))), "mdia", 5)
+	mp4file := filepath.Join(t.TempDir(), "broken.mp4")
+	if err := os.WriteFile(mp4file, broken, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if result := convertFile(context.Background(), mp4file); result.Status != statusSkipped {
+		t.Fatalf("got result %+v, want the file skipped by -if-brand", result)
+	}
+	got, err := os.ReadFile(mp4file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, broken) {
+		t.Error("skipped file was repaired")
+	}
+	if _, err = os.Stat(mp4file + ".bak"); !os.IsNotExist(err) {
+		t.Errorf("skipped file was backed up: %v", err)
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sync/atomic"
+)
+
+// belowThreshold counts the sample entries left unchanged by -min-width and
+// -min-height since the last call to takeBelowThreshold. Tracks may be
+// converted concurrently with -parallel-boxes.
+var belowThreshold atomic.Int64
+
+// takeBelowThreshold returns the number of sample entries left unchanged by
+// the resolution threshold since the last call.
+func takeBelowThreshold() int64 {
+	return belowThreshold.Swap(0)
+}
+
+// belowResolution reports whether the visual sample entry h is smaller than
+// -min-width or -min-height, in which case it must be left unchanged. r is
+// left positioned at the payload of the entry. An entry matching a visual
+// -from codec with -lenient-match, such as DVHE, is a visual sample entry too.
+func belowResolution(r io.ReadSeeker, h *Header) (below bool, err error) {
+	visual := visualSampleEntryTypes[h.Type.String()] || matchesFrom(h.Type.String()) && visualSampleEntryTypes[codecFrom]
+	if (minWidth == 0 && minHeight == 0) || !visual {
+		return false, nil
+	}
+	payloadOffset := h.Offset + h.HeaderLength()
+	if _, err = r.Seek(payloadOffset, io.SeekStart); err != nil {
+		return false, fmt.Errorf(`[belowResolution] failed to seek: %w`, err)
+	}
+	entry, _, err := readVisualSampleEntry(r)
+	if err != nil {
+		return false, fmt.Errorf(`[belowResolution] sample entry %s at %d(%#x): %w`, h.Type, h.Offset, h.Offset, err)
+	}
+	if _, err = r.Seek(payloadOffset, io.SeekStart); err != nil {
+		return false, fmt.Errorf(`[belowResolution] failed to seek back: %w`, err)
+	}
+	if uint(entry.Width) >= minWidth && uint(entry.Height) >= minHeight {
+		return false, nil
+	}
+	fmt.Printf("Leaving sample entry %s at %d(%#x) unchanged: %dx%d is below -min-width %d -min-height %d\n", h.Type, h.Offset, h.Offset, entry.Width, entry.Height, minWidth, minHeight)
+	belowThreshold.Add(1)
+	return true, nil
+}
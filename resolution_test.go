@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConvertMinResolution(t *testing.T) {
+	withCodecs(t, "dvhe", "dvh1")
+	t.Cleanup(func() { minWidth, minHeight = 0, 0 })
+	uhd := visualSampleEntry("dvhe", 3840, 2160, hvcC(), box("dvcC", make([]byte, 24)))
+	hd := visualSampleEntry("dvhe", 1920, 1080, hvcC(), box("dvcC", make([]byte, 24)))
+	data := movie(trak(uhd), trak(hd))
+
+	for _, test := range []struct {
+		width, height uint
+		want          string
+	}{
+		{0, 0, "[[dvh1] [dvh1]]"},
+		{3840, 0, "[[dvh1] [dvhe]]"},
+		{0, 1080, "[[dvh1] [dvh1]]"},
+		{0, 2161, "[[dvhe] [dvhe]]"},
+	} {
+		t.Run(fmt.Sprintf("%dx%d", test.width, test.height), func(t *testing.T) {
+			minWidth, minHeight = test.width, test.height
+			takeChanges()
+			takeBelowThreshold()
+			f := &memFile{data: append([]byte{}, data...)}
+			if err := convert(f); err != nil {
+				t.Fatal(err)
+			}
+			info, err := inspect(bytes.NewReader(f.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var codecs [][]string
+			for _, track := range info.Tracks {
+				codecs = append(codecs, track.Codecs)
+			}
+			if got := fmt.Sprint(codecs); got != test.want {
+				t.Errorf("got codecs %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestConvertFileBelowResolution(t *testing.T) {
+	withCodecs(t, "dvhe", "dvh1")
+	t.Cleanup(func() { minWidth = 0 })
+	minWidth = 3840
+	mp4file := filepath.Join(t.TempDir(), "hd.mp4")
+	data := movie(trak(visualSampleEntry("dvhe", 1920, 1080, hvcC(), box("dvcC", make([]byte, 24)))))
+	if err := os.WriteFile(mp4file, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	result := convertFile(context.Background(), mp4file)
+	if result.Status != statusSkipped || result.Err != nil {
+		t.Errorf("got status %s and error %v, want skipped", result.Status, result.Err)
+	}
+	if got, err := os.ReadFile(mp4file); err != nil || !bytes.Equal(got, data) {
+		t.Errorf("file changed below the threshold (%v)", err)
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+)
+
+// errIncompleteFile is returned for files ending before a moov box was found,
+// such as empty files or partial downloads, as opposed to corrupt ones.
+var errIncompleteFile = errors.New("empty or incomplete MP4 (no moov)")
+
+// fileStatus categorizes the outcome of processing a file.
+type fileStatus string
+
+const (
+	statusDone         fileStatus = "done"
+	statusSkipped      fileStatus = "skipped"
+	statusIncomplete   fileStatus = "empty or incomplete"
+	statusAccessDenied fileStatus = "access denied"
+	statusFailed       fileStatus = "failed"
+)
+
+// summaryOrder is the order in which printSummary lists the statuses.
+var summaryOrder = []fileStatus{statusDone, statusSkipped, statusIncomplete, statusAccessDenied, statusFailed}
+
+// FileResult is the outcome of processing one file of a batch.
+type FileResult struct {
+	File    string
+	Status  fileStatus
+	Err     error
+	Changes []Change
+
+	// RenamedTo is the new name of the file with -rename-on-change
+	RenamedTo string
+
+	// Original is where the original file was kept with -keep-original
+	Original string
+
+	// Reason explains why a file was skipped
+	Reason string
+
+	// Codecs are the sample entry codecs found before processing, with a
+	// -format other than text
+	Codecs []string
+}
+
+// action describes what was done to the file.
+func (result *FileResult) action() string {
+	switch {
+	case result.Status == statusSkipped:
+		return "skipped: " + result.Reason
+	case result.Err != nil:
+		return "none"
+	case len(result.Changes) == 0:
+		return "unchanged"
+	}
+	kinds := make(map[string]int)
+	var order []string
+	for _, change := range result.Changes {
+		kind := fmt.Sprintf("%s %s→%s", change.Kind, change.From, change.To)
+		if kinds[kind] == 0 {
+			order = append(order, kind)
+		}
+		kinds[kind]++
+	}
+	parts := make([]string, len(order))
+	for i, kind := range order {
+		parts[i] = fmt.Sprintf("%s ×%d", kind, kinds[kind])
+	}
+	action := strings.Join(parts, ", ")
+	if result.RenamedTo != "" {
+		action += ", renamed to " + result.RenamedTo
+	}
+	if result.Original != "" {
+		action += ", original kept as " + result.Original
+	}
+	return action
+}
+
+// skipFile reports and returns the result of a file left alone by a filter.
+func skipFile(mp4file, reason string) FileResult {
+	fmt.Printf("Skipping %s: %s\n", mp4file, reason)
+	return FileResult{File: mp4file, Status: statusSkipped, Reason: reason}
+}
+
+func newFileResult(mp4file string, err error) FileResult {
+	switch {
+	case err == nil:
+		return FileResult{File: mp4file, Status: statusDone}
+	case errors.Is(err, errIncompleteFile):
+		return FileResult{File: mp4file, Status: statusIncomplete, Err: err}
+	case errors.Is(err, fs.ErrPermission):
+		// EACCES or EPERM, as for files of other users on shared drives
+		return FileResult{File: mp4file, Status: statusAccessDenied, Err: err}
+	}
+	return FileResult{File: mp4file, Status: statusFailed, Err: err}
+}
+
+// isEndOfFile reports whether err was caused by r ending early.
+func isEndOfFile(err error) bool {
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// reportResults reports the file, codecs found, action taken and status of
+// every file of the batch in format, for -format other than text.
+func reportResults(w io.Writer, format string, results []FileResult) error {
+	rep := newReporter(w, format)
+	for _, result := range results {
+		if err := rep.report(result); err != nil {
+			return fmt.Errorf(`[reportResults] %w`, err)
+		}
+	}
+	if err := rep.finish(); err != nil {
+		return fmt.Errorf(`[reportResults] %w`, err)
+	}
+	return nil
+}
+
+// printText prints nothing, the outcome of a file is told as it is processed.
+func (result FileResult) printText() {}
+
+func (result FileResult) columns() []string {
+	return []string{"file", "codecs", "action", "status"}
+}
+
+func (result FileResult) row() []string {
+	status := string(result.Status)
+	if result.Err != nil {
+		status += ": " + result.Err.Error()
+	}
+	return []string{result.File, commaList(result.Codecs), result.action(), status}
+}
+
+// fileResultJSON is the JSON form of a FileResult, which -json-schema
+// describes.
+type fileResultJSON struct {
+	File      string     `json:"file"`
+	Status    fileStatus `json:"status"`
+	Error     string     `json:"error,omitempty"`
+	Reason    string     `json:"reason,omitempty"`
+	Codecs    []string   `json:"codecs,omitempty"`
+	Action    string     `json:"action"`
+	Changes   []Change   `json:"changes"`
+	RenamedTo string     `json:"renamedTo,omitempty"`
+	Original  string     `json:"original,omitempty"`
+}
+
+func (result FileResult) MarshalJSON() ([]byte, error) {
+	var errText string
+	if result.Err != nil {
+		errText = result.Err.Error()
+	}
+	changes := result.Changes
+	if changes == nil {
+		changes = []Change{}
+	}
+	return json.Marshal(fileResultJSON{result.File, result.Status, errText, result.Reason, result.Codecs, result.action(), changes, result.RenamedTo, result.Original})
+}
+
+// printSummary prints how many files of the batch ended up in each status.
+func printSummary(results []FileResult) {
+	counts := make(map[fileStatus]int)
+	for _, result := range results {
+		counts[result.Status]++
+	}
+	parts := []string{}
+	for _, status := range summaryOrder {
+		if counts[status] > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", counts[status], status))
+		}
+	}
+	fmt.Printf("Processed %d files: %s\n", len(results), strings.Join(parts, ", "))
+}
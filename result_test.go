@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"syscall"
+	"testing"
+)
+
+func TestReportResultsTable(t *testing.T) {
+	results := []FileResult{
+		{
+			File: "a.mp4", Status: statusDone, Codecs: []string{"dvhe", "mp4a"},
+			Changes:   []Change{{Kind: "sample entry", From: "dvhe", To: "dvh1"}, {Kind: "sample entry", From: "dvhe", To: "dvh1"}},
+			RenamedTo: "a.dv.mp4",
+		},
+		{File: "long name.mp4", Status: statusDone, Codecs: []string{"dvh1"}},
+		{File: "c.mp4", Status: statusSkipped, Reason: "conversion declined (-interactive)"},
+		{File: "d.mp4", Status: statusFailed, Err: errors.New("broken")},
+	}
+	var out bytes.Buffer
+	if err := reportResults(&out, formatTable, results); err != nil {
+		t.Fatal(err)
+	}
+	want := `FILE           CODECS     ACTION                                          STATUS
+a.mp4          dvhe,mp4a  sample entry dvhe→dvh1 ×2, renamed to a.dv.mp4  done
+long name.mp4  dvh1       unchanged                                       done
+c.mp4          -          skipped: conversion declined (-interactive)     skipped
+d.mp4          -          none                                            failed: broken
+`
+	if out.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", out.String(), want)
+	}
+}
+
+func TestNewFileResultStatus(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want fileStatus
+	}{
+		{err: nil, want: statusDone},
+		{err: fmt.Errorf("[convert] %w", errIncompleteFile), want: statusIncomplete},
+		{err: fmt.Errorf(`[processFile] cannot open file "a.mp4": %w`, &fs.PathError{Op: "open", Path: "a.mp4", Err: syscall.EACCES}), want: statusAccessDenied},
+		{err: &fs.PathError{Op: "open", Path: "a.mp4", Err: syscall.EPERM}, want: statusAccessDenied},
+		{err: &fs.PathError{Op: "open", Path: "a.mp4", Err: syscall.ENOENT}, want: statusFailed},
+		{err: errors.New("broken"), want: statusFailed},
+	} {
+		if got := newFileResult("a.mp4", tc.err); got.Status != tc.want {
+			t.Errorf("got status %q for %v, want %q", got.Status, tc.err, tc.want)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+)
+
+// isTransient reports whether err is an I/O error worth retrying, as seen on
+// flaky network mounts. Structural errors and missing or inaccessible files are
+// permanent.
+func isTransient(err error) bool {
+	var timeout interface{ Timeout() bool }
+	if errors.As(err, &timeout) && timeout.Timeout() {
+		return true
+	}
+	for _, errno := range []syscall.Errno{syscall.EINTR, syscall.EAGAIN, syscall.ETIMEDOUT, syscall.ECONNRESET, syscall.EIO} {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+	return errors.Is(err, os.ErrDeadlineExceeded)
+}
+
+// processFileWithRetries retries processFile on transient errors, doubling the
+// delay after every attempt. Converting is idempotent: a failed attempt writing
+// to a temporary copy leaves the file untouched and its recorded changes are
+// dropped, while changes written in place by a failed attempt stay recorded and
+// the retry finds fewer entries to change.
+func processFileWithRetries(ctx context.Context, mp4file string) error {
+	return retryTransient(ctx, mp4file, func() error { return processFile(mp4file) })
+}
+
+// retryTransient calls process for mp4file until it succeeds, fails with a
+// permanent error or -retries are exhausted, or ctx is cancelled while waiting
+// to retry.
+func retryTransient(ctx context.Context, mp4file string, process func() error) (err error) {
+	delay := retryDelay
+	for attempt := 0; ; attempt++ {
+		if err = process(); err == nil || attempt >= retries || !isTransient(err) {
+			return
+		}
+		fmt.Printf("Transient error processing %s, retrying in %v (%d of %d): %v\n", mp4file, delay, attempt+1, retries, err)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf(`[retryTransient] interrupted while waiting to retry after "%v": %w`, err, ctx.Err())
+		case <-time.After(delay):
+		}
+		if writesCopy() {
+			takeChanges()
+		}
+		takeBelowThreshold()
+		delay *= 2
+	}
+}
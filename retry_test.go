@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestIsTransient(t *testing.T) {
+	for _, test := range []struct {
+		err  error
+		want bool
+	}{
+		{&fs.PathError{Op: "read", Path: "movie.mp4", Err: syscall.EIO}, true},
+		{&fs.PathError{Op: "read", Path: "movie.mp4", Err: syscall.ETIMEDOUT}, true},
+		{fmt.Errorf("[convert] %w", syscall.EAGAIN), true},
+		{syscall.EINTR, true},
+		{syscall.ECONNRESET, true},
+		{os.ErrDeadlineExceeded, true},
+		{&fs.PathError{Op: "open", Path: "movie.mp4", Err: syscall.ENOENT}, false},
+		{&fs.PathError{Op: "open", Path: "movie.mp4", Err: syscall.EACCES}, false},
+		{io.ErrUnexpectedEOF, false},
+		{errPrefixedFile, false},
+	} {
+		if got := isTransient(test.err); got != test.want {
+			t.Errorf("isTransient(%v): got %v, want %v", test.err, got, test.want)
+		}
+	}
+}
+
+func TestRetryTransient(t *testing.T) {
+	t.Cleanup(func() { retries, retryDelay = 0, 0 })
+	retries, retryDelay = 2, time.Millisecond
+
+	for name, test := range map[string]struct {
+		errs      []error
+		wantCalls int
+		wantErr   error
+	}{
+		"success":         {nil, 1, nil},
+		"retried":         {[]error{syscall.EIO, syscall.EIO}, 3, nil},
+		"exhausted":       {[]error{syscall.EIO, syscall.EIO, syscall.EIO}, 3, syscall.EIO},
+		"permanent error": {[]error{syscall.ENOENT}, 1, syscall.ENOENT},
+	} {
+		calls := 0
+		err := retryTransient(context.Background(), "movie.mp4", func() error {
+			calls++
+			if calls <= len(test.errs) {
+				return test.errs[calls-1]
+			}
+			return nil
+		})
+		if calls != test.wantCalls || !errors.Is(err, test.wantErr) || (err == nil) != (test.wantErr == nil) {
+			t.Errorf("%s: got %d calls and error %v, want %d calls and %v", name, calls, err, test.wantCalls, test.wantErr)
+		}
+	}
+}
+
+func TestRetryTransientCancelled(t *testing.T) {
+	t.Cleanup(func() { retries, retryDelay = 0, 0 })
+	retries, retryDelay = 3, time.Hour
+
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	err := retryTransient(ctx, "movie.mp4", func() error {
+		calls++
+		cancel()
+		return syscall.EIO
+	})
+	if calls != 1 || !errors.Is(err, context.Canceled) || errors.Is(err, syscall.EIO) {
+		t.Fatalf("got %d calls and error %v, want 1 call and context.Canceled", calls, err)
+	}
+}
+
+func TestRetryTransientDropsChanges(t *testing.T) {
+	t.Cleanup(func() { retries, retryDelay, atomicWrite = 0, 0, false })
+	retries, retryDelay = 1, time.Millisecond
+
+	for _, copied := range []bool{false, true} {
+		atomicWrite = copied
+		takeChanges()
+		calls := 0
+		err := retryTransient(context.Background(), "movie.mp4", func() error {
+			calls++
+			if calls == 1 {
+				recordChange("sample entry", 100, "dvhe", "dvh1")
+				return syscall.EIO
+			}
+			recordChange("sample entry", 200, "dvhe", "dvh1")
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Changes written in place stay, those of a discarded copy do not.
+		want := 2
+		if copied {
+			want = 1
+		}
+		if changes := takeChanges(); len(changes) != want {
+			t.Errorf("-atomic %v: got changes %v, want %d", copied, changes, want)
+		}
+	}
+}
@@ -0,0 +1,378 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+var (
+	FtypBoxType = BoxType{'f', 't', 'y', 'p'}
+	StcoBoxType = BoxType{'s', 't', 'c', 'o'}
+	Co64BoxType = BoxType{'c', 'o', '6', '4'}
+)
+
+// errFragmentedRewrite is returned by rewriteFile for fragmented files, whose
+// moof and mfra boxes hold offsets that are not relocated.
+var errFragmentedRewrite = errors.New("fragmented files cannot be rewritten")
+
+// topLevelBox is a top level box header with its size resolved, including
+// size 0 boxes which extend to the end of the file.
+type topLevelBox struct {
+	*Header
+	size int64
+}
+
+func readTopLevelBoxes(r io.ReadSeeker) (boxes []topLevelBox, err error) {
+	var end int64
+
+	if end, err = r.Seek(0, io.SeekEnd); err != nil {
+		return nil, fmt.Errorf(`[readTopLevelBoxes] failed to seek: %w`, err)
+	}
+	for offset := int64(0); offset < end; {
+		var h *Header
+		if _, err = r.Seek(offset, io.SeekStart); err != nil {
+			return nil, fmt.Errorf(`[readTopLevelBoxes] failed to seek: %w`, err)
+		}
+		if h, err = readBoxHeader(r); err != nil {
+			return nil, fmt.Errorf(`[readTopLevelBoxes] failed reading box header at %d(%#x): %w`, offset, offset, err)
+		}
+		size := int64(getBoxSize(h))
+		if h.Size == 0 {
+			size = end - offset
+		}
+		if size < int64(getHeaderSize(h)) || offset+size > end {
+			return nil, fmt.Errorf(`[readTopLevelBoxes] invalid size %d for box "%s" at %d(%#x)`, size, h.Type, offset, offset)
+		}
+		boxes = append(boxes, topLevelBox{Header: h, size: size})
+		offset += size
+	}
+	return
+}
+
+// relocation records that the bytes [from, from+size) of the original file
+// were written at to in the rewritten file.
+type relocation struct {
+	from, size, to int64
+}
+
+func relocate(relocations []relocation, offset uint64) (uint64, error) {
+	for _, rel := range relocations {
+		if int64(offset) >= rel.from && int64(offset) < rel.from+rel.size {
+			return uint64(int64(offset) - rel.from + rel.to), nil
+		}
+	}
+	return 0, fmt.Errorf(`[relocate] offset %d(%#x) does not point into a retained box`, offset, offset)
+}
+
+// upgradeChunkOffsets turns every stco box below b whose relocated offsets no
+// longer fit 32 bits into a co64 box. The offsets themselves are left alone.
+func upgradeChunkOffsets(b *Box, relocations []relocation) (upgraded bool, err error) {
+	err = b.Visit(nil, func(path []BoxType, b *Box) error {
+		if b.Type != StcoBoxType {
+			return nil
+		}
+		stco, err := readStcoBox(bytes.NewReader(b.Fields), int64(len(b.Fields)))
+		if err != nil {
+			return fmt.Errorf(`[upgradeChunkOffsets] %w`, err)
+		}
+		for _, offset := range stco.Offsets {
+			moved, err := relocate(relocations, uint64(offset))
+			if err != nil {
+				return err
+			}
+			if moved > math.MaxUint32 {
+				b.Type = Co64BoxType
+				b.Fields = append(stco.Co64().Payload(), b.Fields[len(stco.Payload()):]...)
+				upgraded = true
+				return nil
+			}
+		}
+		return nil
+	})
+	return
+}
+
+// rewriteChunkOffsets relocates every stco and co64 entry below b.
+func rewriteChunkOffsets(b *Box, relocations []relocation) error {
+	move := func(offset uint64) (uint64, error) {
+		return relocate(relocations, offset)
+	}
+	return b.Visit(nil, func(path []BoxType, b *Box) error {
+		switch b.Type {
+		case StcoBoxType:
+			stco, err := readStcoBox(bytes.NewReader(b.Fields), int64(len(b.Fields)))
+			if err == nil {
+				err = stco.Relocate(move)
+			}
+			if err != nil {
+				return fmt.Errorf(`[rewriteChunkOffsets] %w`, err)
+			}
+			b.Fields = append(stco.Payload(), b.Fields[len(stco.Payload()):]...)
+		case Co64BoxType:
+			co64, err := readCo64Box(bytes.NewReader(b.Fields), int64(len(b.Fields)))
+			if err == nil {
+				err = co64.Relocate(move)
+			}
+			if err != nil {
+				return fmt.Errorf(`[rewriteChunkOffsets] %w`, err)
+			}
+			b.Fields = append(co64.Payload(), b.Fields[len(co64.Payload()):]...)
+		}
+		return nil
+	})
+}
+
+// rewriteOptions selects the structural changes made by rewriteFile.
+type rewriteOptions struct {
+	// StripFree drops free and skip padding boxes
+	StripFree bool
+
+	// MoovFirst orders the top level boxes as ftyp, moov, then everything
+	// else in their original order
+	MoovFirst bool
+
+	// AddEntryAs, when set, adds a copy of every AddEntryFrom sample entry
+	// renamed to AddEntryAs, see duplicateSampleEntries
+	AddEntryFrom BoxType
+	AddEntryAs   BoxType
+
+	// LenientMatch also copies the sample entries differing from
+	// AddEntryFrom in case or padding, as -lenient-match
+	LenientMatch bool
+
+	// Canonical writes every box header with the smallest size field able to
+	// hold its size, and replaces size 0 with the actual size
+	Canonical bool
+
+	// BufferSize is the size of the buffer the boxes other than moov, such as
+	// mdat, are streamed through, 0 for defaultRewriteBufferSize
+	BufferSize int
+}
+
+// defaultRewriteBufferSize is the buffer size used by rewriteFile unless
+// rewriteOptions.BufferSize is set.
+const defaultRewriteBufferSize = 1 << 20
+
+// plannedBox is a top level box scheduled to be written by rewriteFile.
+type plannedBox struct {
+	topLevelBox
+
+	// tree is the parsed box for moov, nil for boxes copied verbatim
+	tree *Box
+
+	// explicitSize is set for size 0 boxes that are no longer last and need
+	// a header with their actual size, and for every box with a size 0 or
+	// 64-bit size field when writing canonical sizes
+	explicitSize bool
+}
+
+func (p *plannedBox) headerSize() int64 {
+	if !p.explicitSize {
+		return int64(getHeaderSize(p.Header))
+	}
+	if payload := p.size - int64(getHeaderSize(p.Header)); payload+8 > math.MaxUint32 {
+		return 16
+	}
+	return 8
+}
+
+func (p *plannedBox) writtenSize() int64 {
+	if p.tree != nil {
+		return int64(p.tree.Size())
+	}
+	return p.headerSize() + p.size - int64(getHeaderSize(p.Header))
+}
+
+func planRewrite(src io.ReadSeeker, boxes []topLevelBox, opts rewriteOptions) (plan []*plannedBox, err error) {
+	for _, b := range boxes {
+		p := &plannedBox{topLevelBox: b}
+		switch b.Type {
+		case FreeBoxType, SkipBoxType:
+			if opts.StripFree {
+				continue
+			}
+		case MoovBoxType:
+			if _, err = src.Seek(b.Offset+int64(getHeaderSize(b.Header)), io.SeekStart); err != nil {
+				return nil, fmt.Errorf(`[planRewrite] failed to seek: %w`, err)
+			}
+			if p.tree, err = readBoxTree(src, b.Header, b.size, nil); err != nil {
+				return nil, fmt.Errorf(`[planRewrite] %w`, err)
+			}
+			if opts.StripFree {
+				removeFreeBoxes(p.tree)
+			}
+			if opts.Canonical {
+				canonicalizeSizes(p.tree)
+			}
+			if opts.AddEntryAs != (BoxType{}) {
+				if _, err = duplicateSampleEntries(p.tree, opts.AddEntryFrom, opts.AddEntryAs, opts.LenientMatch); err != nil {
+					return nil, fmt.Errorf(`[planRewrite] %w`, err)
+				}
+			}
+		}
+		plan = append(plan, p)
+	}
+
+	if opts.MoovFirst {
+		rank := func(p *plannedBox) int {
+			switch p.Type {
+			case FtypBoxType:
+				return 0
+			case MoovBoxType:
+				return 1
+			}
+			return 2
+		}
+		ordered := make([]*plannedBox, 0, len(plan))
+		for r := 0; r <= 2; r++ {
+			for _, p := range plan {
+				if rank(p) == r {
+					ordered = append(ordered, p)
+				}
+			}
+		}
+		plan = ordered
+	}
+
+	for i, p := range plan {
+		p.explicitSize = p.Size == 0 && i < len(plan)-1
+		if opts.Canonical && p.tree == nil && (p.Size == 0 || p.Size == 1) {
+			p.explicitSize = true
+		}
+	}
+	return
+}
+
+// canonicalizeSizes drops the 64-bit size field of b and its descendants
+// wherever the size fits 32 bits.
+func canonicalizeSizes(b *Box) {
+	b.Large = false
+	for _, child := range b.Children {
+		canonicalizeSizes(child)
+	}
+}
+
+// layoutRewrite computes where the media data of every verbatim box ends up.
+func layoutRewrite(plan []*plannedBox) (relocations []relocation) {
+	offset := int64(0)
+	for _, p := range plan {
+		if p.tree == nil {
+			if p.explicitSize {
+				headerSize := int64(getHeaderSize(p.Header))
+				relocations = append(relocations, relocation{from: p.Offset + headerSize, size: p.size - headerSize, to: offset + p.headerSize()})
+			} else {
+				relocations = append(relocations, relocation{from: p.Offset, size: p.size, to: offset})
+			}
+		}
+		offset += p.writtenSize()
+	}
+	return
+}
+
+// rewriteFile writes src to dst with the structural changes selected by opts,
+// recomputing container sizes and fixing up the chunk offsets so they keep
+// pointing at the same media data. It returns the number of bytes written.
+// Fragmented files are refused with errFragmentedRewrite, since only the chunk
+// offsets of moov are relocated.
+//
+// Only moov is parsed into memory. Every other box, the media data included,
+// is streamed from src to dst through a single buffer of opts.BufferSize
+// bytes, so the memory used does not grow with the size of the file.
+func rewriteFile(dst io.Writer, src io.ReadSeeker, opts rewriteOptions) (written int64, err error) {
+	var (
+		boxes       []topLevelBox
+		plan        []*plannedBox
+		relocations []relocation
+	)
+
+	bufferSize := opts.BufferSize
+	if bufferSize <= 0 {
+		bufferSize = defaultRewriteBufferSize
+	}
+	buf := make([]byte, bufferSize)
+
+	if boxes, err = readTopLevelBoxes(src); err != nil {
+		return 0, fmt.Errorf(`[rewriteFile] %w`, err)
+	}
+	for _, b := range boxes {
+		if b.Type == MoofBoxType || b.Type == MfraBoxType {
+			return 0, fmt.Errorf(`[rewriteFile] box "%s" at %d(%#x): %w`, b.Type, b.Offset, b.Offset, errFragmentedRewrite)
+		}
+	}
+
+	if plan, err = planRewrite(src, boxes, opts); err != nil {
+		return 0, fmt.Errorf(`[rewriteFile] %w`, err)
+	}
+
+	// Moving media data may push 32-bit chunk offsets out of range, and
+	// switching to co64 grows moov, which moves the media data again.
+	for {
+		relocations = layoutRewrite(plan)
+		upgraded := false
+		for _, p := range plan {
+			if p.tree == nil {
+				continue
+			}
+			var u bool
+			if u, err = upgradeChunkOffsets(p.tree, relocations); err != nil {
+				return 0, fmt.Errorf(`[rewriteFile] %w`, err)
+			}
+			upgraded = upgraded || u
+		}
+		if !upgraded {
+			break
+		}
+	}
+
+	for _, p := range plan {
+		if p.tree == nil {
+			continue
+		}
+		if err = rewriteChunkOffsets(p.tree, relocations); err != nil {
+			return 0, fmt.Errorf(`[rewriteFile] %w`, err)
+		}
+	}
+
+	for _, p := range plan {
+		var n int64
+		switch {
+		case p.tree != nil:
+			n, err = p.tree.WriteTo(dst)
+		case p.explicitSize:
+			headerSize := int64(getHeaderSize(p.Header))
+			payload := p.size - headerSize
+			if n, err = writeBoxHeader(dst, p.Type, uint64(p.headerSize()+payload), p.headerSize() == 16); err != nil {
+				break
+			}
+			if _, err = src.Seek(p.Offset+headerSize, io.SeekStart); err != nil {
+				return 0, fmt.Errorf(`[rewriteFile] failed to seek: %w`, err)
+			}
+			var m int64
+			m, err = copyBoxData(dst, src, payload, buf)
+			n += m
+		default:
+			if _, err = src.Seek(p.Offset, io.SeekStart); err != nil {
+				return 0, fmt.Errorf(`[rewriteFile] failed to seek: %w`, err)
+			}
+			n, err = copyBoxData(dst, src, p.size, buf)
+		}
+		written += n
+		if err != nil {
+			return written, fmt.Errorf(`[rewriteFile] failed writing box "%s": %w`, p.Type, err)
+		}
+	}
+	return
+}
+
+// copyBoxData copies exactly n bytes from src to dst through buf. Unlike
+// io.CopyN it never allocates a buffer of its own, although dst may still
+// copy without buf if it implements io.ReaderFrom, as files do.
+func copyBoxData(dst io.Writer, src io.Reader, n int64, buf []byte) (written int64, err error) {
+	if written, err = io.CopyBuffer(dst, io.LimitReader(src, n), buf); err == nil && written < n {
+		err = io.ErrUnexpectedEOF
+	}
+	return
+}
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"testing"
+)
+
+func topLevelTypes(t *testing.T, data []byte) (types []string) {
+	t.Helper()
+	boxes, err := readTopLevelBoxes(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, b := range boxes {
+		types = append(types, b.Type.String())
+	}
+	return
+}
+
+func TestRewriteFileMoovFirst(t *testing.T) {
+	ftyp := box("ftyp", []byte("isom"), u32(0), []byte("isomdby1"))
+	tests := []struct {
+		name  string
+		build func(offsets []uint64) []byte
+		want  string
+	}{
+		{
+			name: "moov after mdat",
+			build: func(offsets []uint64) []byte {
+				return bytes.Join([][]byte{
+					ftyp,
+					mdatWithChunks(),
+					box("moov", strippedTrak(stco(uint32(offsets[0]), uint32(offsets[1]), uint32(offsets[2])))),
+				}, nil)
+			},
+			want: "[ftyp moov mdat]",
+		},
+		{
+			name: "moov after mdat and free, co64",
+			build: func(offsets []uint64) []byte {
+				return bytes.Join([][]byte{
+					box("free", make([]byte, 4)),
+					mdatWithChunks(),
+					ftyp,
+					box("moov", strippedTrak(co64(offsets...))),
+				}, nil)
+			},
+			want: "[ftyp moov free mdat]",
+		},
+		{
+			name: "moov before size 0 mdat",
+			build: func(offsets []uint64) []byte {
+				mdat := mdatWithChunks()
+				data := bytes.Join([][]byte{
+					ftyp,
+					box("moov", strippedTrak(stco(uint32(offsets[0]), uint32(offsets[1]), uint32(offsets[2])))),
+					mdat,
+				}, nil)
+				// turn mdat into a box extending to the end of the file
+				mdatStart := len(data) - len(mdat)
+				binary.BigEndian.PutUint32(data[mdatStart:], 0)
+				return data
+			},
+			want: "[ftyp moov mdat]",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := buildChunked(t, tt.build)
+			assertChunksIntact(t, data)
+
+			var out bytes.Buffer
+			written, err := rewriteFile(&out, bytes.NewReader(data), rewriteOptions{MoovFirst: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if written != int64(out.Len()) {
+				t.Errorf("reported %d bytes written, got %d", written, out.Len())
+			}
+			if got := topLevelTypes(t, out.Bytes()); fmt.Sprint(got) != tt.want {
+				t.Errorf("got order %v, want %s", got, tt.want)
+			}
+			assertChunksIntact(t, out.Bytes())
+		})
+	}
+}
+
+func TestRewriteFileSizeZeroBoxNotLast(t *testing.T) {
+	ftyp := box("ftyp", []byte("isom"), u32(0), []byte("isomdby1"))
+	data := buildChunked(t, func(offsets []uint64) []byte {
+		mdat := mdatWithChunks()
+		binary.BigEndian.PutUint32(mdat, 0)
+		return bytes.Join([][]byte{ftyp, mdat}, nil)
+	})
+	var out bytes.Buffer
+	if _, err := rewriteFile(&out, bytes.NewReader(data), rewriteOptions{MoovFirst: true}); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out.Bytes(), data) {
+		t.Error("a trailing size 0 box should be written unchanged")
+	}
+
+	// a size 0 box moved ahead of another box gets an explicit size
+
+	plan := []*plannedBox{
+		{topLevelBox: topLevelBox{Header: &Header{Size: 0, Type: BoxType{'m', 'd', 'a', 't'}, Offset: 100}, size: 50}},
+		{topLevelBox: topLevelBox{Header: &Header{Size: 20, Type: FtypBoxType, Offset: 0}, size: 20}},
+	}
+	plan[0].explicitSize = true
+	relocations := layoutRewrite(plan)
+	if len(relocations) != 2 || relocations[0] != (relocation{from: 108, size: 42, to: 8}) {
+		t.Errorf("got relocations %+v", relocations)
+	}
+}
+
+func TestRewriteFileSizeZeroMoov(t *testing.T) {
+	ftyp := box("ftyp", []byte("isom"), u32(0), []byte("isomdby1"))
+	data := buildChunked(t, func(offsets []uint64) []byte {
+		moov := box("moov", box("free", make([]byte, 4)), strippedTrak(stco(uint32(offsets[0]), uint32(offsets[1]), uint32(offsets[2]))))
+		binary.BigEndian.PutUint32(moov, 0)
+		return bytes.Join([][]byte{ftyp, mdatWithChunks(), moov}, nil)
+	})
+	assertChunksIntact(t, data)
+
+	for _, opts := range []rewriteOptions{{StripFree: true}, {MoovFirst: true}, {Canonical: true}} {
+		var out bytes.Buffer
+		if _, err := rewriteFile(&out, bytes.NewReader(data), opts); err != nil {
+			t.Fatalf("%+v: %v", opts, err)
+		}
+		want := "[ftyp mdat moov]"
+		if opts.MoovFirst {
+			want = "[ftyp moov mdat]"
+		}
+		if got := topLevelTypes(t, out.Bytes()); fmt.Sprint(got) != want {
+			t.Errorf("%+v: got order %v, want %s", opts, got, want)
+		}
+		assertChunksIntact(t, out.Bytes())
+	}
+}
+
+func TestRewriteFileFragmented(t *testing.T) {
+	ismv := smoothStreamingMovie()
+	boxes, err := readTopLevelBoxes(bytes.NewReader(ismv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mfra := boxes[len(boxes)-1]
+	plain := movie(trak(visualSampleEntry("dvhe", 1920, 1080)))
+	tests := []struct {
+		name string
+		data []byte
+		at   int64
+	}{
+		{"moof and mfra", ismv, boxes[2].Offset},
+		{"mfra only", append(plain, ismv[mfra.Offset:]...), int64(len(plain))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, opts := range []rewriteOptions{{StripFree: true}, {MoovFirst: true}, {Canonical: true}, duplicateOptions()} {
+				var out bytes.Buffer
+				_, err := rewriteFile(&out, bytes.NewReader(tt.data), opts)
+				if !errors.Is(err, errFragmentedRewrite) {
+					t.Fatalf("%+v: got error %v, want %v", opts, err, errFragmentedRewrite)
+				}
+				if want := fmt.Sprintf("at %d(%#x)", tt.at, tt.at); !strings.Contains(err.Error(), want) {
+					t.Errorf("error %q does not tell the offset %s", err, want)
+				}
+				if out.Len() != 0 {
+					t.Errorf("%+v: wrote %d bytes", opts, out.Len())
+				}
+			}
+		})
+	}
+}
+
+func TestUpgradeChunkOffsets(t *testing.T) {
+	// Bytes after the offset table are kept, as rewriteChunkOffsets does.
+	trailing := []byte("tail")
+	tree := &Box{Type: StcoBoxType, Fields: append(stco(10, 20)[8:], trailing...)}
+	relocations := []relocation{{from: 0, size: 100, to: math.MaxUint32 - 15}}
+
+	upgraded, err := upgradeChunkOffsets(tree, relocations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !upgraded || tree.Type != Co64BoxType {
+		t.Fatalf("expected stco to be upgraded to co64, got %s", tree.Type)
+	}
+	if err = rewriteChunkOffsets(tree, relocations); err != nil {
+		t.Fatal(err)
+	}
+	if got := binary.BigEndian.Uint64(tree.Fields[8:]); got != math.MaxUint32-5 {
+		t.Errorf("got first offset %d", got)
+	}
+	if got := binary.BigEndian.Uint64(tree.Fields[16:]); got != math.MaxUint32+5 {
+		t.Errorf("got second offset %d", got)
+	}
+
+	if !bytes.Equal(tree.Fields[24:], trailing) {
+		t.Errorf("got trailing bytes %q, want %q", tree.Fields[24:], trailing)
+	}
+
+	if upgraded, err = upgradeChunkOffsets(tree, relocations); err != nil || upgraded {
+		t.Errorf("co64 should not be upgraded again, got %v %v", upgraded, err)
+	}
+}
+
+// largeHeaders counts the boxes of data, at any depth known to Walk, that use
+// a 64-bit size field or size 0.
+func largeHeaders(t *testing.T, data []byte) (n int) {
+	t.Helper()
+	counter := &headerSizeCounter{}
+	if err := Walk(bytes.NewReader(data), counter); err != nil {
+		t.Fatal(err)
+	}
+	return counter.n
+}
+
+type headerSizeCounter struct{ n int }
+
+func (c *headerSizeCounter) EnterBox(path []BoxType, h Header) (bool, error) {
+	if h.Size == 0 || h.Size == 1 {
+		c.n++
+	}
+	return true, nil
+}
+
+func (c *headerSizeCounter) LeaveBox(path []BoxType, h Header) error {
+	return nil
+}
+
+func TestRewriteFileCanonical(t *testing.T) {
+	ftyp := box("ftyp", []byte("isom"), u32(0), []byte("isomdby1"))
+	tests := []struct {
+		name  string
+		build func(offsets []uint64) []byte
+	}{
+		{
+			name: "64-bit moov, trak and sample entry before 64-bit mdat",
+			build: func(offsets []uint64) []byte {
+				return bytes.Join([][]byte{
+					ftyp,
+					largeBox(box("moov", largeBox(box("trak", box("mdia", box("minf", box("stbl",
+						stsd(largeBox(visualSampleEntry("dvhe", 1920, 1080))),
+						stco(uint32(offsets[0]), uint32(offsets[1]), uint32(offsets[2])),
+					))))))),
+					largeBox(mdatWithChunks()),
+				}, nil)
+			},
+		},
+		{
+			name: "size 0 mdat after 64-bit moov with co64",
+			build: func(offsets []uint64) []byte {
+				mdat := mdatWithChunks()
+				binary.BigEndian.PutUint32(mdat, 0)
+				return bytes.Join([][]byte{
+					ftyp,
+					largeBox(box("moov", strippedTrak(co64(offsets...)))),
+					mdat,
+				}, nil)
+			},
+		},
+		{
+			name: "64-bit mdat before moov",
+			build: func(offsets []uint64) []byte {
+				return bytes.Join([][]byte{
+					ftyp,
+					largeBox(mdatWithChunks()),
+					box("moov", strippedTrak(stco(uint32(offsets[0]), uint32(offsets[1]), uint32(offsets[2])))),
+				}, nil)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := buildChunked(t, tt.build)
+			assertChunksIntact(t, data)
+			if largeHeaders(t, data) == 0 {
+				t.Fatal("fixture has no header to canonicalize")
+			}
+
+			var out bytes.Buffer
+			written, err := rewriteFile(&out, bytes.NewReader(data), rewriteOptions{Canonical: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if written != int64(out.Len()) {
+				t.Errorf("reported %d bytes written, got %d", written, out.Len())
+			}
+			if n := largeHeaders(t, out.Bytes()); n != 0 {
+				t.Errorf("%d boxes still use a 64-bit or size 0 header", n)
+			}
+			if out.Len() >= len(data) {
+				t.Errorf("canonical file is %d bytes, original %d", out.Len(), len(data))
+			}
+			assertChunksIntact(t, out.Bytes())
+			problems, err := validate(bytes.NewReader(out.Bytes()), int64(out.Len()))
+			if err != nil || len(problems) > 0 {
+				t.Errorf("canonical file is invalid: %v %v", problems, err)
+			}
+		})
+	}
+}
+
+// onlyWriter hides the io.ReaderFrom of a writer so copies go through the
+// rewrite buffer.
+type onlyWriter struct{ io.Writer }
+
+// BenchmarkRewriteFileMemory remuxes files with moov after a large mdat. The
+// bytes allocated per operation stay the same whatever the size of mdat, as
+// the media data is streamed through the rewrite buffer.
+func BenchmarkRewriteFileMemory(b *testing.B) {
+	ftyp := box("ftyp", []byte("isom"), u32(0), []byte("isomdby1"))
+	for _, mdatSize := range []int{16 << 20, 64 << 20} {
+		data := bytes.Join([][]byte{
+			ftyp,
+			box("mdat", make([]byte, mdatSize)),
+			box("moov", strippedTrak(stco(uint32(len(ftyp)+8)))),
+		}, nil)
+		f := writeTempFile(b, data)
+		for _, bufferSize := range []int{32 << 10, defaultRewriteBufferSize} {
+			b.Run(fmt.Sprintf("mdat=%dMiB/buffer=%dKiB", mdatSize>>20, bufferSize>>10), func(b *testing.B) {
+				b.ReportAllocs()
+				b.SetBytes(int64(len(data)))
+				for i := 0; i < b.N; i++ {
+					if _, err := rewriteFile(onlyWriter{io.Discard}, f, rewriteOptions{MoovFirst: true, BufferSize: bufferSize}); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
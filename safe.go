@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// dolbyVisionProfiles lists the Dolby Vision profiles carried by HEVC and
+// AVC sample entries.
+var dolbyVisionProfiles = map[uint8]bool{4: true, 5: true, 7: true, 8: true, 9: true, 20: true}
+
+// dolbyVisionConfigProblem tells what makes the Dolby Vision configuration of
+// entry unusable, or returns "" for a dvcC or dvvC players can rely on:
+// version 1, a known profile and level, and an RPU with a base or
+// enhancement layer.
+func dolbyVisionConfigProblem(entry *SampleEntryInfo) string {
+	c := entry.DolbyVision
+	switch {
+	case c == nil:
+		return "no dvcC or dvvC configuration"
+	case c.VersionMajor != 1:
+		return fmt.Sprintf("configuration version %d.%d is unknown", c.VersionMajor, c.VersionMinor)
+	case !dolbyVisionProfiles[c.Profile]:
+		return fmt.Sprintf("profile %d is unknown", c.Profile)
+	case c.Level < 1 || c.Level > 13:
+		return fmt.Sprintf("level %d is invalid", c.Level)
+	case !c.RPUPresent:
+		return "configuration declares no RPU"
+	case !c.BLPresent && !c.ELPresent:
+		return "configuration declares neither a base nor an enhancement layer"
+	}
+	return ""
+}
+
+// unsafeReasons tells, for -safe, why converting mp4file could break its
+// playback: a -from sample entry without a valid Dolby Vision configuration,
+// for Dolby Vision codecs, or without its parameter sets in hvcC where -to
+// requires them out-of-band, or the file being encrypted. It composes the
+// checks of advise, of converting and of protection detection.
+func unsafeReasons(mp4file string) (reasons []string, err error) {
+	var info *FileInfo
+	if info, err = inspectFile(mp4file); err != nil {
+		return nil, fmt.Errorf(`[unsafeReasons] %w`, err)
+	}
+	if info.Protected {
+		reasons = append(reasons, "encrypted, renaming does not help players unable to decrypt it")
+	}
+
+	// Offsets of entries are relative to the file opened as inspectFile
+	// does, after the -strip-prefix bytes.
+	var f io.ReadSeekCloser
+	defer func() {
+		if f != nil {
+			f.Close()
+		}
+	}()
+	dolbyVision := strings.HasPrefix(codecFamilies[codecFrom], "Dolby Vision")
+	for i, track := range info.Tracks {
+		for j, entry := range track.SampleEntries {
+			if !matchesFrom(entry.Codec) {
+				continue
+			}
+			reason := func(format string, args ...any) {
+				reasons = append(reasons, fmt.Sprintf("track %d entry %d (%s): ", i+1, j+1, entry.Codec)+fmt.Sprintf(format, args...))
+			}
+			if problem := dolbyVisionConfigProblem(&entry); dolbyVision && problem != "" {
+				reason("%s", problem)
+			}
+			if !needsParameterSets(codecFrom, codecTo) {
+				continue
+			}
+			if f == nil {
+				var r io.ReadSeekCloser
+				if r, err = openForInspection(mp4file); err != nil {
+					return nil, fmt.Errorf(`[unsafeReasons] %w`, err)
+				}
+				if f, err = skipPrefix(r, mp4file); err != nil {
+					r.Close()
+					return nil, fmt.Errorf(`[unsafeReasons] %w`, err)
+				}
+			}
+			var h *Header
+			if _, err = f.Seek(entry.Offset, io.SeekStart); err != nil {
+				return nil, fmt.Errorf(`[unsafeReasons] failed to seek: %w`, err)
+			}
+			if h, err = readBoxHeader(f); err != nil {
+				return nil, fmt.Errorf(`[unsafeReasons] failed reading sample entry at %d(%#x): %w`, entry.Offset, entry.Offset, err)
+			}
+			if err = checkParameterSets(f, h); errors.Is(err, errInBandParameterSets) {
+				reason("parameter sets are not all out-of-band in hvcC, as %s requires", codecTo)
+			} else if err != nil {
+				return nil, fmt.Errorf(`[unsafeReasons] %w`, err)
+			}
+		}
+	}
+	return reasons, nil
+}
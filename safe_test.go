@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// dvcC builds a Dolby Vision configuration of version 1.0 with an RPU and a
+// base layer.
+func dvcC(profile, level uint8) []byte {
+	return box("dvcC", []byte{1, 0}, u16(uint16(profile)<<9|uint16(level)<<3|0x5), []byte{0x10}, make([]byte, 19))
+}
+
+func TestConvertFileSafe(t *testing.T) {
+	withCodecs(t, "dvhe", "dvh1")
+	t.Cleanup(func() { safe = false })
+	safe = true
+	pssh := fullBox("pssh", 0, 0, make([]byte, 16), u32(0))
+
+	for name, test := range map[string]struct {
+		data []byte
+
+		// reasons the file is skipped for, none if it converts
+		reasons []string
+	}{
+		"safe":          {movie(trak(visualSampleEntry("dvhe", 1920, 1080, hvcC(), dvcC(8, 6)))), nil},
+		"no dvcC":       {movie(trak(visualSampleEntry("dvhe", 1920, 1080, hvcC()))), []string{"entry 1 (dvhe): no dvcC or dvvC"}},
+		"blank dvcC":    {movie(trak(visualSampleEntry("dvhe", 1920, 1080, hvcC(), box("dvcC", make([]byte, 24))))), []string{"version 0.0 is unknown"}},
+		"unknown level": {movie(trak(visualSampleEntry("dvhe", 1920, 1080, hvcC(), dvcC(5, 0)))), []string{"level 0 is invalid"}},
+		"in-band only":  {movie(trak(visualSampleEntry("dvhe", 1920, 1080, dvcC(8, 6)))), []string{"parameter sets are not all out-of-band in hvcC, as dvh1 requires"}},
+		"encrypted":     {movie(trak(visualSampleEntry("dvhe", 1920, 1080, hvcC(), dvcC(8, 6))), pssh), []string{"encrypted"}},
+		"every problem": {movie(trak(visualSampleEntry("dvhe", 1920, 1080)), pssh), []string{"encrypted", "no dvcC", "not all out-of-band"}},
+		"second track":  {movie(trak(visualSampleEntry("dvhe", 1920, 1080, hvcC(), dvcC(8, 6))), trak(visualSampleEntry("dvhe", 1920, 1080, hvcC()))), []string{"track 2 entry 1"}},
+		"other codec":   {movie(trak(visualSampleEntry("hvc1", 1920, 1080))), nil},
+	} {
+		t.Run(name, func(t *testing.T) {
+			mp4file := filepath.Join(t.TempDir(), "movie.mp4")
+			if err := os.WriteFile(mp4file, test.data, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			result := convertFile(context.Background(), mp4file)
+			takeChanges()
+			got, err := os.ReadFile(mp4file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.reasons == nil {
+				if result.Status == statusSkipped || result.Err != nil {
+					t.Errorf("got status %s and error %v, want converted", result.Status, result.Err)
+				}
+				return
+			}
+			if result.Status != statusSkipped || !bytes.Equal(got, test.data) {
+				t.Fatalf("got status %s and error %v, want skipped and the file untouched", result.Status, result.Err)
+			}
+			for _, reason := range test.reasons {
+				if !strings.Contains(result.Reason, reason) {
+					t.Errorf("got reason %q, want it to mention %q", result.Reason, reason)
+				}
+			}
+		})
+	}
+}
+
+func TestConvertFileSafeStripPrefix(t *testing.T) {
+	withCodecs(t, "dvhe", "dvh1")
+	t.Cleanup(func() { safe, stripPrefix = false, 0 })
+	safe, stripPrefix = true, 3
+
+	data := append([]byte("\xef\xbb\xbf"), movie(trak(visualSampleEntry("dvhe", 1920, 1080, hvcC(), dvcC(8, 6))))...)
+	mp4file := filepath.Join(t.TempDir(), "movie.mp4")
+	if err := os.WriteFile(mp4file, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	result := convertFile(context.Background(), mp4file)
+	takeChanges()
+	if result.Status == statusSkipped || result.Err != nil {
+		t.Errorf("got status %s, reason %q and error %v, want converted", result.Status, result.Reason, result.Err)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+)
+
+// sampleFiles picks sampleSize files, either the first ones or, with
+// -sample-random, a random selection kept in the original order.
+func sampleFiles(mp4files []string) []string {
+	if sampleSize <= 0 || sampleSize >= len(mp4files) {
+		return mp4files
+	}
+	if !sampleRandom {
+		return mp4files[:sampleSize]
+	}
+	picked := rand.Perm(len(mp4files))[:sampleSize]
+	sort.Ints(picked)
+	sampled := make([]string, len(picked))
+	for i, p := range picked {
+		sampled[i] = mp4files[p]
+	}
+	return sampled
+}
+
+// printSampleSummary reports how many of the sampled files contain each codec.
+func printSampleSummary(infos []*FileInfo, total int) {
+	counts := map[string]int{}
+	for _, info := range infos {
+		seen := map[string]bool{}
+		for _, track := range info.Tracks {
+			for _, codec := range track.Codecs {
+				if !seen[codec] {
+					seen[codec] = true
+					counts[codec]++
+				}
+			}
+		}
+	}
+
+	codecs := make([]string, 0, len(counts))
+	for codec := range counts {
+		codecs = append(codecs, codec)
+	}
+	sort.Slice(codecs, func(i, j int) bool {
+		if counts[codecs[i]] != counts[codecs[j]] {
+			return counts[codecs[i]] > counts[codecs[j]]
+		}
+		return codecs[i] < codecs[j]
+	})
+
+	parts := make([]string, len(codecs))
+	for i, codec := range codecs {
+		parts[i] = fmt.Sprintf("%s: %d", codec, counts[codec])
+	}
+	fmt.Printf("Sampled %d of %d files, files per codec: %s\n", len(infos), total, strings.Join(parts, ", "))
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestSampleFiles(t *testing.T) {
+	t.Cleanup(func() { sampleSize, sampleRandom = 0, false })
+	files := []string{"a.mp4", "b.mp4", "c.mp4", "d.mp4", "e.mp4"}
+
+	for _, n := range []int{0, 5, 7} {
+		sampleSize = n
+		if got := sampleFiles(files); !slices.Equal(got, files) {
+			t.Errorf("-sample %d: got %v, want every file", n, got)
+		}
+	}
+
+	sampleSize = 2
+	if got := sampleFiles(files); !slices.Equal(got, files[:2]) {
+		t.Errorf("got %v, want the first 2 files", got)
+	}
+
+	sampleRandom = true
+	picked := map[string]bool{}
+	for i := 0; i < 100; i++ {
+		got := sampleFiles(files)
+		if len(got) != 2 || !slices.IsSortedFunc(got, func(a, b string) int { return slices.Index(files, a) - slices.Index(files, b) }) || got[0] == got[1] {
+			t.Fatalf("got %v, want 2 distinct files in their original order", got)
+		}
+		picked[got[0]], picked[got[1]] = true, true
+	}
+	if len(picked) < 3 {
+		t.Errorf("only picked %v in 100 random samples", picked)
+	}
+}
+
+func TestPrintSampleSummary(t *testing.T) {
+	infos := []*FileInfo{
+		{Tracks: []TrackInfo{{Codecs: []string{"dvhe", "dvhe"}}, {Codecs: []string{"mp4a"}}}},
+		{Tracks: []TrackInfo{{Codecs: []string{"hvc1"}}, {Codecs: []string{"mp4a"}}}},
+		{Tracks: []TrackInfo{{Codecs: []string{"dvhe"}}, {Codecs: []string{"ec-3"}}}},
+	}
+	printed := captureStdout(t, func() { printSampleSummary(infos, 10) })
+	if want := "Sampled 3 of 10 files, files per codec: dvhe: 2, mp4a: 2, ec-3: 1, hvc1: 1\n"; printed != want {
+		t.Errorf("printed %q, want %q", printed, want)
+	}
+}
+
+func TestRunListSample(t *testing.T) {
+	withFlagDefaults(t)
+	t.Cleanup(func() { sampleSize, sampleRandom = 0, false })
+	dir := t.TempDir()
+	var files []string
+	for i, codec := range []string{"dvhe", "hvc1", "dvhe"} {
+		mp4file := filepath.Join(dir, fmt.Sprintf("%d.mp4", i))
+		if err := os.WriteFile(mp4file, movie(trak(visualSampleEntry(codec, 1920, 1080))), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, mp4file)
+	}
+
+	flag.CommandLine = flag.NewFlagSet("mp4dovi", flag.ContinueOnError)
+	args := parseArgs(append([]string{"list", "-sample", "2"}, files...))
+	printed := captureStdout(t, func() {
+		if err := runList(context.Background(), args); err != nil {
+			t.Fatal(err)
+		}
+	})
+	want := fmt.Sprintf("%s: dvhe\n%s: hvc1\nSampled 2 of 3 files, files per codec: dvhe: 1, hvc1: 1\n", files[0], files[1])
+	if printed != want {
+		t.Errorf("printed %q, want %q", printed, want)
+	}
+}
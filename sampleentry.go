@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// SampleEntry is a sample entry found by ForEachSampleEntry.
+type SampleEntry struct {
+	Header
+
+	// Track is the index of the trak holding the entry, counting from 0 in
+	// file order, and Index its position in the stsd box
+	Track int
+	Index int
+}
+
+// sampleEntryVisitor walks down to the sample entries of every trak.
+type sampleEntryVisitor struct {
+	rw    io.ReadWriteSeeker
+	fn    func(entry SampleEntry, patch func(newType BoxType) error) error
+	track int
+	index int
+}
+
+func (v *sampleEntryVisitor) EnterBox(path []BoxType, h Header) (descend bool, err error) {
+	switch h.Type {
+	case MoovBoxType, MdiaBoxType, MinfBoxType, StblBoxType:
+		return true, nil
+	case TrakBoxType:
+		v.track++
+		return true, nil
+	case StsdBoxType:
+		v.index = 0
+		return len(path) >= 2 && path[len(path)-2] == StblBoxType, nil
+	}
+	if len(path) < 2 || path[len(path)-2] != StsdBoxType {
+		return false, nil
+	}
+
+	entry := SampleEntry{Header: h, Track: v.track - 1, Index: v.index}
+	v.index++
+	patch := func(newType BoxType) (err error) {
+		var cur int64
+		if cur, err = v.rw.Seek(0, io.SeekCurrent); err != nil {
+			return fmt.Errorf(`[ForEachSampleEntry] failed to seek: %w`, err)
+		}
+		typeOffset := h.Offset + int64(getHeaderSize(&h)) + getHeaderTypeOffset(&h)
+		if _, err = v.rw.Seek(typeOffset, io.SeekStart); err != nil {
+			return fmt.Errorf(`[ForEachSampleEntry] failed to seek: %w`, err)
+		}
+		if _, err = v.rw.Write(newType[:]); err != nil {
+			return fmt.Errorf(`[ForEachSampleEntry] failed to write box header type "%s": %w`, newType, err)
+		}
+		if _, err = v.rw.Seek(cur, io.SeekStart); err != nil {
+			return fmt.Errorf(`[ForEachSampleEntry] failed to seek: %w`, err)
+		}
+		return nil
+	}
+	if err = v.fn(entry, patch); err != nil {
+		return false, err
+	}
+	return false, nil
+}
+
+func (v *sampleEntryVisitor) LeaveBox(path []BoxType, h Header) error {
+	return nil
+}
+
+// ForEachSampleEntry calls fn for every sample entry in the stsd boxes of all
+// traks of rw, in file order. patch changes the FourCC of the entry in place;
+// it may be called at most once per entry, since entry still holds the type
+// read from the file. fn is called with the reader positioned at the start of
+// the entry payload and may read from it, for example to parse the child
+// configuration boxes before deciding whether to patch. An error returned by
+// fn stops the walk and is returned wrapped.
+func ForEachSampleEntry(rw io.ReadWriteSeeker, fn func(entry SampleEntry, patch func(newType BoxType) error) error) error {
+	if _, err := rw.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf(`[ForEachSampleEntry] failed to seek: %w`, err)
+	}
+	if err := Walk(rw, &sampleEntryVisitor{rw: rw, fn: fn}); err != nil {
+		return fmt.Errorf(`[ForEachSampleEntry] %w`, err)
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func ExampleForEachSampleEntry() {
+	f := &memFile{data: movie(
+		trak(visualSampleEntry("dvhe", 1920, 1080), visualSampleEntry("hev1", 1920, 1080)),
+		trak(visualSampleEntry("dvhe", 3840, 2160)),
+	)}
+
+	// Only convert the Dolby Vision entry of the second track.
+	err := ForEachSampleEntry(f, func(entry SampleEntry, patch func(BoxType) error) error {
+		fmt.Println(entry.Track, entry.Index, entry.Type)
+		if entry.Track == 1 && entry.Type == (BoxType{'d', 'v', 'h', 'e'}) {
+			return patch(BoxType{'d', 'v', 'h', '1'})
+		}
+		return nil
+	})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	info, _ := inspect(bytes.NewReader(f.data))
+	for _, track := range info.Tracks {
+		fmt.Println(track.Codecs)
+	}
+	// Output:
+	// 0 0 dvhe
+	// 0 1 hev1
+	// 1 0 dvhe
+	// [dvhe hev1]
+	// [dvh1]
+}
+
+func TestForEachSampleEntryPatchLargeHeader(t *testing.T) {
+	data := movie(trak(largeBox(visualSampleEntry("hev1", 1920, 1080)), visualSampleEntry("avc1", 640, 360)))
+	original := append([]byte{}, data...)
+	at := bytes.Index(original, []byte("hev1"))
+
+	f := &memFile{data: data}
+	var seen []string
+	err := ForEachSampleEntry(f, func(entry SampleEntry, patch func(BoxType) error) error {
+		seen = append(seen, entry.Type.String())
+		if entry.Type.String() == "hev1" {
+			return patch(BoxType{'h', 'v', 'c', '1'})
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(seen) != "[hev1 avc1]" {
+		t.Errorf("visited %v, want [hev1 avc1]", seen)
+	}
+	if got := fmt.Sprint(diffOffsets(original, f.data)); got != fmt.Sprint([]int{at + 1, at + 2}) {
+		t.Errorf("changed bytes at %s", got)
+	}
+}
+
+func TestForEachSampleEntryStops(t *testing.T) {
+	errDone := errors.New("done")
+	calls := 0
+	err := ForEachSampleEntry(&memFile{data: movie(trak(visualSampleEntry("dvhe", 1, 1)), trak(visualSampleEntry("dvhe", 1, 1)))},
+		func(SampleEntry, func(BoxType) error) error {
+			calls++
+			return errDone
+		})
+	if !errors.Is(err, errDone) || calls != 1 {
+		t.Errorf("got %v after %d calls, want errDone after 1", err, calls)
+	}
+}
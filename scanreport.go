@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+)
+
+// containerBoundary compares the size a container declares with the space
+// taken by its header, its fields and the children found in it.
+type containerBoundary struct {
+	Path     string
+	Offset   int64
+	Declared uint64
+	Header   uint64
+	Fields   int64
+	Children uint64
+
+	// LargeSize is set for a 64-bit size field holding a size that fits 32 bits
+	LargeSize bool
+}
+
+// Unaccounted returns the bytes of the container not covered by its header,
+// fields and children, such as trailing padding or unparsed data.
+func (b *containerBoundary) Unaccounted() int64 {
+	return int64(b.Declared) - int64(b.Header) - b.Fields - int64(b.Children)
+}
+
+// scanReportVisitor measures every container descended into by Walk.
+type scanReportVisitor struct {
+	open       []*containerBoundary
+	boundaries []*containerBoundary
+}
+
+func (v *scanReportVisitor) EnterBox(path []BoxType, h Header) (descend bool, err error) {
+	if n := len(v.open); n > 0 && len(path) > 1 {
+		v.open[n-1].Children += getBoxSize(&h)
+	}
+	skip, ok := childOffset(path, &h)
+	if !ok || h.Type == MdatBoxType || (h.Size == 0 && len(path) == 1) {
+		return false, nil
+	}
+
+	types := make([]string, len(path))
+	for i, t := range path {
+		types[i] = t.String()
+	}
+	v.open = append(v.open, &containerBoundary{
+		Path:      strings.Join(types, "/"),
+		Offset:    h.Offset,
+		Declared:  getBoxSize(&h),
+		Header:    getHeaderSize(&h),
+		Fields:    skip,
+		LargeSize: h.Size == 1 && getBoxSize(&h) <= math.MaxUint32,
+	})
+	return true, nil
+}
+
+func (v *scanReportVisitor) LeaveBox(path []BoxType, h Header) error {
+	if n := len(v.open); n > 0 && v.open[n-1].Offset == h.Offset {
+		v.boundaries = append(v.boundaries, v.open[n-1])
+		v.open = v.open[:n-1]
+	}
+	return nil
+}
+
+// scanBoundaries returns the boundaries of every container of r in the order
+// they are closed, children before their parents.
+func scanBoundaries(r io.ReadSeeker) (boundaries []*containerBoundary, err error) {
+	v := &scanReportVisitor{}
+	if err = Walk(r, v); err != nil {
+		return nil, fmt.Errorf(`[scanBoundaries] %w`, err)
+	}
+	return v.boundaries, nil
+}
+
+// printScanReport prints the declared and parsed sizes of every container of
+// mp4file and returns the discrepancies, which may be corruption or box
+// extensions the tool does not know about.
+func printScanReport(mp4file string) (problems []string, err error) {
+	var (
+		r          *os.File
+		boundaries []*containerBoundary
+	)
+
+	if r, err = os.Open(mp4file); err != nil {
+		return nil, fmt.Errorf(`[printScanReport] cannot open file "%s": %w`, mp4file, err)
+	}
+	defer r.Close()
+
+	if boundaries, err = scanBoundaries(r); err != nil {
+		return nil, fmt.Errorf(`[printScanReport] %w`, err)
+	}
+	for _, b := range boundaries {
+		line := fmt.Sprintf("%s at %d(%#x): declared %d, header %d + fields %d + children %d", b.Path, b.Offset, b.Offset, b.Declared, b.Header, b.Fields, b.Children)
+		if unaccounted := b.Unaccounted(); unaccounted != 0 {
+			problems = append(problems, fmt.Sprintf("%s, %d bytes unaccounted", line, unaccounted))
+		}
+		if b.LargeSize {
+			problems = append(problems, fmt.Sprintf("%s at %d(%#x) uses a 64-bit size field for %d bytes", b.Path, b.Offset, b.Offset, b.Declared))
+		}
+		fmt.Printf("%s: %s\n", mp4file, line)
+	}
+	return
+}
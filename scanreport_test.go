@@ -0,0 +1,36 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestScanBoundaries(t *testing.T) {
+	data := movie(
+		box("udta", box("name", []byte("movie")), u32(0)),
+		largeBox(trak(visualSampleEntry("dvhe", 1920, 1080))),
+	)
+	boundaries, err := scanBoundaries(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, b := range boundaries {
+		got = append(got, fmt.Sprintf("%s %d %v", b.Path, b.Unaccounted(), b.LargeSize))
+	}
+	want := []string{
+		"moov/udta 4 false",
+		"moov/trak/mdia/minf/stbl/stsd/dvhe 0 false",
+		"moov/trak/mdia/minf/stbl/stsd 0 false",
+		"moov/trak/mdia/minf/stbl 0 false",
+		"moov/trak/mdia/minf 0 false",
+		"moov/trak/mdia 0 false",
+		"moov/trak 0 true",
+		"moov 0 false",
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got %q\nwant %q", got, want)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import "fmt"
+
+// Values of -scope, telling how far a file is converted.
+const (
+	scopeFirstEntry = "first-entry"
+	scopeFirstTrack = "first-track"
+	scopeAll        = "all"
+)
+
+// validateScope checks the value of -scope.
+func validateScope() error {
+	switch scope {
+	case scopeFirstEntry, scopeFirstTrack, scopeAll:
+		return nil
+	}
+	return fmt.Errorf(`[validateScope] unknown -scope "%s", want %s, %s or %s`, scope, scopeFirstEntry, scopeFirstTrack, scopeAll)
+}
+
+// scopeState follows the conversion of a file with -scope first-entry or
+// first-track, which stops renaming sample entries once the first one, or the
+// first track with one, has been changed. A nil scopeState converts
+// everything, as with -scope all, and is safe for concurrent use.
+type scopeState struct {
+	mode string
+
+	// done is set once the scope is exhausted
+	done         bool
+	trackChanged bool
+
+	changed int
+	skipped int
+}
+
+// newScopeState returns the state of a file conversion with -scope, nil for
+// -scope all.
+func newScopeState() *scopeState {
+	if scope == scopeAll {
+		return nil
+	}
+	return &scopeState{mode: scope}
+}
+
+// enterTrack is called before the sample entries of a track are handled.
+func (s *scopeState) enterTrack() {
+	if s != nil {
+		s.trackChanged = false
+	}
+}
+
+// leaveTrack is called after the sample entries of a track were handled.
+func (s *scopeState) leaveTrack() {
+	if s != nil && s.mode == scopeFirstTrack && s.trackChanged {
+		s.done = true
+	}
+}
+
+// entries wraps the handler of the sample entries of a track, leaving them
+// unchanged once the scope is exhausted.
+func (s *scopeState) entries(handler func(*Header) error) func(*Header) error {
+	if s == nil {
+		return handler
+	}
+	return func(h *Header) error {
+		if s.done {
+			if matchesFrom(h.Type.String()) {
+				s.skipped++
+				if verbose {
+					fmt.Printf("[scope] leaving sample entry %s at %d(%#x) unchanged (-scope %s)\n", h.Type, h.Offset, h.Offset, s.mode)
+				}
+			}
+			return nil
+		}
+		before := changeCount()
+		if err := handler(h); err != nil {
+			return err
+		}
+		if changeCount() > before {
+			s.changed++
+			s.trackChanged = true
+			if s.mode == scopeFirstEntry {
+				s.done = true
+			}
+		}
+		return nil
+	}
+}
+
+// report prints what was changed within the scope.
+func (s *scopeState) report() {
+	if s == nil {
+		return
+	}
+	fmt.Printf("Scope %s: changed %d sample entries, left %d %s sample entries unchanged\n", s.mode, s.changed, s.skipped, codecFrom)
+}
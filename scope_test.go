@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestConvertScope(t *testing.T) {
+	withCodecs(t, "dvhe", "dvh1")
+	t.Cleanup(func() { scope = scopeAll })
+	entry := visualSampleEntry("dvhe", 1920, 1080, hvcC(), box("dvcC", make([]byte, 24)))
+	data := movie(trak(visualSampleEntry("hev1", 1920, 1080, hvcC())), trak(entry, entry), trak(entry))
+
+	for _, test := range []struct {
+		scope string
+		want  string
+	}{
+		{scopeFirstEntry, "[[hev1] [dvh1 dvhe] [dvhe]]"},
+		{scopeFirstTrack, "[[hev1] [dvh1 dvh1] [dvhe]]"},
+		{scopeAll, "[[hev1] [dvh1 dvh1] [dvh1]]"},
+	} {
+		t.Run(test.scope, func(t *testing.T) {
+			scope = test.scope
+			takeChanges()
+			f := &memFile{data: append([]byte{}, data...)}
+			if err := convert(f); err != nil {
+				t.Fatal(err)
+			}
+			info, err := inspect(bytes.NewReader(f.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var codecs [][]string
+			for _, track := range info.Tracks {
+				codecs = append(codecs, track.Codecs)
+			}
+			if got := fmt.Sprint(codecs); got != test.want {
+				t.Errorf("got codecs %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestValidateScope(t *testing.T) {
+	t.Cleanup(func() { scope = scopeAll })
+	for value, valid := range map[string]bool{scopeFirstEntry: true, scopeFirstTrack: true, scopeAll: true, "first": false, "": false} {
+		scope = value
+		if err := validateScope(); (err == nil) != valid {
+			t.Errorf("-scope %q: got %v", value, err)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Boxes of Apple's stereo and spatial video, carried by the visual sample
+// entries of MV-HEVC streams next to their configuration boxes.
+var (
+	VexuBoxType = BoxType{'v', 'e', 'x', 'u'}
+	EyesBoxType = BoxType{'e', 'y', 'e', 's'}
+	CamsBoxType = BoxType{'c', 'a', 'm', 's'}
+	CmfyBoxType = BoxType{'c', 'm', 'f', 'y'}
+	ProjBoxType = BoxType{'p', 'r', 'o', 'j'}
+	StriBoxType = BoxType{'s', 't', 'r', 'i'}
+	HeroBoxType = BoxType{'h', 'e', 'r', 'o'}
+	BlinBoxType = BoxType{'b', 'l', 'i', 'n'}
+	DadjBoxType = BoxType{'d', 'a', 'd', 'j'}
+	PrjiBoxType = BoxType{'p', 'r', 'j', 'i'}
+	HfovBoxType = BoxType{'h', 'f', 'o', 'v'}
+)
+
+// Flags of the stri stereo view information.
+const (
+	striLeftEye          = 0x01
+	striRightEye         = 0x02
+	striAdditionalViews  = 0x04
+	striEyeViewsReversed = 0x08
+)
+
+// SpatialVideo describes the stereo views of a sample entry from its vexu
+// video extended usage box and its hfov box. Fields of boxes missing from
+// the entry are left zero.
+type SpatialVideo struct {
+	LeftEye          bool `json:"leftEye"`
+	RightEye         bool `json:"rightEye"`
+	AdditionalViews  bool `json:"additionalViews,omitempty"`
+	EyeViewsReversed bool `json:"eyeViewsReversed,omitempty"`
+
+	// HeroEye is the eye shown on 2D displays: "none", "left" or "right"
+	HeroEye string `json:"heroEye,omitempty"`
+
+	// Baseline is the distance between the camera centers in micrometers
+	Baseline uint32 `json:"baseline,omitempty"`
+
+	// DisparityAdjustment shifts the views horizontally, in 1/10000 of
+	// the image width
+	DisparityAdjustment int32 `json:"disparityAdjustment,omitempty"`
+
+	// Projection is the projection kind, such as rect or equi
+	Projection string `json:"projection,omitempty"`
+
+	// HorizontalFOV is the horizontal field of view in thousandths of a
+	// degree
+	HorizontalFOV uint32 `json:"horizontalFov,omitempty"`
+}
+
+// Eyes returns the eye views present, such as "left and right".
+func (s *SpatialVideo) Eyes() string {
+	switch {
+	case s.LeftEye && s.RightEye:
+		return "left and right"
+	case s.LeftEye:
+		return "left"
+	case s.RightEye:
+		return "right"
+	}
+	return "no"
+}
+
+// inVexu reports whether the box at the end of path is nested in the vexu box
+// of a sample entry.
+func inVexu(path []BoxType) bool {
+	for i := 0; i+2 < len(path)-1; i++ {
+		if path[i] == StsdBoxType && path[i+2] == VexuBoxType {
+			return true
+		}
+	}
+	return false
+}
+
+// readSpatialBox adds what the box h, the vexu or hfov box of a sample entry or
+// a box nested in vexu, tells to spatial. The reader must be positioned right
+// after the box header. descend is set for the containers of vexu.
+func readSpatialBox(r io.Reader, h *Header, spatial *SpatialVideo) (descend bool, err error) {
+	var fields struct {
+		VersionFlags uint32
+		Value        uint32
+	}
+	switch h.Type {
+	case VexuBoxType, EyesBoxType, CamsBoxType, CmfyBoxType, ProjBoxType:
+		return true, nil
+	case HfovBoxType:
+		if err = binary.Read(r, binary.BigEndian, &spatial.HorizontalFOV); err != nil {
+			return false, fmt.Errorf(`[readSpatialBox] failed reading field of view: %w`, err)
+		}
+		return false, nil
+	case StriBoxType, HeroBoxType:
+		var flags [5]byte
+		if _, err = io.ReadFull(r, flags[:]); err != nil {
+			return false, fmt.Errorf(`[readSpatialBox] failed reading %s: %w`, h.Type, err)
+		}
+		if h.Type == HeroBoxType {
+			spatial.HeroEye = map[byte]string{0: "none", 1: "left", 2: "right"}[flags[4]]
+			if spatial.HeroEye == "" {
+				spatial.HeroEye = fmt.Sprintf("unknown (%d)", flags[4])
+			}
+			return false, nil
+		}
+		spatial.LeftEye = flags[4]&striLeftEye != 0
+		spatial.RightEye = flags[4]&striRightEye != 0
+		spatial.AdditionalViews = flags[4]&striAdditionalViews != 0
+		spatial.EyeViewsReversed = flags[4]&striEyeViewsReversed != 0
+		return false, nil
+	case BlinBoxType, DadjBoxType, PrjiBoxType:
+		if err = binary.Read(r, binary.BigEndian, &fields); err != nil {
+			return false, fmt.Errorf(`[readSpatialBox] failed reading %s: %w`, h.Type, err)
+		}
+		switch h.Type {
+		case BlinBoxType:
+			spatial.Baseline = fields.Value
+		case DadjBoxType:
+			spatial.DisparityAdjustment = int32(fields.Value)
+		default:
+			spatial.Projection = BoxType{byte(fields.Value >> 24), byte(fields.Value >> 16), byte(fields.Value >> 8), byte(fields.Value)}.String()
+		}
+	}
+	return false, nil
+}
+
+// printSpatialVideo prints the stereo views of a sample entry, if any.
+func printSpatialVideo(entry *SampleEntryInfo) {
+	s := entry.Spatial
+	if s == nil {
+		return
+	}
+	var parts []string
+	if s.LeftEye || s.RightEye {
+		parts = append(parts, s.Eyes()+" eye views")
+	}
+	if s.EyeViewsReversed {
+		parts = append(parts, "reversed")
+	}
+	if s.HeroEye != "" {
+		parts = append(parts, "hero eye "+s.HeroEye)
+	}
+	if s.Baseline != 0 {
+		parts = append(parts, fmt.Sprintf("baseline %.3g mm", float64(s.Baseline)/1000))
+	}
+	if s.DisparityAdjustment != 0 {
+		parts = append(parts, fmt.Sprintf("disparity adjustment %.2f%%", float64(s.DisparityAdjustment)/100))
+	}
+	if s.Projection != "" {
+		parts = append(parts, "projection "+s.Projection)
+	}
+	if s.HorizontalFOV != 0 {
+		parts = append(parts, fmt.Sprintf("horizontal field of view %.3g°", float64(s.HorizontalFOV)/1000))
+	}
+	if len(parts) == 0 {
+		fmt.Printf("    %s: spatial video\n", entry.Codec)
+		return
+	}
+	fmt.Printf("    %s: spatial video, %s\n", entry.Codec, strings.Join(parts, ", "))
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func spatialEntry() []byte {
+	vexu := box("vexu",
+		box("eyes", fullBox("stri", 0, 0, []byte{striLeftEye | striRightEye}), fullBox("hero", 0, 0, []byte{1})),
+		box("cams", fullBox("blin", 0, 0, u32(63764))),
+		box("cmfy", fullBox("dadj", 0, 0, u32(200))),
+		box("proj", fullBox("prji", 0, 0, []byte("rect"))),
+	)
+	return visualSampleEntry("hvc1", 1920, 1080, hvcC(), box("lhvC", make([]byte, 8)), vexu, box("hfov", u32(63400)))
+}
+
+func TestInspectSpatialVideo(t *testing.T) {
+	info, err := inspect(bytes.NewReader(movie(trak(spatialEntry()))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := info.Tracks[0].SampleEntries[0]
+	want := &SpatialVideo{LeftEye: true, RightEye: true, HeroEye: "left", Baseline: 63764, DisparityAdjustment: 200, Projection: "rect", HorizontalFOV: 63400}
+	if !reflect.DeepEqual(entry.Spatial, want) {
+		t.Errorf("got spatial video %+v, want %+v", entry.Spatial, want)
+	}
+	if !reflect.DeepEqual(entry.Boxes, []string{"hvcC", "lhvC", "vexu", "hfov"}) {
+		t.Errorf("got boxes %v", entry.Boxes)
+	}
+	if entry.Spatial.Eyes() != "left and right" {
+		t.Errorf("got eyes %q", entry.Spatial.Eyes())
+	}
+
+	if _, err = readSpatialBox(bytes.NewReader([]byte{0, 0, 0}), &Header{Type: StriBoxType}, &SpatialVideo{}); err == nil {
+		t.Error("reading a truncated stri succeeded")
+	}
+}
+
+func TestSpatialBoxesAreKnown(t *testing.T) {
+	unknown, err := unknownBoxes(bytes.NewReader(movie(trak(spatialEntry()))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, h := range unknown {
+		t.Errorf("box %s reported unknown", h.Type)
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// maxStreamMoovSize bounds the moov box -stream holds in memory.
+const maxStreamMoovSize = 1 << 30
+
+// boxBuffer holds a box read into memory, read, written and seeked at the
+// offsets its bytes have in the file, so that the box can be converted as if
+// it was still in the file.
+type boxBuffer struct {
+	data []byte
+
+	// base is the offset of the first byte of data in the file
+	base int64
+	pos  int64
+}
+
+func (b *boxBuffer) Read(p []byte) (int, error) {
+	i := b.pos - b.base
+	if i < 0 || i >= int64(len(b.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, b.data[i:])
+	b.pos += int64(n)
+	return n, nil
+}
+
+// Write overwrites the bytes at the current offset, the size of the box being
+// fixed.
+func (b *boxBuffer) Write(p []byte) (int, error) {
+	i := b.pos - b.base
+	if i < 0 || i+int64(len(p)) > int64(len(b.data)) {
+		return 0, fmt.Errorf(`[boxBuffer] write of %d bytes at %d(%#x) outside the box at %d(%#x)`, len(p), b.pos, b.pos, b.base, b.base)
+	}
+	n := copy(b.data[i:], p)
+	b.pos += int64(n)
+	return n, nil
+}
+
+func (b *boxBuffer) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += b.pos
+	case io.SeekEnd:
+		offset += b.base + int64(len(b.data))
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf(`[boxBuffer] negative offset %d`, offset)
+	}
+	b.pos = offset
+	return offset, nil
+}
+
+// readStreamHeader reads the header of the box at offset from r, returning
+// it along with its raw bytes. err is io.EOF if r ends before the box.
+func readStreamHeader(r io.Reader, offset int64) (h *Header, raw []byte, err error) {
+	raw = make([]byte, 8, 16)
+	if _, err = io.ReadFull(r, raw); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			err = fmt.Errorf(`[readStreamHeader] stream ends in the box header at %d(%#x): %w`, offset, offset, err)
+		}
+		return nil, nil, err
+	}
+	h = &Header{Size: binary.BigEndian.Uint32(raw), Offset: offset}
+	copy(h.Type[:], raw[4:])
+	if h.Size == 1 {
+		raw = raw[:16]
+		if _, err = io.ReadFull(r, raw[8:]); err != nil {
+			if errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, nil, fmt.Errorf(`[readStreamHeader] failed reading 64-bit size at %d(%#x): %w`, offset, offset, err)
+		}
+		h.ExtendedSize = binary.BigEndian.Uint64(raw[8:])
+	}
+	if h.Size != 0 && getBoxSize(h) < getHeaderSize(h) {
+		return nil, nil, fmt.Errorf(`[readStreamHeader] invalid size %d for box "%s" at %d(%#x)`, getBoxSize(h), h.Type, offset, offset)
+	}
+	return h, raw, nil
+}
+
+// streamConvert copies src to dst in a single pass, converting the matching
+// sample entries of the first moov box, or of every one with -all-moov, on
+// the way. Only those moov boxes are held in memory, everything else is
+// copied through as it is read. Since converting only ever replaces FourCCs,
+// no offset changes and a moov after the media data is converted all the
+// same. The -strip-prefix bytes are dropped from the output.
+func streamConvert(dst io.Writer, src io.Reader) (err error) {
+	r := bufio.NewReader(src)
+	w := bufio.NewWriter(dst)
+	defer func() {
+		if flushErr := w.Flush(); flushErr != nil && err == nil {
+			err = fmt.Errorf(`[streamConvert] failed writing output: %w`, flushErr)
+		}
+	}()
+
+	if _, err = r.Discard(int(stripPrefix)); err != nil {
+		return fmt.Errorf(`[streamConvert] failed skipping the %d bytes of -strip-prefix: %w`, stripPrefix, err)
+	}
+	head, _ := r.Peek(prefixScanSize)
+	if p := detectPrefix(head); p != nil {
+		return fmt.Errorf(`[streamConvert] %w`, prefixError(p))
+	}
+
+	s := newScopeState()
+	moovs := 0
+	for offset := int64(0); ; {
+		var (
+			h   *Header
+			raw []byte
+		)
+		if h, raw, err = readStreamHeader(r, offset); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return fmt.Errorf(`[streamConvert] %w`, err)
+		}
+
+		if h.Type != MoovBoxType || (moovs > 0 && !allMoov) {
+			if _, err = w.Write(raw); err != nil {
+				return fmt.Errorf(`[streamConvert] failed writing output: %w`, err)
+			}
+			// A box of size 0 extends to the end of the stream.
+			if h.Size == 0 {
+				if _, err = io.Copy(w, r); err != nil {
+					return fmt.Errorf(`[streamConvert] failed copying box "%s" at %d(%#x): %w`, h.Type, offset, offset, err)
+				}
+				break
+			}
+			if _, err = io.CopyN(w, r, int64(getBoxSize(h))-int64(len(raw))); err != nil {
+				return fmt.Errorf(`[streamConvert] failed copying box "%s" at %d(%#x): %w`, h.Type, offset, offset, err)
+			}
+			offset += int64(getBoxSize(h))
+			continue
+		}
+
+		if h.Size == 0 || getBoxSize(h) > maxStreamMoovSize {
+			return fmt.Errorf(`[streamConvert] unsupported size %d for box "%s" at %d(%#x)`, getBoxSize(h), h.Type, offset, offset)
+		}
+		moov := &boxBuffer{data: make([]byte, getBoxSize(h)), base: offset}
+		copy(moov.data, raw)
+		if _, err = io.ReadFull(r, moov.data[len(raw):]); err != nil {
+			return fmt.Errorf(`[streamConvert] failed reading box "%s" at %d(%#x): %w`, h.Type, offset, offset, err)
+		}
+		since := changeCount()
+		if err = convertMoov(moov, h, s); err != nil {
+			return fmt.Errorf(`[streamConvert] %w`, err)
+		}
+		if limitChanges > 0 {
+			if err = enforceChangeLimit(moov, since); err != nil {
+				return fmt.Errorf(`[streamConvert] %w`, err)
+			}
+		}
+		if _, err = w.Write(moov.data); err != nil {
+			return fmt.Errorf(`[streamConvert] failed writing output: %w`, err)
+		}
+		moovs++
+		offset += int64(getBoxSize(h))
+	}
+	if moovs == 0 {
+		return fmt.Errorf(`[streamConvert] %w`, errIncompleteFile)
+	}
+	s.report()
+	return nil
+}
+
+// streamConflicts returns the options -stream cannot be combined with, since
+// they read the file several times or write other files.
+func streamConflicts() (conflicts []string) {
+	for _, option := range []struct {
+		name string
+		set  bool
+	}{
+		{"-atomic", atomicWrite || tempDir != ""},
+		{"-out-dir", outDir != ""},
+		{"-keep-original", keepOriginalFile},
+		{"-rename-on-change", renameOnChange != ""},
+		{"-repair", repair},
+		{"-strip-free", stripFree},
+		{"-remux", remux},
+		{"-canonical", canonical},
+		{"-add-entry", addEntry != ""},
+		{"-anywhere", anywhere},
+		{"-patch-at", patchAt >= 0},
+		{"-debug-crc", debugCRC},
+		{"-compat-brand-check", compatBrandCheck},
+		{"-if-brand", ifBrand != ""},
+		{"-only-codec", onlyCodec != ""},
+		{"-abort-on-unknown", abortOnUnknown},
+		{"-safe", safe},
+		{"-interactive", interactive},
+		{"-log-file", logFile != ""},
+	} {
+		if option.set {
+			conflicts = append(conflicts, option.name)
+		}
+	}
+	return
+}
+
+// runStream converts standard input to standard output for -stream. Messages
+// go to standard error, standard output carrying the converted file.
+func runStream() (err error) {
+	stdout := os.Stdout
+	os.Stdout = os.Stderr
+	defer func() { os.Stdout = stdout }()
+
+	takeChanges()
+	if err = streamConvert(stdout, os.Stdin); err != nil {
+		return fmt.Errorf(`[runStream] %w`, err)
+	}
+	fmt.Printf("Streamed standard input with %d changes\n", len(takeChanges()))
+	return nil
+}
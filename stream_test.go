@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+// onlyReader hides every method of its reader but Read, as for pipes.
+type onlyReader struct{ io.Reader }
+
+func TestStreamConvert(t *testing.T) {
+	withCodecs(t, "dvhe", "dvh1")
+	entry := visualSampleEntry("dvhe", 1920, 1080, hvcC(), box("dvcC", make([]byte, 24)))
+	moov := box("moov", trak(entry))
+	ftyp := box("ftyp", []byte("isom"), u32(0))
+
+	for name, data := range map[string][]byte{
+		"fast start":      bytes.Join([][]byte{ftyp, moov, box("mdat", make([]byte, 100))}, nil),
+		"moov after mdat": bytes.Join([][]byte{ftyp, largeBox(box("mdat", make([]byte, 100))), box("free"), moov}, nil),
+		"mdat to the end": bytes.Join([][]byte{ftyp, moov, u32(0), []byte("mdat"), make([]byte, 100)}, nil),
+	} {
+		t.Run(name, func(t *testing.T) {
+			want := &memFile{data: append([]byte{}, data...)}
+			if err := convert(want); err != nil {
+				t.Fatal(err)
+			}
+			var out bytes.Buffer
+			if err := streamConvert(&out, onlyReader{bytes.NewReader(data)}); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(out.Bytes(), want.data) {
+				t.Error("streamed output differs from the file converted in place")
+			}
+			if bytes.Equal(out.Bytes(), data) {
+				t.Error("nothing converted")
+			}
+		})
+	}
+}
+
+func TestStreamConvertErrors(t *testing.T) {
+	withCodecs(t, "dvhe", "dvh1")
+	data := movie(trak(visualSampleEntry("dvhe", 1920, 1080, hvcC(), box("dvcC", make([]byte, 24)))))
+	for name, test := range map[string]struct {
+		data []byte
+		want error
+	}{
+		"no moov":        {box("ftyp", []byte("isom")), errIncompleteFile},
+		"truncated mdat": {data[:len(data)-4], io.EOF},
+		"cut header":     {data[:len(data)-len(box("mdat", make([]byte, 16)))+3], io.ErrUnexpectedEOF},
+	} {
+		if err := streamConvert(io.Discard, bytes.NewReader(test.data)); !errors.Is(err, test.want) {
+			t.Errorf("%s: got %v, want %v", name, err, test.want)
+		}
+	}
+}
+
+func TestBoxBuffer(t *testing.T) {
+	b := &boxBuffer{data: []byte("0123456789"), base: 100}
+	if _, err := b.Seek(104, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Write([]byte("ab")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Write([]byte("cdefg")); err == nil {
+		t.Error("wrote past the end of the box")
+	}
+	got, err := io.ReadAll(io.NewSectionReader(readerAtFunc(func(p []byte, off int64) (int, error) {
+		b.Seek(off, io.SeekStart)
+		return b.Read(p)
+	}), 100, 10))
+	if err != nil || string(got) != "0123ab6789" {
+		t.Errorf("got %q, %v", got, err)
+	}
+	if _, err = b.Seek(50, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = b.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("got %v reading before the box, want io.EOF", err)
+	}
+}
+
+type readerAtFunc func(p []byte, off int64) (int, error)
+
+func (f readerAtFunc) ReadAt(p []byte, off int64) (int, error) { return f(p, off) }
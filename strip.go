@@ -0,0 +1,22 @@
+package main
+
+var (
+	FreeBoxType = BoxType{'f', 'r', 'e', 'e'}
+	SkipBoxType = BoxType{'s', 'k', 'i', 'p'}
+)
+
+// removeFreeBoxes drops free and skip boxes nested in plain containers below b.
+func removeFreeBoxes(b *Box) {
+	if !containerBoxTypes[b.Type] {
+		return
+	}
+	children := b.Children[:0]
+	for _, child := range b.Children {
+		if child.Type == FreeBoxType || child.Type == SkipBoxType {
+			continue
+		}
+		removeFreeBoxes(child)
+		children = append(children, child)
+	}
+	b.Children = children
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func stco(offsets ...uint32) []byte {
+	entries := make([][]byte, 0, len(offsets)+1)
+	entries = append(entries, u32(uint32(len(offsets))))
+	for _, offset := range offsets {
+		entries = append(entries, u32(offset))
+	}
+	return fullBox("stco", 0, 0, entries...)
+}
+
+func co64(offsets ...uint64) []byte {
+	entries := make([][]byte, 0, len(offsets)+1)
+	entries = append(entries, u32(uint32(len(offsets))))
+	for _, offset := range offsets {
+		entries = append(entries, u64(offset))
+	}
+	return fullBox("co64", 0, 0, entries...)
+}
+
+var chunkMarkers = [][]byte{[]byte("CHUNK0"), []byte("CHUNK1"), []byte("CHUNK2")}
+
+func mdatWithChunks() []byte {
+	return box("mdat", bytes.Join(chunkMarkers, make([]byte, 10)))
+}
+
+// buildChunked builds a file twice: once to find where the chunk markers end
+// up and once more with chunk offset tables pointing at them.
+func buildChunked(t *testing.T, build func(offsets []uint64) []byte) []byte {
+	t.Helper()
+	offsets := make([]uint64, len(chunkMarkers))
+	data := build(offsets)
+	for i, marker := range chunkMarkers {
+		offsets[i] = uint64(bytes.Index(data, marker))
+	}
+	return build(offsets)
+}
+
+// chunkOffsets returns all chunk offsets found in the moov box of data.
+func chunkOffsets(t *testing.T, data []byte) (offsets []uint64) {
+	t.Helper()
+	r := bytes.NewReader(data)
+	boxes, err := readTopLevelBoxes(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, b := range boxes {
+		if b.Type != MoovBoxType {
+			continue
+		}
+		if _, err = r.Seek(b.Offset+int64(getHeaderSize(b.Header)), 0); err != nil {
+			t.Fatal(err)
+		}
+		tree, err := readBoxTree(r, b.Header, b.size, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = tree.Visit(nil, func(path []BoxType, b *Box) error {
+			if b.Type != StcoBoxType && b.Type != Co64BoxType {
+				return nil
+			}
+			count := int(binary.BigEndian.Uint32(b.Fields[4:]))
+			for i := 0; i < count; i++ {
+				switch b.Type {
+				case StcoBoxType:
+					offsets = append(offsets, uint64(binary.BigEndian.Uint32(b.Fields[8+4*i:])))
+				case Co64BoxType:
+					offsets = append(offsets, binary.BigEndian.Uint64(b.Fields[8+8*i:]))
+				}
+			}
+			return nil
+		})
+	}
+	return
+}
+
+func assertChunksIntact(t *testing.T, data []byte) {
+	t.Helper()
+	offsets := chunkOffsets(t, data)
+	if len(offsets) != len(chunkMarkers) {
+		t.Fatalf("got %d chunk offsets, want %d", len(offsets), len(chunkMarkers))
+	}
+	for i, offset := range offsets {
+		marker := chunkMarkers[i]
+		if offset+uint64(len(marker)) > uint64(len(data)) || !bytes.Equal(data[offset:offset+uint64(len(marker))], marker) {
+			t.Errorf("chunk %d offset %d does not point at %q", i, offset, marker)
+		}
+	}
+}
+
+func strippedTrak(table []byte) []byte {
+	return box("trak", box("mdia", box("minf", box("stbl", stsd(visualSampleEntry("dvhe", 1920, 1080)), table))))
+}
+
+func TestRewriteFileStripFree(t *testing.T) {
+	ftyp := box("ftyp", []byte("isom"), u32(0), []byte("isomdby1"))
+	tests := []struct {
+		name  string
+		build func(offsets []uint64) []byte
+	}{
+		{
+			name: "stco with moov before mdat",
+			build: func(offsets []uint64) []byte {
+				return bytes.Join([][]byte{
+					ftyp,
+					box("free", make([]byte, 100)),
+					box("moov",
+						box("free", make([]byte, 7)),
+						strippedTrak(stco(uint32(offsets[0]), uint32(offsets[1]), uint32(offsets[2]))),
+						box("udta", box("skip", make([]byte, 3))),
+					),
+					box("skip", make([]byte, 50)),
+					mdatWithChunks(),
+				}, nil)
+			},
+		},
+		{
+			name: "co64 with moov before mdat",
+			build: func(offsets []uint64) []byte {
+				return bytes.Join([][]byte{
+					ftyp,
+					box("free", make([]byte, 20)),
+					box("moov", strippedTrak(co64(offsets...)), box("free", make([]byte, 1))),
+					mdatWithChunks(),
+				}, nil)
+			},
+		},
+		{
+			name: "moov after mdat",
+			build: func(offsets []uint64) []byte {
+				return bytes.Join([][]byte{
+					ftyp,
+					box("free", make([]byte, 33)),
+					mdatWithChunks(),
+					box("free", make([]byte, 5)),
+					box("moov", box("free", make([]byte, 9)), strippedTrak(stco(uint32(offsets[0]), uint32(offsets[1]), uint32(offsets[2])))),
+				}, nil)
+			},
+		},
+		{
+			name: "nothing to strip",
+			build: func(offsets []uint64) []byte {
+				return bytes.Join([][]byte{
+					ftyp,
+					box("moov", strippedTrak(stco(uint32(offsets[0]), uint32(offsets[1]), uint32(offsets[2])))),
+					mdatWithChunks(),
+				}, nil)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := buildChunked(t, tt.build)
+			assertChunksIntact(t, data)
+
+			var out bytes.Buffer
+			written, err := rewriteFile(&out, bytes.NewReader(data), rewriteOptions{StripFree: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if written != int64(out.Len()) {
+				t.Errorf("reported %d bytes written, output is %d bytes", written, out.Len())
+			}
+
+			counter := BoxCounter{}
+			if err = Walk(bytes.NewReader(out.Bytes()), counter); err != nil {
+				t.Fatal(err)
+			}
+			if counter[FreeBoxType] != 0 || counter[SkipBoxType] != 0 {
+				t.Errorf("output still has %d free and %d skip boxes", counter[FreeBoxType], counter[SkipBoxType])
+			}
+			assertChunksIntact(t, out.Bytes())
+		})
+	}
+}
+
+func TestRewriteFileStripFreeRejectsDanglingChunkOffset(t *testing.T) {
+	data := movie(strippedTrak(stco(3)))
+	var out bytes.Buffer
+	if _, err := rewriteFile(&out, bytes.NewReader(append(data, box("free")...)), rewriteOptions{StripFree: true}); err != nil {
+		t.Fatalf("offset into a retained box should relocate: %v", err)
+	}
+
+	data = bytes.Join([][]byte{box("free", make([]byte, 8)), box("moov", strippedTrak(stco(4)))}, nil)
+	if _, err := rewriteFile(&out, bytes.NewReader(data), rewriteOptions{StripFree: true}); err == nil {
+		t.Error("expected an error for a chunk offset pointing into a removed box")
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+)
+
+var StscBoxType = BoxType{'s', 't', 's', 'c'}
+
+// StscEntry maps a run of chunks, starting at FirstChunk up to the first chunk
+// of the next entry, to a sample description. Both are 1-based.
+type StscEntry struct {
+	FirstChunk             uint32
+	SamplesPerChunk        uint32
+	SampleDescriptionIndex uint32
+}
+
+// StscBox is a sample-to-chunk box, telling which sample description of the
+// stsd each chunk of a track uses.
+type StscBox struct {
+	Version uint8
+	Flags   uint32
+	Entries []StscEntry
+}
+
+// readStscBox parses a stsc payload of payloadSize bytes. The reader must be
+// positioned right after the box header.
+func readStscBox(r io.Reader, payloadSize int64) (*StscBox, error) {
+	var (
+		box   StscBox
+		count uint32
+		err   error
+	)
+	if box.Version, box.Flags, err = readFullBoxHeader(r); err != nil {
+		return nil, fmt.Errorf(`[readStscBox] failed reading version: %w`, err)
+	}
+	if err = binary.Read(r, binary.BigEndian, &count); err != nil {
+		return nil, fmt.Errorf(`[readStscBox] failed reading entry count: %w`, err)
+	}
+	if uint64(payloadSize-8) < uint64(count)*12 {
+		return nil, fmt.Errorf(`[readStscBox] %d bytes are too small for %d entries`, payloadSize, count)
+	}
+	box.Entries = make([]StscEntry, count)
+	if err = binary.Read(r, binary.BigEndian, box.Entries); err != nil {
+		return nil, fmt.Errorf(`[readStscBox] failed reading entries: %w`, err)
+	}
+	return &box, nil
+}
+
+// SampleDescriptions returns the distinct sample description indexes used
+// by the chunks of the track, in ascending order.
+func (b *StscBox) SampleDescriptions() []uint32 {
+	seen := make(map[uint32]bool)
+	var indexes []uint32
+	for _, entry := range b.Entries {
+		if !seen[entry.SampleDescriptionIndex] {
+			seen[entry.SampleDescriptionIndex] = true
+			indexes = append(indexes, entry.SampleDescriptionIndex)
+		}
+	}
+	sort.Slice(indexes, func(i, j int) bool { return indexes[i] < indexes[j] })
+	return indexes
+}
+
+// Uses reports whether any chunk uses the sample description at the 1-based
+// index of the stsd.
+func (b *StscBox) Uses(index uint32) bool {
+	for _, entry := range b.Entries {
+		if entry.SampleDescriptionIndex == index {
+			return true
+		}
+	}
+	return false
+}
+
+// findStsc reads the stsc of the track whose header is given. The position
+// of r is undefined afterwards.
+func findStsc(r io.ReadSeeker, trak *Header) (*StscBox, error) {
+	if _, err := r.Seek(trak.Offset+trak.HeaderLength(), io.SeekStart); err != nil {
+		return nil, fmt.Errorf(`[findStsc] failed to seek: %w`, err)
+	}
+	h, _, err := findStblChild(r, trak, StscBoxType)
+	if err != nil {
+		return nil, fmt.Errorf(`[findStsc] %w`, err)
+	}
+	stsc, err := readStscBox(r, h.PayloadSize())
+	if err != nil {
+		return nil, fmt.Errorf(`[findStsc] %w`, err)
+	}
+	return stsc, nil
+}
+
+// sampleDescriptionUsage reports how many sample descriptions the track holds
+// and which of them its chunks use, returning its stsc. Tracks whose stsc
+// cannot be read are reported but not failed, as the information is only
+// advisory, and nil is returned for them as for tracks without chunks.
+func sampleDescriptionUsage(r io.ReadSeeker, trak *Header, entryCount uint32) *StscBox {
+	stsc, err := findStsc(r, trak)
+	if err != nil {
+		fmt.Printf("Warning: track at %d(%#x) has %d sample descriptions, but which are used is unknown: %v\n", trak.Offset, trak.Offset, entryCount, err)
+		return nil
+	}
+	if len(stsc.Entries) == 0 {
+		// Fragmented files reference sample descriptions from their fragments.
+		fmt.Printf("Track at %d(%#x) has %d sample descriptions, used by its fragments\n", trak.Offset, trak.Offset, entryCount)
+		return nil
+	}
+	fmt.Printf("Track at %d(%#x) has %d sample descriptions, its chunks use %v\n", trak.Offset, trak.Offset, entryCount, stsc.SampleDescriptions())
+	return stsc
+}
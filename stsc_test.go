@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+// stscBox builds a sample-to-chunk box from first chunk, samples per chunk
+// and sample description index triples.
+func stscBox(entries ...[3]uint32) []byte {
+	payload := []byte{}
+	for _, e := range entries {
+		payload = append(payload, u32(e[0])...)
+		payload = append(payload, u32(e[1])...)
+		payload = append(payload, u32(e[2])...)
+	}
+	return fullBox("stsc", 0, 0, u32(uint32(len(entries))), payload)
+}
+
+func TestReadStscBox(t *testing.T) {
+	data := stscBox([3]uint32{1, 10, 2}, [3]uint32{5, 8, 2}, [3]uint32{9, 10, 3})
+	stsc, err := readStscBox(bytes.NewReader(data[8:]), int64(len(data)-8))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stsc.Entries) != 3 || stsc.Entries[1] != (StscEntry{FirstChunk: 5, SamplesPerChunk: 8, SampleDescriptionIndex: 2}) {
+		t.Errorf("got entries %+v", stsc.Entries)
+	}
+	if got := fmt.Sprint(stsc.SampleDescriptions()); got != "[2 3]" {
+		t.Errorf("got sample descriptions %s", got)
+	}
+	if stsc.Uses(1) || !stsc.Uses(2) || !stsc.Uses(3) {
+		t.Errorf("Uses disagrees with entries %+v", stsc.Entries)
+	}
+
+	if _, err = readStscBox(bytes.NewReader(data[8:]), int64(len(data)-8-12)); err == nil {
+		t.Error("expected an error for entries overrunning the box")
+	}
+}
+
+func TestConvertMultipleSampleDescriptions(t *testing.T) {
+	withCodecs(t, "dvhe", "dvh1")
+
+	entry := visualSampleEntry("dvhe", 1920, 1080, hvcC(), box("dvcC", make([]byte, 24)))
+	track := box("trak", box("mdia", box("minf", box("stbl", stsd(entry, entry), stscBox([3]uint32{1, 1, 2})))))
+	data := movie(track)
+
+	trakHeader := &Header{Offset: int64(bytes.Index(data, track)), Size: uint32(len(track)), Type: TrakBoxType}
+	stsc, err := findStsc(bytes.NewReader(data), trakHeader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(stsc.SampleDescriptions()); got != "[2]" {
+		t.Errorf("got sample descriptions %s", got)
+	}
+
+	// Unused sample descriptions are reported, but still converted.
+	f := &memFile{data: data}
+	if err = convert(f); err != nil {
+		t.Fatal(err)
+	}
+	if n := bytes.Count(f.data, []byte("dvh1")); n != 2 {
+		t.Errorf("converted %d sample entries, want 2", n)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// errStsdBounds is returned when the size of an stsd box does not match the
+// sample entries it claims to hold.
+var errStsdBounds = errors.New("stsd size inconsistent with its entry count")
+
+// stsdEntriesLimit returns the size of the sample entries of the stsd box h,
+// after its version, flags and entry count. A box too small for those is an
+// error, as a negative limit would let the sample entries run to the end of
+// the file. With -strict-stsd-bounds, entryCount entries must also fit, each
+// taking at least a box header.
+func stsdEntriesLimit(h *Header, entryCount uint32) (limit int64, err error) {
+	if limit = h.PayloadSize() - 8; limit < 0 {
+		return 0, fmt.Errorf(`[stsdEntriesLimit] stsd at %d(%#x) of %d bytes is too small for its entry count: %w`, h.Offset, h.Offset, getBoxSize(h), errStsdBounds)
+	}
+	if strictStsdBounds && int64(entryCount)*8 > limit {
+		return 0, fmt.Errorf(`[stsdEntriesLimit] stsd at %d(%#x) claims %d sample entries, more than its %d bytes of entries can hold: %w`, h.Offset, h.Offset, entryCount, limit, errStsdBounds)
+	}
+	return limit, nil
+}
+
+// checkStsdEntry checks, with -strict-stsd-bounds, that the sample entry
+// numbered index ends within the stsd box h and does not go past its entry
+// count.
+func checkStsdEntry(h, entry *Header, index, entryCount uint32) error {
+	if !strictStsdBounds {
+		return nil
+	}
+	if index > entryCount {
+		return fmt.Errorf(`[checkStsdEntry] sample entry %s at %d(%#x) is entry %d of an stsd claiming %d: %w`, entry.Type, entry.Offset, entry.Offset, index, entryCount, errStsdBounds)
+	}
+	if end := h.Offset + int64(getBoxSize(h)); entry.Size == 0 || entry.Offset+int64(getBoxSize(entry)) > end {
+		return fmt.Errorf(`[checkStsdEntry] sample entry %s at %d(%#x) of size %d ends past the stsd ending at %d(%#x): %w`, entry.Type, entry.Offset, entry.Offset, getBoxSize(entry), end, end, errStsdBounds)
+	}
+	return nil
+}
+
+// checkStsdEntryCount checks, with -strict-stsd-bounds, that the stsd box h
+// holds as many sample entries as it claims.
+func checkStsdEntryCount(h *Header, found, entryCount uint32) error {
+	if strictStsdBounds && found != entryCount {
+		return fmt.Errorf(`[checkStsdEntryCount] stsd at %d(%#x) holds %d sample entries but claims %d: %w`, h.Offset, h.Offset, found, entryCount, errStsdBounds)
+	}
+	return nil
+}
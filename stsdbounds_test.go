@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+// inconsistentStsd builds an stsd box claiming count sample entries while
+// holding entries.
+func inconsistentStsd(count uint32, entries ...[]byte) []byte {
+	return fullBox("stsd", 0, 0, append([][]byte{u32(count)}, entries...)...)
+}
+
+func TestStrictStsdBounds(t *testing.T) {
+	withCodecs(t, "dvhe", "dvh1")
+	entry := visualSampleEntry("dvhe", 1920, 1080, hvcC())
+	// An entry declaring 16 more bytes than the stsd has left for it
+	overlong := append(u32(uint32(len(entry)+16)), entry[4:]...)
+	// The stsc following stsd leaves bytes for an overlong entry to run into
+	stblOf := func(stsd []byte) []byte {
+		return movie(box("trak", box("mdia", box("minf", box("stbl", stsd, fullBox("stsc", 0, 0, u32(0), u64(0), u64(0)))))))
+	}
+
+	for name, test := range map[string]struct {
+		data []byte
+
+		// lenient is set if the file converts without -strict-stsd-bounds
+		lenient bool
+	}{
+		"fewer entries than claimed": {stblOf(inconsistentStsd(3, entry)), true},
+		"more entries than claimed":  {stblOf(inconsistentStsd(1, entry, box("free"))), true},
+		"count exceeding the size":   {stblOf(inconsistentStsd(1000, entry)), true},
+		"entry ending past stsd":     {stblOf(inconsistentStsd(1, overlong)), true},
+		"stsd too small":             {stblOf(box("stsd", u32(0))), false},
+	} {
+		for _, strict := range []bool{false, true} {
+			strictStsdBounds = strict
+			err := convert(&memFile{data: append([]byte{}, test.data...)})
+			takeChanges()
+			if want := strict || !test.lenient; errors.Is(err, errStsdBounds) != want {
+				t.Errorf("%s with strict %v: got %v", name, strict, err)
+			}
+		}
+	}
+	strictStsdBounds = false
+
+	t.Run("consistent", func(t *testing.T) {
+		t.Cleanup(func() { strictStsdBounds = false })
+		strictStsdBounds = true
+		f := &memFile{data: movie(trak(entry, visualSampleEntry("hvc1", 1920, 1080, hvcC())))}
+		if err := convert(f); err != nil {
+			t.Fatal(err)
+		}
+		if changes := takeChanges(); len(changes) != 1 {
+			t.Errorf("got changes %v", changes)
+		}
+	})
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// muteStdout sends everything printed to standard output to the null device
+// until restore is called, for -summary-only. Errors still go to standard
+// error. restore may be called several times.
+func muteStdout() (restore func(), err error) {
+	var devNull *os.File
+	if devNull, err = os.OpenFile(os.DevNull, os.O_WRONLY, 0); err != nil {
+		return nil, fmt.Errorf(`[muteStdout] cannot open %s: %w`, os.DevNull, err)
+	}
+	stdout := os.Stdout
+	os.Stdout = devNull
+	return func() {
+		if os.Stdout == devNull {
+			os.Stdout = stdout
+			_ = devNull.Close()
+		}
+	}, nil
+}
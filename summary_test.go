@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRunSummaryOnly(t *testing.T) {
+	withCodecs(t, "dvhe", "dvh1")
+	t.Cleanup(func() { summaryOnly, nullSafe = false, false })
+	summaryOnly, nullSafe = true, true
+
+	dir := t.TempDir()
+	converted := filepath.Join(dir, "converted.mp4")
+	empty := filepath.Join(dir, "empty.mp4")
+	if err := os.WriteFile(converted, movie(trak(visualSampleEntry("dvhe", 1920, 1080, hvcC(), box("dvcC", make([]byte, 24))))), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(empty, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := os.Create(filepath.Join(dir, "stdout"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = out
+	err = run(context.Background(), []string{converted, empty})
+	os.Stdout = stdout
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = out.Close()
+
+	printed, err := os.ReadFile(out.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Processed 2 files: 1 done, 1 empty or incomplete\n"; string(printed) != want {
+		t.Errorf("printed %q, want only %q", printed, want)
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Boxes of the iTunes style metadata tags found in udta/meta/ilst.
+var (
+	IlstBoxType = BoxType{'i', 'l', 's', 't'}
+	DataBoxType = BoxType{'d', 'a', 't', 'a'}
+	MeanBoxType = BoxType{'m', 'e', 'a', 'n'}
+	NameBoxType = BoxType{'n', 'a', 'm', 'e'}
+
+	// ToolTagType is the ©too tag naming the application that wrote the file
+	ToolTagType     = BoxType{0xa9, 't', 'o', 'o'}
+	FreeformTagType = BoxType{'-', '-', '-', '-'}
+)
+
+// maxIlstSize bounds the ilst boxes read into memory, which may hold cover
+// art along with the tags.
+const maxIlstSize = 64 << 20
+
+// Well-known types of the values of data boxes.
+const (
+	dataTypeImplicit = 0
+	dataTypeUTF8     = 1
+	dataTypeInteger  = 21
+)
+
+// MetaTag is a tag of an ilst box with a text or integer value. Key is the
+// type of its item, such as ©too, or mean:name for freeform ---- items.
+type MetaTag struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// tagKey returns the type of an ilst item as text. Types are stored in
+// ISO 8859-1, where 0xa9 is ©.
+func tagKey(t BoxType) string {
+	var b strings.Builder
+	for _, c := range t {
+		b.WriteRune(rune(c))
+	}
+	return b.String()
+}
+
+// readTagValue returns the value of the payload of a data box as text. ok is
+// false for values that are neither text nor an integer, such as cover art.
+func readTagValue(payload []byte) (value string, ok bool) {
+	if len(payload) < 8 {
+		return "", false
+	}
+	kind, data := binary.BigEndian.Uint32(payload)&0xffffff, payload[8:]
+	switch kind {
+	case dataTypeUTF8:
+		return strings.TrimRight(string(data), "\x00"), true
+	case dataTypeInteger, dataTypeImplicit:
+		switch len(data) {
+		case 1:
+			return fmt.Sprint(int8(data[0])), true
+		case 2:
+			return fmt.Sprint(int16(binary.BigEndian.Uint16(data))), true
+		case 4:
+			return fmt.Sprint(int32(binary.BigEndian.Uint32(data))), true
+		case 8:
+			return fmt.Sprint(int64(binary.BigEndian.Uint64(data))), true
+		}
+	}
+	return "", false
+}
+
+// splitBoxes splits payload in the boxes it holds, calling fn with the type
+// and payload of each. Sizes are checked against what is left of payload, so
+// that a broken item cannot make the parsing read past its parent.
+func splitBoxes(payload []byte, fn func(t BoxType, payload []byte) error) error {
+	for len(payload) > 0 {
+		if len(payload) < 8 {
+			return fmt.Errorf(`[splitBoxes] %d trailing bytes are too short for a box`, len(payload))
+		}
+		size := binary.BigEndian.Uint32(payload)
+		var t BoxType
+		copy(t[:], payload[4:8])
+		if size < 8 || uint64(size) > uint64(len(payload)) {
+			return fmt.Errorf(`[splitBoxes] invalid size %d for box "%s" with %d bytes left`, size, tagKey(t), len(payload))
+		}
+		if err := fn(t, payload[8:size]); err != nil {
+			return err
+		}
+		payload = payload[size:]
+	}
+	return nil
+}
+
+// readIlstBox parses the tags of an ilst payload of payloadSize bytes. Each
+// item is a box named after its tag holding a data box with the value, and
+// for freeform items a mean and a name box with the key. The reader must be
+// positioned right after the box header. The tags parsed before an error are
+// returned along with it.
+func readIlstBox(r io.Reader, payloadSize int64) (tags []MetaTag, err error) {
+	if payloadSize < 0 {
+		return nil, fmt.Errorf(`[readIlstBox] invalid payload size %d`, payloadSize)
+	}
+	if payloadSize > maxIlstSize {
+		return nil, fmt.Errorf(`[readIlstBox] payload size %d exceeds %d`, payloadSize, maxIlstSize)
+	}
+	payload := make([]byte, payloadSize)
+	if _, err = io.ReadFull(r, payload); err != nil {
+		return nil, fmt.Errorf(`[readIlstBox] failed reading ilst: %w`, err)
+	}
+	err = splitBoxes(payload, func(item BoxType, payload []byte) error {
+		var mean, name string
+		return splitBoxes(payload, func(t BoxType, payload []byte) error {
+			switch t {
+			case MeanBoxType, NameBoxType:
+				// Full boxes whose text follows the version and flags
+				if len(payload) >= 4 {
+					if t == MeanBoxType {
+						mean = string(payload[4:])
+					} else {
+						name = string(payload[4:])
+					}
+				}
+			case DataBoxType:
+				key := tagKey(item)
+				if item == FreeformTagType {
+					key = mean + ":" + name
+				}
+				if value, ok := readTagValue(payload); ok {
+					tags = append(tags, MetaTag{Key: key, Value: value})
+				}
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return tags, fmt.Errorf(`[readIlstBox] %w`, err)
+	}
+	return tags, nil
+}
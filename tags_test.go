@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+// tag builds an ilst item of the given type holding a data box.
+func tag(itemType string, dataType uint32, value []byte, children ...[]byte) []byte {
+	return box(itemType, append(children, box("data", u32(dataType), u32(0), value))...)
+}
+
+// taggedMovie builds a movie with iTunes style tags in the udta of moov and
+// of its trak.
+func taggedMovie() []byte {
+	hdlr := fullBox("hdlr", 0, 0, u32(0), []byte("mdir"), []byte("appl"), make([]byte, 8), []byte{0})
+	ilst := box("ilst",
+		tag("\xa9too", dataTypeUTF8, []byte("Lavf60.16.100")),
+		tag("tmpo", dataTypeInteger, u16(120)),
+		tag("covr", 13, make([]byte, 32)),
+		tag("----", dataTypeUTF8, []byte("x265"), fullBox("mean", 0, 0, []byte("com.apple.iTunes")), fullBox("name", 0, 0, []byte("encoder"))),
+	)
+	track := box("trak", box("mdia", box("minf", box("stbl", stsd(visualSampleEntry("dvhe", 1920, 1080))))),
+		box("udta", box("meta", hdlr, box("ilst", tag("\xa9nam", dataTypeUTF8, []byte("Video"))))))
+	return movie(track, box("udta", fullBox("meta", 0, 0, hdlr, ilst)))
+}
+
+func TestInspectTags(t *testing.T) {
+	info, err := inspect(bytes.NewReader(taggedMovie()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(info.Meta) != 0 || info.Encoder != "" {
+		t.Errorf("got meta %+v encoder %q without -tags", info.Meta, info.Encoder)
+	}
+
+	t.Cleanup(func() { readTags = false })
+	readTags = true
+	if info, err = inspect(bytes.NewReader(taggedMovie())); err != nil {
+		t.Fatal(err)
+	}
+	if info.Encoder != "Lavf60.16.100" {
+		t.Errorf("got encoder %q", info.Encoder)
+	}
+	if len(info.Meta) != 1 || info.Meta[0].Path != "moov/udta/meta" || info.Meta[0].HandlerType != "mdir" {
+		t.Fatalf("got meta %+v, want the one of moov/udta", info.Meta)
+	}
+	if got := fmt.Sprintf("%+v", info.Meta[0].Tags); got != "[{Key:©too Value:Lavf60.16.100} {Key:tmpo Value:120} {Key:com.apple.iTunes:encoder Value:x265}]" {
+		t.Errorf("got tags %s", got)
+	}
+	track := info.Tracks[0]
+	if len(track.Meta) != 1 || track.Meta[0].Path != "moov/trak/udta/meta" || fmt.Sprint(track.Meta[0].Tags) != "[{©nam Video}]" {
+		t.Errorf("got track meta %+v", track.Meta)
+	}
+	if fmt.Sprint(track.Codecs) != "[dvhe]" {
+		t.Errorf("got codecs %v", track.Codecs)
+	}
+
+	data := taggedMovie()
+	parallel, err := inspectAt(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantJSON, _ := json.Marshal(info)
+	gotJSON, _ := json.Marshal(parallel)
+	if !bytes.Equal(gotJSON, wantJSON) {
+		t.Errorf("inspectAt got %s, want %s", gotJSON, wantJSON)
+	}
+}
+
+func TestReadIlstBox(t *testing.T) {
+	for name, test := range map[string]struct {
+		ilst []byte
+		want string
+		err  bool
+	}{
+		"empty":          {box("ilst"), "[]", false},
+		"item past ilst": {box("ilst", tag("\xa9too", 1, []byte("a")), u32(64), []byte("\xa9day")), "[{©too a}]", true},
+		"data past item": {box("ilst", box("\xa9too", u32(40), []byte("data"), u32(1), u32(0))), "[]", true},
+		"short data":     {box("ilst", box("\xa9too", box("data", u16(1)))), "[]", false},
+		"odd integer":    {box("ilst", tag("trkn", dataTypeImplicit, make([]byte, 3))), "[]", false},
+		"truncated size": {box("ilst", tag("tmpo", 21, []byte{0xff}), []byte{0, 0}), "[{tmpo -1}]", true},
+	} {
+		tags, err := readIlstBox(bytes.NewReader(test.ilst[8:]), int64(len(test.ilst)-8))
+		if got := fmt.Sprint(tags); got != test.want && !(test.want == "[]" && tags == nil) {
+			t.Errorf("%s: got tags %s, want %s", name, got, test.want)
+		}
+		if (err != nil) != test.err {
+			t.Errorf("%s: got error %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+)
+
+// TrackCount is the number of trak boxes of a file, for -track-count.
+type TrackCount struct {
+	File   string `json:"file"`
+	Tracks int    `json:"tracks"`
+}
+
+// countTracks returns the number of trak boxes of the first moov box of r.
+// Only the top level boxes and the children of moov are read.
+func countTracks(r io.ReadSeeker) (n int, err error) {
+	var h *Header
+
+	if _, err = r.Seek(0, io.SeekStart); err != nil {
+		return 0, fmt.Errorf(`[countTracks] failed to seek: %w`, err)
+	}
+	if h, err = findHeader(r, MoovBoxType, -1); err != nil {
+		if isEndOfFile(err) {
+			return 0, fmt.Errorf(`[countTracks] %w: %w`, errIncompleteFile, err)
+		}
+		return 0, fmt.Errorf(`[countTracks] %w`, err)
+	}
+	if h.Size == 0 {
+		return 0, fmt.Errorf(`[countTracks] unsupported size 0 for box "%s" at %d(%#x)`, h.Type, h.Offset, h.Offset)
+	}
+	err = forEachBox(r, h.PayloadSize(), func(child *Header) error {
+		if child.Type == TrakBoxType {
+			n++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf(`[countTracks] failed scanning moov children: %w`, err)
+	}
+	return n, nil
+}
+
+// countTracksFile is countTracks for mp4file, decompressed first if needed.
+func countTracksFile(mp4file string) (n int, err error) {
+	var r io.ReadSeekCloser
+
+	if r, err = openForInspection(mp4file); err != nil {
+		return 0, fmt.Errorf(`[countTracksFile] %w`, err)
+	}
+	defer r.Close()
+	if r, err = skipPrefix(r, mp4file); err != nil {
+		return 0, fmt.Errorf(`[countTracksFile] %w`, err)
+	}
+	return countTracks(r)
+}
+
+// runTrackCount reports the number of tracks of every file, for inspect
+// -track-count.
+func runTrackCount(ctx context.Context, mp4files []string) (err error) {
+	rep := newReporter(os.Stdout, outputFormat)
+	for i, mp4file := range mp4files {
+		var n int
+		if err = ctx.Err(); err != nil {
+			return fmt.Errorf(`[runTrackCount] interrupted after %d of %d files: %w`, i, len(mp4files), err)
+		}
+		if n, err = countTracksFile(mp4file); err != nil {
+			return fmt.Errorf(`[runTrackCount] failed counting tracks of file %s: %w`, mp4file, err)
+		}
+		if err = rep.report(TrackCount{File: mp4file, Tracks: n}); err != nil {
+			return fmt.Errorf(`[runTrackCount] %w`, err)
+		}
+	}
+	if err = rep.finish(); err != nil {
+		return fmt.Errorf(`[runTrackCount] %w`, err)
+	}
+	return
+}
+
+func (c TrackCount) printText() {
+	fmt.Printf("%s: %d tracks\n", c.File, c.Tracks)
+}
+
+func (c TrackCount) columns() []string {
+	return []string{"file", "tracks"}
+}
+
+func (c TrackCount) row() []string {
+	return []string{c.File, strconv.Itoa(c.Tracks)}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestCountTracks(t *testing.T) {
+	entry := visualSampleEntry("dvhe", 1920, 1080, hvcC())
+	ftyp := box("ftyp", []byte("isom"), u32(0))
+	moov := box("moov", box("mvhd", make([]byte, 100)), trak(entry), trak(entry), box("udta"), trak(entry))
+	mdat := box("mdat", make([]byte, 4096))
+
+	tests := []struct {
+		name    string
+		data    []byte
+		maxRead int
+	}{
+		// Of moov only the headers of its children are read, up to that of
+		// its last trak.
+		{name: "moov first", data: bytes.Join([][]byte{ftyp, moov, mdat}, nil), maxRead: len(ftyp) + len(moov) - len(trak(entry)) + 8},
+		{name: "moov last", data: bytes.Join([][]byte{ftyp, mdat, moov}, nil), maxRead: len(ftyp) + len(mdat) + len(moov)},
+	}
+	for _, tt := range tests {
+		f := &readExtent{memFile: memFile{data: tt.data}}
+		n, err := countTracks(f)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if n != 3 {
+			t.Errorf("%s: got %d tracks, want 3", tt.name, n)
+		}
+		if f.end > int64(tt.maxRead) {
+			t.Errorf("%s: read up to %d, want at most %d", tt.name, f.end, tt.maxRead)
+		}
+	}
+
+	if _, err := countTracks(&memFile{data: bytes.Join([][]byte{ftyp, mdat}, nil)}); !errors.Is(err, errIncompleteFile) {
+		t.Errorf("no moov: got %v, want %v", err, errIncompleteFile)
+	}
+}
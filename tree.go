@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Box is an in-memory box, used by the features that rewrite the box
+// structure instead of patching bytes in place.
+type Box struct {
+	Type BoxType
+
+	// Large keeps the 64-bit size field of the original header
+	Large bool
+
+	// Fields holds the payload preceding the children of a container, or the
+	// whole payload of a leaf box
+	Fields []byte
+
+	// Container is true if the payload after Fields is a list of child boxes
+	Container bool
+	Children  []*Box
+
+	// Offset of the box in the file it was read from, -1 for new boxes
+	Offset int64
+}
+
+// Size returns the size of the box as it would be written now.
+func (b *Box) Size() uint64 {
+	size := uint64(len(b.Fields))
+	for _, child := range b.Children {
+		size += child.Size()
+	}
+	if b.Large || size+8 > math.MaxUint32 {
+		return size + 16
+	}
+	return size + 8
+}
+
+// writeBoxHeader writes a box header for a box of the given total size,
+// using the 64-bit size field if large is set or the size requires it.
+func writeBoxHeader(w io.Writer, boxType BoxType, size uint64, large bool) (int64, error) {
+	var header []byte
+
+	if large || size > math.MaxUint32 {
+		header = make([]byte, 16)
+		binary.BigEndian.PutUint32(header, 1)
+		binary.BigEndian.PutUint64(header[8:], size)
+	} else {
+		header = make([]byte, 8)
+		binary.BigEndian.PutUint32(header, uint32(size))
+	}
+	copy(header[4:8], boxType[:])
+
+	n, err := w.Write(header)
+	return int64(n), err
+}
+
+// WriteTo serializes the box with freshly computed sizes.
+func (b *Box) WriteTo(w io.Writer) (n int64, err error) {
+	if n, err = writeBoxHeader(w, b.Type, b.Size(), b.Large); err != nil {
+		return
+	}
+
+	var m int
+	if m, err = w.Write(b.Fields); err != nil {
+		return n + int64(m), err
+	}
+	n += int64(m)
+	for _, child := range b.Children {
+		var cn int64
+		cn, err = child.WriteTo(w)
+		n += cn
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// Visit calls fn for b and all its descendants in depth-first order.
+func (b *Box) Visit(path []BoxType, fn func(path []BoxType, b *Box) error) error {
+	path = append(path[:len(path):len(path)], b.Type)
+	if err := fn(path, b); err != nil {
+		return err
+	}
+	for _, child := range b.Children {
+		if err := child.Visit(path, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readBoxTree reads the box described by h, of size bytes as resolved for
+// size 0 boxes extending to the end of their parent or file, into memory,
+// parsing children of every box whose layout is known to childOffset. The
+// reader must be positioned right after the header. Sample entries whose
+// children cannot be parsed are kept as opaque leaves.
+func readBoxTree(r io.ReadSeeker, h *Header, size int64, parent []BoxType) (b *Box, err error) {
+	payloadSize := size - int64(getHeaderSize(h))
+	if payloadSize < 0 {
+		return nil, fmt.Errorf(`[readBoxTree] invalid size %d for box "%s" at %d(%#x)`, size, h.Type, h.Offset, h.Offset)
+	}
+
+	path := append(parent[:len(parent):len(parent)], h.Type)
+	b = &Box{Type: h.Type, Large: h.Size == 1, Offset: h.Offset}
+
+	skip, ok := childOffset(path, h)
+	if ok && skip <= payloadSize {
+		b.Container = true
+		b.Fields = make([]byte, skip)
+		if _, err = io.ReadFull(r, b.Fields); err != nil {
+			return nil, fmt.Errorf(`[readBoxTree] failed reading fields of box "%s": %w`, h.Type, err)
+		}
+		if b.Children, err = readBoxChildren(r, path, payloadSize-skip); err == nil {
+			return b, nil
+		}
+		if !(len(parent) > 0 && parent[len(parent)-1] == StsdBoxType) {
+			return nil, err
+		}
+		if _, err = r.Seek(h.Offset+int64(getHeaderSize(h)), io.SeekStart); err != nil {
+			return nil, fmt.Errorf(`[readBoxTree] failed to seek: %w`, err)
+		}
+		b.Container = false
+		b.Children = nil
+	}
+
+	b.Fields = make([]byte, payloadSize)
+	if _, err = io.ReadFull(r, b.Fields); err != nil {
+		return nil, fmt.Errorf(`[readBoxTree] failed reading payload of box "%s": %w`, h.Type, err)
+	}
+	return b, nil
+}
+
+func readBoxChildren(r io.ReadSeeker, path []BoxType, limit int64) (children []*Box, err error) {
+	for remaining := limit; remaining > 0; {
+		var (
+			h     *Header
+			child *Box
+		)
+		if h, err = readBoxHeader(r); err != nil {
+			return nil, fmt.Errorf(`[readBoxChildren] failed reading box header: %w`, err)
+		}
+		size := int64(getBoxSize(h))
+		if h.Size == 0 {
+			size = remaining
+		}
+		if size > remaining {
+			return nil, fmt.Errorf(`[readBoxChildren] box "%s" at %d(%#x) overruns its parent "%s"`, h.Type, h.Offset, h.Offset, path[len(path)-1])
+		}
+		if child, err = readBoxTree(r, h, size, path); err != nil {
+			return nil, err
+		}
+		children = append(children, child)
+		remaining -= size
+	}
+	return
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// knownBoxTypes lists the leaf boxes the tool knows about, on top of the
+// containers and sample entries known to childOffset.
+var knownBoxTypes = map[string]bool{
+	"ftyp": true, "styp": true, "free": true, "skip": true, "mdat": true, "wide": true, "uuid": true,
+	"sidx": true, "tfra": true, "mfro": true, "pdin": true, "iods": true,
+	"mvhd": true, "tkhd": true, "tref": true, "elst": true, "mdhd": true, "hdlr": true,
+	"vmhd": true, "smhd": true, "nmhd": true, "sthd": true, "dref": true, "url ": true, "urn ": true,
+	"stsd": true, "stts": true, "ctts": true, "cslg": true, "stss": true, "stps": true, "sdtp": true,
+	"stsc": true, "stsz": true, "stz2": true, "stco": true, "co64": true, "sgpd": true, "sbgp": true,
+	"saiz": true, "saio": true, "senc": true, "subs": true,
+	"mehd": true, "trex": true, "mfhd": true, "tfhd": true, "tfdt": true, "trun": true,
+	"meta": true, "ilst": true, "keys": true, "pssh": true, "frma": true, "schm": true, "tenc": true,
+	"hvcC": true, "avcC": true, "dvcC": true, "dvvC": true, "dvwC": true, "av1C": true, "esds": true,
+	"dac3": true, "dec3": true, "btrt": true, "pasp": true, "clap": true, "colr": true, "mdcv": true, "clli": true,
+	"lhvC": true, "hfov": true, "stri": true, "hero": true, "blin": true, "dadj": true, "prji": true,
+}
+
+// unknownBoxVisitor collects the boxes missing from knownBoxTypes, descending
+// into every box with a known child layout.
+type unknownBoxVisitor struct {
+	unknown []Header
+}
+
+func (v *unknownBoxVisitor) EnterBox(path []BoxType, h Header) (bool, error) {
+	t := h.Type.String()
+	known := knownBoxTypes[t] || containerBoxTypes[h.Type]
+	if len(path) >= 2 && path[len(path)-2] == StsdBoxType {
+		known = visualSampleEntryTypes[t] || audioSampleEntryTypes[t]
+	}
+	if !known {
+		v.unknown = append(v.unknown, h)
+	}
+	return true, nil
+}
+
+func (v *unknownBoxVisitor) LeaveBox(path []BoxType, h Header) error {
+	return nil
+}
+
+// unknownBoxes returns the headers of all boxes of r not recognized by the tool.
+func unknownBoxes(r io.ReadSeeker) (unknown []Header, err error) {
+	v := &unknownBoxVisitor{}
+	if err = Walk(r, v); err != nil {
+		return nil, fmt.Errorf(`[unknownBoxes] %w`, err)
+	}
+	return v.unknown, nil
+}
+
+func printUnknownBoxes(mp4file string) (err error) {
+	var (
+		r       *os.File
+		unknown []Header
+	)
+
+	if r, err = os.Open(mp4file); err != nil {
+		return fmt.Errorf(`[printUnknownBoxes] cannot open file "%s": %w`, mp4file, err)
+	}
+	defer r.Close()
+
+	if unknown, err = unknownBoxes(r); err != nil {
+		return fmt.Errorf(`[printUnknownBoxes] %w`, err)
+	}
+	for _, h := range unknown {
+		fmt.Printf("%s: unknown box %q at %d(%#x), %d bytes\n", mp4file, h.Type.String(), h.Offset, h.Offset, getBoxSize(&h))
+	}
+	return
+}
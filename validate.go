@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// validateVisitor checks the structure of a file while walking it. Structural
+// errors found by Walk itself, such as boxes overrunning their parent, are
+// reported by Walk.
+type validateVisitor struct {
+	r        io.Reader
+	problems []string
+	end      int64
+	moov     bool
+	traks    int
+	stsds    int
+
+	// sample entries declared by and found in the stsd being walked
+	declaredEntries uint32
+	foundEntries    uint32
+}
+
+func (v *validateVisitor) EnterBox(path []BoxType, h Header) (descend bool, err error) {
+	if len(path) == 1 {
+		if end := h.Offset + int64(getBoxSize(&h)); end > v.end {
+			v.end = end
+		}
+		if h.Size == 0 {
+			v.end = -1
+		}
+	}
+	if len(path) >= 2 && path[len(path)-2] == StsdBoxType {
+		v.foundEntries++
+	}
+
+	switch h.Type {
+	case MoovBoxType:
+		v.moov = true
+		return true, nil
+	case TrakBoxType:
+		v.traks++
+		return true, nil
+	case MdiaBoxType, MinfBoxType, StblBoxType:
+		return true, nil
+	case StsdBoxType:
+		var entryCount uint32
+		v.stsds++
+		if _, entryCount, err = readStsdHeader(v.r); errors.Is(err, errUnsupportedStsdVersion) {
+			v.declaredEntries, v.foundEntries = 0, 0
+			v.problems = append(v.problems, fmt.Sprintf("stsd at %d(%#x): %v", h.Offset, h.Offset, err))
+			return false, nil
+		}
+		if err != nil {
+			return false, fmt.Errorf(`[validateVisitor] failed reading stsd at %d(%#x): %w`, h.Offset, h.Offset, err)
+		}
+		v.declaredEntries = entryCount
+		v.foundEntries = 0
+		return true, nil
+	}
+	return false, nil
+}
+
+func (v *validateVisitor) LeaveBox(path []BoxType, h Header) error {
+	if h.Type == StsdBoxType && v.declaredEntries != v.foundEntries {
+		v.problems = append(v.problems, fmt.Sprintf("stsd at %d(%#x) declares %d sample entries but holds %d", h.Offset, h.Offset, v.declaredEntries, v.foundEntries))
+	}
+	return nil
+}
+
+// validate returns the structural problems of the file read from r, whose
+// size is given, or an error if it cannot be walked at all.
+func validate(r io.ReadSeeker, size int64) (problems []string, err error) {
+	v := &validateVisitor{r: r}
+	if err = Walk(r, v); err != nil {
+		return nil, fmt.Errorf(`[validate] %w`, err)
+	}
+	if !v.moov {
+		v.problems = append(v.problems, "no moov box")
+	}
+	if v.stsds < v.traks {
+		v.problems = append(v.problems, fmt.Sprintf("%d of %d tracks have no stsd box", v.traks-v.stsds, v.traks))
+	}
+	if v.end >= 0 && v.end != size {
+		v.problems = append(v.problems, fmt.Sprintf("top level boxes end at %d but the file is %d bytes", v.end, size))
+	}
+	return v.problems, nil
+}
+
+// validateFile validates mp4file from offset, past the -strip-prefix bytes.
+func validateFile(mp4file string, offset int64) (problems []string, err error) {
+	var (
+		f    *os.File
+		info os.FileInfo
+	)
+
+	if f, err = os.Open(mp4file); err != nil {
+		return nil, fmt.Errorf(`[validateFile] cannot open file "%s": %w`, mp4file, err)
+	}
+	defer f.Close()
+
+	if info, err = f.Stat(); err != nil {
+		return nil, fmt.Errorf(`[validateFile] cannot stat file "%s": %w`, mp4file, err)
+	}
+	r := io.NewSectionReader(f, offset, max(info.Size()-offset, 0))
+	if err = checkPrefix(r); err != nil {
+		return nil, fmt.Errorf(`[validateFile] "%s": %w`, mp4file, err)
+	}
+	return validate(r, r.Size())
+}
+
+func runValidate(ctx context.Context, mp4files []string) (err error) {
+	invalid := 0
+	for i, mp4file := range mp4files {
+		var problems []string
+		if err = ctx.Err(); err != nil {
+			return fmt.Errorf(`[runValidate] interrupted after %d of %d files: %w`, i, len(mp4files), err)
+		}
+		if problems, err = validateFile(mp4file, stripPrefix); err != nil {
+			problems = []string{err.Error()}
+		} else {
+			if reportUnknownBoxes {
+				if err = printUnknownBoxes(mp4file); err != nil {
+					problems = append(problems, err.Error())
+				}
+			}
+			if scanReport {
+				var mismatches []string
+				if mismatches, err = printScanReport(mp4file); err != nil {
+					mismatches = []string{err.Error()}
+				}
+				problems = append(problems, mismatches...)
+			}
+		}
+		if len(problems) == 0 {
+			fmt.Printf("%s: ok\n", mp4file)
+			continue
+		}
+		invalid++
+		for _, problem := range problems {
+			fmt.Printf("%s: %s\n", mp4file, problem)
+		}
+	}
+	if invalid > 0 {
+		return fmt.Errorf(`[runValidate] %d of %d files failed validation`, invalid, len(mp4files))
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// verifyBaseline is the state of a file before conversion, which the
+// converted file is checked against unless -no-verify is set.
+type verifyBaseline struct {
+	size     int64
+	problems map[string]bool
+}
+
+// newVerifyBaseline validates mp4file before it is converted. Files that
+// cannot be walked get an empty baseline, since converting them fails anyway.
+func newVerifyBaseline(mp4file string) (b *verifyBaseline, err error) {
+	var info os.FileInfo
+
+	if info, err = os.Stat(mp4file); err != nil {
+		return nil, fmt.Errorf(`[newVerifyBaseline] cannot stat file "%s": %w`, mp4file, err)
+	}
+	b = &verifyBaseline{size: info.Size(), problems: make(map[string]bool)}
+	problems, _ := validateFile(mp4file, stripPrefix)
+	for _, problem := range problems {
+		b.problems[problem] = true
+	}
+	return b, nil
+}
+
+// verify checks that converting mp4file into dst introduced no structural
+// problem: every box still fits its parent, the stsd entry counts match the
+// entries found and, unless the file was rewritten, its size is unchanged.
+// Problems already present before conversion are not reported.
+func (b *verifyBaseline) verify(dst string, rewritten bool) (err error) {
+	var (
+		problems []string
+		info     os.FileInfo
+		found    []string
+	)
+
+	if info, err = os.Stat(dst); err != nil {
+		return fmt.Errorf(`[verify] cannot stat file "%s": %w`, dst, err)
+	}
+	if !rewritten && info.Size() != b.size {
+		found = append(found, fmt.Sprintf("size changed from %d to %d bytes", b.size, info.Size()))
+	}
+	if problems, err = validateFile(dst, 0); err != nil {
+		return fmt.Errorf(`[verify] "%s" no longer parses after conversion: %w`, dst, err)
+	}
+	for _, problem := range problems {
+		if !b.problems[problem] {
+			found = append(found, problem)
+		}
+	}
+	if len(found) > 0 {
+		return fmt.Errorf(`[verify] "%s" is inconsistent after conversion: %s`, dst, strings.Join(found, "; "))
+	}
+	fmt.Printf("Verified %s\n", dst)
+	return nil
+}
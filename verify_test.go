@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestVerifyBaseline(t *testing.T) {
+	data := movie(trak(visualSampleEntry("dvhe", 1920, 1080)))
+	stsdAt := bytes.Index(data, []byte("stsd"))
+
+	tests := []struct {
+		name      string
+		corrupt   func(data []byte) []byte
+		rewritten bool
+		want      string
+	}{
+		{name: "unchanged", corrupt: func(data []byte) []byte { return data }},
+		{
+			name: "entry count",
+			corrupt: func(data []byte) []byte {
+				binary.BigEndian.PutUint32(data[stsdAt+8:], 2)
+				return data
+			},
+			want: "declares 2 sample entries but holds 1",
+		},
+		{name: "size", corrupt: func(data []byte) []byte { return append(data, box("free")...) }, want: "size changed"},
+		{name: "rewritten size", corrupt: func(data []byte) []byte { return append(data, box("free")...) }, rewritten: true},
+		{name: "truncated", corrupt: func(data []byte) []byte { return data[:len(data)-4] }, rewritten: true, want: "top level boxes end"},
+		{
+			name: "overrun",
+			corrupt: func(data []byte) []byte {
+				entryAt := stsdAt + 12
+				binary.BigEndian.PutUint32(data[entryAt:], binary.BigEndian.Uint32(data[entryAt:])+8)
+				return data
+			},
+			want: "no longer parses",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := writeTempFile(t, data)
+			baseline, err := newVerifyBaseline(f.Name())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = os.WriteFile(f.Name(), tt.corrupt(append([]byte{}, data...)), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			err = baseline.verify(f.Name(), tt.rewritten)
+			switch {
+			case tt.want == "" && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)):
+				t.Errorf("got error %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
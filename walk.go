@@ -0,0 +1,245 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+var (
+	EdtsBoxType = BoxType{'e', 'd', 't', 's'}
+	DinfBoxType = BoxType{'d', 'i', 'n', 'f'}
+	UdtaBoxType = BoxType{'u', 'd', 't', 'a'}
+	MvexBoxType = BoxType{'m', 'v', 'e', 'x'}
+	MoofBoxType = BoxType{'m', 'o', 'o', 'f'}
+	TrafBoxType = BoxType{'t', 'r', 'a', 'f'}
+	SinfBoxType = BoxType{'s', 'i', 'n', 'f'}
+	SchiBoxType = BoxType{'s', 'c', 'h', 'i'}
+	MdatBoxType = BoxType{'m', 'd', 'a', 't'}
+	MfraBoxType = BoxType{'m', 'f', 'r', 'a'}
+)
+
+// containerBoxTypes lists boxes whose payload is made entirely of child boxes.
+var containerBoxTypes = map[BoxType]bool{
+	MoovBoxType: true,
+	TrakBoxType: true,
+	MdiaBoxType: true,
+	MinfBoxType: true,
+	StblBoxType: true,
+	EdtsBoxType: true,
+	DinfBoxType: true,
+	UdtaBoxType: true,
+	MvexBoxType: true,
+	MoofBoxType: true,
+	TrafBoxType: true,
+	SinfBoxType: true,
+	SchiBoxType: true,
+	MfraBoxType: true,
+	VexuBoxType: true,
+	EyesBoxType: true,
+	CamsBoxType: true,
+	CmfyBoxType: true,
+	ProjBoxType: true,
+}
+
+// Sample entries carry fixed fields before their child boxes. The sizes below
+// exclude the 8 byte box header.
+var (
+	visualSampleEntryTypes = map[string]bool{
+		"avc1": true, "avc3": true, "hvc1": true, "hev1": true,
+		"dvh1": true, "dvhe": true, "dva1": true, "dvav": true,
+		"av01": true, "encv": true,
+	}
+	audioSampleEntryTypes = map[string]bool{
+		"mp4a": true, "ac-3": true, "ec-3": true, "enca": true,
+	}
+)
+
+const (
+	visualSampleEntryFieldsSize = 78
+	audioSampleEntryFieldsSize  = 28
+)
+
+// childOffset reports where the children of a box start, relative to the
+// start of its payload. ok is false if the box is not known to have children.
+func childOffset(path []BoxType, h *Header) (offset int64, ok bool) {
+	if containerBoxTypes[h.Type] {
+		return 0, true
+	}
+	if h.Type == StsdBoxType {
+		// Version(1 byte) + Flags(3 bytes) + Number of entries(4 bytes)
+		return 8, true
+	}
+	if len(path) >= 2 && path[len(path)-2] == StsdBoxType {
+		switch {
+		case visualSampleEntryTypes[h.Type.String()]:
+			return visualSampleEntryFieldsSize, true
+		case audioSampleEntryTypes[h.Type.String()]:
+			return audioSampleEntryFieldsSize, true
+		}
+	}
+	return 0, false
+}
+
+// Visitor receives callbacks from Walk.
+//
+// path holds the types of all enclosing boxes followed by the type of the
+// current box. When EnterBox is called the reader is positioned at the start
+// of the box payload; visitors may read from it freely since Walk seeks to the
+// next box on its own. Returning descend=true makes Walk visit the children of
+// the box, but only for boxes whose child layout is known (see childOffset).
+type Visitor interface {
+	EnterBox(path []BoxType, h Header) (descend bool, err error)
+	LeaveBox(path []BoxType, h Header) error
+}
+
+// WalkOptions restricts which boxes WalkWithOptions descends into, whatever
+// the visitor asks for.
+type WalkOptions struct {
+	// Descend, when not empty, lists the only box types that may be descended into
+	Descend []BoxType
+
+	// NoDescend lists box types that are never descended into
+	NoDescend []BoxType
+}
+
+// DefaultWalkOptions never descends into media data, which can be huge and
+// holds no boxes.
+var DefaultWalkOptions = WalkOptions{NoDescend: []BoxType{MdatBoxType}}
+
+func (opts *WalkOptions) allows(boxType BoxType) bool {
+	for _, t := range opts.NoDescend {
+		if t == boxType {
+			return false
+		}
+	}
+	if len(opts.Descend) == 0 {
+		return true
+	}
+	for _, t := range opts.Descend {
+		if t == boxType {
+			return true
+		}
+	}
+	return false
+}
+
+// Walk visits every top level box of r and, as directed by visitor, their
+// children, using DefaultWalkOptions.
+func Walk(r io.ReadSeeker, visitor Visitor) error {
+	return WalkWithOptions(r, visitor, DefaultWalkOptions)
+}
+
+// WalkWithOptions is like Walk but only descends into boxes allowed by opts.
+func WalkWithOptions(r io.ReadSeeker, visitor Visitor, opts WalkOptions) error {
+	w := &walker{r: r, visitor: visitor, opts: opts}
+	if err := w.walkBoxes(nil, 0, -1); err != nil {
+		return fmt.Errorf(`[Walk] %w`, err)
+	}
+	return nil
+}
+
+type walker struct {
+	r       io.ReadSeeker
+	visitor Visitor
+	opts    WalkOptions
+}
+
+func (w *walker) walkBoxes(parent []BoxType, start int64, limit int64) (err error) {
+	r, visitor := w.r, w.visitor
+	var (
+		h       *Header
+		descend bool
+	)
+	for offset := start; limit < 0 || offset < start+limit; offset += int64(getBoxSize(h)) {
+		// Some writers end containers with a few bytes of padding, such as
+		// the 32-bit zero terminating QuickTime udta boxes.
+		if limit >= 0 && start+limit-offset < 8 {
+			return nil
+		}
+
+		if _, err = r.Seek(offset, io.SeekStart); err != nil {
+			return fmt.Errorf(`[walkBoxes] failed to seek to offset: %w`, err)
+		}
+
+		if h, err = readBoxHeader(r); err != nil {
+			if limit < 0 && errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf(`[walkBoxes] failed reading box header at %d(%#x): %w`, offset, offset, err)
+		}
+
+		// A top level box of size 0 extends to the end of the file. Its size
+		// is unknown here, so it is visited without its children.
+		last := h.Size == 0 && limit < 0
+
+		if !last && getBoxSize(h) < getHeaderSize(h) {
+			return fmt.Errorf(`[walkBoxes] invalid size %d for box "%s" at %d(%#x)`, getBoxSize(h), h.Type, offset, offset)
+		}
+
+		if limit >= 0 && offset+int64(getBoxSize(h)) > start+limit {
+			return fmt.Errorf(`[walkBoxes] box "%s" at %d(%#x) overruns its parent "%s"`, h.Type, offset, offset, parent[len(parent)-1])
+		}
+
+		path := make([]BoxType, len(parent)+1)
+		copy(path, parent)
+		path[len(parent)] = h.Type
+
+		if verbose {
+			fmt.Printf("[walkBoxes] inspecting %s at %d(%#x)\n", h.Type, offset, offset)
+		}
+
+		if descend, err = visitor.EnterBox(path, *h); err != nil {
+			return err
+		}
+
+		if descend && !last && w.opts.allows(h.Type) {
+			if skip, ok := childOffset(path, h); ok {
+				childStart := offset + int64(getHeaderSize(h)) + skip
+				err = w.walkBoxes(path, childStart, offset+int64(getBoxSize(h))-childStart)
+				// Sample entries of unusual writers may carry data that does
+				// not parse as boxes, which does not affect their siblings.
+				if err != nil && len(parent) > 0 && parent[len(parent)-1] == StsdBoxType {
+					if verbose {
+						fmt.Printf("[walkBoxes] ignoring unparsable children of sample entry %s at %d(%#x): %v\n", h.Type, offset, offset, err)
+					}
+					err = nil
+				}
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		if err = visitor.LeaveBox(path, *h); err != nil {
+			return err
+		}
+		if last {
+			return nil
+		}
+	}
+	return
+}
+
+// BoxCounter is a Visitor counting the occurrences of every box type it sees.
+type BoxCounter map[BoxType]int
+
+func (c BoxCounter) EnterBox(path []BoxType, h Header) (bool, error) {
+	c[h.Type]++
+	return true, nil
+}
+
+func (c BoxCounter) LeaveBox(path []BoxType, h Header) error {
+	return nil
+}
+
+// Types returns the counted box types in lexical order.
+func (c BoxCounter) Types() []BoxType {
+	types := make([]BoxType, 0, len(c))
+	for t := range c {
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i].String() < types[j].String() })
+	return types
+}
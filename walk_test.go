@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func ExampleBoxCounter() {
+	data := movie(
+		fullBox("mvhd", 0, 0, make([]byte, 16)),
+		trak(visualSampleEntry("dvhe", 1920, 1080, box("dvcC", make([]byte, 24)))),
+	)
+
+	counter := BoxCounter{}
+	if err := Walk(bytes.NewReader(data), counter); err != nil {
+		fmt.Println(err)
+		return
+	}
+	for _, t := range counter.Types() {
+		fmt.Println(t, counter[t])
+	}
+	// Output:
+	// dvcC 1
+	// dvhe 1
+	// ftyp 1
+	// mdat 1
+	// mdia 1
+	// minf 1
+	// moov 1
+	// mvhd 1
+	// stbl 1
+	// stsd 1
+	// trak 1
+}
+
+// pathPrinter prints the path of every box it enters, descending into all.
+type pathPrinter struct{}
+
+func (pathPrinter) EnterBox(path []BoxType, h Header) (bool, error) {
+	fmt.Println(path, h.Offset)
+	return true, nil
+}
+
+func (pathPrinter) LeaveBox(path []BoxType, h Header) error {
+	return nil
+}
+
+func ExampleWalkWithOptions() {
+	data := movie(trak(visualSampleEntry("dvhe", 1920, 1080, box("dvcC", make([]byte, 24)))))
+
+	// Stop at the sample descriptions, whatever the visitor asks for.
+	opts := WalkOptions{NoDescend: append([]BoxType{StsdBoxType}, DefaultWalkOptions.NoDescend...)}
+	if err := WalkWithOptions(bytes.NewReader(data), pathPrinter{}, opts); err != nil {
+		fmt.Println(err)
+	}
+	// Output:
+	// [ftyp] 0
+	// [moov] 24
+	// [moov trak] 32
+	// [moov trak mdia] 40
+	// [moov trak mdia minf] 48
+	// [moov trak mdia minf stbl] 56
+	// [moov trak mdia minf stbl stsd] 64
+	// [mdat] 198
+}
+
+func TestWalkWithOptions(t *testing.T) {
+	data := movie(
+		fullBox("mvhd", 0, 0, make([]byte, 16)),
+		trak(visualSampleEntry("dvhe", 1920, 1080)),
+	)
+
+	tests := []struct {
+		name string
+		opts WalkOptions
+		want []string
+		stsd bool
+	}{
+		{"default", DefaultWalkOptions, []string{"dvhe", "stsd"}, true},
+		{"deny trak", WalkOptions{NoDescend: []BoxType{TrakBoxType}}, []string{"mvhd", "trak"}, false},
+		{"allow moov only", WalkOptions{Descend: []BoxType{MoovBoxType}}, []string{"mvhd", "trak"}, false},
+		{"deny wins over allow", WalkOptions{Descend: []BoxType{MoovBoxType}, NoDescend: []BoxType{MoovBoxType}}, []string{"moov"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			counter := BoxCounter{}
+			if err := WalkWithOptions(bytes.NewReader(data), counter, tt.opts); err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range tt.want {
+				var boxType BoxType
+				copy(boxType[:], want)
+				if counter[boxType] != 1 {
+					t.Errorf("expected to visit %s once, got %d", want, counter[boxType])
+				}
+			}
+			if got := counter[StsdBoxType] != 0; got != tt.stsd {
+				t.Errorf("visited stsd: got %v, want %v", got, tt.stsd)
+			}
+		})
+	}
+}
+
+func TestWalkContainerPadding(t *testing.T) {
+	// QuickTime ends udta with a 32-bit zero, too short for a box.
+	data := movie(box("udta", box("name", []byte("movie")), u32(0)), trak(visualSampleEntry("dvhe", 1920, 1080)))
+	counter := BoxCounter{}
+	if err := Walk(bytes.NewReader(data), counter); err != nil {
+		t.Fatal(err)
+	}
+	if counter[TrakBoxType] != 1 || counter[BoxType{'n', 'a', 'm', 'e'}] != 1 {
+		t.Errorf("got %v, want the boxes around the padding visited", counter)
+	}
+}